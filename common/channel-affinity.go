@@ -0,0 +1,62 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	ChannelAffinityToken  = "token"
+	ChannelAffinityUser   = "user"
+	ChannelAffinityHeader = "header"
+	ChannelAffinityPrompt = "prompt"
+)
+
+// ChannelAffinities enables sticky routing, keys are "group:model", a model name or a group name and values
+// tell what identifies a conversation
+var ChannelAffinities = map[string]string{}
+
+var ChannelAffinityTTL = 3600 // seconds a conversation stays on its channel after its last request
+var ChannelAffinityHeaderName = "X-Session-Id"
+
+func IsValidChannelAffinity(affinity string) bool {
+	switch affinity {
+	case ChannelAffinityToken, ChannelAffinityUser, ChannelAffinityHeader, ChannelAffinityPrompt:
+		return true
+	}
+	return false
+}
+
+func ChannelAffinities2JSONString() string {
+	jsonBytes, err := json.Marshal(ChannelAffinities)
+	if err != nil {
+		SysError("error marshalling channel affinities: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateChannelAffinitiesByJSONString(jsonStr string) error {
+	affinities := make(map[string]string)
+	err := json.Unmarshal([]byte(jsonStr), &affinities)
+	if err != nil {
+		return err
+	}
+	for key, affinity := range affinities {
+		if affinity != "" && !IsValidChannelAffinity(affinity) {
+			return errors.New(fmt.Sprintf("invalid channel affinity %s for %s", affinity, key))
+		}
+	}
+	ChannelAffinities = affinities
+	return nil
+}
+
+// GetChannelAffinity returns the most specific affinity configured for the group and model, empty when disabled
+func GetChannelAffinity(group string, model string) string {
+	for _, key := range []string{group + ":" + model, model, group} {
+		if affinity, ok := ChannelAffinities[key]; ok {
+			return affinity
+		}
+	}
+	return ""
+}
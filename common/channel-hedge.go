@@ -0,0 +1,51 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ChannelHedge enables hedged requests for a group: a non-stream completion or embedding whose first channel has
+// not answered after the delay is sent to a second channel as well, and the first response wins
+type ChannelHedge struct {
+	Delay int `json:"delay"` // milliseconds
+	// Percentile, e.g. 0.95, hedges after that percentile of the recent latencies of the first channel instead of
+	// the delay, the delay is used until the channel has enough samples
+	Percentile float64 `json:"percentile,omitempty"`
+	// MaxTokens only hedges requests asking for at most that many tokens, 0 for any request
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// MaxPerMinute caps the hedged requests of the group, 0 for no cap
+	MaxPerMinute int `json:"max_per_minute,omitempty"`
+}
+
+// ChannelHedges holds the groups that hedge requests, keyed by group name
+var ChannelHedges = map[string]ChannelHedge{}
+
+func ChannelHedges2JSONString() string {
+	jsonBytes, err := json.Marshal(ChannelHedges)
+	if err != nil {
+		SysError("error marshalling channel hedges: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateChannelHedgesByJSONString(jsonStr string) error {
+	hedges := make(map[string]ChannelHedge)
+	err := json.Unmarshal([]byte(jsonStr), &hedges)
+	if err != nil {
+		return err
+	}
+	for group, hedge := range hedges {
+		if hedge.Delay <= 0 || hedge.Percentile < 0 || hedge.Percentile >= 1 || hedge.MaxTokens < 0 || hedge.MaxPerMinute < 0 {
+			return errors.New(fmt.Sprintf("invalid channel hedge for %s", group))
+		}
+	}
+	ChannelHedges = hedges
+	return nil
+}
+
+func GetChannelHedge(group string) (ChannelHedge, bool) {
+	hedge, ok := ChannelHedges[group]
+	return hedge, ok
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	ChannelStrategyWeightedRandom = "weighted_random"
+	ChannelStrategyLeastInFlight  = "least_in_flight"
+	ChannelStrategyEWMALatency    = "ewma_latency"
+	ChannelStrategyPowerOfTwo     = "power_of_two"
+)
+
+var ChannelSelectStrategy = ChannelStrategyWeightedRandom
+
+// ChannelSelectStrategies overrides the default strategy, keys are "group:model", a model name or a group name
+var ChannelSelectStrategies = map[string]string{}
+
+func IsValidChannelStrategy(strategy string) bool {
+	switch strategy {
+	case ChannelStrategyWeightedRandom, ChannelStrategyLeastInFlight, ChannelStrategyEWMALatency, ChannelStrategyPowerOfTwo:
+		return true
+	}
+	return false
+}
+
+func ChannelSelectStrategies2JSONString() string {
+	jsonBytes, err := json.Marshal(ChannelSelectStrategies)
+	if err != nil {
+		SysError("error marshalling channel select strategies: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateChannelSelectStrategiesByJSONString(jsonStr string) error {
+	strategies := make(map[string]string)
+	err := json.Unmarshal([]byte(jsonStr), &strategies)
+	if err != nil {
+		return err
+	}
+	for key, strategy := range strategies {
+		if !IsValidChannelStrategy(strategy) {
+			return errors.New(fmt.Sprintf("invalid channel select strategy %s for %s", strategy, key))
+		}
+	}
+	ChannelSelectStrategies = strategies
+	return nil
+}
+
+// GetChannelSelectStrategy returns the most specific strategy configured for the group and model
+func GetChannelSelectStrategy(group string, model string) string {
+	for _, key := range []string{group + ":" + model, model, group} {
+		if strategy, ok := ChannelSelectStrategies[key]; ok {
+			return strategy
+		}
+	}
+	if !IsValidChannelStrategy(ChannelSelectStrategy) {
+		return ChannelStrategyWeightedRandom
+	}
+	return ChannelSelectStrategy
+}
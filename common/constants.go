@@ -18,6 +18,9 @@ var PaymentEnabled = false
 var StripeUnitPrice = 8.0
 var MinTopUp = 5
 
+// SubscriptionGraceDays is how long a subscription whose renewal was not paid keeps its plan after its period ended
+var SubscriptionGraceDays = 3
+
 var StartTime = time.Now().Unix() // unit: second
 var Version = "v0.0.0"            // this hard coding will be replaced automatically when building, no need to manually change
 var SystemName = "New API"
@@ -109,10 +112,36 @@ var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
 var QuotaRemindThreshold = 1000
+
+// StatementEmailEnabled emails every user its statement of the previous month at the start of a month
+var StatementEmailEnabled = false
+
+// NotificationDedupMinutes is how long a notification subscription is not notified of the same occurrence again
+var NotificationDedupMinutes = 60
+
 var PreConsumedQuota = 500
 
+// BatchDiscountRatio is applied to the quota of every request run by a /v1/batches job
+var BatchDiscountRatio = 0.5
+
 var RetryTimes = 0
 
+// channel circuit breaker, a channel (or one model of it) whose circuit is open is skipped when selecting channels
+var CircuitBreakerEnabled = false
+var CircuitBreakerFailureThreshold = 5 // consecutive failures that open the circuit, 0 disables the check
+var CircuitBreakerErrorRate = 0.5      // error rate within the window that opens the circuit, 0 disables the check
+var CircuitBreakerMinRequests = 10     // requests within the window before the error rate is considered
+var CircuitBreakerWindow = 60          // seconds
+var CircuitBreakerCooldown = 30        // seconds an open circuit waits before it lets probe requests through
+var CircuitBreakerHalfOpenRequests = 3 // probe requests let through while half-open, all of them must succeed to close
+
+// requests for channels at their concurrency, RPM or TPM limits wait in a bounded queue of each channel
+var ChannelQueueSize = 100   // requests waiting for the same channel, more fail right away
+var ChannelQueueTimeout = 30 // seconds
+
+// channel tests and sampled relay outcomes are kept this long for the channel health timeline, 0 keeps them forever
+var ChannelHealthRetentionDays = 30
+
 var RootUserEmail = ""
 
 var IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
@@ -206,6 +235,19 @@ const (
 	TopUpStatusExpired = "expired"
 )
 
+const (
+	PlanStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	PlanStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	SubscriptionStatusPending  = "pending" // checkout not completed yet
+	SubscriptionStatusActive   = "active"
+	SubscriptionStatusPastDue  = "past_due" // the renewal payment failed, the plan is kept for the grace period
+	SubscriptionStatusCanceled = "canceled"
+	SubscriptionStatusExpired  = "expired" // lapsed without renewal
+)
+
 const (
 	ChannelTypeUnknown        = 0
 	ChannelTypeOpenAI         = 1
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// ModelFallbacks holds the ordered fallback chain of a model per group, e.g.
+// {"default": {"claude-3-5-sonnet-20241022": ["gpt-4o", "deepseek-chat"]}}
+var ModelFallbacks = map[string]map[string][]string{}
+
+func ModelFallbacks2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelFallbacks)
+	if err != nil {
+		SysError("error marshalling model fallbacks: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelFallbacksByJSONString(jsonStr string) error {
+	ModelFallbacks = make(map[string]map[string][]string)
+	return json.Unmarshal([]byte(jsonStr), &ModelFallbacks)
+}
+
+func GetModelFallbacks(group string, model string) []string {
+	return ModelFallbacks[group][model]
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// model patterns are accepted wherever a model name is configured: a name starting with ^ is a regular
+// expression, a name containing * is a glob where * matches anything
+
+var modelPatterns sync.Map // pattern -> *regexp.Regexp, nil for an invalid pattern
+
+func IsModelPattern(name string) bool {
+	return strings.HasPrefix(name, "^") || strings.Contains(name, "*")
+}
+
+func compileModelPattern(pattern string) *regexp.Regexp {
+	if re, ok := modelPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	expr := pattern
+	if !strings.HasPrefix(pattern, "^") {
+		expr = "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		SysError("invalid model pattern " + pattern + ": " + err.Error())
+		re = nil
+	}
+	modelPatterns.Store(pattern, re)
+	return re
+}
+
+// MatchModelPattern reports whether the model is the name or matches it as a pattern
+func MatchModelPattern(pattern string, model string) bool {
+	if pattern == model {
+		return true
+	}
+	if !IsModelPattern(pattern) {
+		return false
+	}
+	re := compileModelPattern(pattern)
+	return re != nil && re.MatchString(model)
+}
+
+// matchingModelPatterns returns the pattern keys of the map matching the model, the most specific, that is the
+// longest, first
+func matchingModelPatterns[T any](m map[string]T, model string) []string {
+	var patterns []string
+	for key := range m {
+		if IsModelPattern(key) && MatchModelPattern(key, model) {
+			patterns = append(patterns, key)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	return patterns
+}
+
+// LookupModelPattern returns the value of the model in the map, or of the most specific pattern matching it
+func LookupModelPattern[T any](m map[string]T, model string) (T, bool) {
+	if value, ok := m[model]; ok {
+		return value, true
+	}
+	if patterns := matchingModelPatterns(m, model); len(patterns) > 0 {
+		return m[patterns[0]], true
+	}
+	var zero T
+	return zero, false
+}
+
+// MapModelName applies a model mapping, whose keys may be patterns. The target of a regular expression can
+// refer to its groups, e.g. "^gpt-4o-(.*)$": "azure-gpt4o-$1".
+func MapModelName(mapping map[string]string, model string) (string, bool) {
+	if target, ok := mapping[model]; ok && target != "" {
+		return target, true
+	}
+	for _, pattern := range matchingModelPatterns(mapping, model) {
+		target := mapping[pattern]
+		if target == "" {
+			continue
+		}
+		if strings.HasPrefix(pattern, "^") {
+			target = compileModelPattern(pattern).ReplaceAllString(model, target)
+		}
+		return target, true
+	}
+	return "", false
+}
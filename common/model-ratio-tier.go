@@ -0,0 +1,71 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ModelRatioTier prices the requests of a model whose prompt is longer than the threshold at its own ratios
+type ModelRatioTier struct {
+	Threshold  int     `json:"threshold"` // prompt tokens, the tier applies to prompts of more tokens
+	ModelRatio float64 `json:"model_ratio"`
+	// CompletionRatio replaces the completion ratio of the model, 0 keeps it
+	CompletionRatio float64 `json:"completion_ratio,omitempty"`
+}
+
+// ModelRatioTiers holds the tiers of the models priced by prompt length, keyed by model name or pattern, e.g.
+// {"gemini-1.5-pro*": [{"threshold": 128000, "model_ratio": 2.5, "completion_ratio": 4}]}
+var ModelRatioTiers = map[string][]ModelRatioTier{}
+
+func ModelRatioTiers2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelRatioTiers)
+	if err != nil {
+		SysError("error marshalling model ratio tiers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelRatioTiersByJSONString(jsonStr string) error {
+	tiers := make(map[string][]ModelRatioTier)
+	err := json.Unmarshal([]byte(jsonStr), &tiers)
+	if err != nil {
+		return err
+	}
+	for model, modelTiers := range tiers {
+		for _, tier := range modelTiers {
+			if tier.Threshold <= 0 || tier.ModelRatio < 0 || tier.CompletionRatio < 0 {
+				return errors.New(fmt.Sprintf("invalid model ratio tier for %s", model))
+			}
+		}
+		sort.Slice(modelTiers, func(i, j int) bool {
+			return modelTiers[i].Threshold < modelTiers[j].Threshold
+		})
+	}
+	ModelRatioTiers = tiers
+	return nil
+}
+
+// GetModelRatioTier returns the tier with the highest threshold the prompt is longer than, false when the prompt
+// is priced at the flat ratios of the model
+func GetModelRatioTier(name string, promptTokens int) (ModelRatioTier, bool) {
+	tiers, ok := LookupModelPattern(ModelRatioTiers, name)
+	if !ok {
+		return ModelRatioTier{}, false
+	}
+	for i := len(tiers) - 1; i >= 0; i-- {
+		if promptTokens > tiers[i].Threshold {
+			return tiers[i], true
+		}
+	}
+	return ModelRatioTier{}, false
+}
+
+// GetModelRatioByPromptTokens returns the model ratio of the tier the prompt falls in
+func GetModelRatioByPromptTokens(name string, promptTokens int) float64 {
+	if tier, ok := GetModelRatioTier(name, promptTokens); ok {
+		return tier.ModelRatio
+	}
+	return GetModelRatio(name)
+}
@@ -38,6 +38,16 @@ var defaultModelRatio = map[string]float64{
 	"gpt-4o-2024-05-13":                   2.5,  // $0.005 / 1K tokens
 	"gpt-4o-2024-08-06":                   1.25, // $0.01 / 1K tokens
 	"gpt-4o-2024-11-20":                   1.25, // $0.01 / 1K tokens
+	"gpt-4o-realtime-preview":             2.5,  // $0.005 / 1K tokens
+	"gpt-4o-realtime-preview-2024-10-01":  2.5,
+	"gpt-4o-realtime-preview-2024-12-17":  2.5,
+	"gpt-4o-mini-realtime-preview":        0.3,  // $0.0006 / 1K tokens
+	"gpt-4o-mini-realtime-preview-2024-12-17": 0.3,
+	"gpt-4o-audio-preview":                1.25, // $0.0025 / 1K tokens
+	"gpt-4o-audio-preview-2024-10-01":     1.25,
+	"gpt-4o-audio-preview-2024-12-17":     1.25,
+	"gpt-4o-mini-audio-preview":           0.075, // $0.00015 / 1K tokens
+	"gpt-4o-mini-audio-preview-2024-12-17": 0.075,
 	"o1-preview":                          7.5,
 	"o1-preview-2024-09-12":               7.5,
 	"o1-mini":                             0.55, // $0.0011 / 1K tokens
@@ -122,6 +132,9 @@ var defaultModelRatio = map[string]float64{
 	"gemini-1.0-pro-latest":               1,
 	"gemini-1.0-pro-vision-latest":        1,
 	"gemini-ultra":                        1,
+	"text-embedding-004":                  0.01,
+	"text-embedding-005":                  0.01,
+	"text-multilingual-embedding-002":     0.01,
 	"chatglm_turbo":                       0.3572,     // ￥0.005 / 1k tokens
 	"chatglm_pro":                         0.7143,     // ￥0.01 / 1k tokens
 	"chatglm_std":                         0.3572,     // ￥0.005 / 1k tokens
@@ -137,9 +150,13 @@ var defaultModelRatio = map[string]float64{
 	"glm-4-long":                          0.001 * RMB,
 	"glm-4-flash":                         0,
 	"glm-4v-plus":                         0.01 * RMB,
+	"embedding-2":                         0.0005 * RMB,
+	"embedding-3":                         0.0005 * RMB,
 	"qwen-turbo":                          0.8572, // ￥0.012 / 1k tokens
 	"qwen-plus":                           10,     // ￥0.14 / 1k tokens
 	"text-embedding-v1":                   0.05,   // ￥0.0007 / 1k tokens
+	"text-embedding-v2":                   0.05,   // ￥0.0007 / 1k tokens
+	"text-embedding-v3":                   0.0357, // ￥0.0005 / 1k tokens
 	"SparkDesk-v1.1":                      1.2858, // ￥0.018 / 1k tokens
 	"SparkDesk-v2.1":                      1.2858, // ￥0.018 / 1k tokens
 	"SparkDesk-v3.1":                      1.2858, // ￥0.018 / 1k tokens
@@ -177,6 +194,11 @@ var defaultModelRatio = map[string]float64{
 	"command-r-plus-08-2024": 1.25,
 	"deepseek-chat":          0.07,
 	"deepseek-coder":         0.07,
+	// cohere embed v3, $0.1 / 1M tokens
+	"embed-english-v3.0":            0.05,
+	"embed-multilingual-v3.0":       0.05,
+	"embed-english-light-v3.0":      0.05,
+	"embed-multilingual-light-v3.0": 0.05,
 	// Perplexity online 模型对搜索额外收费，有需要应自行调整，此处不计入搜索费用
 	"llama-3-sonar-small-32k-chat":   0.2 / 1000 * USD,
 	"llama-3-sonar-small-32k-online": 0.2 / 1000 * USD,
@@ -261,7 +283,7 @@ func GetModelPrice(name string, printErr bool) (float64, bool) {
 	} else if strings.HasPrefix(name, "g-") {
 		name = "g-*"
 	}
-	price, ok := modelPriceMap[name]
+	price, ok := LookupModelPattern(modelPriceMap, name)
 	if !ok {
 		if printErr {
 			SysError("model price not found: " + name)
@@ -303,7 +325,7 @@ func GetModelRatio(name string) float64 {
 	} else if strings.HasPrefix(name, "g-") {
 		name = "g-*"
 	}
-	ratio, ok := modelRatioMap[name]
+	ratio, ok := LookupModelPattern(modelRatioMap, name)
 	if !ok {
 		SysError("model ratio not found: " + name)
 		return 30
@@ -359,6 +381,9 @@ func GetCompletionRatio(name string) float64 {
 		return 4.0 / 3.0
 	}
 	if strings.HasPrefix(name, "gpt-4") && name != "gpt-4-all" && name != "gpt-4-gizmo-*" {
+		if strings.Contains(name, "realtime") || strings.Contains(name, "audio") {
+			return 4
+		}
 		if strings.HasSuffix(name, "preview") || strings.HasPrefix(name, "gpt-4-turbo") || "gpt-4o-2024-05-13" == name {
 			return 3
 		}
@@ -425,12 +450,198 @@ func GetCompletionRatio(name string) float64 {
 	case "llama3-70b-8192":
 		return 0.79 / 0.59
 	}
-	if ratio, ok := CompletionRatio[name]; ok {
+	if ratio, ok := LookupModelPattern(CompletionRatio, name); ok {
+		return ratio
+	}
+	return 1
+}
+
+// AudioRatio is the price of an audio input token relative to a text input token
+var AudioRatio map[string]float64 = nil
+var defaultAudioRatio = map[string]float64{
+	"gpt-4o-realtime-preview":                 8,  // $0.04 / 1K tokens
+	"gpt-4o-realtime-preview-2024-10-01":      20, // $0.1 / 1K tokens
+	"gpt-4o-realtime-preview-2024-12-17":      8,
+	"gpt-4o-mini-realtime-preview":            16.67, // $0.01 / 1K tokens
+	"gpt-4o-mini-realtime-preview-2024-12-17": 16.67,
+	"gpt-4o-audio-preview":                    16, // $0.04 / 1K tokens
+	"gpt-4o-audio-preview-2024-10-01":         40, // $0.1 / 1K tokens
+	"gpt-4o-audio-preview-2024-12-17":         16,
+	"gpt-4o-mini-audio-preview":               66.67, // $0.01 / 1K tokens
+	"gpt-4o-mini-audio-preview-2024-12-17":    66.67,
+}
+
+// AudioCompletionRatio is the price of an audio output token relative to an audio input token
+var AudioCompletionRatio map[string]float64 = nil
+var defaultAudioCompletionRatio = map[string]float64{
+	"gpt-4o-realtime-preview":                 2,
+	"gpt-4o-realtime-preview-2024-10-01":      2,
+	"gpt-4o-realtime-preview-2024-12-17":      2,
+	"gpt-4o-mini-realtime-preview":            2,
+	"gpt-4o-mini-realtime-preview-2024-12-17": 2,
+	"gpt-4o-audio-preview":                    2,
+	"gpt-4o-audio-preview-2024-10-01":         2,
+	"gpt-4o-audio-preview-2024-12-17":         2,
+	"gpt-4o-mini-audio-preview":               2,
+	"gpt-4o-mini-audio-preview-2024-12-17":    2,
+}
+
+func AudioRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(GetAudioRatioMap())
+	if err != nil {
+		SysError("error marshalling audio ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateAudioRatioByJSONString(jsonStr string) error {
+	AudioRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &AudioRatio)
+}
+
+func GetAudioRatioMap() map[string]float64 {
+	if AudioRatio == nil {
+		AudioRatio = defaultAudioRatio
+	}
+	return AudioRatio
+}
+
+func GetAudioRatio(name string) float64 {
+	if ratio, ok := GetAudioRatioMap()[name]; ok {
 		return ratio
 	}
 	return 1
 }
 
+func AudioCompletionRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(GetAudioCompletionRatioMap())
+	if err != nil {
+		SysError("error marshalling audio completion ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateAudioCompletionRatioByJSONString(jsonStr string) error {
+	AudioCompletionRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &AudioCompletionRatio)
+}
+
+func GetAudioCompletionRatioMap() map[string]float64 {
+	if AudioCompletionRatio == nil {
+		AudioCompletionRatio = defaultAudioCompletionRatio
+	}
+	return AudioCompletionRatio
+}
+
+func GetAudioCompletionRatio(name string) float64 {
+	if ratio, ok := GetAudioCompletionRatioMap()[name]; ok {
+		return ratio
+	}
+	return 1
+}
+
+// CacheRatio is the price of a prompt token read from the prompt cache relative to an uncached prompt token
+var CacheRatio map[string]float64 = nil
+var defaultCacheRatio = map[string]float64{
+	"gpt-4o":                     0.5,
+	"gpt-4o-2024-08-06":          0.5,
+	"gpt-4o-2024-11-20":          0.5,
+	"gpt-4o-mini":                0.5,
+	"gpt-4o-mini-2024-07-18":     0.5,
+	"o1":                         0.5,
+	"o1-2024-12-17":              0.5,
+	"o1-preview":                 0.5,
+	"o1-mini":                    0.5,
+	"o3-mini":                    0.5,
+	"claude-3-haiku-20240307":    0.1,
+	"claude-3-5-haiku-20241022":  0.1,
+	"claude-3-5-sonnet-20240620": 0.1,
+	"claude-3-5-sonnet-20241022": 0.1,
+	"claude-3-opus-20240229":     0.1,
+	"gemini-1.5-pro":             0.25,
+	"gemini-1.5-flash":           0.25,
+	"gemini-2.0-flash":           0.25,
+	"deepseek-chat":              0.1,
+	"deepseek-reasoner":          0.25,
+}
+
+// CreateCacheRatio is the price of a prompt token written to the prompt cache relative to an uncached prompt token
+var CreateCacheRatio map[string]float64 = nil
+var defaultCreateCacheRatio = map[string]float64{
+	"claude-3-haiku-20240307":    1.25,
+	"claude-3-5-haiku-20241022":  1.25,
+	"claude-3-5-sonnet-20240620": 1.25,
+	"claude-3-5-sonnet-20241022": 1.25,
+	"claude-3-opus-20240229":     1.25,
+}
+
+func CacheRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(GetCacheRatioMap())
+	if err != nil {
+		SysError("error marshalling cache ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCacheRatioByJSONString(jsonStr string) error {
+	CacheRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &CacheRatio)
+}
+
+func GetCacheRatioMap() map[string]float64 {
+	if CacheRatio == nil {
+		CacheRatio = defaultCacheRatio
+	}
+	return CacheRatio
+}
+
+// GetCacheRatio falls back to the provider's usual discount for models missing from the map
+func GetCacheRatio(name string) float64 {
+	if ratio, ok := GetCacheRatioMap()[name]; ok {
+		return ratio
+	}
+	if strings.HasPrefix(name, "gpt-4o") || strings.HasPrefix(name, "o1") || strings.HasPrefix(name, "o3") {
+		return 0.5
+	}
+	if strings.HasPrefix(name, "claude-") || strings.HasPrefix(name, "deepseek") {
+		return 0.1
+	}
+	if strings.HasPrefix(name, "gemini-") {
+		return 0.25
+	}
+	return 1
+}
+
+func CreateCacheRatio2JSONString() string {
+	jsonBytes, err := json.Marshal(GetCreateCacheRatioMap())
+	if err != nil {
+		SysError("error marshalling create cache ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateCreateCacheRatioByJSONString(jsonStr string) error {
+	CreateCacheRatio = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &CreateCacheRatio)
+}
+
+func GetCreateCacheRatioMap() map[string]float64 {
+	if CreateCacheRatio == nil {
+		CreateCacheRatio = defaultCreateCacheRatio
+	}
+	return CreateCacheRatio
+}
+
+func GetCreateCacheRatio(name string) float64 {
+	if ratio, ok := GetCreateCacheRatioMap()[name]; ok {
+		return ratio
+	}
+	if strings.HasPrefix(name, "claude-") {
+		return 1.25
+	}
+	return 1
+}
+
 func GetCompletionRatioMap() map[string]float64 {
 	if CompletionRatio == nil {
 		CompletionRatio = defaultCompletionRatio
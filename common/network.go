@@ -0,0 +1,39 @@
+package common
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP reports whether the ip is an internet address, requests made on behalf of users must not reach the
+// loopback, private or link-local addresses around the server
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// ValidatePublicURL checks that the url is an http or https url whose host only resolves to public addresses
+func ValidatePublicURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("invalid url")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("the host is not a public address")
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return errors.New("failed to resolve the host")
+	}
+	for _, ip := range ips {
+		if !IsPublicIP(ip) {
+			return errors.New("the host is not a public address")
+		}
+	}
+	return nil
+}
@@ -19,6 +19,12 @@ var GetMediaTokenNotStream = common.GetEnvOrDefaultBool("GET_MEDIA_TOKEN_NOT_STR
 
 var UpdateTask = common.GetEnvOrDefaultBool("UPDATE_TASK", true)
 
+// FileStorePath 上传文件（/v1/files）的本地存储目录
+var FileStorePath = common.GetEnvOrDefaultString("FILE_STORE_PATH", "files")
+
+// FileMaxSize 上传文件大小上限，单位 MB
+var FileMaxSize = common.GetEnvOrDefault("FILE_MAX_SIZE", 512)
+
 var GeminiModelMap = map[string]string{
 	"gemini-1.5-pro-latest":     "v1beta",
 	"gemini-1.5-pro-001":        "v1beta",
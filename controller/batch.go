@@ -0,0 +1,543 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusCompleted  = "completed"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// batchMaxLineSize limits a single request line of a batch input file
+const batchMaxLineSize = 16 << 20
+
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+func newBatchScanner(reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), batchMaxLineSize)
+	return scanner
+}
+
+// validateBatchInput checks every line of the input file and returns the number of requests
+func validateBatchInput(fileId string, endpoint string) (int, error) {
+	reader, err := service.GetFileStore().Open(fileId)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	customIds := make(map[string]bool)
+	total := 0
+	scanner := newBatchScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var input dto.BatchRequestInput
+		if err := json.Unmarshal(text, &input); err != nil {
+			return 0, fmt.Errorf("line %d: invalid json: %s", line, err.Error())
+		}
+		if input.CustomId == "" {
+			return 0, fmt.Errorf("line %d: custom_id is required", line)
+		}
+		if customIds[input.CustomId] {
+			return 0, fmt.Errorf("line %d: duplicate custom_id %s", line, input.CustomId)
+		}
+		customIds[input.CustomId] = true
+		if input.Method != http.MethodPost {
+			return 0, fmt.Errorf("line %d: method must be POST", line)
+		}
+		if input.Url != endpoint {
+			return 0, fmt.Errorf("line %d: url %s does not match the batch endpoint %s", line, input.Url, endpoint)
+		}
+		total++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, errors.New("input file contains no requests")
+	}
+	return total, nil
+}
+
+func CreateBatch(c *gin.Context) {
+	var request dto.OpenAIBatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if !batchEndpoints[request.Endpoint] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("unsupported endpoint: %s", request.Endpoint))
+		return
+	}
+	if request.CompletionWindow != "24h" {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "completion_window must be 24h")
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFile(userId, request.InputFileId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("No such File object: %s", request.InputFileId))
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "input file must be uploaded with purpose batch")
+		return
+	}
+	total, err := validateBatchInput(inputFile.FileId, request.Endpoint)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "invalid input file, "+err.Error())
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &dto.OpenAIBatch{
+		Id:               "batch_" + common.GetUUID(),
+		Object:           "batch",
+		Endpoint:         request.Endpoint,
+		InputFileId:      request.InputFileId,
+		CompletionWindow: request.CompletionWindow,
+		Status:           BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+		RequestCounts:    dto.OpenAIBatchRequestCounts{Total: total},
+		Metadata:         request.Metadata,
+	}
+	task := &model.Task{
+		TaskID:     batch.Id,
+		Platform:   constant.TaskPlatformBatch,
+		UserId:     userId,
+		Action:     request.Endpoint,
+		Status:     model.TaskStatusQueued,
+		SubmitTime: now,
+		Progress:   "0%",
+		Properties: model.Properties{
+			Input:    request.InputFileId,
+			TokenId:  c.GetInt("token_id"),
+			ClientIp: c.ClientIP(),
+		},
+	}
+	task.SetData(batch)
+	if err = task.Insert(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+func getUserBatch(c *gin.Context) (*model.Task, *dto.OpenAIBatch) {
+	batchId := c.Param("id")
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), batchId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return nil, nil
+	}
+	if !exist || task.Platform != constant.TaskPlatformBatch {
+		openAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such Batch object: %s", batchId))
+		return nil, nil
+	}
+	batch := &dto.OpenAIBatch{}
+	if err = task.GetData(batch); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return nil, nil
+	}
+	return task, batch
+}
+
+func RetrieveBatch(c *gin.Context) {
+	_, batch := getUserBatch(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+func ListBatches(c *gin.Context) {
+	userId := c.GetInt("id")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var beforeId int64
+	if after := c.Query("after"); after != "" {
+		task, exist, err := model.GetByTaskId(userId, after)
+		if err != nil || !exist {
+			openAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such Batch object: %s", after))
+			return
+		}
+		beforeId = task.ID
+	}
+	tasks := model.GetUserTasksByPlatform(userId, constant.TaskPlatformBatch, beforeId, limit+1)
+	list := dto.OpenAIBatchList{
+		Object: "list",
+		Data:   make([]*dto.OpenAIBatch, 0, len(tasks)),
+	}
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+		list.HasMore = true
+	}
+	for _, task := range tasks {
+		batch := &dto.OpenAIBatch{}
+		if err := task.GetData(batch); err != nil {
+			continue
+		}
+		list.Data = append(list.Data, batch)
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = list.Data[0].Id
+		list.LastId = list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func CancelBatch(c *gin.Context) {
+	task, batch := getUserBatch(c)
+	if batch == nil {
+		return
+	}
+	now := common.GetTimestamp()
+	var status model.TaskStatus
+	var params map[string]any
+	switch task.Status {
+	case model.TaskStatusQueued:
+		// not picked up yet, cancel right away
+		batch.Status = BatchStatusCancelled
+		batch.CancellingAt = now
+		batch.CancelledAt = now
+		status = model.TaskStatusQueued
+		params = map[string]any{
+			"status":      model.TaskStatusFailure,
+			"fail_reason": "cancelled",
+			"progress":    "100%",
+			"finish_time": now,
+		}
+	case model.TaskStatusInProgress:
+		// the executor notices the status change after the current line and finishes the batch
+		batch.Status = BatchStatusCancelling
+		batch.CancellingAt = now
+		status = model.TaskStatusInProgress
+		params = map[string]any{
+			"status": model.TaskStatusCancelling,
+		}
+	default:
+		openAIErrorResponse(c, http.StatusConflict, "invalid_request_error", fmt.Sprintf("Cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+	data, _ := json.Marshal(batch)
+	params["data"] = data
+	updated, err := model.TaskUpdateIfStatus(task.ID, status, params)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	if !updated {
+		openAIErrorResponse(c, http.StatusConflict, "invalid_request_error", "batch status changed, please retry")
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// UpdateBatchTaskBulk runs the queued batch jobs, every request line is served by handler
+// exactly like a client request, so channel selection, retries and billing all apply
+func UpdateBatchTaskBulk(handler http.Handler) {
+	failInterruptedBatches()
+	for {
+		time.Sleep(time.Duration(10) * time.Second)
+		tasks := model.GetTasksByPlatformAndStatus(constant.TaskPlatformBatch, model.TaskStatusQueued, 100)
+		for _, task := range tasks {
+			now := common.GetTimestamp()
+			started, err := model.TaskUpdateIfStatus(task.ID, model.TaskStatusQueued, map[string]any{
+				"status":     model.TaskStatusInProgress,
+				"start_time": now,
+			})
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to start batch %s: %s", task.TaskID, err.Error()))
+				continue
+			}
+			if !started {
+				// cancelled in the meantime
+				continue
+			}
+			task.Status = model.TaskStatusInProgress
+			task.StartTime = now
+			batchTask := task
+			gopool.Go(func() {
+				runBatch(handler, batchTask)
+			})
+		}
+	}
+}
+
+// failInterruptedBatches fails the batches cut off by a restart, their finished lines are already
+// billed, so running them again is not an option
+func failInterruptedBatches() {
+	for _, status := range []model.TaskStatus{model.TaskStatusInProgress, model.TaskStatusCancelling} {
+		tasks := model.GetTasksByPlatformAndStatus(constant.TaskPlatformBatch, status, 1000)
+		for _, task := range tasks {
+			batch := &dto.OpenAIBatch{}
+			_ = task.GetData(batch)
+			failBatch(task, batch, "interrupted", "batch was interrupted by a server restart")
+		}
+	}
+}
+
+func failBatch(task *model.Task, batch *dto.OpenAIBatch, code string, message string) {
+	now := common.GetTimestamp()
+	batch.Status = BatchStatusFailed
+	batch.FailedAt = now
+	batch.Errors = &dto.OpenAIBatchErrors{
+		Object: "list",
+		Data:   []*dto.OpenAIBatchError{{Code: code, Message: message}},
+	}
+	task.Status = model.TaskStatusFailure
+	task.FailReason = message
+	task.Progress = "100%"
+	task.FinishTime = now
+	task.SetData(batch)
+	if err := task.Update(); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", task.TaskID, err.Error()))
+	}
+	go model.NotifyTaskFailed(task.UserId, "batch", task.TaskID, message)
+}
+
+func runBatch(handler http.Handler, task *model.Task) {
+	ctx := context.Background()
+	batch := &dto.OpenAIBatch{}
+	if err := task.GetData(batch); err != nil {
+		failBatch(task, batch, "invalid_batch", err.Error())
+		return
+	}
+	batch.Status = BatchStatusInProgress
+	batch.InProgressAt = task.StartTime
+	common.LogInfo(ctx, fmt.Sprintf("batch %s started, %d requests", batch.Id, batch.RequestCounts.Total))
+
+	token, err := model.GetTokenById(task.Properties.TokenId)
+	if err != nil {
+		failBatch(task, batch, "token_not_found", "the token used to create the batch no longer exists")
+		return
+	}
+	reader, err := service.GetFileStore().Open(task.Properties.Input)
+	if err != nil {
+		failBatch(task, batch, "input_file_not_found", "failed to read the input file")
+		return
+	}
+	defer reader.Close()
+
+	output := newBatchOutputFile(task, batch, "output")
+	errorOutput := newBatchOutputFile(task, batch, "error")
+	cancelled := !saveBatchProgress(task, batch)
+	scanner := newBatchScanner(reader)
+	for !cancelled && scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		result := runBatchRequest(handler, task, token, line)
+		if result.Error == nil && result.Response.StatusCode == http.StatusOK {
+			batch.RequestCounts.Completed++
+			output.write(result)
+		} else {
+			batch.RequestCounts.Failed++
+			errorOutput.write(result)
+		}
+		cancelled = !saveBatchProgress(task, batch)
+	}
+	if err = scanner.Err(); err != nil {
+		common.LogError(ctx, fmt.Sprintf("failed to read the input of batch %s: %s", batch.Id, err.Error()))
+	}
+
+	now := common.GetTimestamp()
+	batch.FinalizingAt = now
+	batch.OutputFileId = output.save()
+	batch.ErrorFileId = errorOutput.save()
+	if cancelled {
+		// keep the cancelling time set by the request
+		latest, exist, err := model.GetByOnlyTaskId(task.TaskID)
+		if err == nil && exist {
+			latestBatch := &dto.OpenAIBatch{}
+			if latest.GetData(latestBatch) == nil {
+				batch.CancellingAt = latestBatch.CancellingAt
+			}
+		}
+		batch.Status = BatchStatusCancelled
+		batch.CancelledAt = now
+		task.Status = model.TaskStatusFailure
+		task.FailReason = "cancelled"
+	} else {
+		batch.Status = BatchStatusCompleted
+		batch.CompletedAt = now
+		task.Status = model.TaskStatusSuccess
+	}
+	task.Progress = "100%"
+	task.FinishTime = now
+	task.SetData(batch)
+	if err = task.Update(); err != nil {
+		common.LogError(ctx, fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+	common.LogInfo(ctx, fmt.Sprintf("batch %s %s, %d completed, %d failed", batch.Id, batch.Status,
+		batch.RequestCounts.Completed, batch.RequestCounts.Failed))
+}
+
+// saveBatchProgress stores the request counts of a running batch, it returns false once the batch has been cancelled
+func saveBatchProgress(task *model.Task, batch *dto.OpenAIBatch) bool {
+	done := batch.RequestCounts.Completed + batch.RequestCounts.Failed
+	progress := done * 100 / batch.RequestCounts.Total
+	if progress > 99 {
+		// 100% marks a finished task
+		progress = 99
+	}
+	task.Progress = fmt.Sprintf("%d%%", progress)
+	data, _ := json.Marshal(batch)
+	updated, err := model.TaskUpdateIfStatus(task.ID, model.TaskStatusInProgress, map[string]any{
+		"progress": task.Progress,
+		"data":     data,
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+		return true
+	}
+	return updated
+}
+
+// runBatchRequest serves one line of the input file through the relay handler
+func runBatchRequest(handler http.Handler, task *model.Task, token *model.Token, line []byte) *dto.BatchRequestOutput {
+	result := &dto.BatchRequestOutput{
+		Id: "batch_req_" + common.GetUUID(),
+	}
+	var input dto.BatchRequestInput
+	if err := json.Unmarshal(line, &input); err != nil {
+		result.Error = &dto.OpenAIBatchError{Code: "invalid_json_line", Message: err.Error()}
+		return result
+	}
+	result.CustomId = input.CustomId
+	var body map[string]any
+	if err := json.Unmarshal(input.Body, &body); err != nil {
+		result.Error = &dto.OpenAIBatchError{Code: "invalid_request", Message: "body must be a json object"}
+		return result
+	}
+	// batch results are written to a file, streaming makes no sense
+	delete(body, "stream")
+	delete(body, "stream_options")
+	requestBody, _ := json.Marshal(body)
+
+	ctx := relaycommon.WithBatchId(context.Background(), task.TaskID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, input.Url, bytes.NewReader(requestBody))
+	if err != nil {
+		result.Error = &dto.OpenAIBatchError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	req.Header.Set("Content-Type", "application/json")
+	// the token ip limits apply to the address the batch was submitted from
+	req.RemoteAddr = net.JoinHostPort(task.Properties.ClientIp, "0")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	responseBody := recorder.Body.Bytes()
+	if !json.Valid(responseBody) {
+		responseBody, _ = json.Marshal(string(responseBody))
+	}
+	result.Response = &dto.BatchResponse{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       responseBody,
+	}
+	return result
+}
+
+// batchOutputFile streams the output or error lines of a batch to the file store as they come, so that a large
+// batch is never held in memory. The file is only created with its first line.
+type batchOutputFile struct {
+	task   *model.Task
+	batch  *dto.OpenAIBatch
+	kind   string
+	fileId string
+	writer *io.PipeWriter
+	done   chan struct{}
+	size   int64
+	err    error
+}
+
+func newBatchOutputFile(task *model.Task, batch *dto.OpenAIBatch, kind string) *batchOutputFile {
+	return &batchOutputFile{task: task, batch: batch, kind: kind}
+}
+
+func (f *batchOutputFile) write(result *dto.BatchRequestOutput) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		common.SysError("failed to marshal batch output: " + err.Error())
+		return
+	}
+	if f.writer == nil {
+		f.fileId = "file-" + common.GetUUID()
+		reader, writer := io.Pipe()
+		f.writer = writer
+		f.done = make(chan struct{})
+		go func() {
+			f.size, f.err = service.GetFileStore().Save(f.fileId, reader)
+			// a store that gave up early must not block the batch
+			_ = reader.Close()
+			close(f.done)
+		}()
+	}
+	_, _ = f.writer.Write(append(data, '\n'))
+}
+
+// save finishes the file and returns its id, empty when there is nothing to store
+func (f *batchOutputFile) save() string {
+	if f.writer == nil {
+		return ""
+	}
+	_ = f.writer.Close()
+	<-f.done
+	if f.err != nil {
+		common.SysError(fmt.Sprintf("failed to save %s file of batch %s: %s", f.kind, f.batch.Id, f.err.Error()))
+		return ""
+	}
+	file := &model.File{
+		FileId:    f.fileId,
+		UserId:    f.task.UserId,
+		Filename:  fmt.Sprintf("%s_%s.jsonl", f.batch.Id, f.kind),
+		Purpose:   "batch_output",
+		Bytes:     f.size,
+		CreatedAt: common.GetTimestamp(),
+	}
+	if err := file.Insert(); err != nil {
+		_ = service.GetFileStore().Delete(file.FileId)
+		common.SysError(fmt.Sprintf("failed to save %s file of batch %s: %s", f.kind, f.batch.Id, err.Error()))
+		return ""
+	}
+	return file.FileId
+}
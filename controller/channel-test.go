@@ -48,10 +48,13 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 		if channel.TestModel != nil && *channel.TestModel != "" {
 			testModel = *channel.TestModel
 		} else {
-			if len(channel.GetModels()) > 0 {
-				testModel = channel.GetModels()[0]
-			} else {
-				testModel = "gpt-3.5-turbo"
+			// a model pattern cannot be requested, the first concrete model is tested
+			testModel = "gpt-3.5-turbo"
+			for _, channelModel := range channel.GetModels() {
+				if !common.IsModelPattern(channelModel) {
+					testModel = channelModel
+					break
+				}
 			}
 		}
 	} else {
@@ -62,8 +65,8 @@ func testChannel(channel *model.Channel, testModel string) (err error, openAIErr
 			if err != nil {
 				return err, service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
 			}
-			if modelMap[testModel] != "" {
-				testModel = modelMap[testModel]
+			if mappedModel, ok := common.MapModelName(modelMap, testModel); ok {
+				testModel = mappedModel
 			}
 		}
 	}
@@ -186,6 +189,7 @@ func TestChannel(c *gin.Context) {
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
 	go channel.UpdateResponseTime(milliseconds)
+	go model.RecordChannelTest(channel.Id, model.ChannelHealthSourceManualTest, milliseconds, err)
 	consumedTime := float64(milliseconds) / 1000.0
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -206,7 +210,7 @@ func TestChannel(c *gin.Context) {
 var testAllChannelsLock sync.Mutex
 var testAllChannelsRunning bool = false
 
-func testAllChannels(notify bool) error {
+func testAllChannels(notify bool, source string) error {
 	if common.RootUserEmail == "" {
 		common.RootUserEmail = model.GetRootUserEmail()
 	}
@@ -258,6 +262,7 @@ func testAllChannels(notify bool) error {
 			}
 
 			channel.UpdateResponseTime(milliseconds)
+			model.RecordChannelTest(channel.Id, source, milliseconds, err)
 			time.Sleep(common.RequestInterval)
 		}
 		testAllChannelsLock.Lock()
@@ -274,7 +279,7 @@ func testAllChannels(notify bool) error {
 }
 
 func TestAllChannels(c *gin.Context) {
-	err := testAllChannels(true)
+	err := testAllChannels(true, model.ChannelHealthSourceManualTest)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -293,7 +298,7 @@ func AutomaticallyTestChannels(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Minute)
 		common.SysLog("testing all channels")
-		_ = testAllChannels(false)
+		_ = testAllChannels(false, model.ChannelHealthSourceAutoTest)
 		common.SysLog("channel test finished")
 	}
 }
@@ -2,14 +2,17 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
 	"one-api/relay/channel/openai"
+	relaycommon "one-api/relay/common"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type OpenAIModel struct {
@@ -187,6 +190,39 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// validateChannelKeyMode rejects unknown key modes, task channels can not rotate keys since their tasks are
+// fetched later with the key that created them
+func validateChannelKeyMode(channel *model.Channel) error {
+	if channel.KeyMode == "" {
+		return nil
+	}
+	if !channel.IsMultiKey() {
+		return fmt.Errorf("无效的密钥模式：%s", channel.KeyMode)
+	}
+	switch channel.Type {
+	case common.ChannelTypeMidjourney, common.ChannelTypeMidjourneyPlus, common.ChannelTypeSunoAPI:
+		return errors.New("该渠道类型不支持多密钥模式")
+	}
+	return nil
+}
+
+// validateChannelParamOverride rejects invalid rules, and rules on channel types whose requests are not sent as a
+// JSON body the rules could change
+func validateChannelParamOverride(channel *model.Channel) error {
+	rules, err := relaycommon.ParseParamOverride(channel.GetParamOverride())
+	if err != nil {
+		return errors.New("参数覆盖规则无效：" + err.Error())
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	switch channel.Type {
+	case common.ChannelTypeMidjourney, common.ChannelTypeMidjourneyPlus, common.ChannelTypeSunoAPI, common.ChannelTypeXunfei:
+		return errors.New("该渠道类型不支持参数覆盖")
+	}
+	return nil
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -197,6 +233,20 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if err = validateChannelKeyMode(&channel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = validateChannelParamOverride(&channel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	channel.CreatedTime = common.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
 	if channel.Type == common.ChannelTypeVertexAi {
@@ -221,6 +271,11 @@ func AddChannel(c *gin.Context) {
 		}
 		keys = []string{channel.Key}
 	}
+	channel.KeyStatus = ""
+	if channel.IsMultiKey() {
+		// a multi-key channel keeps all keys instead of being split into one channel per key
+		keys = []string{channel.Key}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -357,6 +412,22 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if err = validateChannelKeyMode(&channel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err = validateChannelParamOverride(&channel); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// key statuses are only changed through the channel key api
+	channel.KeyStatus = ""
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -397,3 +468,154 @@ func handleOpenAIChannelRefreshToken(channel model.Channel) (model.Channel, erro
 		return channel, nil
 	}
 }
+
+// GetChannelBreakers lists circuit breaker states, of every channel or of the channel given by ?id=
+func GetChannelBreakers(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("id"))
+	breakers, err := model.GetChannelBreakers(channelId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    breakers,
+	})
+}
+
+func ResetChannelBreaker(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.ResetChannelBreaker(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetChannelsStats(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("id"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelsStats(channelId),
+	})
+}
+
+// channelHealthWindows maps the selectable windows of the channel health to the bucket of their timeline
+var channelHealthWindows = map[string][2]time.Duration{
+	"1h":  {time.Hour, 5 * time.Minute},
+	"24h": {24 * time.Hour, time.Hour},
+	"7d":  {7 * 24 * time.Hour, 6 * time.Hour},
+	"30d": {30 * 24 * time.Hour, 24 * time.Hour},
+}
+
+func GetChannelHealth(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	window, ok := channelHealthWindows[c.DefaultQuery("window", "24h")]
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的时间窗口，可选 1h、24h、7d、30d",
+		})
+		return
+	}
+	report, err := model.GetChannelHealth(id, window[0], window[1])
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    report,
+	})
+}
+
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	keys, err := model.GetChannelKeys(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+type channelKeyStatusRequest struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+}
+
+func UpdateChannelKeyStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	req := channelKeyStatusRequest{}
+	err = c.ShouldBindJSON(&req)
+	if err != nil || (req.Status != common.ChannelStatusEnabled && req.Status != common.ChannelStatusManuallyDisabled) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	_, err = model.UpdateChannelKeyStatus(id, req.Fingerprint, req.Status, "")
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func openAIErrorResponse(c *gin.Context, statusCode int, errType string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: message,
+			Type:    errType,
+			Param:   "",
+			Code:    "",
+		},
+	})
+}
+
+func UploadFile(c *gin.Context) {
+	purpose := c.PostForm("purpose")
+	if purpose == "" {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "purpose is required")
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", "file is required")
+		return
+	}
+	if fileHeader.Size > int64(constant.FileMaxSize)<<20 {
+		openAIErrorResponse(c, http.StatusRequestEntityTooLarge, "invalid_request_error", fmt.Sprintf("file exceeds the maximum size of %d MB", constant.FileMaxSize))
+		return
+	}
+	reader, err := fileHeader.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	defer reader.Close()
+
+	file := &model.File{
+		FileId:    "file-" + common.GetUUID(),
+		UserId:    c.GetInt("id"),
+		Filename:  fileHeader.Filename,
+		Purpose:   purpose,
+		CreatedAt: common.GetTimestamp(),
+	}
+	file.Bytes, err = service.GetFileStore().Save(file.FileId, reader)
+	if err != nil {
+		common.SysError("failed to save file: " + err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", "failed to save file")
+		return
+	}
+	if err = file.Insert(); err != nil {
+		_ = service.GetFileStore().Delete(file.FileId)
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func ListFiles(c *gin.Context) {
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"))
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	data := make([]*dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, file.ToOpenAIFile())
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileList{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+func getUserFile(c *gin.Context) *model.File {
+	fileId := c.Param("id")
+	file, err := model.GetUserFile(c.GetInt("id"), fileId)
+	if err != nil {
+		openAIErrorResponse(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such File object: %s", fileId))
+		return nil
+	}
+	return file
+}
+
+func RetrieveFile(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.GetFileStore().Open(file.FileId)
+	if err != nil {
+		common.SysError("failed to open file: " + err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", "failed to read file content")
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", reader, nil)
+}
+
+func DeleteFile(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	if err := file.Delete(); err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "new_api_error", err.Error())
+		return
+	}
+	if err := service.GetFileStore().Delete(file.FileId); err != nil {
+		common.SysError("failed to delete file content: " + err.Error())
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.FileId,
+		"object":  "file",
+		"deleted": true,
+	})
+}
@@ -150,6 +150,7 @@ func UpdateMidjourneyTaskBulk() {
 				if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
 					common.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
 					task.Progress = "100%"
+					go model.NotifyTaskFailed(task.UserId, constant.TaskPlatformMidjourney, task.MjId, task.FailReason)
 					if task.Quota != 0 {
 						shouldReturnQuota = true
 					}
@@ -159,7 +160,11 @@ func UpdateMidjourneyTaskBulk() {
 					common.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 				} else {
 					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota)
+						err = model.IncreaseUserQuota(task.UserId, task.Quota, model.QuotaChange{
+							Type:        model.QuotaChangeRefund,
+							Reason:      "构图失败补偿",
+							ReferenceId: task.MjId,
+						})
 						if err != nil {
 							common.LogError(ctx, "fail to increase user quota: "+err.Error())
 						}
@@ -15,6 +15,7 @@ import (
 	"one-api/relay/channel/moonshot"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
+	"sort"
 )
 
 // https://platform.openai.com/docs/api-reference/models/list
@@ -179,7 +180,7 @@ func ListModels(c *gin.Context) {
 		if tokenGroup != "" {
 			group = tokenGroup
 		}
-		models := model.GetGroupModels(group)
+		models := expandModelPatterns(model.GetGroupModels(group))
 		for _, s := range models {
 			if _, ok := openAIModelsMap[s]; ok {
 				userOpenAiModels = append(userOpenAiModels, openAIModelsMap[s])
@@ -202,6 +203,53 @@ func ListModels(c *gin.Context) {
 	})
 }
 
+// expandModelPatterns replaces the model patterns in the list with the known models matching them, known models
+// are those of the adaptors, of the other entries and of the prices
+func expandModelPatterns(models []string) []string {
+	var patterns []string
+	known := make(map[string]bool)
+	for _, name := range models {
+		if common.IsModelPattern(name) {
+			patterns = append(patterns, name)
+		} else {
+			known[name] = true
+		}
+	}
+	if len(patterns) == 0 {
+		return models
+	}
+	result := make([]string, 0, len(models))
+	for _, name := range models {
+		if !common.IsModelPattern(name) {
+			result = append(result, name)
+		}
+	}
+	candidates := make(map[string]bool)
+	for name := range openAIModelsMap {
+		candidates[name] = true
+	}
+	for name := range common.GetModelRatioMap() {
+		candidates[name] = true
+	}
+	for name := range common.GetModelPriceMap() {
+		candidates[name] = true
+	}
+	var expanded []string
+	for name := range candidates {
+		if known[name] || common.IsModelPattern(name) {
+			continue
+		}
+		for _, pattern := range patterns {
+			if common.MatchModelPattern(pattern, name) {
+				expanded = append(expanded, name)
+				break
+			}
+		}
+	}
+	sort.Strings(expanded)
+	return append(result, expanded...)
+}
+
 func ChannelListModels(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"success": true,
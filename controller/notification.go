@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+)
+
+func GetAllNotifications(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	notifications, err := model.GetNotifications(userId, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    notifications,
+	})
+}
+
+func GetSelfNotifications(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	notifications, err := model.GetNotifications(c.GetInt("id"), p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    notifications,
+	})
+}
+
+func GetNotificationSubscriptions(c *gin.Context) {
+	subscriptions, err := model.GetUserNotificationSubscriptions(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscriptions,
+	})
+}
+
+func AddNotificationSubscription(c *gin.Context) {
+	subscription := model.NotificationSubscription{}
+	err := c.ShouldBindJSON(&subscription)
+	if err == nil {
+		subscription.Id = 0
+		subscription.UserId = c.GetInt("id")
+		err = subscription.Validate(c.GetInt("role") >= common.RoleAdminUser)
+	}
+	if err == nil {
+		err = subscription.Insert()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscription,
+	})
+}
+
+func UpdateNotificationSubscription(c *gin.Context) {
+	input := model.NotificationSubscription{}
+	err := c.ShouldBindJSON(&input)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	subscription, err := model.GetNotificationSubscriptionById(input.Id, c.GetInt("id"))
+	if err == nil {
+		subscription.Event = input.Event
+		subscription.Channel = input.Channel
+		subscription.Target = input.Target
+		subscription.Threshold = input.Threshold
+		subscription.Enabled = input.Enabled
+		// an empty secret keeps the current one
+		if input.Secret != "" {
+			subscription.Secret = input.Secret
+		}
+		err = subscription.Validate(c.GetInt("role") >= common.RoleAdminUser)
+	}
+	if err == nil {
+		err = subscription.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscription,
+	})
+}
+
+func DeleteNotificationSubscription(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	subscription, err := model.GetNotificationSubscriptionById(id, c.GetInt("id"))
+	if err == nil {
+		err = subscription.Delete()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// TestNotificationSubscription delivers a test notification right away and reports the outcome
+func TestNotificationSubscription(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	subscription, err := model.GetNotificationSubscriptionById(id, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	notification, err := model.CreateNotification(subscription, model.NotificationMessage{
+		Event:    subscription.Event,
+		DedupKey: fmt.Sprintf("test:%d", common.GetTimestamp()),
+		Title:    "测试通知",
+		Content:  fmt.Sprintf("这是一条来自 %s 的测试通知，收到即表示通知配置正确。", common.SystemName),
+		Data: map[string]interface{}{
+			"test": true,
+		},
+	})
+	if err == nil && notification == nil {
+		err = fmt.Errorf("请勿频繁发送测试通知")
+	}
+	if err == nil && notification.Status == model.NotificationStatusPending {
+		// a failed test is reported right away instead of being retried
+		if deliveryErr := service.DeliverNotification(notification); deliveryErr != nil {
+			notification.Failed(deliveryErr)
+		} else {
+			notification.Delivered(nil)
+		}
+	}
+	if err == nil && notification.Status != model.NotificationStatusSent {
+		err = fmt.Errorf("发送失败：%s", notification.LastError)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
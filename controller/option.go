@@ -82,6 +82,14 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ChannelSelectStrategy":
+		if !common.IsValidChannelStrategy(option.Value) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的渠道选择策略：" + option.Value,
+			})
+			return
+		}
 	}
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
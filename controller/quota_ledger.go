@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+)
+
+// ledgerUserId returns the user whose ledger is requested, admins only see the ledgers of the users below them
+func ledgerUserId(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, err
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		return 0, err
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		return 0, errors.New("无权获取同级或更高等级用户的信息")
+	}
+	return id, nil
+}
+
+func GetUserQuotaLedger(c *gin.Context) {
+	id, err := ledgerUserId(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	entries, err := model.GetQuotaLedgerEntries(id, p*common.ItemsPerPage, common.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    entries,
+	})
+}
+
+func CheckUserQuotaLedger(c *gin.Context) {
+	id, err := ledgerUserId(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	check, err := model.CheckQuotaLedger(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    check,
+	})
+}
+
+// CheckAllQuotaLedgers lists the users whose balances disagree with their ledger
+func CheckAllQuotaLedgers(c *gin.Context) {
+	checks, err := model.CheckAllQuotaLedgers()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    checks,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 	"io"
 	"log"
 	"net/http"
@@ -17,12 +18,13 @@ import (
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
 	"strings"
+	"time"
 )
 
 func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	var err *dto.OpenAIErrorWithStatusCode
 	switch relayMode {
-	case relayconstant.RelayModeImagesGenerations:
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
 		err = relay.ImageHelper(c, relayMode)
 	case relayconstant.RelayModeAudioSpeech:
 		fallthrough
@@ -32,6 +34,14 @@ func relayHandler(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 		err = relay.AudioHelper(c)
 	case relayconstant.RelayModeRerank:
 		err = relay.RerankHelper(c, relayMode)
+	case relayconstant.RelayModeClaudeMessages:
+		err = relay.ClaudeHelper(c)
+	case relayconstant.RelayModeGemini:
+		err = relay.GeminiHelper(c)
+	case relayconstant.RelayModeResponses:
+		err = relay.ResponsesHelper(c)
+	case relayconstant.RelayModeRealtime:
+		err = relay.RealtimeHelper(c)
 	default:
 		err = relay.TextHelper(c)
 	}
@@ -95,43 +105,174 @@ func Relay(c *gin.Context) {
 	requestId := c.GetString(common.RequestIdKey)
 	group := c.GetString("group")
 	originalModel := c.GetString("original_model")
-	var openaiErr *dto.OpenAIErrorWithStatusCode
+	openaiErr, exhausted := relayModel(c, relayMode, group, originalModel)
+	if exhausted {
+		for _, fallback := range service.GetModelFallbacks(c, group, originalModel) {
+			channel, err := model.CacheGetRandomSatisfiedChannel(group, fallback, 0)
+			if err != nil {
+				continue
+			}
+			if err = service.UseFallbackModel(c, originalModel, fallback); err != nil {
+				common.LogError(c, fmt.Sprintf("failed to fall back to model %s: %s", fallback, err.Error()))
+				break
+			}
+			common.LogInfo(c, fmt.Sprintf("模型 %s 的渠道已用尽，回退到模型 %s", originalModel, fallback))
+			middleware.SetupContextForSelectedChannel(c, channel, fallback)
+			originalModel = fallback
+			openaiErr, exhausted = relayModel(c, relayMode, group, fallback)
+			if !exhausted {
+				break
+			}
+		}
+	}
+	if openaiErr == nil {
+		return
+	}
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		common.LogInfo(c, retryLogStr)
+	}
+
+	if openaiErr != nil {
+		if openaiErr.StatusCode == http.StatusTooManyRequests {
+			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
+		}
+		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+		if relayMode == relayconstant.RelayModeClaudeMessages {
+			// anthropic sdk error format
+			c.JSON(openaiErr.StatusCode, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"type":    openaiErr.Error.Type,
+					"message": openaiErr.Error.Message,
+				},
+			})
+			return
+		}
+		if relayMode == relayconstant.RelayModeGemini {
+			// google api error format
+			c.JSON(openaiErr.StatusCode, gin.H{
+				"error": gin.H{
+					"code":    openaiErr.StatusCode,
+					"message": openaiErr.Error.Message,
+					"status":  openaiErr.Error.Type,
+				},
+			})
+			return
+		}
+		c.JSON(openaiErr.StatusCode, gin.H{
+			"error": openaiErr.Error,
+		})
+	}
+}
 
+// relayModel runs the retry loop for one model. exhausted reports that the request failed because the channels
+// of the model ran out rather than because of the request itself, so another model may still serve it.
+func relayModel(c *gin.Context, relayMode int, group string, originalModel string) (openaiErr *dto.OpenAIErrorWithStatusCode, exhausted bool) {
+	// the request waits for saturated channels at most the queue timeout in total, whatever the channels it tries
+	if _, ok := c.Get("channel_queue_deadline"); !ok {
+		c.Set("channel_queue_deadline", time.Now().Add(time.Duration(common.ChannelQueueTimeout)*time.Second))
+	}
+	var saturatedErr *dto.OpenAIErrorWithStatusCode
 	for i := 0; i <= common.RetryTimes; i++ {
 		channel, err := getChannel(c, group, originalModel, i)
 		if err != nil {
+			if saturatedErr != nil {
+				// every channel left was saturated
+				return saturatedErr, true
+			}
 			common.LogError(c, err.Error())
 			openaiErr = service.OpenAIErrorWrapperLocal(err, "get_channel_failed", http.StatusInternalServerError)
-			break
+			return openaiErr, true
 		}
 
-		openaiErr = relayRequest(c, relayMode, channel)
-
+		var saturated bool
+		if delay, ok := service.GetHedgeDelay(c, relayMode, group, channel.Id); ok {
+			channel, openaiErr, saturated = relayHedged(c, relayMode, group, originalModel, channel, delay)
+		} else {
+			openaiErr, saturated = relayAttempt(c, relayMode, channel, originalModel)
+		}
+		if saturated {
+			// the request was not sent, it goes to another channel without using a retry
+			_, specific := c.Get("specific_channel_id")
+			excluded := getSaturatedChannels(c)
+			if specific || lo.Contains(excluded, channel.Id) || c.Request.Context().Err() != nil {
+				return openaiErr, true
+			}
+			c.Set("saturated_channels", append(excluded, channel.Id))
+			saturatedErr = openaiErr
+			i--
+			continue
+		}
 		if openaiErr == nil {
-			return // 成功处理请求，直接返回
+			if affinityKey := c.GetString("channel_affinity"); affinityKey != "" && c.GetString("fallback_from") == "" {
+				model.SetChannelAffinity(affinityKey, channel.Id, c.GetString("channel_key"))
+			}
+			return nil, false // 成功处理请求，直接返回
 		}
 
-		go processChannelError(c, channel.Id, channel.Type, channel.Name, channel.GetAutoBan(), openaiErr)
-
 		if !shouldRetry(c, openaiErr, common.RetryTimes-i) {
 			break
 		}
 	}
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		common.LogInfo(c, retryLogStr)
+	// the last error would have been retried if retries were left
+	return openaiErr, shouldRetry(c, openaiErr, 1)
+}
+
+// relayAttempt sends the request to the channel within the limits of the channel and records the outcome for
+// channel selection. saturated reports that the channel had no capacity left or no half-open probe, so the request
+// was not sent.
+func relayAttempt(c *gin.Context, relayMode int, channel *model.Channel, originalModel string) (openaiErr *dto.OpenAIErrorWithStatusCode, saturated bool) {
+	limits, _ := c.Get("channel_limits")
+	channelLimits, _ := limits.(model.ChannelLimits)
+	deadline, ok := c.Value("channel_queue_deadline").(time.Time)
+	if !ok {
+		deadline = time.Now().Add(time.Duration(common.ChannelQueueTimeout) * time.Second)
+	}
+	lease, err := model.AcquireChannelLimit(c.Request.Context(), channel.Id, channelLimits, estimateRequestTokens(c, relayMode, channelLimits), deadline)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("channel #%d is saturated: %s", channel.Id, err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "channel_saturated", http.StatusTooManyRequests), true
+	}
+	if !model.AcquireChannelBreaker(channel.Id, originalModel) {
+		model.ReleaseChannelLimit(lease, 0)
+		common.LogError(c, fmt.Sprintf("channel #%d is circuit broken", channel.Id))
+		return service.OpenAIErrorWrapperLocal(errors.New("channel is circuit broken"), "channel_circuit_open", http.StatusServiceUnavailable), true
 	}
 
-	if openaiErr != nil {
-		if openaiErr.StatusCode == http.StatusTooManyRequests {
-			openaiErr.Error.Message = "当前分组上游负载已饱和，请稍后再试"
-		}
-		openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
-		c.JSON(openaiErr.StatusCode, gin.H{
-			"error": openaiErr.Error,
-		})
+	startTime := time.Now()
+	c.Set("channel_usage_tokens", 0)
+	model.ChannelRequestStarted(channel.Id)
+	openaiErr = relayRequest(c, relayMode, channel)
+	model.ReleaseChannelLimit(lease, c.GetInt("channel_usage_tokens"))
+	if openaiErr != nil && service.LostHedge(c) {
+		// cancelled because another attempt of the hedged request was served
+		model.ChannelRequestCancelled(channel.Id)
+		return openaiErr, false
+	}
+	latency := time.Since(startTime)
+	if relayMode == relayconstant.RelayModeRealtime {
+		// a realtime session lasts as long as the client wants, it says nothing about the channel latency
+		latency = 0
+	}
+	model.ChannelRequestFinished(channel.Id, latency, openaiErr == nil || !service.IsChannelFailure(openaiErr))
+
+	if openaiErr == nil {
+		go model.RecordChannelSuccess(channel.Id, originalModel)
+		return nil, false
+	}
+	go processChannelError(c, channel.Id, channel.Type, channel.Name, c.GetString("channel_key"), originalModel, channel.GetAutoBan(), openaiErr)
+	return openaiErr, false
+}
+
+// estimateRequestTokens reserves the prompt tokens of a request on the TPM limit of the channel, the estimate is
+// replaced with the actual usage once the request is done
+func estimateRequestTokens(c *gin.Context, relayMode int, limits model.ChannelLimits) int {
+	if limits.TPM <= 0 || !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return 0
 	}
+	return relay.EstimatePromptTokens(c, relayMode)
 }
 
 func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *dto.OpenAIErrorWithStatusCode {
@@ -141,14 +282,26 @@ func relayRequest(c *gin.Context, relayMode int, channel *model.Channel) *dto.Op
 	return relayHandler(c, relayMode)
 }
 
+// getSaturatedChannels returns the channels the request could not get a slot of, they are not selected again
+func getSaturatedChannels(c *gin.Context) []int {
+	channelIds, _ := c.Value("saturated_channels").([]int)
+	return channelIds
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
-	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
+	if c.GetString("fallback_from") != "" {
+		// channels of a fallback model are traced with the model they served
+		useChannel = append(useChannel, fmt.Sprintf("%s:%d", c.GetString("original_model"), channelId))
+	} else {
+		useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
+	}
 	c.Set("use_channel", useChannel)
 }
 
 func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*model.Channel, error) {
-	if retryCount == 0 {
+	excluded := getSaturatedChannels(c)
+	if retryCount == 0 && !lo.Contains(excluded, c.GetInt("channel_id")) {
 		autoBan := c.GetBool("auto_ban")
 		autoBanInt := 1
 		if !autoBan {
@@ -161,7 +314,15 @@ func getChannel(c *gin.Context, group, originalModel string, retryCount int) (*m
 			AutoBan: &autoBanInt,
 		}, nil
 	}
-	channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, retryCount)
+	// a multi-key channel is retried with its other keys before moving on to another channel
+	if c.GetString("channel_key") != "" && !lo.Contains(excluded, c.GetInt("channel_id")) {
+		channel, err := model.CacheGetChannel(c.GetInt("channel_id"))
+		if err == nil && channel.HasUntriedKey(c.GetStringSlice("use_channel_key")) {
+			middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+			return channel, nil
+		}
+	}
+	channel, err := model.CacheGetRandomSatisfiedChannelExcept(group, originalModel, retryCount, excluded)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("获取重试渠道失败: %s", err.Error()))
 	}
@@ -212,12 +373,24 @@ func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode, retry
 	return true
 }
 
-func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
+func processChannelError(c *gin.Context, channelId int, channelType int, channelName string, channelKey string, modelName string, autoBan bool, err *dto.OpenAIErrorWithStatusCode) {
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	common.LogError(c, fmt.Sprintf("relay error (channel #%d, status code: %d): %s", channelId, err.StatusCode, err.Error.Message))
+	if service.IsChannelFailure(err) {
+		model.RecordChannelFailure(channelId, modelName, fmt.Sprintf("status code %d: %s", err.StatusCode, err.Error.Message))
+	}
+	if channelKey != "" && service.IsChannelFailure(err) {
+		if keyErr := model.RecordChannelKeyError(channelId, channelKey, fmt.Sprintf("status code %d: %s", err.StatusCode, err.Error.Message)); keyErr != nil {
+			common.LogError(c, "failed to record channel key error: "+keyErr.Error())
+		}
+	}
 	if service.ShouldDisableChannel(channelType, err) && autoBan {
-		service.DisableChannel(channelId, channelName, err.Error.Message)
+		if channelKey != "" {
+			service.DisableChannelKey(channelId, channelName, channelKey, err.Error.Message)
+		} else {
+			service.DisableChannel(channelId, channelName, err.Error.Message)
+		}
 	}
 }
 
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedResponseWriter keeps the response of a hedge attempt until it is known to win
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *bufferedResponseWriter) Flush() {}
+
+func (w *bufferedResponseWriter) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func (w *bufferedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack is not supported by a hedged request")
+}
+
+func (w *bufferedResponseWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// writeTo sends the buffered response to the client
+func (w *bufferedResponseWriter) writeTo(writer gin.ResponseWriter) {
+	for key, values := range w.header {
+		writer.Header()[key] = values
+	}
+	writer.WriteHeader(w.status)
+	_, _ = writer.Write(w.body.Bytes())
+}
+
+type hedgeAttempt struct {
+	id        int
+	ctx       *gin.Context
+	writer    *bufferedResponseWriter
+	cancel    context.CancelFunc
+	channel   *model.Channel
+	openaiErr *dto.OpenAIErrorWithStatusCode
+	saturated bool
+}
+
+// newHedgeAttempt copies the context for an attempt, with its own request, response and channel trace
+func newHedgeAttempt(c *gin.Context, race *service.HedgeRace, id int) *hedgeAttempt {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	attempt := &hedgeAttempt{
+		id:     id,
+		ctx:    c.Copy(),
+		writer: newBufferedResponseWriter(),
+		cancel: cancel,
+	}
+	attempt.ctx.Request = c.Request.Clone(ctx)
+	attempt.ctx.Writer = attempt.writer
+	attempt.ctx.Set("hedge", race)
+	attempt.ctx.Set("hedge_attempt", id)
+	attempt.ctx.Set("use_channel", append([]string(nil), c.GetStringSlice("use_channel")...))
+	attempt.ctx.Set("use_channel_key", append([]string(nil), c.GetStringSlice("use_channel_key")...))
+	return attempt
+}
+
+// getHedgeChannel picks a channel other than the one already tried and the saturated ones
+func getHedgeChannel(c *gin.Context, group string, originalModel string, channelId int) *model.Channel {
+	excluded := append([]int{channelId}, getSaturatedChannels(c)...)
+	channel, err := model.CacheGetRandomSatisfiedChannelExcept(group, originalModel, 0, excluded)
+	if err != nil {
+		return nil
+	}
+	return channel
+}
+
+// relayHedged sends the request to the channel, and to a second channel as well when the first has not answered
+// after the delay. The first successful attempt is answered to the client and billed, the other one is cancelled.
+// It returns the channel of the attempt whose result is returned.
+func relayHedged(c *gin.Context, relayMode int, group string, originalModel string, channel *model.Channel, delay time.Duration) (*model.Channel, *dto.OpenAIErrorWithStatusCode, bool) {
+	race := &service.HedgeRace{Delay: delay}
+	useChannel := c.GetStringSlice("use_channel")
+	done := make(chan *hedgeAttempt, 2)
+	run := func(attempt *hedgeAttempt) {
+		race.AddChannel(attempt.channel.Id)
+		go func() {
+			attempt.openaiErr, attempt.saturated = relayAttempt(attempt.ctx, relayMode, attempt.channel, originalModel)
+			done <- attempt
+		}()
+	}
+	primary := newHedgeAttempt(c, race, 1)
+	primary.channel = channel
+	attempts := []*hedgeAttempt{primary}
+	run(primary)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var result *hedgeAttempt
+	for running := 1; running > 0; {
+		select {
+		case <-timer.C:
+			hedgeChannel := getHedgeChannel(c, group, originalModel, channel.Id)
+			if hedgeChannel == nil {
+				common.LogInfo(c, fmt.Sprintf("渠道 #%d 在 %dms 内未响应，但没有其他可用渠道，不对冲", channel.Id, delay.Milliseconds()))
+				continue
+			}
+			if !service.AcquireHedgeBudget(group) {
+				common.LogInfo(c, fmt.Sprintf("渠道 #%d 在 %dms 内未响应，但分组 %s 的对冲额度已用尽，不对冲", channel.Id, delay.Milliseconds(), group))
+				continue
+			}
+			common.LogInfo(c, fmt.Sprintf("渠道 #%d 在 %dms 内未响应，对冲请求到渠道 #%d", channel.Id, delay.Milliseconds(), hedgeChannel.Id))
+			hedge := newHedgeAttempt(c, race, 2)
+			hedge.channel = hedgeChannel
+			middleware.SetupContextForSelectedChannel(hedge.ctx, hedgeChannel, originalModel)
+			attempts = append(attempts, hedge)
+			run(hedge)
+			running++
+		case attempt := <-done:
+			running--
+			if attempt.openaiErr == nil && race.Claim(attempt.id) {
+				result = attempt
+				running = 0
+			} else if result == nil || attempt.id == primary.id {
+				// when every attempt failed the error of the first channel is reported
+				result = attempt
+			}
+		}
+	}
+	// the attempt that is still running lost the race
+	for _, attempt := range attempts {
+		attempt.cancel()
+	}
+	if race.Hedged() && result.openaiErr == nil {
+		common.LogInfo(c, fmt.Sprintf("对冲请求由渠道 #%d 完成", result.channel.Id))
+	}
+
+	// the context continues with the attempt that is returned, every tried channel stays in the trace
+	for key, value := range result.ctx.Keys {
+		if key != "hedge" && key != "hedge_attempt" {
+			c.Set(key, value)
+		}
+	}
+	c.Set("use_channel", useChannel)
+	useChannelKey := c.GetStringSlice("use_channel_key")
+	for _, attempt := range attempts {
+		addUsedChannel(c, attempt.channel.Id)
+		if fingerprint := attempt.ctx.GetString("channel_key"); fingerprint != "" && !common.StringsContains(useChannelKey, fingerprint) {
+			useChannelKey = append(useChannelKey, fingerprint)
+		}
+	}
+	c.Set("use_channel_key", useChannelKey)
+	if result.openaiErr == nil {
+		result.writer.writeTo(c.Writer)
+	}
+	return result.channel, result.openaiErr, result.saturated
+}
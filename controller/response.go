@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func responseNotFound(c *gin.Context, responseId string) {
+	openAIError := dto.OpenAIError{
+		Message: fmt.Sprintf("Response with id '%s' not found.", responseId),
+		Type:    "invalid_request_error",
+		Param:   "",
+		Code:    "",
+	}
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": openAIError,
+	})
+}
+
+func RetrieveResponse(c *gin.Context) {
+	responseId := c.Param("id")
+	storedResponse, err := model.GetStoredResponse(c.GetInt("id"), responseId)
+	if err != nil {
+		responseNotFound(c, responseId)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", storedResponse.Data)
+}
+
+func DeleteResponse(c *gin.Context) {
+	responseId := c.Param("id")
+	deleted, err := model.DeleteStoredResponse(c.GetInt("id"), responseId)
+	if err != nil {
+		common.SysError("failed to delete response: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": dto.OpenAIError{
+				Message: err.Error(),
+				Type:    "new_api_error",
+				Param:   "",
+				Code:    "delete_response_failed",
+			},
+		})
+		return
+	}
+	if !deleted {
+		responseNotFound(c, responseId)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      responseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+)
+
+// respondStatement generates the statement of the user for the month and token of the query, in the format it asks
+// for: json (the default), csv or html
+func respondStatement(c *gin.Context, userId int) {
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	statement, err := model.GenerateStatement(userId, tokenId, c.Query("month"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	switch c.Query("format") {
+	case "csv":
+		c.Header("Content-Disposition", `attachment; filename="`+service.StatementFileName(statement, "csv")+`"`)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = service.WriteStatementCSV(c.Writer, statement)
+	case "html":
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = service.WriteStatementHTML(c.Writer, statement)
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    statement,
+		})
+	}
+	if err != nil {
+		_ = c.Error(err)
+	}
+}
+
+func GetSelfStatement(c *gin.Context) {
+	respondStatement(c, c.GetInt("id"))
+}
+
+func GetUserStatement(c *gin.Context) {
+	id, err := ledgerUserId(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	respondStatement(c, id)
+}
@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/refund"
+	"github.com/stripe/stripe-go/v79/subscription"
 	"github.com/stripe/stripe-go/v79/webhook"
 	"io"
 	"log"
@@ -38,6 +42,14 @@ func StripeWebhook(c *gin.Context) {
 		sessionCompleted(event)
 	case stripe.EventTypeCheckoutSessionExpired:
 		sessionExpired(event)
+	case stripe.EventTypeInvoicePaid:
+		invoicePaid(event)
+	case stripe.EventTypeInvoicePaymentFailed:
+		invoicePaymentFailed(event)
+	case stripe.EventTypeCustomerSubscriptionUpdated:
+		subscriptionUpdated(event)
+	case stripe.EventTypeCustomerSubscriptionDeleted:
+		subscriptionDeleted(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
@@ -54,6 +66,21 @@ func sessionCompleted(event stripe.Event) {
 		return
 	}
 
+	if string(stripe.CheckoutSessionModeSubscription) == event.GetObjectValue("mode") {
+		stripeSubscriptionId := event.GetObjectValue("subscription")
+		err := model.ActivateSubscription(referenceId, customerId, stripeSubscriptionId)
+		if errors.Is(err, model.ErrSubscriptionRunning) {
+			cancelDuplicateSubscription(referenceId, stripeSubscriptionId)
+			return
+		}
+		if err != nil {
+			log.Println(err.Error(), referenceId)
+			return
+		}
+		log.Printf("订阅已生效：%s", referenceId)
+		return
+	}
+
 	err := model.Recharge(referenceId, customerId)
 	if err != nil {
 		log.Println(err.Error(), referenceId)
@@ -78,6 +105,14 @@ func sessionExpired(event stripe.Event) {
 		return
 	}
 
+	if string(stripe.CheckoutSessionModeSubscription) == event.GetObjectValue("mode") {
+		err := model.CancelSubscription(referenceId, "")
+		if err != nil {
+			log.Println("过期订阅订单失败", referenceId, ", err:", err.Error())
+		}
+		return
+	}
+
 	topUp := model.GetTopUpByTradeNo(referenceId)
 	if topUp == nil {
 		log.Println("充值订单不存在", referenceId)
@@ -97,3 +132,109 @@ func sessionExpired(event stripe.Event) {
 
 	log.Println("充值订单已过期", referenceId)
 }
+
+// parseInvoice returns the subscription of an invoice event, by its trade number and Stripe id, and the end of the
+// period the invoice is for
+func parseInvoice(event stripe.Event) (string, string, int64, bool) {
+	var invoice stripe.Invoice
+	if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		log.Println("解析Stripe发票失败", err.Error())
+		return "", "", 0, false
+	}
+	if invoice.Subscription == nil {
+		return "", "", 0, false
+	}
+	tradeNo := ""
+	if invoice.SubscriptionDetails != nil {
+		tradeNo = invoice.SubscriptionDetails.Metadata["trade_no"]
+	}
+	var periodEnd int64
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Period != nil && line.Period.End > periodEnd {
+				periodEnd = line.Period.End
+			}
+		}
+	}
+	return tradeNo, invoice.Subscription.ID, periodEnd, true
+}
+
+func invoicePaid(event stripe.Event) {
+	tradeNo, subscriptionId, periodEnd, ok := parseInvoice(event)
+	if !ok {
+		return
+	}
+	err := model.PaySubscription(tradeNo, subscriptionId, periodEnd)
+	if err != nil {
+		log.Println("订阅续费失败", tradeNo, subscriptionId, ", err:", err.Error())
+		return
+	}
+	log.Printf("收到订阅款项：%s, %s", tradeNo, subscriptionId)
+}
+
+func invoicePaymentFailed(event stripe.Event) {
+	tradeNo, subscriptionId, _, ok := parseInvoice(event)
+	if !ok {
+		return
+	}
+	err := model.SetSubscriptionPastDue(tradeNo, subscriptionId)
+	if err != nil {
+		log.Println("订阅扣款失败状态更新失败", tradeNo, subscriptionId, ", err:", err.Error())
+		return
+	}
+	log.Printf("订阅扣款失败：%s, %s", tradeNo, subscriptionId)
+}
+
+func parseSubscription(event stripe.Event) (*stripe.Subscription, bool) {
+	var subscription stripe.Subscription
+	if err := json.Unmarshal(event.Data.Raw, &subscription); err != nil {
+		log.Println("解析Stripe订阅失败", err.Error())
+		return nil, false
+	}
+	return &subscription, true
+}
+
+func subscriptionUpdated(event stripe.Event) {
+	subscription, ok := parseSubscription(event)
+	if !ok {
+		return
+	}
+	err := model.SetSubscriptionCancelAtPeriodEnd(subscription.Metadata["trade_no"], subscription.ID, subscription.CancelAtPeriodEnd)
+	if err != nil {
+		log.Println("更新订阅失败", subscription.ID, ", err:", err.Error())
+	}
+}
+
+func subscriptionDeleted(event stripe.Event) {
+	subscription, ok := parseSubscription(event)
+	if !ok {
+		return
+	}
+	err := model.CancelSubscription(subscription.Metadata["trade_no"], subscription.ID)
+	if err != nil {
+		log.Println("取消订阅失败", subscription.ID, ", err:", err.Error())
+		return
+	}
+	log.Printf("订阅已取消：%s", subscription.ID)
+}
+
+// cancelDuplicateSubscription cancels in Stripe a subscription checked out while another one was running and refunds
+// its first invoice
+func cancelDuplicateSubscription(referenceId string, stripeSubscriptionId string) {
+	stripe.Key = common.StripeApiSecret
+	params := &stripe.SubscriptionCancelParams{}
+	params.AddExpand("latest_invoice")
+	sub, err := subscription.Cancel(stripeSubscriptionId, params)
+	if err != nil {
+		log.Println("取消重复订阅失败", referenceId, stripeSubscriptionId, ", err:", err.Error())
+		return
+	}
+	if sub.LatestInvoice != nil && sub.LatestInvoice.PaymentIntent != nil {
+		_, err = refund.New(&stripe.RefundParams{PaymentIntent: stripe.String(sub.LatestInvoice.PaymentIntent.ID)})
+		if err != nil {
+			log.Println("退还重复订阅款项失败", referenceId, stripeSubscriptionId, ", err:", err.Error())
+			return
+		}
+	}
+	log.Printf("重复订阅已取消并退款：%s, %s", referenceId, stripeSubscriptionId)
+}
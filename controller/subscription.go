@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/checkout/session"
+	"github.com/stripe/stripe-go/v79/subscription"
+	"log"
+	"math"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func GetAllPlans(c *gin.Context) {
+	plans, err := model.GetAllPlans(false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+// GetPlans lists the plans users can subscribe to
+func GetPlans(c *gin.Context) {
+	plans, err := model.GetAllPlans(true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+func AddPlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err == nil {
+		err = plan.Validate()
+	}
+	if err == nil {
+		err = plan.Insert()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func UpdatePlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := c.ShouldBindJSON(&plan)
+	if err == nil {
+		err = plan.Validate()
+	}
+	if err == nil {
+		_, err = model.GetPlanById(plan.Id)
+	}
+	if err == nil {
+		err = plan.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+// DeletePlan stops selling a plan, its running subscriptions continue until they lapse
+func DeletePlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	plan := model.Plan{Id: id}
+	err := plan.Delete()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetAllSubscriptions(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	subscriptions, err := model.GetAllSubscriptions(p*common.ItemsPerPage, common.ItemsPerPage, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscriptions,
+	})
+}
+
+// GetSelfSubscription returns the running subscription of the user, data is null when there is none
+func GetSelfSubscription(c *gin.Context) {
+	sub, err := model.GetUserSubscription(c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    sub,
+	})
+}
+
+type SubscribeRequest struct {
+	PlanId int `json:"plan_id"`
+}
+
+func genStripeSubscriptionLink(referenceId string, customerId string, email string, plan *model.Plan) (string, error) {
+	if !strings.HasPrefix(common.StripeApiSecret, "sk_") {
+		return "", fmt.Errorf("无效的Stripe API密钥")
+	}
+
+	stripe.Key = common.StripeApiSecret
+
+	lineItem := &stripe.CheckoutSessionLineItemParams{
+		Quantity: stripe.Int64(1),
+	}
+	if plan.StripePriceId != "" {
+		lineItem.Price = stripe.String(plan.StripePriceId)
+	} else {
+		lineItem.PriceData = &stripe.CheckoutSessionLineItemPriceDataParams{
+			Currency: stripe.String(plan.Currency),
+			ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+				Name: stripe.String(plan.Name),
+			},
+			Recurring: &stripe.CheckoutSessionLineItemPriceDataRecurringParams{
+				Interval: stripe.String(plan.Period),
+			},
+			UnitAmount: stripe.Int64(int64(math.Round(plan.Price * 100))),
+		}
+	}
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(referenceId),
+		SuccessURL:        stripe.String(common.ServerAddress + "/topup"),
+		CancelURL:         stripe.String(common.ServerAddress + "/topup"),
+		LineItems:         []*stripe.CheckoutSessionLineItemParams{lineItem},
+		Mode:              stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		ExpiresAt:         stripe.Int64(time.Now().Unix() + model.SubscriptionCheckoutSeconds),
+		// the events of the subscription and its invoices find it by the trade number
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{"trade_no": referenceId},
+		},
+	}
+
+	// a customer is always created in subscription mode
+	if "" != customerId {
+		params.Customer = stripe.String(customerId)
+	} else if "" != email {
+		params.CustomerEmail = stripe.String(email)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return "", err
+	}
+
+	return result.URL, nil
+}
+
+func Subscribe(c *gin.Context) {
+	var req SubscribeRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "参数错误"})
+		return
+	}
+	if !common.PaymentEnabled {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "管理员未开启在线支付"})
+		return
+	}
+	plan, err := model.GetPlanById(req.PlanId)
+	if err != nil || plan.DeletedAt.Valid || plan.Status != common.PlanStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "套餐不存在"})
+		return
+	}
+	id := c.GetInt("id")
+	open, err := model.HasOpenSubscription(id)
+	if err != nil || open {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "已有生效中或待支付的订阅"})
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "用户不存在"})
+		return
+	}
+
+	reference := fmt.Sprintf("new-api-sub-%d-%d-%s", user.Id, time.Now().UnixMilli(), common.RandomString(4))
+	referenceId := "sub_" + common.Sha1(reference)
+
+	payLink, err := genStripeSubscriptionLink(referenceId, user.StripeCustomer, user.Email, plan)
+	if err != nil {
+		log.Println("获取Stripe Checkout订阅链接失败", err)
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
+		return
+	}
+
+	sub := &model.Subscription{
+		UserId:  id,
+		PlanId:  plan.Id,
+		TradeNo: referenceId,
+		Status:  common.SubscriptionStatusPending,
+	}
+	err = sub.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"payLink": payLink,
+		},
+	})
+}
+
+// CancelSelfSubscription cancels the subscription at the end of its period, Stripe confirms it by webhook
+func CancelSelfSubscription(c *gin.Context) {
+	sub, err := model.GetUserSubscription(c.GetInt("id"))
+	if err != nil || sub == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "没有生效中的订阅",
+		})
+		return
+	}
+	stripe.Key = common.StripeApiSecret
+	_, err = subscription.Update(sub.StripeSubscriptionId, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+	if err == nil {
+		err = model.SetSubscriptionCancelAtPeriodEnd(sub.TradeNo, "", true)
+	}
+	if err != nil {
+		log.Println("取消Stripe订阅失败", sub.TradeNo, err)
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "取消订阅失败",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
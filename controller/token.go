@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
@@ -8,6 +9,28 @@ import (
 	"strconv"
 )
 
+// tokenWithSpendWindows reports the usage of the spend windows of a token along with it
+type tokenWithSpendWindows struct {
+	*model.Token
+	SpendWindows []model.SpendWindowUsage `json:"spend_windows"`
+}
+
+func withSpendWindows(tokens []*model.Token) []tokenWithSpendWindows {
+	result := make([]tokenWithSpendWindows, len(tokens))
+	for i, token := range tokens {
+		result[i].Token = token
+		if token.GetSpendLimits().IsZero() {
+			continue
+		}
+		usages, err := model.GetSpendWindows(model.SpendWindowOwnerToken, token.Id, token.GetSpendLimits())
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get spend windows of token %d: %s", token.Id, err.Error()))
+		}
+		result[i].SpendWindows = usages
+	}
+	return result
+}
+
 func GetAllTokens(c *gin.Context) {
 	userId := c.GetInt("id")
 	p, _ := strconv.Atoi(c.Query("p"))
@@ -31,7 +54,7 @@ func GetAllTokens(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    tokens,
+		"data":    withSpendWindows(tokens),
 	})
 	return
 }
@@ -51,7 +74,7 @@ func SearchTokens(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    tokens,
+		"data":    withSpendWindows(tokens),
 	})
 	return
 }
@@ -77,7 +100,7 @@ func GetToken(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    token,
+		"data":    withSpendWindows([]*model.Token{token})[0],
 	})
 	return
 }
@@ -123,6 +146,13 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := token.GetSpendLimits().Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -145,6 +175,10 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		FallbackDisabled:   token.FallbackDisabled,
+		DailyQuotaLimit:    token.DailyQuotaLimit,
+		WeeklyQuotaLimit:   token.WeeklyQuotaLimit,
+		MonthlyQuotaLimit:  token.MonthlyQuotaLimit,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -198,6 +232,13 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := token.GetSpendLimits().Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -234,6 +275,10 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.FallbackDisabled = token.FallbackDisabled
+		cleanToken.DailyQuotaLimit = token.DailyQuotaLimit
+		cleanToken.WeeklyQuotaLimit = token.WeeklyQuotaLimit
+		cleanToken.MonthlyQuotaLimit = token.MonthlyQuotaLimit
 	}
 	err = cleanToken.Update()
 	if err != nil {
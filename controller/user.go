@@ -455,7 +455,7 @@ func GetUserModels(c *gin.Context) {
 		})
 		return
 	}
-	models := model.GetGroupModels(user.Group)
+	models := expandModelPatterns(model.GetGroupModels(user.Group))
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -507,11 +507,18 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := updatedUser.GetSpendLimits().Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
 	updatePassword := updatedUser.Password != ""
-	if err := updatedUser.Edit(updatePassword); err != nil {
+	if err := updatedUser.Edit(updatePassword, c.GetInt("id")); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": err.Error(),
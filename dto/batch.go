@@ -0,0 +1,94 @@
+package dto
+
+import "encoding/json"
+
+type OpenAIFile struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+}
+
+type OpenAIFileList struct {
+	Object string        `json:"object"`
+	Data   []*OpenAIFile `json:"data"`
+}
+
+type OpenAIBatchRequest struct {
+	InputFileId      string         `json:"input_file_id"`
+	Endpoint         string         `json:"endpoint"`
+	CompletionWindow string         `json:"completion_window"`
+	Metadata         map[string]any `json:"metadata,omitempty"`
+}
+
+type OpenAIBatch struct {
+	Id               string                   `json:"id"`
+	Object           string                   `json:"object"`
+	Endpoint         string                   `json:"endpoint"`
+	Errors           *OpenAIBatchErrors       `json:"errors"`
+	InputFileId      string                   `json:"input_file_id"`
+	CompletionWindow string                   `json:"completion_window"`
+	Status           string                   `json:"status"`
+	OutputFileId     string                   `json:"output_file_id,omitempty"`
+	ErrorFileId      string                   `json:"error_file_id,omitempty"`
+	CreatedAt        int64                    `json:"created_at"`
+	InProgressAt     int64                    `json:"in_progress_at,omitempty"`
+	ExpiresAt        int64                    `json:"expires_at,omitempty"`
+	FinalizingAt     int64                    `json:"finalizing_at,omitempty"`
+	CompletedAt      int64                    `json:"completed_at,omitempty"`
+	FailedAt         int64                    `json:"failed_at,omitempty"`
+	CancellingAt     int64                    `json:"cancelling_at,omitempty"`
+	CancelledAt      int64                    `json:"cancelled_at,omitempty"`
+	RequestCounts    OpenAIBatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]any           `json:"metadata,omitempty"`
+}
+
+type OpenAIBatchErrors struct {
+	Object string              `json:"object"`
+	Data   []*OpenAIBatchError `json:"data"`
+}
+
+type OpenAIBatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+}
+
+type OpenAIBatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type OpenAIBatchList struct {
+	Object  string         `json:"object"`
+	Data    []*OpenAIBatch `json:"data"`
+	FirstId string         `json:"first_id,omitempty"`
+	LastId  string         `json:"last_id,omitempty"`
+	HasMore bool           `json:"has_more"`
+}
+
+// BatchRequestInput is one line of a batch input file
+type BatchRequestInput struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// BatchRequestOutput is one line of a batch output or error file
+type BatchRequestOutput struct {
+	Id       string            `json:"id"`
+	CustomId string            `json:"custom_id"`
+	Response *BatchResponse    `json:"response"`
+	Error    *OpenAIBatchError `json:"error"`
+}
+
+type BatchResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
@@ -1,5 +1,7 @@
 package dto
 
+import "mime/multipart"
+
 type ImageRequest struct {
 	Model          string `json:"model"`
 	Prompt         string `json:"prompt" binding:"required"`
@@ -9,6 +11,9 @@ type ImageRequest struct {
 	ResponseFormat string `json:"response_format,omitempty"`
 	Style          string `json:"style,omitempty"`
 	User           string `json:"user,omitempty"`
+	// Image and Mask are the uploads of /v1/images/edits and /v1/images/variations
+	Image *multipart.FileHeader `json:"-"`
+	Mask  *multipart.FileHeader `json:"-"`
 }
 
 type ImageResponse struct {
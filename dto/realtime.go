@@ -0,0 +1,40 @@
+package dto
+
+const (
+	RealtimeEventTypeError        = "error"
+	RealtimeEventTypeResponseDone = "response.done"
+)
+
+// RealtimeEvent holds the fields of a realtime api event the gateway looks at, every other field is
+// forwarded untouched
+type RealtimeEvent struct {
+	EventId  string            `json:"event_id,omitempty"`
+	Type     string            `json:"type"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+	Error    *OpenAIError      `json:"error,omitempty"`
+}
+
+type RealtimeResponse struct {
+	Id     string         `json:"id"`
+	Status string         `json:"status"`
+	Usage  *RealtimeUsage `json:"usage"`
+}
+
+type RealtimeUsage struct {
+	TotalTokens        int                        `json:"total_tokens"`
+	InputTokens        int                        `json:"input_tokens"`
+	OutputTokens       int                        `json:"output_tokens"`
+	InputTokenDetails  RealtimeInputTokenDetails  `json:"input_token_details"`
+	OutputTokenDetails RealtimeOutputTokenDetails `json:"output_token_details"`
+}
+
+type RealtimeInputTokenDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	TextTokens   int `json:"text_tokens"`
+	AudioTokens  int `json:"audio_tokens"`
+}
+
+type RealtimeOutputTokenDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+}
@@ -0,0 +1,126 @@
+package dto
+
+import "encoding/json"
+
+// OpenAIResponsesRequest is the body of POST /v1/responses
+type OpenAIResponsesRequest struct {
+	Model              string          `json:"model"`
+	Input              json.RawMessage `json:"input,omitempty"`
+	Instructions       string          `json:"instructions,omitempty"`
+	MaxOutputTokens    uint            `json:"max_output_tokens,omitempty"`
+	Temperature        float64         `json:"temperature,omitempty"`
+	TopP               float64         `json:"top_p,omitempty"`
+	Stream             bool            `json:"stream,omitempty"`
+	Tools              []ResponsesTool `json:"tools,omitempty"`
+	ToolChoice         any             `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool           `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseId string          `json:"previous_response_id,omitempty"`
+	Store              *bool           `json:"store,omitempty"`
+	Metadata           map[string]any  `json:"metadata,omitempty"`
+	User               string          `json:"user,omitempty"`
+	Text               *ResponsesText  `json:"text,omitempty"`
+	Reasoning          *struct {
+		Effort string `json:"effort,omitempty"`
+	} `json:"reasoning,omitempty"`
+}
+
+// ParseInput returns the input as a list of items, a plain string input is a single user message
+func (r *OpenAIResponsesRequest) ParseInput() ([]map[string]any, error) {
+	if len(r.Input) == 0 {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(r.Input, &text); err == nil {
+		return []map[string]any{
+			{
+				"type":    "message",
+				"role":    "user",
+				"content": text,
+			},
+		}, nil
+	}
+	var items []map[string]any
+	err := json.Unmarshal(r.Input, &items)
+	return items, err
+}
+
+// ShouldStore reports whether the response should be kept for previous_response_id and GET, openai defaults to true
+func (r *OpenAIResponsesRequest) ShouldStore() bool {
+	return r.Store == nil || *r.Store
+}
+
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesTextFormat struct {
+	Type   string `json:"type"`
+	Name   string `json:"name,omitempty"`
+	Schema any    `json:"schema,omitempty"`
+	Strict *bool  `json:"strict,omitempty"`
+}
+
+type OpenAIResponsesResponse struct {
+	Id                 string            `json:"id"`
+	Object             string            `json:"object"`
+	CreatedAt          int64             `json:"created_at"`
+	Status             string            `json:"status"`
+	Model              string            `json:"model"`
+	Output             []ResponsesOutput `json:"output"`
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseId string            `json:"previous_response_id,omitempty"`
+	IncompleteDetails  *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
+	Error *OpenAIError    `json:"error,omitempty"`
+	Usage *ResponsesUsage `json:"usage,omitempty"`
+}
+
+type ResponsesOutput struct {
+	Type      string                   `json:"type"`
+	Id        string                   `json:"id"`
+	Status    string                   `json:"status,omitempty"`
+	Role      string                   `json:"role,omitempty"`
+	Content   []ResponsesOutputContent `json:"content,omitempty"`
+	Summary   []ResponsesOutputContent `json:"summary,omitempty"`
+	CallId    string                   `json:"call_id,omitempty"`
+	Name      string                   `json:"name,omitempty"`
+	Arguments string                   `json:"arguments,omitempty"`
+}
+
+type ResponsesOutputContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens         int                 `json:"input_tokens"`
+	OutputTokens        int                 `json:"output_tokens"`
+	TotalTokens         int                 `json:"total_tokens"`
+	InputTokensDetails  *InputTokenDetails  `json:"input_tokens_details,omitempty"`
+	OutputTokensDetails *OutputTokenDetails `json:"output_tokens_details,omitempty"`
+}
+
+// ResponsesStreamResponse is one typed event of a streamed response, the fields used depend on Type
+type ResponsesStreamResponse struct {
+	Type           string                   `json:"type"`
+	SequenceNumber int                      `json:"sequence_number"`
+	Response       *OpenAIResponsesResponse `json:"response,omitempty"`
+	OutputIndex    *int                     `json:"output_index,omitempty"`
+	ContentIndex   *int                     `json:"content_index,omitempty"`
+	SummaryIndex   *int                     `json:"summary_index,omitempty"`
+	ItemId         string                   `json:"item_id,omitempty"`
+	Item           *ResponsesOutput         `json:"item,omitempty"`
+	Part           *ResponsesOutputContent  `json:"part,omitempty"`
+	Delta          string                   `json:"delta,omitempty"`
+	Text           string                   `json:"text,omitempty"`
+	Arguments      string                   `json:"arguments,omitempty"`
+}
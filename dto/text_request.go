@@ -1,6 +1,9 @@
 package dto
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+)
 
 type GeneralOpenAIRequest struct {
 	Model               string         `json:"model,omitempty"`
@@ -83,6 +86,18 @@ func (r GeneralOpenAIRequest) ParseInput() []string {
 	return input
 }
 
+// ParseEmbeddingInput returns the texts to embed for providers that cannot take token arrays
+func (r GeneralOpenAIRequest) ParseEmbeddingInput() ([]string, error) {
+	input := r.ParseInput()
+	if len(input) == 0 {
+		return nil, errors.New("input must be a string or an array of strings")
+	}
+	if items, ok := r.Input.([]any); ok && len(items) != len(input) {
+		return nil, errors.New("input must be a string or an array of strings")
+	}
+	return input, nil
+}
+
 type Message struct {
 	Role             string          `json:"role"`
 	Content          json.RawMessage `json:"content"`
@@ -129,7 +129,28 @@ type CompletionsStreamResponse struct {
 }
 
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                `json:"prompt_tokens"`
+	CompletionTokens        int                `json:"completion_tokens"`
+	TotalTokens             int                `json:"total_tokens"`
+	PromptTokensDetails     InputTokenDetails  `json:"prompt_tokens_details"`
+	CompletionTokensDetails OutputTokenDetails `json:"completion_tokens_details"`
+}
+
+// InputTokenDetails splits the prompt tokens by how they are billed, every count is part of PromptTokens
+type InputTokenDetails struct {
+	CachedTokens         int `json:"cached_tokens"`
+	CachedCreationTokens int `json:"cached_creation_tokens,omitempty"`
+	TextTokens           int `json:"text_tokens,omitempty"`
+	AudioTokens          int `json:"audio_tokens"`
+	ImageTokens          int `json:"image_tokens,omitempty"`
+}
+
+// OutputTokenDetails splits the completion tokens the same way, every count is part of CompletionTokens
+type OutputTokenDetails struct {
+	TextTokens               int `json:"text_tokens,omitempty"`
+	AudioTokens              int `json:"audio_tokens"`
+	ImageTokens              int `json:"image_tokens,omitempty"`
+	ReasoningTokens          int `json:"reasoning_tokens"`
+	AcceptedPredictionTokens int `json:"accepted_prediction_tokens,omitempty"`
+	RejectedPredictionTokens int `json:"rejected_prediction_tokens,omitempty"`
 }
@@ -84,6 +84,10 @@ func main() {
 
 	// 数据看板
 	go model.UpdateQuotaData()
+	// 渠道健康记录
+	go model.UpdateChannelHealth()
+	// 通知投递
+	go service.DeliverNotifications()
 
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
 		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
@@ -146,6 +150,11 @@ func main() {
 	server.Use(sessions.Sessions("session", store))
 
 	router.SetRouter(server, buildFS, indexPage)
+	if common.IsMasterNode && constant.UpdateTask {
+		gopool.Go(func() {
+			controller.UpdateBatchTaskBulk(server)
+		})
+	}
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
@@ -3,6 +3,7 @@ package middleware
 import (
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
@@ -168,6 +169,25 @@ func RootAuth() func(c *gin.Context) {
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		key := c.Request.Header.Get("Authorization")
+		if key == "" {
+			// anthropic sdk
+			key = c.Request.Header.Get("x-api-key")
+		}
+		if key == "" && strings.HasPrefix(c.Request.URL.Path, "/v1beta/models") {
+			// gemini sdk
+			key = c.Request.Header.Get("x-goog-api-key")
+			if key == "" {
+				key = c.Query("key")
+			}
+		}
+		if key == "" && strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+			// browsers cannot set headers on a websocket handshake, the key comes as a subprotocol
+			for _, protocol := range websocket.Subprotocols(c.Request) {
+				if strings.HasPrefix(protocol, "openai-insecure-api-key.") {
+					key = strings.TrimPrefix(protocol, "openai-insecure-api-key.")
+				}
+			}
+		}
 		parts := make([]string, 0)
 		key = strings.TrimPrefix(key, "Bearer ")
 		if key == "" || key == "midjourney-proxy" {
@@ -225,6 +245,8 @@ func TokenAuth() func(c *gin.Context) {
 		}
 		c.Set("allow_ips", token.GetIpLimitsMap())
 		c.Set("token_group", token.Group)
+		c.Set("token_fallback_disabled", token.FallbackDisabled)
+		c.Set("token_spend_limits", token.GetSpendLimits())
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set("specific_channel_id", parts[1])
@@ -94,7 +94,31 @@ func Distribute() func(c *gin.Context) {
 			}
 
 			if shouldSelectChannel {
-				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
+				// a conversation sticks to the channel that last served it while that channel is healthy
+				if affinityKey := service.GetChannelAffinityKey(c, userGroup, modelRequest.Model); affinityKey != "" {
+					c.Set("channel_affinity", affinityKey)
+					if affinity, ok := model.GetChannelAffinity(affinityKey); ok {
+						if affinityChannel, ok := model.CacheGetAffinityChannel(userGroup, modelRequest.Model, affinity.ChannelId); ok {
+							channel = affinityChannel
+							c.Set("affinity_channel_id", affinity.ChannelId)
+							c.Set("affinity_channel_key", affinity.Key)
+						}
+					}
+				}
+				if channel == nil {
+					channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, 0)
+				}
+				if err != nil {
+					// no channel of the model is available at all, try its fallbacks before giving up
+					for _, fallback := range service.GetModelFallbacks(c, userGroup, modelRequest.Model) {
+						fallbackChannel, fallbackErr := model.CacheGetRandomSatisfiedChannel(userGroup, fallback, 0)
+						if fallbackErr == nil && service.UseFallbackModel(c, modelRequest.Model, fallback) == nil {
+							channel, err = fallbackChannel, nil
+							modelRequest.Model = fallback
+							break
+						}
+					}
+				}
 				if err != nil {
 					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, modelRequest.Model)
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
@@ -170,6 +194,14 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的请求, "+err.Error())
 		return nil, false, errors.New("无效的请求, " + err.Error())
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		// gemini puts the model in the path: /v1beta/models/{model}:generateContent
+		modelName := strings.TrimPrefix(c.Request.URL.Path, "/v1beta/models/")
+		if i := strings.LastIndex(modelName, ":"); i > 0 {
+			modelName = modelName[:i]
+		}
+		modelRequest.Model = modelName
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "text-moderation-stable"
@@ -183,6 +215,14 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
 		modelRequest.Model = common.GetStringIfEmpty(modelRequest.Model, "dall-e")
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") || strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+		// multipart upload, the model is a form field
+		modelRequest.Model = common.GetStringIfEmpty(c.PostForm("model"), "dall-e-2")
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		// websocket handshake, the model is a query parameter
+		modelRequest.Model = c.Query("model")
+	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		relayMode := relayconstant.RelayModeAudioSpeech
 		if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/speech") {
@@ -213,12 +253,28 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		c.Set("channel_organization", *channel.OpenAIOrganization)
 	}
 	c.Set("auto_ban", channel.GetAutoBan())
+	c.Set("channel_limits", channel.GetLimits())
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	var key, fingerprint string
+	preferred, ok := "", false
+	if c.GetInt("affinity_channel_id") == channel.Id {
+		preferred, ok = channel.GetEnabledKey(c.GetString("affinity_channel_key"), c.GetStringSlice("use_channel_key"))
+	}
+	if ok {
+		key, fingerprint = preferred, c.GetString("affinity_channel_key")
+	} else {
+		key, fingerprint = channel.SelectKey(c.GetStringSlice("use_channel_key"))
+	}
+	c.Set("channel_key", fingerprint)
+	if fingerprint != "" {
+		c.Set("use_channel_key", append(c.GetStringSlice("use_channel_key"), fingerprint))
+	}
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set("base_url", channel.GetBaseURL())
 	c.Set("headers", channel.GetHeaders())
 	c.Set("proxy", channel.GetProxy())
+	c.Set("param_override", channel.GetParamOverride())
 	// TODO: api_version统一
 	switch channel.Type {
 	case common.ChannelTypeAzure:
@@ -42,7 +42,18 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
+// getAbilityModels returns the model with the model patterns of the group matching it
+func getAbilityModels(group string, model string) []string {
+	models := []string{model}
+	for _, groupModel := range GetGroupModels(group) {
+		if groupModel != model && common.IsModelPattern(groupModel) && common.MatchModelPattern(groupModel, model) {
+			models = append(models, groupModel)
+		}
+	}
+	return models
+}
+
+func getPriority(group string, models []string, retry int) (int, error) {
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
@@ -53,7 +64,7 @@ func getPriority(group string, model string, retry int) (int, error) {
 	var priorities []int
 	err := DB.Model(&Ability{}).
 		Select("DISTINCT(priority)").
-		Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model).
+		Where(groupCol+" = ? and model IN ? and enabled = "+trueVal, group, models).
 		Order("priority DESC").              // 按优先级降序排序
 		Pluck("priority", &priorities).Error // Pluck用于将查询的结果直接扫描到一个切片中
 
@@ -78,32 +89,32 @@ func getPriority(group string, model string, retry int) (int, error) {
 	return priorityToUse, nil
 }
 
-func getChannelQuery(group string, model string, retry int) *gorm.DB {
+func getChannelQuery(group string, models []string, retry int) *gorm.DB {
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
 		groupCol = `"group"`
 		trueVal = "true"
 	}
-	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-	channelQuery := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
+	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model IN ? and enabled = "+trueVal, group, models)
+	channelQuery := DB.Where(groupCol+" = ? and model IN ? and enabled = "+trueVal+" and priority = (?)", group, models, maxPrioritySubQuery)
 	if retry != 0 {
-		priority, err := getPriority(group, model, retry)
+		priority, err := getPriority(group, models, retry)
 		if err != nil {
 			common.SysError(fmt.Sprintf("Get priority failed: %s", err.Error()))
 		} else {
-			channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = ?", group, model, priority)
+			channelQuery = DB.Where(groupCol+" = ? and model IN ? and enabled = "+trueVal+" and priority = ?", group, models, priority)
 		}
 	}
 
 	return channelQuery
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+func GetRandomSatisfiedChannel(group string, model string, retry int, excluded []int) (*Channel, error) {
 	var abilities []Ability
 
 	var err error = nil
-	channelQuery := getChannelQuery(group, model, retry)
+	channelQuery := getChannelQuery(group, getAbilityModels(group, model), retry)
 	if common.UsingSQLite || common.UsingPostgreSQL {
 		err = channelQuery.Order("weight DESC").Find(&abilities).Error
 	} else {
@@ -112,23 +123,67 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	if err != nil {
 		return nil, err
 	}
+	// a channel serving the model by name and by a pattern has an ability for each
+	abilities = lo.UniqBy(abilities, func(ability_ Ability) int {
+		return ability_.ChannelId
+	})
+	if len(excluded) > 0 {
+		abilities = lo.Filter(abilities, func(ability_ Ability, _ int) bool {
+			return !lo.Contains(excluded, ability_.ChannelId)
+		})
+	}
+	if common.CircuitBreakerEnabled && len(abilities) > 0 {
+		channelIds := make([]int, 0, len(abilities))
+		for _, ability_ := range abilities {
+			channelIds = append(channelIds, ability_.ChannelId)
+		}
+		blocked := openChannelBreakers(channelIds, model)
+		if len(blocked) > 0 {
+			available := make([]Ability, 0, len(abilities))
+			for _, ability_ := range abilities {
+				if !blocked[ability_.ChannelId] {
+					available = append(available, ability_)
+				}
+			}
+			if len(available) == 0 {
+				return nil, errors.New("all channels are circuit broken")
+			}
+			abilities = available
+		}
+	}
 	channel := Channel{}
 	if len(abilities) > 0 {
-		// Randomly choose one
-		weightSum := uint(0)
+		candidates := make([]channelCandidate, 0, len(abilities))
 		for _, ability_ := range abilities {
-			weightSum += ability_.Weight + 10
+			candidates = append(candidates, channelCandidate{
+				Id:     ability_.ChannelId,
+				Weight: int(ability_.Weight),
+			})
 		}
-		// Randomly choose one
-		weight := common.GetRandomInt(int(weightSum))
-		for _, ability_ := range abilities {
-			weight -= int(ability_.Weight) + 10
-			//log.Printf("weight: %d, ability weight: %d", weight, *ability_.Weight)
-			if weight <= 0 {
-				channel.Id = ability_.ChannelId
-				break
+		// the limits and response times are only on the channels
+		var channels []*Channel
+		channelIds := make([]int, 0, len(candidates))
+		for _, candidate := range candidates {
+			channelIds = append(channelIds, candidate.Id)
+		}
+		err = DB.Select("id", "response_time", "max_concurrency", "rpm_limit", "tpm_limit").Where("id IN ?", channelIds).Find(&channels).Error
+		if err == nil {
+			available := make(map[int]*Channel, len(channels))
+			for _, c := range skipSaturatedChannels(channels) {
+				available[c.Id] = c
+			}
+			filtered := make([]channelCandidate, 0, len(candidates))
+			for _, candidate := range candidates {
+				if c, ok := available[candidate.Id]; ok {
+					candidate.ResponseTime = c.ResponseTime
+					filtered = append(filtered, candidate)
+				}
+			}
+			if len(filtered) > 0 {
+				candidates = filtered
 			}
 		}
+		channel.Id = selectChannelCandidate(group, model, candidates)
 	} else {
 		return nil, errors.New("channel not found")
 	}
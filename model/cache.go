@@ -4,13 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
 	"one-api/common"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/samber/lo"
 )
 
 var (
@@ -205,6 +206,26 @@ func CacheIsUserEnabled(userId int) (bool, error) {
 	return userEnabled, err
 }
 
+func CacheGetUserSpendLimits(userId int) (limits SpendLimits, err error) {
+	if !common.RedisEnabled {
+		return GetUserSpendLimits(userId)
+	}
+	value, err := common.RedisGet(fmt.Sprintf("user_spend_limits:%d", userId))
+	if err == nil && json.Unmarshal([]byte(value), &limits) == nil {
+		return limits, nil
+	}
+	limits, err = GetUserSpendLimits(userId)
+	if err != nil {
+		return limits, err
+	}
+	jsonBytes, _ := json.Marshal(limits)
+	err = common.RedisSet(fmt.Sprintf("user_spend_limits:%d", userId), string(jsonBytes), time.Duration(UserId2StatusCacheSeconds)*time.Second)
+	if err != nil {
+		common.SysError("Redis set user spend limits error: " + err.Error())
+	}
+	return limits, nil
+}
+
 func CacheIsLinuxDoEnabled(userId int) (bool, error) {
 	if !common.RedisEnabled {
 		return IsLinuxDoEnabled(userId)
@@ -230,6 +251,7 @@ func CacheIsLinuxDoEnabled(userId int) (bool, error) {
 }
 
 var group2model2channels map[string]map[string][]*Channel
+var group2modelPatterns map[string][]string
 var channelsIDM map[int]*Channel
 var channelSyncLock sync.RWMutex
 
@@ -266,8 +288,12 @@ func InitChannelCache() {
 	}
 
 	// sort by priority
+	newGroup2modelPatterns := make(map[string][]string)
 	for group, model2channels := range newGroup2model2channels {
 		for model, channels := range model2channels {
+			if common.IsModelPattern(model) {
+				newGroup2modelPatterns[group] = append(newGroup2modelPatterns[group], model)
+			}
 			sort.Slice(channels, func(i, j int) bool {
 				return channels[i].GetPriority() > channels[j].GetPriority()
 			})
@@ -277,6 +303,7 @@ func InitChannelCache() {
 
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
+	group2modelPatterns = newGroup2modelPatterns
 	channelsIDM = newChannelsIDM
 	channelSyncLock.Unlock()
 	common.SysLog("channels synced from database")
@@ -291,6 +318,11 @@ func SyncChannelCache(frequency int) {
 }
 
 func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+	return CacheGetRandomSatisfiedChannelExcept(group, model, retry, nil)
+}
+
+// CacheGetRandomSatisfiedChannelExcept selects a channel other than the excluded ones
+func CacheGetRandomSatisfiedChannelExcept(group string, model string, retry int, excluded []int) (*Channel, error) {
 	if strings.HasPrefix(model, "gpt-4-gizmo") {
 		model = "gpt-4-gizmo-*"
 	} else if strings.HasPrefix(model, "g-") {
@@ -299,14 +331,46 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannel(group, model, retry)
+		return GetRandomSatisfiedChannel(group, model, retry, excluded)
 	}
+	// the breakers and the limits may be in redis, they are only asked once the cache is released. The channels
+	// are copied since the cached slices are updated in place when a key changes status.
 	channelSyncLock.RLock()
-	defer channelSyncLock.RUnlock()
-	channels := group2model2channels[group][model]
+	channels := append([]*Channel(nil), cacheGetModelChannels(group, model)...)
+	channelSyncLock.RUnlock()
+	if len(excluded) > 0 {
+		available := make([]*Channel, 0, len(channels))
+		for _, channel := range channels {
+			if !lo.Contains(excluded, channel.Id) {
+				available = append(available, channel)
+			}
+		}
+		channels = available
+	}
 	if len(channels) == 0 {
 		return nil, errors.New("channel not found")
 	}
+	if common.CircuitBreakerEnabled {
+		channelIds := make([]int, 0, len(channels))
+		for _, channel := range channels {
+			channelIds = append(channelIds, channel.Id)
+		}
+		blocked := openChannelBreakers(channelIds, model)
+		if len(blocked) > 0 {
+			available := make([]*Channel, 0, len(channels))
+			for _, channel := range channels {
+				if !blocked[channel.Id] {
+					available = append(available, channel)
+				}
+			}
+			if len(available) == 0 {
+				return nil, errors.New("all channels are circuit broken")
+			}
+			channels = available
+		}
+	}
+
+	channels = skipSaturatedChannels(channels)
 
 	uniquePriorities := make(map[int]bool)
 	for _, channel := range channels {
@@ -331,20 +395,17 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 		}
 	}
 
-	// 平滑系数
-	smoothingFactor := 10
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := 0
+	candidates := make([]channelCandidate, 0, len(targetChannels))
 	for _, channel := range targetChannels {
-		totalWeight += channel.GetWeight() + smoothingFactor
+		candidates = append(candidates, channelCandidate{
+			Id:           channel.Id,
+			Weight:       channel.GetWeight(),
+			ResponseTime: channel.ResponseTime,
+		})
 	}
-	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
+	channelId := selectChannelCandidate(group, model, candidates)
 	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight() + smoothingFactor
-		if randomWeight < 0 {
+		if channel.Id == channelId {
 			return channel, nil
 		}
 	}
@@ -352,6 +413,61 @@ func CacheGetRandomSatisfiedChannel(group string, model string, retry int) (*Cha
 	return nil, errors.New("channel not found")
 }
 
+// cacheGetModelChannels returns the channels of the group serving the model by name or by a model pattern, the
+// cached slices are never appended to
+func cacheGetModelChannels(group string, model string) []*Channel {
+	channels := group2model2channels[group][model]
+	var merged []*Channel
+	seen := make(map[int]bool)
+	for _, pattern := range group2modelPatterns[group] {
+		if pattern == model || !common.MatchModelPattern(pattern, model) {
+			continue
+		}
+		if merged == nil {
+			merged = append(merged, channels...)
+			for _, channel := range channels {
+				seen[channel.Id] = true
+			}
+		}
+		for _, channel := range group2model2channels[group][pattern] {
+			if !seen[channel.Id] {
+				seen[channel.Id] = true
+				merged = append(merged, channel)
+			}
+		}
+	}
+	if merged == nil {
+		return channels
+	}
+	return merged
+}
+
+// cacheUpdateChannelKeyStatus replaces the cached channel with a copy holding the new key statuses, so readers
+// that already got the channel never see it change
+func cacheUpdateChannelKeyStatus(id int, keyStatus string) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	channel, ok := channelsIDM[id]
+	if !ok {
+		return
+	}
+	updated := *channel
+	updated.KeyStatus = keyStatus
+	channelsIDM[id] = &updated
+	for _, model2channels := range group2model2channels {
+		for _, channels := range model2channels {
+			for i := range channels {
+				if channels[i] == channel {
+					channels[i] = &updated
+				}
+			}
+		}
+	}
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
@@ -36,6 +36,12 @@ type Channel struct {
 	OtherInfo                    string  `json:"other_info"`
 	Headers                      *string `json:"headers" gorm:"type:varchar(1024);default:''"`
 	Proxy                        *string `json:"proxy" gorm:"type:varchar(1024);default:''"`
+	ParamOverride                *string `json:"param_override" gorm:"type:text"`             // rules changing the outgoing request body
+	KeyMode                      string  `json:"key_mode" gorm:"type:varchar(32);default:''"` // empty for a single key, otherwise one key per line
+	KeyStatus                    string  `json:"key_status" gorm:"type:text"`
+	MaxConcurrency               *int    `json:"max_concurrency" gorm:"default:0"`
+	RPMLimit                     *int    `json:"rpm_limit" gorm:"default:0"`
+	TPMLimit                     *int    `json:"tpm_limit" gorm:"default:0"`
 	// MaxInputTokens     		 	 *int    `json:"max_input_tokens" gorm:"default:0"`
 }
 
@@ -226,6 +232,13 @@ func (channel *Channel) GetHeaders() string {
 	return *channel.Headers
 }
 
+func (channel *Channel) GetParamOverride() string {
+	if channel.ParamOverride == nil {
+		return ""
+	}
+	return *channel.ParamOverride
+}
+
 func (channel *Channel) GetProxy() string {
 	if channel.Proxy == nil {
 		return ""
@@ -249,6 +262,13 @@ func (channel *Channel) Update() error {
 	if err != nil {
 		return err
 	}
+	if channel.KeyMode == "" {
+		// Updates skips zero values, leaving the multi-key mode has to be written on its own
+		err = DB.Model(channel).Update("key_mode", "").Error
+		if err != nil {
+			return err
+		}
+	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	err = channel.UpdateAbilities()
 	return err
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ChannelAffinity is the channel, and key of a multi-key channel, a conversation was last served by
+type ChannelAffinity struct {
+	ChannelId int
+	Key       string // fingerprint of the key, empty for single key channels
+}
+
+type memoryChannelAffinity struct {
+	ChannelAffinity
+	expiresAt time.Time
+}
+
+var (
+	memoryChannelAffinities     = make(map[string]*memoryChannelAffinity)
+	memoryChannelAffinitiesLock sync.Mutex
+	memoryChannelAffinitiesGC   time.Time
+)
+
+const redisChannelAffinityPrefix = "channel_affinity:"
+
+func GetChannelAffinity(key string) (*ChannelAffinity, bool) {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(redisChannelAffinityPrefix + key)
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				common.SysError("failed to get channel affinity: " + err.Error())
+			}
+			return nil, false
+		}
+		id, fingerprint, _ := strings.Cut(value, ":")
+		channelId, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, false
+		}
+		return &ChannelAffinity{ChannelId: channelId, Key: fingerprint}, true
+	}
+	memoryChannelAffinitiesLock.Lock()
+	defer memoryChannelAffinitiesLock.Unlock()
+	affinity, ok := memoryChannelAffinities[key]
+	if !ok || time.Now().After(affinity.expiresAt) {
+		return nil, false
+	}
+	copied := affinity.ChannelAffinity
+	return &copied, true
+}
+
+// SetChannelAffinity remembers the channel that served a conversation, every request extends the ttl
+func SetChannelAffinity(key string, channelId int, channelKey string) {
+	if common.ChannelAffinityTTL <= 0 {
+		return
+	}
+	ttl := time.Duration(common.ChannelAffinityTTL) * time.Second
+	if common.RedisEnabled {
+		err := common.RedisSet(redisChannelAffinityPrefix+key, fmt.Sprintf("%d:%s", channelId, channelKey), ttl)
+		if err != nil {
+			common.SysError("failed to set channel affinity: " + err.Error())
+		}
+		return
+	}
+	memoryChannelAffinitiesLock.Lock()
+	defer memoryChannelAffinitiesLock.Unlock()
+	now := time.Now()
+	memoryChannelAffinities[key] = &memoryChannelAffinity{
+		ChannelAffinity: ChannelAffinity{ChannelId: channelId, Key: channelKey},
+		expiresAt:       now.Add(ttl),
+	}
+	// sweep expired conversations once per ttl
+	if now.Sub(memoryChannelAffinitiesGC) > ttl {
+		memoryChannelAffinitiesGC = now
+		for k, affinity := range memoryChannelAffinities {
+			if now.After(affinity.expiresAt) {
+				delete(memoryChannelAffinities, k)
+			}
+		}
+	}
+}
+
+// CacheGetAffinityChannel returns the preferred channel if it can still serve the group and model: it must be
+// enabled, its circuit closed and it must be below its limits. Otherwise normal selection takes over.
+func CacheGetAffinityChannel(group string, model string, channelId int) (*Channel, bool) {
+	channel, err := CacheGetChannel(channelId)
+	if err != nil || channel.Status != common.ChannelStatusEnabled {
+		return nil, false
+	}
+	servesGroup := false
+	for _, g := range strings.Split(channel.Group, ",") {
+		if g == group {
+			servesGroup = true
+			break
+		}
+	}
+	servesModel := false
+	for _, m := range channel.GetModels() {
+		if common.MatchModelPattern(m, model) {
+			servesModel = true
+			break
+		}
+	}
+	if !servesGroup || !servesModel {
+		return nil, false
+	}
+	if openChannelBreakers([]int{channel.Id}, model)[channel.Id] {
+		return nil, false
+	}
+	if limits := channel.GetLimits(); !limits.IsZero() && saturatedChannels(map[int]ChannelLimits{channel.Id: limits})[channel.Id] {
+		return nil, false
+	}
+	return channel, true
+}
@@ -0,0 +1,502 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	BreakerStateClosed   = "closed"
+	BreakerStateOpen     = "open"
+	BreakerStateHalfOpen = "half_open"
+)
+
+// ChannelBreaker is the circuit breaker state of a channel, or of one model on a channel when Model is set.
+// A closed circuit counts failures in a sliding window and opens once too many of them fail, an open circuit
+// rejects the channel until the cooldown ends, then it is half-open and lets a few live requests through:
+// if all of them succeed the circuit closes again, a single failure opens it for another cooldown.
+type ChannelBreaker struct {
+	ChannelId           int    `json:"channel_id"`
+	Model               string `json:"model,omitempty"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	WindowStart         int64  `json:"window_start"`
+	WindowRequests      int    `json:"window_requests"`
+	WindowFailures      int    `json:"window_failures"`
+	OpenedAt            int64  `json:"opened_at,omitempty"`
+	ProbeAt             int64  `json:"probe_at,omitempty"`
+	Probes              int    `json:"probes,omitempty"`
+	ProbeSuccesses      int    `json:"probe_successes,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+	UpdatedAt           int64  `json:"updated_at"`
+}
+
+// available reports whether a request may be sent, without reserving a half-open probe
+func (b *ChannelBreaker) available(now int64) bool {
+	switch b.State {
+	case BreakerStateOpen:
+		return now >= b.OpenedAt+int64(common.CircuitBreakerCooldown)
+	case BreakerStateHalfOpen:
+		// probes whose result never came back are given up after a cooldown
+		return b.Probes < common.CircuitBreakerHalfOpenRequests || now >= b.ProbeAt+int64(common.CircuitBreakerCooldown)
+	}
+	return true
+}
+
+func (b *ChannelBreaker) acquire(now int64) {
+	if b.State == BreakerStateOpen && b.available(now) {
+		b.State = BreakerStateHalfOpen
+		b.ProbeAt = now
+		b.Probes = 0
+		b.ProbeSuccesses = 0
+	} else if b.State == BreakerStateHalfOpen && b.Probes >= common.CircuitBreakerHalfOpenRequests && b.available(now) {
+		b.ProbeAt = now
+		b.Probes = 0
+		b.ProbeSuccesses = 0
+	}
+	if b.State == BreakerStateHalfOpen {
+		b.Probes++
+	}
+}
+
+func (b *ChannelBreaker) resetWindow(now int64) {
+	if now-b.WindowStart >= int64(common.CircuitBreakerWindow) {
+		b.WindowStart = now
+		b.WindowRequests = 0
+		b.WindowFailures = 0
+	}
+}
+
+func (b *ChannelBreaker) close(now int64) {
+	b.State = BreakerStateClosed
+	b.ConsecutiveFailures = 0
+	b.WindowStart = now
+	b.WindowRequests = 0
+	b.WindowFailures = 0
+	b.OpenedAt = 0
+	b.ProbeAt = 0
+	b.Probes = 0
+	b.ProbeSuccesses = 0
+}
+
+func (b *ChannelBreaker) open(now int64) {
+	b.State = BreakerStateOpen
+	b.OpenedAt = now
+	b.Probes = 0
+	b.ProbeSuccesses = 0
+}
+
+func (b *ChannelBreaker) success(now int64) {
+	switch b.State {
+	case BreakerStateHalfOpen:
+		b.ProbeSuccesses++
+		if b.ProbeSuccesses >= common.CircuitBreakerHalfOpenRequests {
+			b.close(now)
+		}
+	case BreakerStateClosed, "":
+		b.State = BreakerStateClosed
+		b.resetWindow(now)
+		b.ConsecutiveFailures = 0
+		b.WindowRequests++
+	}
+}
+
+func (b *ChannelBreaker) failure(now int64, message string) {
+	b.LastError = message
+	switch b.State {
+	case BreakerStateHalfOpen:
+		b.open(now)
+	case BreakerStateClosed, "":
+		b.State = BreakerStateClosed
+		b.resetWindow(now)
+		b.ConsecutiveFailures++
+		b.WindowRequests++
+		b.WindowFailures++
+		if common.CircuitBreakerFailureThreshold > 0 && b.ConsecutiveFailures >= common.CircuitBreakerFailureThreshold {
+			b.open(now)
+		} else if common.CircuitBreakerErrorRate > 0 && b.WindowRequests >= common.CircuitBreakerMinRequests &&
+			float64(b.WindowFailures)/float64(b.WindowRequests) >= common.CircuitBreakerErrorRate {
+			b.open(now)
+		}
+	}
+}
+
+// breakerStore keeps breaker states, in memory for a single instance or in Redis to share them between instances
+type breakerStore interface {
+	// update applies fn to the stored state atomically, a missing state is passed in as a new closed one
+	update(key string, fn func(b *ChannelBreaker)) error
+	// acquire checks that every breaker lets a request through and counts it as a probe of the half-open ones,
+	// in one atomic step so that concurrent requests cannot exceed the probes
+	acquire(keys []string, now int64) (bool, error)
+	getMany(keys []string) (map[string]*ChannelBreaker, error)
+	list() ([]*ChannelBreaker, error)
+	delete(channelId int) error
+}
+
+func getBreakerStore() breakerStore {
+	if common.RedisEnabled {
+		return redisBreakerStore{}
+	}
+	return memoryBreakers
+}
+
+func breakerKey(channelId int, model string) string {
+	if model == "" {
+		return strconv.Itoa(channelId)
+	}
+	return fmt.Sprintf("%d:%s", channelId, model)
+}
+
+func newChannelBreaker(key string) *ChannelBreaker {
+	b := &ChannelBreaker{State: BreakerStateClosed}
+	id, model, _ := strings.Cut(key, ":")
+	b.ChannelId, _ = strconv.Atoi(id)
+	b.Model = model
+	return b
+}
+
+type memoryBreakerStore struct {
+	mutex    sync.Mutex
+	breakers map[string]*ChannelBreaker
+}
+
+var memoryBreakers = &memoryBreakerStore{breakers: make(map[string]*ChannelBreaker)}
+
+func (s *memoryBreakerStore) update(key string, fn func(b *ChannelBreaker)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b, ok := s.breakers[key]
+	if !ok {
+		b = newChannelBreaker(key)
+		s.breakers[key] = b
+	}
+	fn(b)
+	b.UpdatedAt = time.Now().Unix()
+	return nil
+}
+
+func (s *memoryBreakerStore) acquire(keys []string, now int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	breakers := make([]*ChannelBreaker, 0, len(keys))
+	for _, key := range keys {
+		if b, ok := s.breakers[key]; ok {
+			if !b.available(now) {
+				return false, nil
+			}
+			breakers = append(breakers, b)
+		}
+	}
+	for _, b := range breakers {
+		if b.State != BreakerStateClosed {
+			b.acquire(now)
+			b.UpdatedAt = now
+		}
+	}
+	return true, nil
+}
+
+func (s *memoryBreakerStore) getMany(keys []string) (map[string]*ChannelBreaker, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make(map[string]*ChannelBreaker, len(keys))
+	for _, key := range keys {
+		if b, ok := s.breakers[key]; ok {
+			copied := *b
+			result[key] = &copied
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryBreakerStore) list() ([]*ChannelBreaker, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make([]*ChannelBreaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		copied := *b
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (s *memoryBreakerStore) delete(channelId int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, b := range s.breakers {
+		if b.ChannelId == channelId {
+			delete(s.breakers, key)
+		}
+	}
+	return nil
+}
+
+const redisBreakerPrefix = "channel_breaker:"
+
+// redisBreakerAcquireScript is ChannelBreaker.available and ChannelBreaker.acquire over the JSON values
+var redisBreakerAcquireScript = redis.NewScript(`
+local now, cooldown, probes, expiration = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local breakers = {}
+for i, key in ipairs(KEYS) do
+	local data = redis.call('GET', key)
+	if data then
+		local b = cjson.decode(data)
+		if b.state == 'open' and now < (b.opened_at or 0) + cooldown then return 0 end
+		if b.state == 'half_open' and (b.probes or 0) >= probes and now < (b.probe_at or 0) + cooldown then return 0 end
+		breakers[i] = b
+	end
+end
+for i, b in pairs(breakers) do
+	if b.state == 'open' or (b.state == 'half_open' and (b.probes or 0) >= probes) then
+		b.state = 'half_open'
+		b.probe_at = now
+		b.probes = 0
+		b.probe_successes = 0
+	end
+	if b.state == 'half_open' then
+		b.probes = b.probes + 1
+		b.updated_at = now
+		redis.call('SET', KEYS[i], cjson.encode(b), 'EX', expiration)
+	end
+end
+return 1
+`)
+
+// redisBreakerStore keeps one JSON value per breaker, updates use optimistic transactions and acquisitions a lua script
+type redisBreakerStore struct{}
+
+func (redisBreakerStore) expiration() time.Duration {
+	// a state untouched for this long is equivalent to a fresh closed one
+	return time.Duration(common.CircuitBreakerWindow+common.CircuitBreakerCooldown)*time.Second + time.Hour
+}
+
+func (s redisBreakerStore) update(key string, fn func(b *ChannelBreaker)) error {
+	ctx := context.Background()
+	redisKey := redisBreakerPrefix + key
+	txf := func(tx *redis.Tx) error {
+		b := newChannelBreaker(key)
+		data, err := tx.Get(ctx, redisKey).Bytes()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if err == nil {
+			if err = json.Unmarshal(data, b); err != nil {
+				b = newChannelBreaker(key)
+			}
+		}
+		fn(b)
+		b.UpdatedAt = time.Now().Unix()
+		data, err = json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, redisKey, data, s.expiration())
+			return nil
+		})
+		return err
+	}
+	var err error
+	for i := 0; i < 5; i++ {
+		err = common.RDB.Watch(ctx, txf, redisKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return err
+}
+
+func (s redisBreakerStore) acquire(keys []string, now int64) (bool, error) {
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = redisBreakerPrefix + key
+	}
+	result, err := redisBreakerAcquireScript.Run(context.Background(), common.RDB, redisKeys, now,
+		common.CircuitBreakerCooldown, common.CircuitBreakerHalfOpenRequests, int(s.expiration().Seconds())).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func (redisBreakerStore) getMany(keys []string) (map[string]*ChannelBreaker, error) {
+	result := make(map[string]*ChannelBreaker, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = redisBreakerPrefix + key
+	}
+	values, err := common.RDB.MGet(context.Background(), redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		b := &ChannelBreaker{}
+		if json.Unmarshal([]byte(data), b) == nil {
+			result[keys[i]] = b
+		}
+	}
+	return result, nil
+}
+
+func (s redisBreakerStore) scan(pattern string) ([]string, error) {
+	ctx := context.Background()
+	var keys []string
+	iter := common.RDB.Scan(ctx, 0, redisBreakerPrefix+pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), redisBreakerPrefix))
+	}
+	return keys, iter.Err()
+}
+
+func (s redisBreakerStore) list() ([]*ChannelBreaker, error) {
+	keys, err := s.scan("*")
+	if err != nil {
+		return nil, err
+	}
+	breakers, err := s.getMany(keys)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ChannelBreaker, 0, len(breakers))
+	for _, b := range breakers {
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+func (s redisBreakerStore) delete(channelId int) error {
+	keys, err := s.scan(strconv.Itoa(channelId) + ":*")
+	if err != nil {
+		return err
+	}
+	redisKeys := []string{redisBreakerPrefix + strconv.Itoa(channelId)}
+	for _, key := range keys {
+		redisKeys = append(redisKeys, redisBreakerPrefix+key)
+	}
+	return common.RDB.Del(context.Background(), redisKeys...).Err()
+}
+
+// openChannelBreakers returns the channels whose circuit is open for the model, the store is asked once
+// for all candidates. Errors of the store never block a channel.
+func openChannelBreakers(channelIds []int, model string) map[int]bool {
+	blocked := make(map[int]bool)
+	if !common.CircuitBreakerEnabled || len(channelIds) == 0 {
+		return blocked
+	}
+	keys := make([]string, 0, len(channelIds)*2)
+	for _, id := range channelIds {
+		keys = append(keys, breakerKey(id, ""), breakerKey(id, model))
+	}
+	breakers, err := getBreakerStore().getMany(keys)
+	if err != nil {
+		common.SysError("failed to get channel breakers: " + err.Error())
+		return blocked
+	}
+	now := time.Now().Unix()
+	for _, b := range breakers {
+		if !b.available(now) {
+			blocked[b.ChannelId] = true
+		}
+	}
+	return blocked
+}
+
+// AcquireChannelBreaker is called right before a request is sent to the channel, a half-open circuit counts it as
+// a probe. Selecting a channel does not count, since the selection may still be discarded. It is false when the
+// circuit opened or its probes were taken since the channel was selected. Errors of the store never block a channel.
+func AcquireChannelBreaker(channelId int, model string) bool {
+	if !common.CircuitBreakerEnabled {
+		return true
+	}
+	ok, err := getBreakerStore().acquire([]string{breakerKey(channelId, ""), breakerKey(channelId, model)}, time.Now().Unix())
+	if err != nil {
+		common.SysError("failed to acquire channel breaker: " + err.Error())
+		return true
+	}
+	return ok
+}
+
+func recordChannelBreaker(channelId int, model string, fn func(b *ChannelBreaker, now int64)) {
+	if !common.CircuitBreakerEnabled {
+		return
+	}
+	now := time.Now().Unix()
+	for _, key := range []string{breakerKey(channelId, ""), breakerKey(channelId, model)} {
+		var before, after string
+		err := getBreakerStore().update(key, func(b *ChannelBreaker) {
+			before = b.State
+			fn(b, now)
+			after = b.State
+		})
+		if err != nil {
+			common.SysError("failed to update channel breaker: " + err.Error())
+			continue
+		}
+		if before != after {
+			common.SysLog(fmt.Sprintf("channel breaker %s changed from %s to %s", key, before, after))
+		}
+	}
+}
+
+// RecordChannelSuccess feeds a successful relay into the channel and channel+model breakers
+func RecordChannelSuccess(channelId int, model string) {
+	recordChannelBreaker(channelId, model, func(b *ChannelBreaker, now int64) {
+		b.success(now)
+	})
+}
+
+// RecordChannelFailure feeds a failed relay into the channel and channel+model breakers
+func RecordChannelFailure(channelId int, model string, message string) {
+	recordChannelBreaker(channelId, model, func(b *ChannelBreaker, now int64) {
+		b.failure(now, message)
+	})
+}
+
+// GetChannelBreakers lists the breaker states of one channel, or of all channels when channelId is 0
+func GetChannelBreakers(channelId int) ([]*ChannelBreaker, error) {
+	breakers, err := getBreakerStore().list()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*ChannelBreaker, 0, len(breakers))
+	now := time.Now().Unix()
+	for _, b := range breakers {
+		if channelId != 0 && b.ChannelId != channelId {
+			continue
+		}
+		// report the state the next request would see
+		if b.State == BreakerStateOpen && b.available(now) {
+			b.State = BreakerStateHalfOpen
+		}
+		result = append(result, b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ChannelId != result[j].ChannelId {
+			return result[i].ChannelId < result[j].ChannelId
+		}
+		return result[i].Model < result[j].Model
+	})
+	return result, nil
+}
+
+// ResetChannelBreaker closes every circuit of a channel
+func ResetChannelBreaker(channelId int) error {
+	return getBreakerStore().delete(channelId)
+}
@@ -0,0 +1,282 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"one-api/common"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ChannelHealthSourceManualTest = "manual_test"
+	ChannelHealthSourceAutoTest   = "auto_test"
+	ChannelHealthSourceRelay      = "relay"
+)
+
+const (
+	// channelHealthInterval is how often the relay outcomes of each channel are saved as one row
+	channelHealthInterval = 5 * time.Minute
+	// channelHealthSamples is how many latencies of an interval are kept, sampled uniformly from its requests
+	channelHealthSamples = 20
+)
+
+// ChannelHealth is a test of a channel, or the relay outcomes of a channel on this instance over an interval
+type ChannelHealth struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index:idx_channel_health,priority:1"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index:idx_channel_health,priority:2;index:idx_channel_health_created_at"`
+	Source       string `json:"source" gorm:"size:16"`
+	Success      bool   `json:"success"`                              // of a test
+	ResponseTime int64  `json:"response_time"`                        // of a test, in milliseconds
+	Requests     int    `json:"requests"`                             // relayed in the interval
+	Failures     int    `json:"failures"`                             // failures of the channel among the requests
+	Latencies    string `json:"latencies,omitempty" gorm:"type:text"` // JSON array of sampled latencies in milliseconds
+	Message      string `json:"message,omitempty" gorm:"type:text"`
+}
+
+// RecordChannelTest saves the result of a manual or automatic test, err is nil when the test passed
+func RecordChannelTest(channelId int, source string, responseTime int64, err error) {
+	health := &ChannelHealth{
+		ChannelId:    channelId,
+		CreatedAt:    common.GetTimestamp(),
+		Source:       source,
+		Success:      err == nil,
+		ResponseTime: responseTime,
+	}
+	if err != nil {
+		health.Message = err.Error()
+	}
+	if err := DB.Create(health).Error; err != nil {
+		common.SysError("failed to record channel test: " + err.Error())
+	}
+}
+
+type channelHealthAggregate struct {
+	requests  int
+	failures  int
+	latencies []int64
+	sampled   int // successful requests offered to the latency sample
+}
+
+var (
+	channelHealthAggregates     = make(map[int]*channelHealthAggregate)
+	channelHealthAggregatesLock sync.Mutex
+)
+
+// sampleChannelHealth counts a relayed request of the channel, its latency is kept by reservoir sampling
+func sampleChannelHealth(channelId int, latency time.Duration, success bool) {
+	channelHealthAggregatesLock.Lock()
+	defer channelHealthAggregatesLock.Unlock()
+	aggregate, ok := channelHealthAggregates[channelId]
+	if !ok {
+		aggregate = &channelHealthAggregate{}
+		channelHealthAggregates[channelId] = aggregate
+	}
+	aggregate.requests++
+	if !success {
+		aggregate.failures++
+		return
+	}
+	if latency <= 0 {
+		return
+	}
+	aggregate.sampled++
+	if len(aggregate.latencies) < channelHealthSamples {
+		aggregate.latencies = append(aggregate.latencies, latency.Milliseconds())
+	} else if i := common.GetRandomInt(aggregate.sampled); i < channelHealthSamples {
+		aggregate.latencies[i] = latency.Milliseconds()
+	}
+}
+
+// SaveChannelHealthCache saves the relay outcomes collected since the last call
+func SaveChannelHealthCache() {
+	channelHealthAggregatesLock.Lock()
+	aggregates := channelHealthAggregates
+	channelHealthAggregates = make(map[int]*channelHealthAggregate)
+	channelHealthAggregatesLock.Unlock()
+	if len(aggregates) == 0 {
+		return
+	}
+	now := common.GetTimestamp()
+	healths := make([]*ChannelHealth, 0, len(aggregates))
+	for channelId, aggregate := range aggregates {
+		latencies, _ := json.Marshal(aggregate.latencies)
+		healths = append(healths, &ChannelHealth{
+			ChannelId: channelId,
+			CreatedAt: now,
+			Source:    ChannelHealthSourceRelay,
+			Success:   aggregate.failures == 0,
+			Requests:  aggregate.requests,
+			Failures:  aggregate.failures,
+			Latencies: string(latencies),
+		})
+	}
+	if err := DB.Create(&healths).Error; err != nil {
+		common.SysError("failed to save channel health: " + err.Error())
+	}
+}
+
+func DeleteChannelHealthBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&ChannelHealth{})
+	return result.RowsAffected, result.Error
+}
+
+// UpdateChannelHealth saves the relay outcomes periodically, the master node also removes the rows past retention
+func UpdateChannelHealth() {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysLog(fmt.Sprintf("UpdateChannelHealth panic: %s", r))
+		}
+	}()
+	for {
+		time.Sleep(channelHealthInterval)
+		SaveChannelHealthCache()
+		if common.IsMasterNode && common.ChannelHealthRetentionDays > 0 {
+			before := time.Now().AddDate(0, 0, -common.ChannelHealthRetentionDays).Unix()
+			if _, err := DeleteChannelHealthBefore(before); err != nil {
+				common.SysError("failed to delete channel health: " + err.Error())
+			}
+		}
+	}
+}
+
+// ChannelHealthPoint sums the health of a channel over a bucket of the timeline
+type ChannelHealthPoint struct {
+	Time         int64 `json:"time"` // start of the bucket
+	Tests        int   `json:"tests"`
+	TestFailures int   `json:"test_failures"`
+	Requests     int   `json:"requests"`
+	Failures     int   `json:"failures"`
+	Latency      int64 `json:"latency"` // median, in milliseconds
+}
+
+// ChannelHealthReport is the health of a channel over a window. Uptime is the share of passed tests, or of
+// successful requests when the channel was not tested in the window. Latencies come from the sampled relay
+// requests, or from the passed tests when nothing was relayed.
+type ChannelHealthReport struct {
+	ChannelId    int                   `json:"channel_id"`
+	Start        int64                 `json:"start"`
+	End          int64                 `json:"end"`
+	Tests        int                   `json:"tests"`
+	TestFailures int                   `json:"test_failures"`
+	Requests     int                   `json:"requests"`
+	Failures     int                   `json:"failures"`
+	Uptime       float64               `json:"uptime"`
+	ErrorRate    float64               `json:"error_rate"`
+	LatencyP50   int64                 `json:"latency_p50"`
+	LatencyP95   int64                 `json:"latency_p95"`
+	LatencyP99   int64                 `json:"latency_p99"`
+	Timeline     []*ChannelHealthPoint `json:"timeline"`
+	RecentTests  []*ChannelHealth      `json:"recent_tests"`
+}
+
+// channelHealthRecentTests is how many of the latest tests a report lists
+const channelHealthRecentTests = 20
+
+type channelHealthLatencies struct {
+	relay []int64
+	tests []int64
+}
+
+func (l *channelHealthLatencies) add(health *ChannelHealth) {
+	if health.Source == ChannelHealthSourceRelay {
+		var latencies []int64
+		if err := json.Unmarshal([]byte(health.Latencies), &latencies); err == nil {
+			l.relay = append(l.relay, latencies...)
+		}
+	} else if health.Success {
+		l.tests = append(l.tests, health.ResponseTime)
+	}
+}
+
+func (l *channelHealthLatencies) sorted() []int64 {
+	latencies := l.relay
+	if len(latencies) == 0 {
+		latencies = l.tests
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies
+}
+
+func latencyPercentile(sorted []int64, percentile float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(math.Ceil(percentile*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// GetChannelHealth reports the health of the channel over the window ending now, with a timeline point per bucket
+func GetChannelHealth(channelId int, window time.Duration, bucket time.Duration) (*ChannelHealthReport, error) {
+	end := common.GetTimestamp()
+	start := end - int64(window.Seconds())
+	var healths []*ChannelHealth
+	err := DB.Where("channel_id = ? and created_at >= ?", channelId, start).Order("created_at asc").Find(&healths).Error
+	if err != nil {
+		return nil, err
+	}
+	report := &ChannelHealthReport{
+		ChannelId:   channelId,
+		Start:       start,
+		End:         end,
+		RecentTests: make([]*ChannelHealth, 0),
+	}
+	bucketSeconds := int64(bucket.Seconds())
+	points := make(map[int64]*ChannelHealthPoint)
+	pointLatencies := make(map[int64]*channelHealthLatencies)
+	for t := start - start%bucketSeconds; t <= end; t += bucketSeconds {
+		points[t] = &ChannelHealthPoint{Time: t}
+		pointLatencies[t] = &channelHealthLatencies{}
+		report.Timeline = append(report.Timeline, points[t])
+	}
+	var latencies channelHealthLatencies
+	for _, health := range healths {
+		t := health.CreatedAt - health.CreatedAt%bucketSeconds
+		point, ok := points[t]
+		if !ok {
+			continue
+		}
+		if health.Source == ChannelHealthSourceRelay {
+			report.Requests += health.Requests
+			report.Failures += health.Failures
+			point.Requests += health.Requests
+			point.Failures += health.Failures
+		} else {
+			report.Tests++
+			point.Tests++
+			if !health.Success {
+				report.TestFailures++
+				point.TestFailures++
+			}
+		}
+		latencies.add(health)
+		pointLatencies[t].add(health)
+	}
+	for t, point := range points {
+		point.Latency = latencyPercentile(pointLatencies[t].sorted(), 0.5)
+	}
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Failures) / float64(report.Requests)
+	}
+	if report.Tests > 0 {
+		report.Uptime = float64(report.Tests-report.TestFailures) / float64(report.Tests)
+	} else if report.Requests > 0 {
+		report.Uptime = 1 - report.ErrorRate
+	}
+	sorted := latencies.sorted()
+	report.LatencyP50 = latencyPercentile(sorted, 0.5)
+	report.LatencyP95 = latencyPercentile(sorted, 0.95)
+	report.LatencyP99 = latencyPercentile(sorted, 0.99)
+	for i := len(healths) - 1; i >= 0 && len(report.RecentTests) < channelHealthRecentTests; i-- {
+		if healths[i].Source != ChannelHealthSourceRelay {
+			report.RecentTests = append(report.RecentTests, healths[i])
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,295 @@
+package model
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"one-api/common"
+	"strings"
+	"sync"
+)
+
+const (
+	ChannelKeyModeRoundRobin = "round_robin"
+	ChannelKeyModeRandom     = "random"
+)
+
+// ChannelKeyStatus is the state of one key of a multi-key channel, stored in Channel.KeyStatus by key fingerprint
+type ChannelKeyStatus struct {
+	Status        int    `json:"status"`
+	Reason        string `json:"reason,omitempty"`
+	StatusTime    int64  `json:"status_time,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	LastErrorTime int64  `json:"last_error_time,omitempty"`
+}
+
+// ChannelKey is what the admin api shows of a key, the key itself is masked
+type ChannelKey struct {
+	Index       int    `json:"index"`
+	Key         string `json:"key"`
+	Fingerprint string `json:"fingerprint"`
+	ChannelKeyStatus
+}
+
+var (
+	channelKeyCursors    = make(map[int]int)
+	channelKeyCursorLock sync.Mutex
+	// channelKeyLock serializes the read-modify-write of key statuses in this instance
+	channelKeyLock sync.Mutex
+)
+
+// ChannelKeyFingerprint identifies a key in statuses and logs without revealing it
+func ChannelKeyFingerprint(key string) string {
+	return hex.EncodeToString(common.Sha256Raw(key))[:16]
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + strings.Repeat("*", 8) + key[len(key)-4:]
+}
+
+func (channel *Channel) IsMultiKey() bool {
+	return channel.KeyMode == ChannelKeyModeRoundRobin || channel.KeyMode == ChannelKeyModeRandom
+}
+
+// GetKeys returns the keys of the channel, a multi-key channel holds one key per line
+func (channel *Channel) GetKeys() []string {
+	if !channel.IsMultiKey() {
+		return []string{channel.Key}
+	}
+	keys := make([]string, 0)
+	for _, key := range strings.Split(channel.Key, "\n") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (channel *Channel) GetKeyStatuses() map[string]*ChannelKeyStatus {
+	statuses := make(map[string]*ChannelKeyStatus)
+	if channel.KeyStatus != "" {
+		err := json.Unmarshal([]byte(channel.KeyStatus), &statuses)
+		if err != nil {
+			common.SysError("failed to unmarshal channel key status: " + err.Error())
+		}
+	}
+	return statuses
+}
+
+func (channel *Channel) isKeyEnabled(statuses map[string]*ChannelKeyStatus, key string) bool {
+	status, ok := statuses[ChannelKeyFingerprint(key)]
+	return !ok || status.Status == common.ChannelStatusEnabled
+}
+
+// SelectKey picks an enabled key that is not excluded, by fingerprint, with the key mode of the channel. When no
+// such key is left the enabled keys are used again, and when every key is disabled all of them are.
+func (channel *Channel) SelectKey(excluded []string) (string, string) {
+	keys := channel.GetKeys()
+	if !channel.IsMultiKey() || len(keys) == 0 {
+		return channel.Key, ""
+	}
+	statuses := channel.GetKeyStatuses()
+	skip := make(map[string]bool, len(excluded))
+	for _, fingerprint := range excluded {
+		skip[fingerprint] = true
+	}
+	var enabled, candidates []string
+	for _, key := range keys {
+		if channel.isKeyEnabled(statuses, key) {
+			enabled = append(enabled, key)
+			if !skip[ChannelKeyFingerprint(key)] {
+				candidates = append(candidates, key)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = enabled
+	}
+	if len(candidates) == 0 {
+		candidates = keys
+	}
+	var key string
+	if channel.KeyMode == ChannelKeyModeRandom {
+		key = candidates[common.GetRandomInt(len(candidates))]
+	} else {
+		channelKeyCursorLock.Lock()
+		cursor := channelKeyCursors[channel.Id]
+		channelKeyCursors[channel.Id] = cursor + 1
+		channelKeyCursorLock.Unlock()
+		key = candidates[cursor%len(candidates)]
+	}
+	return key, ChannelKeyFingerprint(key)
+}
+
+// GetEnabledKey returns the key with the fingerprint if it is still enabled and not excluded
+func (channel *Channel) GetEnabledKey(fingerprint string, excluded []string) (string, bool) {
+	if !channel.IsMultiKey() || fingerprint == "" {
+		return "", false
+	}
+	for _, skipped := range excluded {
+		if skipped == fingerprint {
+			return "", false
+		}
+	}
+	statuses := channel.GetKeyStatuses()
+	for _, key := range channel.GetKeys() {
+		if ChannelKeyFingerprint(key) == fingerprint && channel.isKeyEnabled(statuses, key) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// HasUntriedKey reports whether an enabled key outside of excluded is left
+func (channel *Channel) HasUntriedKey(excluded []string) bool {
+	if !channel.IsMultiKey() {
+		return false
+	}
+	statuses := channel.GetKeyStatuses()
+	skip := make(map[string]bool, len(excluded))
+	for _, fingerprint := range excluded {
+		skip[fingerprint] = true
+	}
+	for _, key := range channel.GetKeys() {
+		if channel.isKeyEnabled(statuses, key) && !skip[ChannelKeyFingerprint(key)] {
+			return true
+		}
+	}
+	return false
+}
+
+// GetChannelKeys lists the keys of a channel with their status
+func GetChannelKeys(channelId int) ([]ChannelKey, error) {
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return nil, err
+	}
+	statuses := channel.GetKeyStatuses()
+	keys := channel.GetKeys()
+	result := make([]ChannelKey, 0, len(keys))
+	for i, key := range keys {
+		fingerprint := ChannelKeyFingerprint(key)
+		channelKey := ChannelKey{
+			Index:       i,
+			Key:         maskChannelKey(key),
+			Fingerprint: fingerprint,
+		}
+		if status, ok := statuses[fingerprint]; ok {
+			channelKey.ChannelKeyStatus = *status
+		} else {
+			channelKey.Status = common.ChannelStatusEnabled
+		}
+		result = append(result, channelKey)
+	}
+	return result, nil
+}
+
+// updateChannelKeyStatus applies fn to the statuses of the channel, statuses of removed keys are dropped
+func updateChannelKeyStatus(channelId int, fn func(channel *Channel, statuses map[string]*ChannelKeyStatus) error) (*Channel, error) {
+	channelKeyLock.Lock()
+	defer channelKeyLock.Unlock()
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return nil, err
+	}
+	if !channel.IsMultiKey() {
+		return nil, errors.New("channel does not have multiple keys")
+	}
+	statuses := channel.GetKeyStatuses()
+	if err = fn(channel, statuses); err != nil {
+		return nil, err
+	}
+	current := make(map[string]*ChannelKeyStatus)
+	for _, key := range channel.GetKeys() {
+		fingerprint := ChannelKeyFingerprint(key)
+		if status, ok := statuses[fingerprint]; ok {
+			current[fingerprint] = status
+		}
+	}
+	jsonBytes, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	channel.KeyStatus = string(jsonBytes)
+	err = DB.Model(&Channel{}).Where("id = ?", channelId).Update("key_status", channel.KeyStatus).Error
+	if err != nil {
+		return nil, err
+	}
+	cacheUpdateChannelKeyStatus(channelId, channel.KeyStatus)
+	return channel, nil
+}
+
+func getOrCreateKeyStatus(statuses map[string]*ChannelKeyStatus, fingerprint string) *ChannelKeyStatus {
+	status, ok := statuses[fingerprint]
+	if !ok {
+		status = &ChannelKeyStatus{Status: common.ChannelStatusEnabled}
+		statuses[fingerprint] = status
+	}
+	return status
+}
+
+// RecordChannelKeyError keeps the last error of a key
+func RecordChannelKeyError(channelId int, fingerprint string, message string) error {
+	_, err := updateChannelKeyStatus(channelId, func(channel *Channel, statuses map[string]*ChannelKeyStatus) error {
+		status := getOrCreateKeyStatus(statuses, fingerprint)
+		status.LastError = message
+		status.LastErrorTime = common.GetTimestamp()
+		return nil
+	})
+	return err
+}
+
+// UpdateChannelKeyStatus changes the status of a key and returns how many keys of the channel are still enabled
+func UpdateChannelKeyStatus(channelId int, fingerprint string, status int, reason string) (int, error) {
+	channel, err := updateChannelKeyStatus(channelId, func(channel *Channel, statuses map[string]*ChannelKeyStatus) error {
+		found := false
+		for _, key := range channel.GetKeys() {
+			if ChannelKeyFingerprint(key) == fingerprint {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("key not found")
+		}
+		keyStatus := getOrCreateKeyStatus(statuses, fingerprint)
+		keyStatus.Status = status
+		keyStatus.Reason = reason
+		keyStatus.StatusTime = common.GetTimestamp()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return channel.enabledKeyCount(), nil
+}
+
+// EnableAutoDisabledChannelKeys enables the keys that were disabled by errors, keys disabled by an admin stay disabled
+func EnableAutoDisabledChannelKeys(channelId int) error {
+	_, err := updateChannelKeyStatus(channelId, func(channel *Channel, statuses map[string]*ChannelKeyStatus) error {
+		for _, status := range statuses {
+			if status.Status == common.ChannelStatusAutoDisabled {
+				status.Status = common.ChannelStatusEnabled
+				status.Reason = ""
+				status.StatusTime = common.GetTimestamp()
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (channel *Channel) enabledKeyCount() int {
+	statuses := channel.GetKeyStatuses()
+	count := 0
+	for _, key := range channel.GetKeys() {
+		if channel.isKeyEnabled(statuses, key) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,478 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrChannelQueueFull    = errors.New("channel queue is full")
+	ErrChannelQueueTimeout = errors.New("timed out waiting for a channel")
+)
+
+// ChannelLimits are the upstream limits of a channel, zero means unlimited
+type ChannelLimits struct {
+	MaxConcurrency int `json:"max_concurrency"`
+	RPM            int `json:"rpm_limit"`
+	TPM            int `json:"tpm_limit"`
+}
+
+func (l ChannelLimits) IsZero() bool {
+	return l.MaxConcurrency <= 0 && l.RPM <= 0 && l.TPM <= 0
+}
+
+func (channel *Channel) GetLimits() ChannelLimits {
+	limits := ChannelLimits{}
+	if channel.MaxConcurrency != nil {
+		limits.MaxConcurrency = *channel.MaxConcurrency
+	}
+	if channel.RPMLimit != nil {
+		limits.RPM = *channel.RPMLimit
+	}
+	if channel.TPMLimit != nil {
+		limits.TPM = *channel.TPMLimit
+	}
+	return limits
+}
+
+// ChannelLimitUsage is the usage of a channel in the current minute, requests and tokens are counted in fixed
+// one minute windows
+type ChannelLimitUsage struct {
+	InFlight int `json:"in_flight"`
+	Requests int `json:"requests"`
+	Tokens   int `json:"tokens"`
+}
+
+func (u ChannelLimitUsage) saturated(limits ChannelLimits, tokens int) bool {
+	if limits.MaxConcurrency > 0 && u.InFlight >= limits.MaxConcurrency {
+		return true
+	}
+	if limits.RPM > 0 && u.Requests >= limits.RPM {
+		return true
+	}
+	// a request larger than the whole budget still goes through on an idle minute
+	if limits.TPM > 0 && u.Tokens > 0 && u.Tokens+tokens > limits.TPM {
+		return true
+	}
+	return false
+}
+
+// ChannelLease is a slot held on a channel, it must be given back with ReleaseChannelLimit
+type ChannelLease struct {
+	ChannelId int
+	Minute    int64
+	Tokens    int
+}
+
+type channelLimitStore interface {
+	// acquire takes a slot and counts the request and its estimated tokens when the channel is below its limits
+	acquire(channelId int, limits ChannelLimits, tokens int, minute int64) (bool, error)
+	// release frees the slot and replaces the estimated tokens with the actual ones
+	release(lease *ChannelLease, tokens int) error
+	usages(channelIds []int, minute int64) (map[int]ChannelLimitUsage, error)
+}
+
+func getChannelLimitStore() channelLimitStore {
+	if common.RedisEnabled {
+		return redisChannelLimitStore{}
+	}
+	return memoryChannelLimits
+}
+
+func currentMinute() int64 {
+	return time.Now().Unix() / 60
+}
+
+type memoryChannelLimit struct {
+	ChannelLimitUsage
+	minute int64
+}
+
+type memoryChannelLimitStore struct {
+	mutex  sync.Mutex
+	limits map[int]*memoryChannelLimit
+}
+
+var memoryChannelLimits = &memoryChannelLimitStore{limits: make(map[int]*memoryChannelLimit)}
+
+func (s *memoryChannelLimitStore) get(channelId int, minute int64) *memoryChannelLimit {
+	l, ok := s.limits[channelId]
+	if !ok {
+		l = &memoryChannelLimit{minute: minute}
+		s.limits[channelId] = l
+	}
+	if l.minute != minute {
+		l.minute = minute
+		l.Requests = 0
+		l.Tokens = 0
+	}
+	return l
+}
+
+func (s *memoryChannelLimitStore) acquire(channelId int, limits ChannelLimits, tokens int, minute int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	l := s.get(channelId, minute)
+	if l.saturated(limits, tokens) {
+		return false, nil
+	}
+	l.InFlight++
+	l.Requests++
+	l.Tokens += tokens
+	return true, nil
+}
+
+func (s *memoryChannelLimitStore) release(lease *ChannelLease, tokens int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	l := s.get(lease.ChannelId, currentMinute())
+	if l.InFlight > 0 {
+		l.InFlight--
+	}
+	if l.minute == lease.Minute {
+		l.Tokens += tokens - lease.Tokens
+	} else {
+		// the request outlived its minute, its tokens count for the one it finished in
+		l.Tokens += tokens
+	}
+	if l.Tokens < 0 {
+		l.Tokens = 0
+	}
+	return nil
+}
+
+func (s *memoryChannelLimitStore) usages(channelIds []int, minute int64) (map[int]ChannelLimitUsage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make(map[int]ChannelLimitUsage, len(channelIds))
+	for _, id := range channelIds {
+		result[id] = s.get(id, minute).ChannelLimitUsage
+	}
+	return result, nil
+}
+
+const (
+	redisChannelLimitPrefix = "channel_limit:"
+	// in-flight counters of a crashed instance are forgotten once a channel is idle for this long
+	redisChannelInFlightExpiration = 10 * time.Minute
+	redisChannelWindowExpiration   = 2 * time.Minute
+	// the instances are told about released slots so that their queues are woken
+	redisChannelReleaseTopic = "channel_limit_release"
+)
+
+func redisChannelLimitKeys(channelId int, minute int64) []string {
+	prefix := redisChannelLimitPrefix + strconv.Itoa(channelId)
+	return []string{
+		prefix + ":in_flight",
+		fmt.Sprintf("%s:requests:%d", prefix, minute),
+		fmt.Sprintf("%s:tokens:%d", prefix, minute),
+	}
+}
+
+var redisChannelAcquireScript = redis.NewScript(`
+local inFlight = tonumber(redis.call('GET', KEYS[1]) or '0')
+local requests = tonumber(redis.call('GET', KEYS[2]) or '0')
+local tokens = tonumber(redis.call('GET', KEYS[3]) or '0')
+local maxConcurrency, rpm, tpm, cost = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+if maxConcurrency > 0 and inFlight >= maxConcurrency then return 0 end
+if rpm > 0 and requests >= rpm then return 0 end
+if tpm > 0 and tokens > 0 and tokens + cost > tpm then return 0 end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+redis.call('INCR', KEYS[2])
+redis.call('EXPIRE', KEYS[2], ARGV[6])
+redis.call('INCRBY', KEYS[3], cost)
+redis.call('EXPIRE', KEYS[3], ARGV[6])
+return 1
+`)
+
+var redisChannelReleaseScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') > 0 then
+	redis.call('DECR', KEYS[1])
+end
+if tonumber(ARGV[1]) ~= 0 then
+	local tokens = redis.call('INCRBY', KEYS[2], ARGV[1])
+	if tokens < 0 then
+		redis.call('SET', KEYS[2], 0)
+	end
+	redis.call('EXPIRE', KEYS[2], ARGV[2])
+end
+redis.call('PUBLISH', ARGV[3], ARGV[4])
+return 1
+`)
+
+// redisChannelLimitStore shares the limits between instances, checks and increments run in lua scripts
+type redisChannelLimitStore struct{}
+
+func (redisChannelLimitStore) acquire(channelId int, limits ChannelLimits, tokens int, minute int64) (bool, error) {
+	result, err := redisChannelAcquireScript.Run(context.Background(), common.RDB, redisChannelLimitKeys(channelId, minute),
+		limits.MaxConcurrency, limits.RPM, limits.TPM, tokens,
+		int(redisChannelInFlightExpiration.Seconds()), int(redisChannelWindowExpiration.Seconds())).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func (redisChannelLimitStore) release(lease *ChannelLease, tokens int) error {
+	keys := redisChannelLimitKeys(lease.ChannelId, lease.Minute)
+	delta := tokens - lease.Tokens
+	if currentMinute() != lease.Minute {
+		keys = redisChannelLimitKeys(lease.ChannelId, currentMinute())
+		delta = tokens
+	}
+	return redisChannelReleaseScript.Run(context.Background(), common.RDB, []string{keys[0], keys[2]},
+		delta, int(redisChannelWindowExpiration.Seconds()), redisChannelReleaseTopic, lease.ChannelId).Err()
+}
+
+func (redisChannelLimitStore) usages(channelIds []int, minute int64) (map[int]ChannelLimitUsage, error) {
+	result := make(map[int]ChannelLimitUsage, len(channelIds))
+	if len(channelIds) == 0 {
+		return result, nil
+	}
+	keys := make([]string, 0, len(channelIds)*3)
+	for _, id := range channelIds {
+		keys = append(keys, redisChannelLimitKeys(id, minute)...)
+	}
+	values, err := common.RDB.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	number := func(value interface{}) int {
+		s, _ := value.(string)
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	for i, id := range channelIds {
+		result[id] = ChannelLimitUsage{
+			InFlight: number(values[i*3]),
+			Requests: number(values[i*3+1]),
+			Tokens:   number(values[i*3+2]),
+		}
+	}
+	return result, nil
+}
+
+// saturatedChannels returns the channels at one of their limits. Errors of the store never block a channel.
+func saturatedChannels(limits map[int]ChannelLimits) map[int]bool {
+	saturated := make(map[int]bool)
+	if len(limits) == 0 {
+		return saturated
+	}
+	channelIds := make([]int, 0, len(limits))
+	for id := range limits {
+		channelIds = append(channelIds, id)
+	}
+	usages, err := getChannelLimitStore().usages(channelIds, currentMinute())
+	if err != nil {
+		common.SysError("failed to get channel limit usages: " + err.Error())
+		return saturated
+	}
+	for id, usage := range usages {
+		if usage.saturated(limits[id], 0) {
+			saturated[id] = true
+		}
+	}
+	return saturated
+}
+
+// skipSaturatedChannels drops the channels at their limits. If all of them are, they are all kept and the
+// relay waits in the queue for a slot of the one selected.
+func skipSaturatedChannels(channels []*Channel) []*Channel {
+	limits := make(map[int]ChannelLimits)
+	for _, channel := range channels {
+		if channelLimits := channel.GetLimits(); !channelLimits.IsZero() {
+			limits[channel.Id] = channelLimits
+		}
+	}
+	saturated := saturatedChannels(limits)
+	if len(saturated) == 0 || len(saturated) == len(channels) {
+		return channels
+	}
+	available := make([]*Channel, 0, len(channels)-len(saturated))
+	for _, channel := range channels {
+		if !saturated[channel.Id] {
+			available = append(available, channel)
+		}
+	}
+	return available
+}
+
+// channelQueue holds the requests waiting for a slot of a channel in arrival order. Only the first one tries to
+// take a slot, it is woken when a slot of the channel is released or a new minute starts, and wakes the next one
+// once it leaves the queue.
+type channelQueue struct {
+	waiters []chan struct{}
+}
+
+var channelQueues = struct {
+	sync.Mutex
+	queues map[int]*channelQueue
+}{queues: make(map[int]*channelQueue)}
+
+func channelQueueLen(channelId int) int {
+	channelQueues.Lock()
+	defer channelQueues.Unlock()
+	if queue, ok := channelQueues.queues[channelId]; ok {
+		return len(queue.waiters)
+	}
+	return 0
+}
+
+// joinChannelQueue adds a waiter to the queue of the channel, false when the queue is full
+func joinChannelQueue(channelId int, wake chan struct{}) bool {
+	channelQueues.Lock()
+	defer channelQueues.Unlock()
+	queue, ok := channelQueues.queues[channelId]
+	if !ok {
+		queue = &channelQueue{}
+		channelQueues.queues[channelId] = queue
+	}
+	if len(queue.waiters) >= common.ChannelQueueSize {
+		return false
+	}
+	queue.waiters = append(queue.waiters, wake)
+	if len(queue.waiters) == 1 {
+		wake <- struct{}{}
+	}
+	return true
+}
+
+func isChannelQueueHead(channelId int, wake chan struct{}) bool {
+	channelQueues.Lock()
+	defer channelQueues.Unlock()
+	queue, ok := channelQueues.queues[channelId]
+	return ok && len(queue.waiters) > 0 && queue.waiters[0] == wake
+}
+
+// leaveChannelQueue removes a waiter from the queue of the channel, the next one is woken when it was the first
+func leaveChannelQueue(channelId int, wake chan struct{}) {
+	channelQueues.Lock()
+	defer channelQueues.Unlock()
+	queue, ok := channelQueues.queues[channelId]
+	if !ok {
+		return
+	}
+	for i, waiter := range queue.waiters {
+		if waiter == wake {
+			queue.waiters = append(queue.waiters[:i], queue.waiters[i+1:]...)
+			if i == 0 && len(queue.waiters) > 0 {
+				notifyChannelWaiter(queue.waiters[0])
+			}
+			break
+		}
+	}
+	if len(queue.waiters) == 0 {
+		delete(channelQueues.queues, channelId)
+	}
+}
+
+// wakeChannelQueue wakes the first request waiting for the channel after one of its slots was released
+func wakeChannelQueue(channelId int) {
+	channelQueues.Lock()
+	defer channelQueues.Unlock()
+	if queue, ok := channelQueues.queues[channelId]; ok && len(queue.waiters) > 0 {
+		notifyChannelWaiter(queue.waiters[0])
+	}
+}
+
+func notifyChannelWaiter(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+var subscribeChannelReleasesOnce sync.Once
+
+// subscribeChannelReleases wakes the local queues on the slots released by every instance
+func subscribeChannelReleases() {
+	go func() {
+		pubsub := common.RDB.Subscribe(context.Background(), redisChannelReleaseTopic)
+		for message := range pubsub.Channel() {
+			if channelId, err := strconv.Atoi(message.Payload); err == nil {
+				wakeChannelQueue(channelId)
+			}
+		}
+	}()
+}
+
+// AcquireChannelLimit takes a slot on the channel, waiting in the queue of the channel until the deadline while the
+// channel is saturated. tokens is the estimate of the request, the lease is nil for channels without limits.
+func AcquireChannelLimit(ctx context.Context, channelId int, limits ChannelLimits, tokens int, deadline time.Time) (*ChannelLease, error) {
+	if limits.IsZero() {
+		return nil, nil
+	}
+	store := getChannelLimitStore()
+	tryAcquire := func() (*ChannelLease, bool) {
+		minute := currentMinute()
+		ok, err := store.acquire(channelId, limits, tokens, minute)
+		if err != nil {
+			common.SysError("failed to acquire channel limit: " + err.Error())
+			return nil, true
+		}
+		if !ok {
+			return nil, false
+		}
+		return &ChannelLease{ChannelId: channelId, Minute: minute, Tokens: tokens}, true
+	}
+	// a request does not get ahead of the ones already waiting
+	if channelQueueLen(channelId) == 0 {
+		if lease, ok := tryAcquire(); ok {
+			return lease, nil
+		}
+	}
+
+	if common.RedisEnabled {
+		subscribeChannelReleasesOnce.Do(subscribeChannelReleases)
+	}
+	wake := make(chan struct{}, 1)
+	if !joinChannelQueue(channelId, wake) {
+		return nil, ErrChannelQueueFull
+	}
+	defer leaveChannelQueue(channelId, wake)
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+	for {
+		// the request and token windows are reset when the minute changes
+		nextMinute := time.NewTimer(time.Until(time.Unix((currentMinute()+1)*60, 0)))
+		select {
+		case <-ctx.Done():
+			nextMinute.Stop()
+			return nil, ctx.Err()
+		case <-timeout.C:
+			nextMinute.Stop()
+			return nil, ErrChannelQueueTimeout
+		case <-wake:
+		case <-nextMinute.C:
+		}
+		nextMinute.Stop()
+		if !isChannelQueueHead(channelId, wake) {
+			continue
+		}
+		if lease, ok := tryAcquire(); ok {
+			return lease, nil
+		}
+	}
+}
+
+// ReleaseChannelLimit gives the slot back, tokens is the actual usage of the request or 0 to keep the estimate
+func ReleaseChannelLimit(lease *ChannelLease, tokens int) {
+	if lease == nil {
+		return
+	}
+	if tokens <= 0 {
+		tokens = lease.Tokens
+	}
+	if err := getChannelLimitStore().release(lease, tokens); err != nil {
+		common.SysError("failed to release channel limit: " + err.Error())
+	}
+	wakeChannelQueue(lease.ChannelId)
+}
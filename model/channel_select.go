@@ -0,0 +1,254 @@
+package model
+
+import (
+	"math"
+	"one-api/common"
+	"sort"
+	"sync"
+	"time"
+)
+
+// channelStatsDecay is the weight of the newest sample in the moving averages
+const channelStatsDecay = 0.2
+
+const (
+	// channelLatencySamples is how many recent latencies of a channel are kept for percentiles
+	channelLatencySamples = 100
+	// channelLatencyMinSamples is how many latencies a percentile needs to be meaningful
+	channelLatencyMinSamples = 20
+)
+
+// ChannelStats are the live relay statistics of a channel collected by this instance. Latency and error rate
+// are exponentially weighted moving averages, latency only counts successful requests so that a channel that
+// fails fast does not look fast.
+type ChannelStats struct {
+	ChannelId int     `json:"channel_id"`
+	InFlight  int     `json:"in_flight"`
+	Latency   float64 `json:"latency"` // in milliseconds
+	ErrorRate float64 `json:"error_rate"`
+	Requests  int64   `json:"requests"`
+	UpdatedAt int64   `json:"updated_at"`
+
+	latencies []float64 // ring of the recent latencies
+	next      int
+}
+
+var (
+	channelStats     = make(map[int]*ChannelStats)
+	channelStatsLock sync.Mutex
+)
+
+func getChannelStats(channelId int) *ChannelStats {
+	stats, ok := channelStats[channelId]
+	if !ok {
+		stats = &ChannelStats{ChannelId: channelId}
+		channelStats[channelId] = stats
+	}
+	return stats
+}
+
+// ChannelRequestStarted counts a request sent to the channel as in flight
+func ChannelRequestStarted(channelId int) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	getChannelStats(channelId).InFlight++
+}
+
+// ChannelRequestFinished must follow every ChannelRequestStarted, success is false only for failures of the channel.
+// A zero latency is not sampled.
+func ChannelRequestFinished(channelId int, latency time.Duration, success bool) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	stats := getChannelStats(channelId)
+	if stats.InFlight > 0 {
+		stats.InFlight--
+	}
+	errorSample := 0.0
+	if !success {
+		errorSample = 1
+	}
+	if stats.Requests == 0 {
+		stats.ErrorRate = errorSample
+	} else {
+		stats.ErrorRate += channelStatsDecay * (errorSample - stats.ErrorRate)
+	}
+	if success && latency > 0 {
+		ms := float64(latency.Milliseconds())
+		if stats.Latency == 0 {
+			stats.Latency = ms
+		} else {
+			stats.Latency += channelStatsDecay * (ms - stats.Latency)
+		}
+		if len(stats.latencies) < channelLatencySamples {
+			stats.latencies = append(stats.latencies, ms)
+		} else {
+			stats.latencies[stats.next] = ms
+			stats.next = (stats.next + 1) % channelLatencySamples
+		}
+	}
+	stats.Requests++
+	stats.UpdatedAt = time.Now().Unix()
+	sampleChannelHealth(channelId, latency, success)
+}
+
+// ChannelRequestCancelled ends a request that was abandoned by the gateway, it says nothing about the channel
+func ChannelRequestCancelled(channelId int) {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	stats := getChannelStats(channelId)
+	if stats.InFlight > 0 {
+		stats.InFlight--
+	}
+}
+
+// ChannelLatencyPercentile returns the percentile, between 0 and 1, of the recent latencies of the channel, or
+// 0 when there are too few samples
+func ChannelLatencyPercentile(channelId int, percentile float64) time.Duration {
+	channelStatsLock.Lock()
+	stats, ok := channelStats[channelId]
+	if !ok || len(stats.latencies) < channelLatencyMinSamples {
+		channelStatsLock.Unlock()
+		return 0
+	}
+	latencies := append([]float64(nil), stats.latencies...)
+	channelStatsLock.Unlock()
+	sort.Float64s(latencies)
+	index := int(math.Ceil(percentile*float64(len(latencies)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return time.Duration(latencies[index]) * time.Millisecond
+}
+
+// GetChannelsStats lists the live statistics of one channel, or of all channels when channelId is 0
+func GetChannelsStats(channelId int) []ChannelStats {
+	channelStatsLock.Lock()
+	defer channelStatsLock.Unlock()
+	result := make([]ChannelStats, 0, len(channelStats))
+	for _, stats := range channelStats {
+		if channelId != 0 && stats.ChannelId != channelId {
+			continue
+		}
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ChannelId < result[j].ChannelId
+	})
+	return result
+}
+
+type channelCandidate struct {
+	Id     int
+	Weight int
+	// ResponseTime is the latency of the last channel test, used until live samples exist
+	ResponseTime int
+
+	inFlight  int
+	latency   float64
+	errorRate float64
+}
+
+// selectChannelCandidate picks one of the candidates, which all have the same priority, with the strategy
+// configured for the group and model
+func selectChannelCandidate(group string, model string, candidates []channelCandidate) int {
+	if len(candidates) == 1 {
+		return candidates[0].Id
+	}
+	strategy := common.GetChannelSelectStrategy(group, model)
+	if strategy == common.ChannelStrategyWeightedRandom {
+		return weightedRandomCandidate(candidates).Id
+	}
+
+	channelStatsLock.Lock()
+	for i := range candidates {
+		if stats, ok := channelStats[candidates[i].Id]; ok {
+			candidates[i].inFlight = stats.InFlight
+			candidates[i].latency = stats.Latency
+			candidates[i].errorRate = stats.ErrorRate
+		}
+	}
+	channelStatsLock.Unlock()
+	// channels without any sample are assumed to be average, so they still get traffic to be measured
+	knownLatency, known := 0.0, 0
+	for i := range candidates {
+		if candidates[i].latency == 0 {
+			candidates[i].latency = float64(candidates[i].ResponseTime)
+		}
+		if candidates[i].latency > 0 {
+			knownLatency += candidates[i].latency
+			known++
+		}
+	}
+	averageLatency := 1.0
+	if known > 0 {
+		averageLatency = knownLatency / float64(known)
+	}
+	for i := range candidates {
+		if candidates[i].latency == 0 {
+			candidates[i].latency = averageLatency
+		}
+	}
+
+	switch strategy {
+	case common.ChannelStrategyLeastInFlight:
+		return lowestCostCandidate(candidates, func(c *channelCandidate) float64 {
+			return float64(c.inFlight)
+		}).Id
+	case common.ChannelStrategyEWMALatency:
+		return lowestCostCandidate(candidates, func(c *channelCandidate) float64 {
+			return c.latency / successRate(c)
+		}).Id
+	case common.ChannelStrategyPowerOfTwo:
+		first := weightedRandomCandidate(candidates)
+		rest := make([]channelCandidate, 0, len(candidates)-1)
+		for _, candidate := range candidates {
+			if candidate.Id != first.Id {
+				rest = append(rest, candidate)
+			}
+		}
+		second := weightedRandomCandidate(rest)
+		return lowestCostCandidate([]channelCandidate{*first, *second}, func(c *channelCandidate) float64 {
+			return float64(c.inFlight+1) * c.latency / successRate(c)
+		}).Id
+	}
+	return weightedRandomCandidate(candidates).Id
+}
+
+// successRate never reaches zero, a channel that only failed lately is still preferred over nothing
+func successRate(c *channelCandidate) float64 {
+	return math.Max(1-c.errorRate, 0.05)
+}
+
+func weightedRandomCandidate(candidates []channelCandidate) *channelCandidate {
+	// 平滑系数
+	smoothingFactor := 10
+	totalWeight := 0
+	for _, candidate := range candidates {
+		totalWeight += candidate.Weight + smoothingFactor
+	}
+	randomWeight := common.GetRandomInt(totalWeight)
+	for i := range candidates {
+		randomWeight -= candidates[i].Weight + smoothingFactor
+		if randomWeight < 0 {
+			return &candidates[i]
+		}
+	}
+	return &candidates[len(candidates)-1]
+}
+
+// lowestCostCandidate returns the cheapest candidate, ties are broken by weight
+func lowestCostCandidate(candidates []channelCandidate, cost func(c *channelCandidate) float64) *channelCandidate {
+	lowest := math.Inf(1)
+	var cheapest []channelCandidate
+	for i := range candidates {
+		value := cost(&candidates[i])
+		if value < lowest {
+			lowest = value
+			cheapest = cheapest[:0]
+		}
+		if value == lowest {
+			cheapest = append(cheapest, candidates[i])
+		}
+	}
+	return weightedRandomCandidate(cheapest)
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"errors"
+	"one-api/dto"
+)
+
+// File is an upload of /v1/files, the content itself lives in the file store under FileId
+type File struct {
+	Id        int    `json:"id"`
+	FileId    string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (f *File) Insert() error {
+	return DB.Create(f).Error
+}
+
+func (f *File) ToOpenAIFile() *dto.OpenAIFile {
+	return &dto.OpenAIFile{
+		Id:        f.FileId,
+		Object:    "file",
+		Bytes:     f.Bytes,
+		CreatedAt: f.CreatedAt,
+		Filename:  f.Filename,
+		Purpose:   f.Purpose,
+		Status:    "processed",
+	}
+}
+
+func GetUserFile(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id 为空！")
+	}
+	var file File
+	err := DB.Where("user_id = ? and file_id = ?", userId, fileId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func GetUserFiles(userId int, purpose string) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	err := query.Order("id desc").Find(&files).Error
+	return files, err
+}
+
+func (f *File) Delete() error {
+	return DB.Delete(f).Error
+}
@@ -199,9 +199,44 @@ func migrateDB() error {
 	if err != nil {
 		return err
 	}
+	err = DB.AutoMigrate(&StoredResponse{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&File{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&ChannelHealth{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Plan{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Subscription{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&NotificationSubscription{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&Notification{})
+	if err != nil {
+		return err
+	}
+	err = DB.AutoMigrate(&QuotaLedgerEntry{})
+	if err != nil {
+		return err
+	}
 	common.SysLog("database migrated")
 	err = createRootAccountIfNeed()
-	return err
+	if err != nil {
+		return err
+	}
+	return openQuotaLedgers()
 }
 
 func migrateLOGDB() error {
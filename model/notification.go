@@ -0,0 +1,466 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"sync"
+	"time"
+)
+
+const (
+	NotificationEventBalanceLow      = "balance_low"
+	NotificationEventTokenExhausted  = "token_exhausted"
+	NotificationEventChannelDisabled = "channel_disabled"
+	NotificationEventTopUpSuccess    = "topup_success"
+	NotificationEventTaskFailed      = "task_failed"
+)
+
+// notificationEvents are the events users can subscribe to, the value tells whether the event is for admins only
+var notificationEvents = map[string]bool{
+	NotificationEventBalanceLow:      false,
+	NotificationEventTokenExhausted:  false,
+	NotificationEventChannelDisabled: true,
+	NotificationEventTopUpSuccess:    false,
+	NotificationEventTaskFailed:      false,
+}
+
+const (
+	NotificationChannelEmail    = "email"
+	NotificationChannelWebhook  = "webhook"
+	NotificationChannelTelegram = "telegram"
+)
+
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusFailed  = "failed"
+)
+
+const (
+	// a notification is delivered by the instance that created it, the others retry it once the lease ran out
+	notificationLease       = 2 * time.Minute
+	notificationMaxAttempts = 5
+)
+
+// delays before the retries of a notification whose delivery failed
+var notificationBackoff = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}
+
+// NotificationSubscription delivers the notifications of an event to a user through a channel
+type NotificationSubscription struct {
+	Id      int    `json:"id"`
+	UserId  int    `json:"user_id" gorm:"index"`
+	Event   string `json:"event" gorm:"type:varchar(32);index"`
+	Channel string `json:"channel" gorm:"type:varchar(16)"`
+	// Target is the webhook url, or the email address or telegram chat id used instead of the ones bound to the user
+	Target      string `json:"target"`
+	Secret      string `json:"secret" gorm:"type:varchar(64)"` // signs the webhook payloads
+	Threshold   int    `json:"threshold"`                      // balance_low fires when the quota drops below it
+	Enabled     bool   `json:"enabled"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+// Notification is one delivery of an event to a subscription, kept as the notification history
+type Notification struct {
+	Id             int    `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	SubscriptionId int    `json:"subscription_id" gorm:"index:idx_notification_dedup,priority:1"`
+	Event          string `json:"event" gorm:"type:varchar(32)"`
+	Channel        string `json:"channel" gorm:"type:varchar(16)"`
+	Target         string `json:"target"`
+	DedupKey       string `json:"dedup_key" gorm:"type:varchar(64);index:idx_notification_dedup,priority:2"`
+	Title          string `json:"title"`
+	Content        string `json:"content"`
+	Data           string `json:"data"` // json object sent to webhooks
+	Status         string `json:"status" gorm:"type:varchar(16);index:idx_notification_due,priority:1"`
+	Attempts       int    `json:"attempts"`
+	LastError      string `json:"last_error"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index:idx_notification_due,priority:2"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	SentAt         int64  `json:"sent_at" gorm:"bigint"`
+}
+
+func (s *NotificationSubscription) Validate(isAdmin bool) error {
+	adminOnly, ok := notificationEvents[s.Event]
+	if !ok {
+		return errors.New("未知的通知事件")
+	}
+	if adminOnly && !isAdmin {
+		return errors.New("该通知事件仅管理员可以订阅")
+	}
+	switch s.Channel {
+	case NotificationChannelEmail:
+		if s.Target != "" {
+			if err := common.Validate.Var(s.Target, "email"); err != nil {
+				return errors.New("无效的邮箱地址")
+			}
+		}
+	case NotificationChannelWebhook:
+		if err := common.Validate.Var(s.Target, "url"); err != nil {
+			return errors.New("无效的 Webhook 地址")
+		}
+		if err := common.ValidatePublicURL(s.Target); err != nil {
+			return errors.New("Webhook 地址不可用：" + err.Error())
+		}
+		if s.Secret == "" {
+			s.Secret = common.GetRandomString(32)
+		}
+	case NotificationChannelTelegram:
+		// users may only be notified in the chat they bound, so that the bot cannot be used to message others
+		if s.Target != "" && !isAdmin {
+			user, err := GetUserById(s.UserId, false)
+			if err != nil {
+				return err
+			}
+			if s.Target != user.TelegramId {
+				return errors.New("只能通知到已绑定的 Telegram 账户")
+			}
+		}
+	default:
+		return errors.New("未知的通知渠道")
+	}
+	if s.Event == NotificationEventBalanceLow && s.Threshold <= 0 {
+		return errors.New("余额提醒阈值必须大于 0")
+	}
+	return nil
+}
+
+func GetUserNotificationSubscriptions(userId int) ([]*NotificationSubscription, error) {
+	var subscriptions []*NotificationSubscription
+	err := DB.Where("user_id = ?", userId).Order("id asc").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// GetNotificationSubscriptionById finds a subscription of the user, any user when userId is 0
+func GetNotificationSubscriptionById(id int, userId int) (*NotificationSubscription, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	subscription := NotificationSubscription{}
+	query := DB.Where("id = ?", id)
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	err := query.First(&subscription).Error
+	return &subscription, err
+}
+
+func (s *NotificationSubscription) Insert() error {
+	s.CreatedTime = common.GetTimestamp()
+	err := DB.Create(s).Error
+	if err == nil {
+		invalidateBalanceThresholds(s.UserId)
+	}
+	return err
+}
+
+func (s *NotificationSubscription) Update() error {
+	err := DB.Model(s).Select("event", "channel", "target", "secret", "threshold", "enabled").Updates(s).Error
+	if err == nil {
+		invalidateBalanceThresholds(s.UserId)
+	}
+	return err
+}
+
+func (s *NotificationSubscription) Delete() error {
+	err := DB.Delete(s).Error
+	if err == nil {
+		invalidateBalanceThresholds(s.UserId)
+	}
+	return err
+}
+
+// GetNotifications returns the notification history of the user, of all users when userId is 0
+func GetNotifications(userId int, startIdx int, num int) ([]*Notification, error) {
+	var notifications []*Notification
+	query := DB.Order("id desc").Limit(num).Offset(startIdx)
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	err := query.Find(&notifications).Error
+	return notifications, err
+}
+
+// NotificationMessage is an occurrence of an event
+type NotificationMessage struct {
+	Event string
+	// DedupKey identifies the occurrence, a subscription is notified once per key within the dedup window
+	DedupKey string
+	Title    string
+	Content  string
+	Data     map[string]interface{}
+}
+
+// notificationQueue holds the notifications created by this instance, service.DeliverNotifications delivers them
+var notificationQueue = make(chan *Notification, 1024)
+
+func NotificationQueue() <-chan *Notification {
+	return notificationQueue
+}
+
+var recentNotifications = make(map[string]int64)
+var recentNotificationsLock sync.Mutex
+
+// notifiedRecently spares the lookups of an occurrence reported over and over, e.g. a token exhausted by every
+// request made with it. The notification history is what actually deduplicates.
+func notifiedRecently(key string) bool {
+	recentNotificationsLock.Lock()
+	defer recentNotificationsLock.Unlock()
+	now := time.Now().Unix()
+	if expireAt, ok := recentNotifications[key]; ok && expireAt > now {
+		return true
+	}
+	if len(recentNotifications) > 10000 {
+		for k, expireAt := range recentNotifications {
+			if expireAt <= now {
+				delete(recentNotifications, k)
+			}
+		}
+	}
+	recentNotifications[key] = now + int64(common.NotificationDedupMinutes*60)
+	return false
+}
+
+// Notify sends msg to the subscriptions of the user to its event
+func Notify(userId int, msg NotificationMessage) {
+	if notifiedRecently(fmt.Sprintf("%d:%s", userId, msg.DedupKey)) {
+		return
+	}
+	var subscriptions []*NotificationSubscription
+	err := DB.Where("user_id = ? and event = ? and enabled = ?", userId, msg.Event, true).Find(&subscriptions).Error
+	if err != nil {
+		common.SysError("failed to get notification subscriptions: " + err.Error())
+		return
+	}
+	notify(subscriptions, msg)
+}
+
+// NotifyAdmins sends msg to the subscriptions of the admins to its event
+func NotifyAdmins(msg NotificationMessage) {
+	if notifiedRecently("admins:" + msg.DedupKey) {
+		return
+	}
+	var subscriptions []*NotificationSubscription
+	err := DB.Joins("join users on users.id = notification_subscriptions.user_id").
+		Where("notification_subscriptions.event = ? and notification_subscriptions.enabled = ? and users.role >= ? and users.deleted_at is null",
+			msg.Event, true, common.RoleAdminUser).
+		Find(&subscriptions).Error
+	if err != nil {
+		common.SysError("failed to get notification subscriptions: " + err.Error())
+		return
+	}
+	notify(subscriptions, msg)
+}
+
+func notify(subscriptions []*NotificationSubscription, msg NotificationMessage) {
+	for _, subscription := range subscriptions {
+		notification, err := CreateNotification(subscription, msg)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to create notification for subscription #%d: %s", subscription.Id, err.Error()))
+			continue
+		}
+		if notification == nil || notification.Status != NotificationStatusPending {
+			continue
+		}
+		select {
+		case notificationQueue <- notification:
+		default:
+			// delivered by the retries once its lease runs out
+		}
+	}
+}
+
+// CreateNotification records msg for the subscription, it returns nil when the subscription was notified of the
+// same occurrence within the dedup window
+func CreateNotification(subscription *NotificationSubscription, msg NotificationMessage) (*Notification, error) {
+	now := time.Now()
+	var count int64
+	err := DB.Model(&Notification{}).Where("subscription_id = ? and dedup_key = ? and created_at > ?", subscription.Id,
+		msg.DedupKey, now.Unix()-int64(common.NotificationDedupMinutes*60)).Count(&count).Error
+	if err != nil || count > 0 {
+		return nil, err
+	}
+	data, _ := json.Marshal(msg.Data)
+	notification := &Notification{
+		UserId:         subscription.UserId,
+		SubscriptionId: subscription.Id,
+		Event:          msg.Event,
+		Channel:        subscription.Channel,
+		Target:         subscription.Target,
+		DedupKey:       msg.DedupKey,
+		Title:          msg.Title,
+		Content:        msg.Content,
+		Data:           string(data),
+		Status:         NotificationStatusPending,
+		NextAttemptAt:  now.Add(notificationLease).Unix(),
+		CreatedAt:      now.Unix(),
+	}
+	if notification.Target == "" {
+		user, err := GetUserById(subscription.UserId, false)
+		if err != nil {
+			return nil, err
+		}
+		switch subscription.Channel {
+		case NotificationChannelEmail:
+			notification.Target = user.Email
+		case NotificationChannelTelegram:
+			notification.Target = user.TelegramId
+		}
+	}
+	if notification.Target == "" {
+		// recorded anyway so the user finds out why nothing arrived
+		notification.Status = NotificationStatusFailed
+		notification.LastError = "未设置接收地址，且账户未绑定邮箱或 Telegram"
+	}
+	err = DB.Create(notification).Error
+	return notification, err
+}
+
+// ClaimDueNotifications takes the pending notifications due for a retry, for the lease
+func ClaimDueNotifications(limit int) []*Notification {
+	var notifications []*Notification
+	now := time.Now().Unix()
+	err := DB.Where("status = ? and next_attempt_at <= ?", NotificationStatusPending, now).Order("next_attempt_at asc").
+		Limit(limit).Find(&notifications).Error
+	if err != nil {
+		common.SysError("failed to get due notifications: " + err.Error())
+		return nil
+	}
+	claimed := notifications[:0]
+	for _, notification := range notifications {
+		// another instance may have claimed it in the meantime
+		result := DB.Model(&Notification{}).Where("id = ? and next_attempt_at = ?", notification.Id, notification.NextAttemptAt).
+			Update("next_attempt_at", now+int64(notificationLease.Seconds()))
+		if result.Error == nil && result.RowsAffected == 1 {
+			claimed = append(claimed, notification)
+		}
+	}
+	return claimed
+}
+
+// Delivered records the outcome of a delivery, a failed one is retried with backoff
+func (n *Notification) Delivered(deliveryErr error) {
+	now := time.Now()
+	n.Attempts++
+	if deliveryErr == nil {
+		n.Status = NotificationStatusSent
+		n.SentAt = now.Unix()
+		n.LastError = ""
+	} else {
+		n.LastError = deliveryErr.Error()
+		if n.Attempts >= notificationMaxAttempts {
+			n.Status = NotificationStatusFailed
+		} else {
+			n.NextAttemptAt = now.Add(notificationBackoff[n.Attempts-1]).Unix()
+		}
+	}
+	n.save()
+}
+
+// Failed records a delivery that is not to be retried
+func (n *Notification) Failed(deliveryErr error) {
+	n.Attempts++
+	n.Status = NotificationStatusFailed
+	n.LastError = deliveryErr.Error()
+	n.save()
+}
+
+func (n *Notification) save() {
+	err := DB.Model(n).Select("status", "attempts", "last_error", "next_attempt_at", "sent_at").Updates(n).Error
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update notification #%d: %s", n.Id, err.Error()))
+	}
+}
+
+type balanceThresholds struct {
+	thresholds []int
+	expireAt   int64
+}
+
+// the thresholds of the balance_low subscriptions are cached, so consuming quota only looks up the subscriptions
+// when the balance crosses one of them
+var balanceThresholdsCache = make(map[int]*balanceThresholds)
+var balanceThresholdsLock sync.Mutex
+
+func invalidateBalanceThresholds(userId int) {
+	balanceThresholdsLock.Lock()
+	defer balanceThresholdsLock.Unlock()
+	delete(balanceThresholdsCache, userId)
+}
+
+func getBalanceThresholds(userId int) []int {
+	balanceThresholdsLock.Lock()
+	defer balanceThresholdsLock.Unlock()
+	now := time.Now().Unix()
+	if cached, ok := balanceThresholdsCache[userId]; ok && cached.expireAt > now {
+		return cached.thresholds
+	}
+	var thresholds []int
+	err := DB.Model(&NotificationSubscription{}).Where("user_id = ? and event = ? and enabled = ?", userId,
+		NotificationEventBalanceLow, true).Pluck("threshold", &thresholds).Error
+	if err != nil {
+		common.SysError("failed to get balance thresholds: " + err.Error())
+	}
+	balanceThresholdsCache[userId] = &balanceThresholds{thresholds: thresholds, expireAt: now + int64(common.SyncFrequency)}
+	return thresholds
+}
+
+// notifyBalance notifies the balance_low subscriptions whose threshold the quota of the user dropped below
+func notifyBalance(userId int, before int, after int) {
+	if after >= before {
+		return
+	}
+	for _, threshold := range getBalanceThresholds(userId) {
+		if before < threshold || after >= threshold {
+			continue
+		}
+		var subscriptions []*NotificationSubscription
+		err := DB.Where("user_id = ? and event = ? and enabled = ? and threshold = ?", userId,
+			NotificationEventBalanceLow, true, threshold).Find(&subscriptions).Error
+		if err != nil {
+			common.SysError("failed to get notification subscriptions: " + err.Error())
+			return
+		}
+		notify(subscriptions, NotificationMessage{
+			Event:    NotificationEventBalanceLow,
+			DedupKey: fmt.Sprintf("balance_low:%d", threshold),
+			Title:    "余额不足提醒",
+			Content:  fmt.Sprintf("您的余额已低于 %s，当前剩余 %s，为了不影响您的使用，请及时充值。", common.LogQuota(threshold), common.LogQuota(after)),
+			Data: map[string]interface{}{
+				"user_id":   userId,
+				"threshold": threshold,
+				"quota":     after,
+			},
+		})
+	}
+}
+
+func notifyTopUp(userId int, quota int, dedupKey string, source string) {
+	Notify(userId, NotificationMessage{
+		Event:    NotificationEventTopUpSuccess,
+		DedupKey: dedupKey,
+		Title:    "充值成功",
+		Content:  fmt.Sprintf("您已通过%s成功充值 %s。", source, common.LogQuota(quota)),
+		Data: map[string]interface{}{
+			"user_id": userId,
+			"quota":   quota,
+			"source":  source,
+		},
+	})
+}
+
+// NotifyTaskFailed notifies the user that an asynchronous task failed
+func NotifyTaskFailed(userId int, platform string, taskId string, reason string) {
+	Notify(userId, NotificationMessage{
+		Event:    NotificationEventTaskFailed,
+		DedupKey: fmt.Sprintf("task_failed:%s:%s", platform, taskId),
+		Title:    "任务执行失败",
+		Content:  fmt.Sprintf("您的 %s 任务 %s 执行失败：%s", platform, taskId, reason),
+		Data: map[string]interface{}{
+			"platform": platform,
+			"task_id":  taskId,
+			"reason":   reason,
+		},
+	})
+}
@@ -69,6 +69,7 @@ func InitOptionMap() {
 	common.OptionMap["PaymentEnabled"] = strconv.FormatBool(common.PaymentEnabled)
 	common.OptionMap["StripeUnitPrice"] = strconv.FormatFloat(common.StripeUnitPrice, 'f', -1, 64)
 	common.OptionMap["MinTopUp"] = strconv.Itoa(common.MinTopUp)
+	common.OptionMap["SubscriptionGraceDays"] = strconv.Itoa(common.SubscriptionGraceDays)
 	common.OptionMap["TopupGroupRatio"] = common.TopupGroupRatio2JSONString()
 	common.OptionMap["Chats"] = constant.Chats2JsonString()
 	common.OptionMap["GitHubClientId"] = ""
@@ -87,17 +88,42 @@ func InitOptionMap() {
 	common.OptionMap["QuotaForInviter"] = strconv.Itoa(common.QuotaForInviter)
 	common.OptionMap["QuotaForInvitee"] = strconv.Itoa(common.QuotaForInvitee)
 	common.OptionMap["QuotaRemindThreshold"] = strconv.Itoa(common.QuotaRemindThreshold)
+	common.OptionMap["NotificationDedupMinutes"] = strconv.Itoa(common.NotificationDedupMinutes)
+	common.OptionMap["StatementEmailEnabled"] = strconv.FormatBool(common.StatementEmailEnabled)
 	common.OptionMap["PreConsumedQuota"] = strconv.Itoa(common.PreConsumedQuota)
 	common.OptionMap["ModelRatio"] = common.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = common.ModelPrice2JSONString()
 	common.OptionMap["GroupRatio"] = common.GroupRatio2JSONString()
 	common.OptionMap["UserUsableGroups"] = common.UserUsableGroups2JSONString()
 	common.OptionMap["CompletionRatio"] = common.CompletionRatio2JSONString()
+	common.OptionMap["CacheRatio"] = common.CacheRatio2JSONString()
+	common.OptionMap["CreateCacheRatio"] = common.CreateCacheRatio2JSONString()
+	common.OptionMap["AudioRatio"] = common.AudioRatio2JSONString()
+	common.OptionMap["AudioCompletionRatio"] = common.AudioCompletionRatio2JSONString()
+	common.OptionMap["ModelRatioTiers"] = common.ModelRatioTiers2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	common.OptionMap["ChatLink"] = common.ChatLink
 	common.OptionMap["ChatLink2"] = common.ChatLink2
 	common.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(common.QuotaPerUnit, 'f', -1, 64)
+	common.OptionMap["BatchDiscountRatio"] = strconv.FormatFloat(common.BatchDiscountRatio, 'f', -1, 64)
 	common.OptionMap["RetryTimes"] = strconv.Itoa(common.RetryTimes)
+	common.OptionMap["CircuitBreakerEnabled"] = strconv.FormatBool(common.CircuitBreakerEnabled)
+	common.OptionMap["CircuitBreakerFailureThreshold"] = strconv.Itoa(common.CircuitBreakerFailureThreshold)
+	common.OptionMap["CircuitBreakerErrorRate"] = strconv.FormatFloat(common.CircuitBreakerErrorRate, 'f', -1, 64)
+	common.OptionMap["CircuitBreakerMinRequests"] = strconv.Itoa(common.CircuitBreakerMinRequests)
+	common.OptionMap["CircuitBreakerWindow"] = strconv.Itoa(common.CircuitBreakerWindow)
+	common.OptionMap["CircuitBreakerCooldown"] = strconv.Itoa(common.CircuitBreakerCooldown)
+	common.OptionMap["CircuitBreakerHalfOpenRequests"] = strconv.Itoa(common.CircuitBreakerHalfOpenRequests)
+	common.OptionMap["ChannelQueueSize"] = strconv.Itoa(common.ChannelQueueSize)
+	common.OptionMap["ChannelQueueTimeout"] = strconv.Itoa(common.ChannelQueueTimeout)
+	common.OptionMap["ChannelHealthRetentionDays"] = strconv.Itoa(common.ChannelHealthRetentionDays)
+	common.OptionMap["ChannelSelectStrategy"] = common.ChannelSelectStrategy
+	common.OptionMap["ChannelSelectStrategies"] = common.ChannelSelectStrategies2JSONString()
+	common.OptionMap["ChannelAffinities"] = common.ChannelAffinities2JSONString()
+	common.OptionMap["ChannelAffinityTTL"] = strconv.Itoa(common.ChannelAffinityTTL)
+	common.OptionMap["ChannelAffinityHeaderName"] = common.ChannelAffinityHeaderName
+	common.OptionMap["ChannelHedges"] = common.ChannelHedges2JSONString()
+	common.OptionMap["ModelFallbacks"] = common.ModelFallbacks2JSONString()
 	common.OptionMap["DataExportInterval"] = strconv.Itoa(common.DataExportInterval)
 	common.OptionMap["DataExportDefaultTime"] = common.DataExportDefaultTime
 	common.OptionMap["DefaultCollapseSidebar"] = strconv.FormatBool(common.DefaultCollapseSidebar)
@@ -189,6 +215,8 @@ func updateOptionMap(key string, value string) (err error) {
 			common.TurnstileCheckEnabled = boolValue
 		case "RegisterEnabled":
 			common.RegisterEnabled = boolValue
+		case "StatementEmailEnabled":
+			common.StatementEmailEnabled = boolValue
 		case "UserSelfDeletionEnabled":
 			common.UserSelfDeletionEnabled = boolValue
 		case "EmailDomainRestrictionEnabled":
@@ -199,6 +227,8 @@ func updateOptionMap(key string, value string) (err error) {
 			common.AutomaticDisableChannelEnabled = boolValue
 		case "AutomaticEnableChannelEnabled":
 			common.AutomaticEnableChannelEnabled = boolValue
+		case "CircuitBreakerEnabled":
+			common.CircuitBreakerEnabled = boolValue
 		case "LogConsumeEnabled":
 			common.LogConsumeEnabled = boolValue
 		case "DisplayInCurrencyEnabled":
@@ -267,6 +297,8 @@ func updateOptionMap(key string, value string) (err error) {
 		common.StripeUnitPrice, _ = strconv.ParseFloat(value, 64)
 	case "MinTopUp":
 		common.MinTopUp, _ = strconv.Atoi(value)
+	case "SubscriptionGraceDays":
+		common.SubscriptionGraceDays, _ = strconv.Atoi(value)
 	case "TopupGroupRatio":
 		err = common.UpdateTopupGroupRatioByJSONString(value)
 	case "GitHubClientId":
@@ -307,10 +339,44 @@ func updateOptionMap(key string, value string) (err error) {
 		common.QuotaForInvitee, _ = strconv.Atoi(value)
 	case "QuotaRemindThreshold":
 		common.QuotaRemindThreshold, _ = strconv.Atoi(value)
+	case "NotificationDedupMinutes":
+		common.NotificationDedupMinutes, _ = strconv.Atoi(value)
 	case "PreConsumedQuota":
 		common.PreConsumedQuota, _ = strconv.Atoi(value)
 	case "RetryTimes":
 		common.RetryTimes, _ = strconv.Atoi(value)
+	case "CircuitBreakerFailureThreshold":
+		common.CircuitBreakerFailureThreshold, _ = strconv.Atoi(value)
+	case "CircuitBreakerErrorRate":
+		common.CircuitBreakerErrorRate, _ = strconv.ParseFloat(value, 64)
+	case "CircuitBreakerMinRequests":
+		common.CircuitBreakerMinRequests, _ = strconv.Atoi(value)
+	case "CircuitBreakerWindow":
+		common.CircuitBreakerWindow, _ = strconv.Atoi(value)
+	case "CircuitBreakerCooldown":
+		common.CircuitBreakerCooldown, _ = strconv.Atoi(value)
+	case "CircuitBreakerHalfOpenRequests":
+		common.CircuitBreakerHalfOpenRequests, _ = strconv.Atoi(value)
+	case "ChannelQueueSize":
+		common.ChannelQueueSize, _ = strconv.Atoi(value)
+	case "ChannelQueueTimeout":
+		common.ChannelQueueTimeout, _ = strconv.Atoi(value)
+	case "ChannelHealthRetentionDays":
+		common.ChannelHealthRetentionDays, _ = strconv.Atoi(value)
+	case "ChannelSelectStrategy":
+		common.ChannelSelectStrategy = value
+	case "ChannelSelectStrategies":
+		err = common.UpdateChannelSelectStrategiesByJSONString(value)
+	case "ChannelAffinities":
+		err = common.UpdateChannelAffinitiesByJSONString(value)
+	case "ChannelAffinityTTL":
+		common.ChannelAffinityTTL, _ = strconv.Atoi(value)
+	case "ChannelAffinityHeaderName":
+		common.ChannelAffinityHeaderName = value
+	case "ChannelHedges":
+		err = common.UpdateChannelHedgesByJSONString(value)
+	case "ModelFallbacks":
+		err = common.UpdateModelFallbacksByJSONString(value)
 	case "DataExportInterval":
 		common.DataExportInterval, _ = strconv.Atoi(value)
 	case "DataExportDefaultTime":
@@ -323,6 +389,16 @@ func updateOptionMap(key string, value string) (err error) {
 		err = common.UpdateUserUsableGroupsByJSONString(value)
 	case "CompletionRatio":
 		err = common.UpdateCompletionRatioByJSONString(value)
+	case "CacheRatio":
+		err = common.UpdateCacheRatioByJSONString(value)
+	case "CreateCacheRatio":
+		err = common.UpdateCreateCacheRatioByJSONString(value)
+	case "AudioRatio":
+		err = common.UpdateAudioRatioByJSONString(value)
+	case "AudioCompletionRatio":
+		err = common.UpdateAudioCompletionRatioByJSONString(value)
+	case "ModelRatioTiers":
+		err = common.UpdateModelRatioTiersByJSONString(value)
 	case "ModelPrice":
 		err = common.UpdateModelPriceByJSONString(value)
 	case "TopUpLink":
@@ -335,6 +411,8 @@ func updateOptionMap(key string, value string) (err error) {
 		common.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
 	case "QuotaPerUnit":
 		common.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
+	case "BatchDiscountRatio":
+		common.BatchDiscountRatio, _ = strconv.ParseFloat(value, 64)
 	case "SensitiveWords":
 		constant.SensitiveWordsFromString(value)
 	case "StreamCacheQueueLength":
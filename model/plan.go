@@ -0,0 +1,96 @@
+package model
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"one-api/common"
+	"time"
+)
+
+// Plan is a subscription sold through Stripe recurring checkout, it grants its quota every period
+type Plan struct {
+	Id          int     `json:"id"`
+	Name        string  `json:"name" gorm:"index"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"` // per period, in units of the currency, e.g. 9.99
+	Currency    string  `json:"currency" gorm:"type:varchar(8);default:'usd'"`
+	// StripePriceId is a recurring price created in Stripe, it is charged instead of Price and Currency when set
+	StripePriceId string         `json:"stripe_price_id" gorm:"type:varchar(64)"`
+	Period        string         `json:"period" gorm:"type:varchar(8);default:'month'"` // day, week, month or year
+	Quota         int            `json:"quota"`                                         // granted every period
+	Group         string         `json:"group" gorm:"type:varchar(64)"`                 // assigned while subscribed, empty keeps the group of the user
+	RollOver      bool           `json:"roll_over"`                                     // whether quota left at the end of a period is kept
+	Status        int            `json:"status" gorm:"default:1"`
+	CreatedTime   int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+var planPeriods = map[string][3]int{
+	"day":   {0, 0, 1},
+	"week":  {0, 0, 7},
+	"month": {0, 1, 0},
+	"year":  {1, 0, 0},
+}
+
+func (plan *Plan) Validate() error {
+	if plan.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if plan.Currency == "" {
+		plan.Currency = "usd"
+	}
+	if _, ok := planPeriods[plan.Period]; !ok {
+		return errors.New("无效的套餐周期，可选 day、week、month、year")
+	}
+	if plan.Quota < 0 || plan.Price < 0 {
+		return errors.New("套餐价格和额度不能为负数")
+	}
+	if plan.StripePriceId == "" && plan.Price <= 0 {
+		return errors.New("未设置 Stripe 价格 ID 时套餐价格必须大于 0")
+	}
+	return nil
+}
+
+// PeriodEnd returns the end of the period starting at start
+func (plan *Plan) PeriodEnd(start int64) int64 {
+	period := planPeriods[plan.Period]
+	return time.Unix(start, 0).AddDate(period[0], period[1], period[2]).Unix()
+}
+
+func GetAllPlans(enabledOnly bool) ([]*Plan, error) {
+	var plans []*Plan
+	query := DB.Order("price asc, id asc")
+	if enabledOnly {
+		query = query.Where("status = ?", common.PlanStatusEnabled)
+	}
+	err := query.Find(&plans).Error
+	return plans, err
+}
+
+// GetPlanById also finds deleted plans, since their subscriptions keep running until they lapse
+func GetPlanById(id int) (*Plan, error) {
+	return getPlanById(DB, id)
+}
+
+func getPlanById(tx *gorm.DB, id int) (*Plan, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	plan := Plan{Id: id}
+	err := tx.Unscoped().First(&plan, "id = ?", id).Error
+	return &plan, err
+}
+
+func (plan *Plan) Insert() error {
+	plan.CreatedTime = common.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+func (plan *Plan) Update() error {
+	return DB.Model(plan).Select("name", "description", "price", "currency", "stripe_price_id", "period", "quota",
+		"group", "roll_over", "status").Updates(plan).Error
+}
+
+func (plan *Plan) Delete() error {
+	return DB.Delete(plan).Error
+}
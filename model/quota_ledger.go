@@ -0,0 +1,209 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"one-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	QuotaChangeOpening      = "opening" // balance held before the ledger existed
+	QuotaChangeRegister     = "register"
+	QuotaChangeTopUp        = "topup"
+	QuotaChangeRedemption   = "redemption"
+	QuotaChangeSubscription = "subscription"
+	QuotaChangeReferral     = "referral"
+	QuotaChangeAffTransfer  = "aff_transfer"
+	QuotaChangeAdminAdjust  = "admin_adjust"
+	QuotaChangePreConsume   = "pre_consume"
+	QuotaChangeConsume      = "consume"
+	QuotaChangeRefund       = "refund"
+)
+
+// QuotaChange tells why the quota of a user changes, it is recorded in the ledger with the change
+type QuotaChange struct {
+	Type        string
+	Reason      string
+	ReferenceId string // e.g. the request id, the trade number or the task id
+}
+
+// QuotaLedgerEntry is an immutable double-entry record: Amount moves out of the debit account into the credit
+// account. The account of a user is "user:<id>", its referral rewards are held in "aff:<id>", quota coming from or
+// going to the outside is booked against "system:<type>". The balance of an account is what was credited to it
+// minus what was debited from it, and the balances of all the accounts always sum to zero.
+type QuotaLedgerEntry struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index:idx_quota_ledger_user,priority:1"`
+	Type          string `json:"type" gorm:"type:varchar(32)"`
+	DebitAccount  string `json:"debit_account" gorm:"type:varchar(64)"`
+	CreditAccount string `json:"credit_account" gorm:"type:varchar(64)"`
+	Amount        int    `json:"amount"` // always positive
+	Reason        string `json:"reason"`
+	ReferenceId   string `json:"reference_id" gorm:"type:varchar(128);index"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index:idx_quota_ledger_user,priority:2"`
+}
+
+var errQuotaLedgerImmutable = errors.New("quota ledger entries are immutable")
+
+func (entry *QuotaLedgerEntry) BeforeUpdate(tx *gorm.DB) error {
+	return errQuotaLedgerImmutable
+}
+
+func (entry *QuotaLedgerEntry) BeforeDelete(tx *gorm.DB) error {
+	return errQuotaLedgerImmutable
+}
+
+func userQuotaAccount(userId int) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+func userAffQuotaAccount(userId int) string {
+	return fmt.Sprintf("aff:%d", userId)
+}
+
+// newQuotaLedgerEntry books delta, positive when the account gains quota, between account and the account quota
+// of the change comes from or goes to. It returns nil when delta is 0.
+func newQuotaLedgerEntry(userId int, account string, delta int, change QuotaChange) *QuotaLedgerEntry {
+	if delta == 0 {
+		return nil
+	}
+	contra := "system:" + change.Type
+	if change.Type == QuotaChangeAffTransfer {
+		contra = userAffQuotaAccount(userId)
+	}
+	entry := &QuotaLedgerEntry{
+		UserId:        userId,
+		Type:          change.Type,
+		DebitAccount:  contra,
+		CreditAccount: account,
+		Amount:        delta,
+		Reason:        change.Reason,
+		ReferenceId:   change.ReferenceId,
+		CreatedAt:     common.GetTimestamp(),
+	}
+	if delta < 0 {
+		entry.DebitAccount, entry.CreditAccount = account, contra
+		entry.Amount = -delta
+	}
+	return entry
+}
+
+// recordUserQuotaChange records a change of the quota of the user, in the transaction that made it
+func recordUserQuotaChange(tx *gorm.DB, userId int, delta int, change QuotaChange) error {
+	entry := newQuotaLedgerEntry(userId, userQuotaAccount(userId), delta, change)
+	if entry == nil {
+		return nil
+	}
+	return tx.Create(entry).Error
+}
+
+// recordUserAffQuotaChange records a change of the referral rewards of the user, in the transaction that made it
+func recordUserAffQuotaChange(tx *gorm.DB, userId int, delta int, change QuotaChange) error {
+	entry := newQuotaLedgerEntry(userId, userAffQuotaAccount(userId), delta, change)
+	if entry == nil {
+		return nil
+	}
+	return tx.Create(entry).Error
+}
+
+// updateUserQuota changes the quota of the user by delta and records the entries explaining it
+func updateUserQuota(id int, delta int, entries []*QuotaLedgerEntry) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", delta)).Error
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+		return tx.Create(&entries).Error
+	})
+}
+
+func GetQuotaLedgerEntries(userId int, startIdx int, num int) ([]*QuotaLedgerEntry, error) {
+	var entries []*QuotaLedgerEntry
+	err := DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&entries).Error
+	return entries, err
+}
+
+// sumLedgerBalance returns the balance of an account according to the ledger
+func sumLedgerBalance(userId int, account string) (int, error) {
+	var balance int
+	err := DB.Model(&QuotaLedgerEntry{}).
+		Select("coalesce(sum(case when credit_account = ? then amount when debit_account = ? then -amount else 0 end), 0)", account, account).
+		Where("user_id = ?", userId).Scan(&balance).Error
+	return balance, err
+}
+
+// QuotaLedgerCheck compares the balances of a user with the ones its ledger adds up to
+type QuotaLedgerCheck struct {
+	UserId         int  `json:"user_id"`
+	Quota          int  `json:"quota"`
+	LedgerQuota    int  `json:"ledger_quota"`
+	AffQuota       int  `json:"aff_quota"`
+	LedgerAffQuota int  `json:"ledger_aff_quota"`
+	Consistent     bool `json:"consistent"`
+}
+
+// CheckQuotaLedger checks the balances of the user against its ledger. With BATCH_UPDATE_ENABLED the quota and its
+// entries are written together every interval, so both lag behind the same way.
+func CheckQuotaLedger(userId int) (*QuotaLedgerCheck, error) {
+	user := User{}
+	err := DB.Unscoped().Select("id", "quota", "aff_quota").First(&user, "id = ?", userId).Error
+	if err != nil {
+		return nil, err
+	}
+	check := &QuotaLedgerCheck{
+		UserId:   user.Id,
+		Quota:    user.Quota,
+		AffQuota: user.AffQuota,
+	}
+	check.LedgerQuota, err = sumLedgerBalance(userId, userQuotaAccount(userId))
+	if err != nil {
+		return nil, err
+	}
+	check.LedgerAffQuota, err = sumLedgerBalance(userId, userAffQuotaAccount(userId))
+	if err != nil {
+		return nil, err
+	}
+	check.Consistent = check.Quota == check.LedgerQuota && check.AffQuota == check.LedgerAffQuota
+	return check, nil
+}
+
+// CheckAllQuotaLedgers returns the users whose balances disagree with their ledger
+func CheckAllQuotaLedgers() ([]*QuotaLedgerCheck, error) {
+	var checks []*QuotaLedgerCheck
+	err := DB.Raw(`select users.id as user_id, users.quota as quota, coalesce(ledger.quota, 0) as ledger_quota,
+		users.aff_quota as aff_quota, coalesce(ledger.aff_quota, 0) as ledger_aff_quota
+		from users left join (
+			select user_id,
+				sum(case when credit_account like 'user:%' then amount when debit_account like 'user:%' then -amount else 0 end) as quota,
+				sum(case when credit_account like 'aff:%' then amount when debit_account like 'aff:%' then -amount else 0 end) as aff_quota
+			from quota_ledger_entries group by user_id
+		) ledger on ledger.user_id = users.id
+		where users.quota <> coalesce(ledger.quota, 0) or users.aff_quota <> coalesce(ledger.aff_quota, 0)`).
+		Scan(&checks).Error
+	return checks, err
+}
+
+// openQuotaLedgers books the balances users held before the ledger existed, so that their ledger adds up
+func openQuotaLedgers() error {
+	var users []*User
+	err := DB.Unscoped().Select("id", "quota", "aff_quota").
+		Where("id not in (?)", DB.Model(&QuotaLedgerEntry{}).Select("user_id")).
+		Where("quota <> 0 or aff_quota <> 0").Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return err
+	}
+	change := QuotaChange{Type: QuotaChangeOpening, Reason: "账本启用时的余额"}
+	var entries []*QuotaLedgerEntry
+	for _, user := range users {
+		if entry := newQuotaLedgerEntry(user.Id, userQuotaAccount(user.Id), user.Quota, change); entry != nil {
+			entries = append(entries, entry)
+		}
+		if entry := newQuotaLedgerEntry(user.Id, userAffQuotaAccount(user.Id), user.AffQuota, change); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	common.SysLog(fmt.Sprintf("opening the quota ledger of %d users", len(users)))
+	return DB.CreateInBatches(entries, 100).Error
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"one-api/common"
+	"strconv"
 )
 
 type Redemption struct {
@@ -58,7 +60,7 @@ func Redeem(key string, userId int) (quota int, err error) {
 	}
 	common.RandomSleep()
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
 		}
@@ -69,6 +71,14 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if err != nil {
 			return err
 		}
+		err = recordUserQuotaChange(tx, userId, redemption.Quota, QuotaChange{
+			Type:        QuotaChangeRedemption,
+			Reason:      "兑换码充值",
+			ReferenceId: strconv.Itoa(redemption.Id),
+		})
+		if err != nil {
+			return err
+		}
 		redemption.RedeemedTime = common.GetTimestamp()
 		redemption.Status = common.RedemptionCodeStatusUsed
 		redemption.UsedUserId = userId
@@ -79,6 +89,7 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return 0, errors.New("兑换失败，" + err.Error())
 	}
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", common.LogQuota(redemption.Quota), redemption.Id))
+	go notifyTopUp(userId, redemption.Quota, fmt.Sprintf("redemption:%d", redemption.Id), "兑换码")
 	return redemption.Quota, nil
 }
 
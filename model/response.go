@@ -0,0 +1,59 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// StoredResponse keeps a /v1/responses result locally, so that previous_response_id and
+// retrieval work no matter which channel produced the response
+type StoredResponse struct {
+	Id                 int             `json:"id"`
+	ResponseId         string          `json:"response_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId             int             `json:"user_id" gorm:"index"`
+	ChannelId          int             `json:"channel_id"`
+	Model              string          `json:"model"`
+	PreviousResponseId string          `json:"previous_response_id" gorm:"type:varchar(64)"`
+	Input              json.RawMessage `json:"input" gorm:"type:json"` // 会话到目前为止的全部输入项，包含之前的响应
+	Data               json.RawMessage `json:"data" gorm:"type:json"`  // 响应对象
+	CreatedAt          int64           `json:"created_at" gorm:"bigint;index"`
+}
+
+func (r *StoredResponse) Insert() error {
+	return DB.Create(r).Error
+}
+
+func GetStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	if responseId == "" {
+		return nil, errors.New("response id 为空！")
+	}
+	var response StoredResponse
+	err := DB.Where("user_id = ? and response_id = ?", userId, responseId).First(&response).Error
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func DeleteStoredResponse(userId int, responseId string) (bool, error) {
+	result := DB.Where("user_id = ? and response_id = ?", userId, responseId).Delete(&StoredResponse{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ConversationItems returns the input items followed by the output items of the response,
+// which is what a follow-up request with previous_response_id continues from
+func (r *StoredResponse) ConversationItems() ([]map[string]any, error) {
+	var items []map[string]any
+	if len(r.Input) > 0 {
+		if err := json.Unmarshal(r.Input, &items); err != nil {
+			return nil, err
+		}
+	}
+	var data struct {
+		Output []map[string]any `json:"output"`
+	}
+	if err := json.Unmarshal(r.Data, &data); err != nil {
+		return nil, err
+	}
+	return append(items, data.Output...), nil
+}
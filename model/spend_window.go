@@ -0,0 +1,311 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	relaycommon "one-api/relay/common"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	SpendWindowOwnerToken = "token"
+	SpendWindowOwnerUser  = "user"
+)
+
+// spend windows are calendar periods in the time zone of the server, weeks start on monday
+var spendWindows = []string{"day", "week", "month"}
+
+var spendWindowNames = map[string]string{
+	"day":   "每日",
+	"week":  "每周",
+	"month": "每月",
+}
+
+// SpendLimits caps the quota a token or a user spends per day, week and month, zero means unlimited
+type SpendLimits struct {
+	Daily   int `json:"daily_quota_limit"`
+	Weekly  int `json:"weekly_quota_limit"`
+	Monthly int `json:"monthly_quota_limit"`
+}
+
+func (l SpendLimits) IsZero() bool {
+	return l.Daily <= 0 && l.Weekly <= 0 && l.Monthly <= 0
+}
+
+func (l SpendLimits) Validate() error {
+	if l.Daily < 0 || l.Weekly < 0 || l.Monthly < 0 {
+		return errors.New("消费限额不能为负数")
+	}
+	return nil
+}
+
+func (l SpendLimits) limit(window string) int {
+	switch window {
+	case "day":
+		return l.Daily
+	case "week":
+		return l.Weekly
+	case "month":
+		return l.Monthly
+	}
+	return 0
+}
+
+// SpendWindowUsage is the quota spent in the current period of a window
+type SpendWindowUsage struct {
+	Window  string `json:"window"` // day, week or month
+	Limit   int    `json:"limit"`
+	Used    int    `json:"used"`
+	ResetAt int64  `json:"reset_at"`
+}
+
+// SpendWindowError is returned when a request would spend more than a window of its token or user allows
+type SpendWindowError struct {
+	Owner string
+	SpendWindowUsage
+}
+
+func (e *SpendWindowError) Error() string {
+	owner := "令牌"
+	if e.Owner == SpendWindowOwnerUser {
+		owner = "用户"
+	}
+	return fmt.Sprintf("%s%s消费额度已用尽，已用 %d / %d，将于 %s 重置", owner, spendWindowNames[e.Window], e.Used,
+		e.Limit, time.Unix(e.ResetAt, 0).Format("2006-01-02 15:04:05"))
+}
+
+// spendWindowPeriod returns the start and the end of the period of the window now is in
+func spendWindowPeriod(window string, now time.Time) (int64, int64) {
+	year, month, day := now.Date()
+	var start, end time.Time
+	switch window {
+	case "week":
+		start = time.Date(year, month, day-(int(now.Weekday())+6)%7, 0, 0, 0, 0, now.Location())
+		end = start.AddDate(0, 0, 7)
+	case "month":
+		start = time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+		end = start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+		end = start.AddDate(0, 0, 1)
+	}
+	return start.Unix(), end.Unix()
+}
+
+func spendWindowKey(owner string, id int, window string, start int64) string {
+	return fmt.Sprintf("spend_window:%s:%d:%s:%d", owner, id, window, start)
+}
+
+type spendWindowStore interface {
+	// get returns the quota spent in a period, ok is false when the period is not counted yet
+	get(key string) (quota int, ok bool, err error)
+	// init starts counting a period from quota unless it is counted already, it returns the quota spent
+	init(key string, quota int, expireAt int64) (int, error)
+	// add counts quota in the periods that are counted already
+	add(keys []string, quota int) error
+}
+
+func getSpendWindowStore() spendWindowStore {
+	if common.RedisEnabled {
+		return redisSpendWindowStore{}
+	}
+	return memorySpendWindows
+}
+
+type memorySpendWindow struct {
+	quota    int
+	expireAt int64
+}
+
+// memorySpendWindowStore counts the spending of this instance only
+type memorySpendWindowStore struct {
+	mutex   sync.Mutex
+	windows map[string]*memorySpendWindow
+}
+
+var memorySpendWindows = &memorySpendWindowStore{windows: make(map[string]*memorySpendWindow)}
+
+func (s *memorySpendWindowStore) get(key string) (int, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	w, ok := s.windows[key]
+	if !ok {
+		return 0, false, nil
+	}
+	return w.quota, true, nil
+}
+
+func (s *memorySpendWindowStore) init(key string, quota int, expireAt int64) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if w, ok := s.windows[key]; ok {
+		return w.quota, nil
+	}
+	// periods are only started here, so this is where the ended ones are dropped
+	now := time.Now().Unix()
+	for k, w := range s.windows {
+		if w.expireAt < now {
+			delete(s.windows, k)
+		}
+	}
+	s.windows[key] = &memorySpendWindow{quota: quota, expireAt: expireAt}
+	return quota, nil
+}
+
+func (s *memorySpendWindowStore) add(keys []string, quota int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, key := range keys {
+		if w, ok := s.windows[key]; ok {
+			w.quota += quota
+		}
+	}
+	return nil
+}
+
+var redisSpendWindowAddScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('INCRBY', key, ARGV[1])
+	end
+end
+return 1
+`)
+
+// redisSpendWindowStore shares the counters between instances
+type redisSpendWindowStore struct{}
+
+func (redisSpendWindowStore) get(key string) (int, bool, error) {
+	value, err := common.RDB.Get(context.Background(), key).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	quota, err := strconv.Atoi(value)
+	return quota, err == nil, err
+}
+
+func (s redisSpendWindowStore) init(key string, quota int, expireAt int64) (int, error) {
+	ok, err := common.RDB.SetNX(context.Background(), key, quota, time.Until(time.Unix(expireAt, 0))).Result()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		// another instance started counting first
+		quota, _, err = s.get(key)
+	}
+	return quota, err
+}
+
+func (redisSpendWindowStore) add(keys []string, quota int) error {
+	return redisSpendWindowAddScript.Run(context.Background(), common.RDB, keys, quota).Err()
+}
+
+// sumSpentQuota returns the quota consumed by a token or a user since start according to the consume logs
+func sumSpentQuota(owner string, id int, start int64) (int, error) {
+	var quota int
+	err := LOG_DB.Table("logs").Select("coalesce(sum(quota), 0)").
+		Where(owner+"_id = ? and type = ? and created_at >= ?", id, LogTypeConsume, start).Scan(&quota).Error
+	return quota, err
+}
+
+// GetSpendWindows returns the usage of the windows the limits cap. A period is counted from the consume logs the
+// first time it is checked, then from the quota consumed by the requests.
+func GetSpendWindows(owner string, id int, limits SpendLimits) ([]SpendWindowUsage, error) {
+	store := getSpendWindowStore()
+	now := time.Now()
+	var usages []SpendWindowUsage
+	for _, window := range spendWindows {
+		limit := limits.limit(window)
+		if limit <= 0 {
+			continue
+		}
+		start, end := spendWindowPeriod(window, now)
+		key := spendWindowKey(owner, id, window, start)
+		used, ok, err := store.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			used, err = sumSpentQuota(owner, id, start)
+			if err != nil {
+				return nil, err
+			}
+			used, err = store.init(key, used, end)
+			if err != nil {
+				return nil, err
+			}
+		}
+		usages = append(usages, SpendWindowUsage{
+			Window:  window,
+			Limit:   limit,
+			Used:    used,
+			ResetAt: end,
+		})
+	}
+	return usages, nil
+}
+
+// CheckSpendWindows returns a *SpendWindowError when spending quota would exceed a window of the token or the user.
+// A request crossing a limit is billed in full, the requests after it are refused until the period ends.
+func CheckSpendWindows(tokenId int, tokenLimits SpendLimits, userId int, quota int) error {
+	userLimits, err := CacheGetUserSpendLimits(userId)
+	if err != nil {
+		return err
+	}
+	owners := []struct {
+		owner  string
+		id     int
+		limits SpendLimits
+	}{
+		{SpendWindowOwnerToken, tokenId, tokenLimits},
+		{SpendWindowOwnerUser, userId, userLimits},
+	}
+	for _, o := range owners {
+		if o.id == 0 || o.limits.IsZero() {
+			continue
+		}
+		usages, err := GetSpendWindows(o.owner, o.id, o.limits)
+		if err != nil {
+			return err
+		}
+		for _, usage := range usages {
+			if usage.Used >= usage.Limit || usage.Used+quota > usage.Limit {
+				return &SpendWindowError{Owner: o.owner, SpendWindowUsage: usage}
+			}
+		}
+	}
+	return nil
+}
+
+// addSpendWindows counts consumed quota, negative when it is given back, in the windows of the token and the user
+func addSpendWindows(relayInfo *relaycommon.RelayInfo, quota int) {
+	if quota == 0 {
+		return
+	}
+	tokenId, userId := relayInfo.TokenId, relayInfo.UserId
+	if relayInfo.IsPlayground {
+		tokenId = 0
+	}
+	now := time.Now()
+	keys := make([]string, 0, len(spendWindows)*2)
+	for _, window := range spendWindows {
+		start, _ := spendWindowPeriod(window, now)
+		if tokenId != 0 {
+			keys = append(keys, spendWindowKey(SpendWindowOwnerToken, tokenId, window, start))
+		}
+		keys = append(keys, spendWindowKey(SpendWindowOwnerUser, userId, window, start))
+	}
+	err := getSpendWindowStore().add(keys, quota)
+	if err != nil {
+		common.SysError("failed to count spend windows: " + err.Error())
+	}
+}
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StatementLine aggregates the consumption of a model, a token or a day
+type StatementLine struct {
+	Name             string `json:"name"`
+	Requests         int    `json:"requests"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int    `json:"quota"`
+}
+
+// StatementChange sums the ledger entries of a type, Amount is the net change of the balance
+type StatementChange struct {
+	Type   string `json:"type"`
+	Count  int    `json:"count"`
+	Amount int    `json:"amount"`
+}
+
+// Statement is the account of a user, or of one of its tokens, for a month. The consumption comes from the consume
+// logs, the balances and their changes from the quota ledger, so that OpeningBalance plus the changes is
+// ClosingBalance. Token statements have no balance section.
+type Statement struct {
+	UserId    int    `json:"user_id"`
+	Username  string `json:"username"`
+	TokenId   int    `json:"token_id,omitempty"`
+	TokenName string `json:"token_name,omitempty"`
+	Period    string `json:"period"` // e.g. 2006-01
+	Start     int64  `json:"start"`
+	End       int64  `json:"end"`
+
+	Consumption StatementLine   `json:"consumption"`
+	ByModel     []StatementLine `json:"by_model"`
+	ByToken     []StatementLine `json:"by_token"`
+	ByDay       []StatementLine `json:"by_day"`
+
+	OpeningBalance int                 `json:"opening_balance"`
+	ClosingBalance int                 `json:"closing_balance"`
+	Changes        []StatementChange   `json:"changes"`
+	TopUps         []*QuotaLedgerEntry `json:"top_ups"`
+	Adjustments    []*QuotaLedgerEntry `json:"adjustments"`
+
+	GeneratedAt int64 `json:"generated_at"`
+}
+
+// statementTopUpTypes are listed one by one as top-ups, the changes made by requests are only summed
+var statementTopUpTypes = []string{QuotaChangeTopUp, QuotaChangeRedemption, QuotaChangeSubscription}
+var statementAdjustmentTypes = []string{QuotaChangeOpening, QuotaChangeRegister, QuotaChangeReferral,
+	QuotaChangeAffTransfer, QuotaChangeAdminAdjust}
+
+// StatementPeriod returns the start and the end of a month given as 2006-01, the previous month when it is empty
+func StatementPeriod(month string) (string, int64, int64, error) {
+	now := time.Now()
+	var start time.Time
+	if month == "" {
+		start = time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.Local)
+	} else {
+		var err error
+		start, err = time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			return "", 0, 0, errors.New("无效的账单月份，格式为 2006-01")
+		}
+	}
+	if start.After(now) {
+		return "", 0, 0, errors.New("账单月份尚未开始")
+	}
+	return start.Format("2006-01"), start.Unix(), start.AddDate(0, 1, 0).Unix(), nil
+}
+
+// GenerateStatement builds the statement of the user for a month, of one of its tokens when tokenId is not 0
+func GenerateStatement(userId int, tokenId int, month string) (*Statement, error) {
+	period, start, end, err := StatementPeriod(month)
+	if err != nil {
+		return nil, err
+	}
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	statement := &Statement{
+		UserId:      user.Id,
+		Username:    user.Username,
+		TokenId:     tokenId,
+		Period:      period,
+		Start:       start,
+		End:         end,
+		GeneratedAt: common.GetTimestamp(),
+	}
+	if tokenId != 0 {
+		token, err := GetTokenByIds(tokenId, userId)
+		if err != nil {
+			return nil, err
+		}
+		statement.TokenName = token.Name
+	}
+	if err = statement.sumConsumption(); err != nil {
+		return nil, err
+	}
+	if tokenId == 0 {
+		if err = statement.sumLedger(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+func (statement *Statement) consumeLogs() *gorm.DB {
+	tx := LOG_DB.Table("logs").Where("user_id = ? and type = ? and created_at >= ? and created_at < ?",
+		statement.UserId, LogTypeConsume, statement.Start, statement.End)
+	if statement.TokenId != 0 {
+		tx = tx.Where("token_id = ?", statement.TokenId)
+	}
+	return tx
+}
+
+const statementLineColumns = "count(*) as requests, coalesce(sum(prompt_tokens), 0) as prompt_tokens, " +
+	"coalesce(sum(completion_tokens), 0) as completion_tokens, coalesce(sum(quota), 0) as quota"
+
+func (statement *Statement) sumConsumption() error {
+	err := statement.consumeLogs().Select(statementLineColumns).Scan(&statement.Consumption).Error
+	if err != nil {
+		return err
+	}
+	err = statement.consumeLogs().Select("model_name as name, " + statementLineColumns).
+		Group("model_name").Order("quota desc").Scan(&statement.ByModel).Error
+	if err != nil {
+		return err
+	}
+	err = statement.consumeLogs().Select("token_name as name, " + statementLineColumns).
+		Group("token_name").Order("quota desc").Scan(&statement.ByToken).Error
+	if err != nil {
+		return err
+	}
+	// day by day rather than grouping by an expression, the databases disagree on date functions and integer division
+	for day := time.Unix(statement.Start, 0); day.Unix() < statement.End; day = day.AddDate(0, 0, 1) {
+		line := StatementLine{}
+		err = statement.consumeLogs().Where("created_at >= ? and created_at < ?", day.Unix(), day.AddDate(0, 0, 1).Unix()).
+			Select(statementLineColumns).Scan(&line).Error
+		if err != nil {
+			return err
+		}
+		if line.Requests > 0 {
+			line.Name = day.Format("2006-01-02")
+			statement.ByDay = append(statement.ByDay, line)
+		}
+	}
+	return nil
+}
+
+func (statement *Statement) sumLedger() error {
+	account := userQuotaAccount(statement.UserId)
+	balance := "coalesce(sum(case when credit_account = ? then amount when debit_account = ? then -amount else 0 end), 0)"
+	err := DB.Model(&QuotaLedgerEntry{}).Select(balance, account, account).
+		Where("user_id = ? and created_at < ?", statement.UserId, statement.Start).Scan(&statement.OpeningBalance).Error
+	if err != nil {
+		return err
+	}
+	inPeriod := func() *gorm.DB {
+		return DB.Model(&QuotaLedgerEntry{}).Where("user_id = ? and created_at >= ? and created_at < ? and (credit_account = ? or debit_account = ?)",
+			statement.UserId, statement.Start, statement.End, account, account)
+	}
+	err = inPeriod().Select("type, count(*) as count, "+
+		"sum(case when credit_account = ? then amount else -amount end) as amount", account).
+		Group("type").Order("type").Scan(&statement.Changes).Error
+	if err != nil {
+		return err
+	}
+	statement.ClosingBalance = statement.OpeningBalance
+	for _, change := range statement.Changes {
+		statement.ClosingBalance += change.Amount
+	}
+	err = inPeriod().Where("type in ?", statementTopUpTypes).Order("id asc").Find(&statement.TopUps).Error
+	if err != nil {
+		return err
+	}
+	return inPeriod().Where("type in ?", statementAdjustmentTypes).Order("id asc").Find(&statement.Adjustments).Error
+}
+
+// GetStatementUserIds returns the users with an email whose quota moved during the month, for the monthly emails
+func GetStatementUserIds(start int64, end int64) ([]int, error) {
+	var userIds []int
+	err := DB.Model(&QuotaLedgerEntry{}).Distinct("user_id").
+		Where("created_at >= ? and created_at < ? and user_id in (?)", start, end,
+			DB.Model(&User{}).Select("id").Where("email <> '' and status = ?", common.UserStatusEnabled)).
+		Pluck("user_id", &userIds).Error
+	return userIds, err
+}
@@ -0,0 +1,415 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"one-api/common"
+	"strconv"
+	"time"
+)
+
+// Subscription of a user to a plan. Stripe reports the payments, the periods are started by
+// ProcessSubscriptions: each period grants the quota of the plan, a plan without roll over first takes back what
+// was left of the previous grant. The grant is assumed to be used before any other quota of the user.
+type Subscription struct {
+	Id                   int    `json:"id"`
+	UserId               int    `json:"user_id" gorm:"index"`
+	PlanId               int    `json:"plan_id" gorm:"index"`
+	TradeNo              string `json:"trade_no" gorm:"unique"` // client reference of the checkout
+	StripeSubscriptionId string `json:"stripe_subscription_id" gorm:"type:varchar(64);index"`
+	Status               string `json:"status" gorm:"type:varchar(16);index"`
+	PreviousGroup        string `json:"previous_group" gorm:"type:varchar(64)"` // restored when the subscription lapses
+	PeriodStart          int64  `json:"period_start" gorm:"bigint"`
+	PeriodEnd            int64  `json:"period_end" gorm:"bigint"`
+	PaidUntil            int64  `json:"paid_until" gorm:"bigint"` // end of the last period paid in Stripe
+	GrantedQuota         int    `json:"granted_quota"`            // granted at the start of the current period
+	UsedQuotaAtGrant     int    `json:"used_quota_at_grant"`      // used quota of the user when it was granted
+	CancelAtPeriodEnd    bool   `json:"cancel_at_period_end"`
+	CreatedTime          int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime          int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func (subscription *Subscription) Insert() error {
+	subscription.CreatedTime = common.GetTimestamp()
+	subscription.UpdatedTime = subscription.CreatedTime
+	return DB.Create(subscription).Error
+}
+
+func GetAllSubscriptions(startIdx int, num int, userId int) ([]*Subscription, error) {
+	var subscriptions []*Subscription
+	query := DB.Order("id desc").Limit(num).Offset(startIdx)
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	err := query.Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// SubscriptionCheckoutSeconds is how long the checkout of a subscription stays open, a pending subscription blocks
+// new checkouts of the user until then
+const SubscriptionCheckoutSeconds = 3600
+
+var ErrSubscriptionRunning = errors.New("已有生效中的订阅")
+
+// HasOpenSubscription reports whether the user has a running subscription or a checkout that may still complete
+func HasOpenSubscription(userId int) (bool, error) {
+	var count int64
+	err := DB.Model(&Subscription{}).Where("user_id = ? and (status in ? or (status = ? and created_time > ?))", userId,
+		[]string{common.SubscriptionStatusActive, common.SubscriptionStatusPastDue}, common.SubscriptionStatusPending,
+		common.GetTimestamp()-SubscriptionCheckoutSeconds).Count(&count).Error
+	return count > 0, err
+}
+
+// GetUserSubscription returns the running subscription of the user, nil when there is none
+func GetUserSubscription(userId int) (*Subscription, error) {
+	var subscriptions []*Subscription
+	err := DB.Where("user_id = ? and status in ?", userId,
+		[]string{common.SubscriptionStatusActive, common.SubscriptionStatusPastDue}).Order("id desc").Limit(1).Find(&subscriptions).Error
+	if err != nil || len(subscriptions) == 0 {
+		return nil, err
+	}
+	return subscriptions[0], nil
+}
+
+// findSubscription locks the subscription by its trade number, or by its Stripe id when there is none
+func findSubscription(tx *gorm.DB, tradeNo string, stripeSubscriptionId string) (*Subscription, error) {
+	subscription := &Subscription{}
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	var err error
+	if tradeNo != "" {
+		err = query.Where("trade_no = ?", tradeNo).First(subscription).Error
+	} else if stripeSubscriptionId != "" {
+		err = query.Where("stripe_subscription_id = ?", stripeSubscriptionId).First(subscription).Error
+	} else {
+		return nil, errors.New("未提供订阅单号")
+	}
+	if err != nil {
+		return nil, errors.New("订阅不存在")
+	}
+	return subscription, nil
+}
+
+func (subscription *Subscription) save(tx *gorm.DB) error {
+	subscription.UpdatedTime = common.GetTimestamp()
+	return tx.Save(subscription).Error
+}
+
+// unusedQuota is what is left of the quota granted for the current period
+func (subscription *Subscription) unusedQuota(user *User) int {
+	unused := subscription.GrantedQuota - (user.UsedQuota - subscription.UsedQuotaAtGrant)
+	if unused > user.Quota {
+		unused = user.Quota
+	}
+	if unused < 0 {
+		unused = 0
+	}
+	return unused
+}
+
+// startPeriod grants the quota of the plan for the period, taking back the unused quota of the previous period
+// unless the plan rolls it over
+func (subscription *Subscription) startPeriod(tx *gorm.DB, plan *Plan, start int64, end int64) (int, error) {
+	user := &User{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota", "used_quota").
+		Where("id = ?", subscription.UserId).First(user).Error
+	if err != nil {
+		return 0, err
+	}
+	delta := plan.Quota
+	if !plan.RollOver {
+		delta -= subscription.unusedQuota(user)
+	}
+	if delta != 0 {
+		err = tx.Model(&User{}).Where("id = ?", user.Id).Update("quota", gorm.Expr("quota + ?", delta)).Error
+		if err == nil {
+			err = recordUserQuotaChange(tx, user.Id, delta, QuotaChange{
+				Type:        QuotaChangeSubscription,
+				Reason:      "订阅周期额度发放",
+				ReferenceId: subscription.TradeNo,
+			})
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	subscription.GrantedQuota = plan.Quota
+	subscription.UsedQuotaAtGrant = user.UsedQuota
+	subscription.PeriodStart = start
+	subscription.PeriodEnd = end
+	return delta, nil
+}
+
+// lapse ends the subscription: the group of the user is restored and, unless the plan rolls it over, the unused
+// quota of the period is taken back
+func (subscription *Subscription) lapse(tx *gorm.DB, plan *Plan, status string) error {
+	user := &User{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota", "used_quota", "group").
+		Where("id = ?", subscription.UserId).First(user).Error
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{}
+	unused := 0
+	if !plan.RollOver {
+		if unused = subscription.unusedQuota(user); unused > 0 {
+			updates["quota"] = gorm.Expr("quota - ?", unused)
+		}
+	}
+	if plan.Group != "" && user.Group == plan.Group {
+		group := subscription.PreviousGroup
+		if group == "" {
+			group = "default"
+		}
+		updates["group"] = group
+	}
+	if len(updates) > 0 {
+		err = tx.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+	}
+	if unused > 0 {
+		err = recordUserQuotaChange(tx, user.Id, -unused, QuotaChange{
+			Type:        QuotaChangeSubscription,
+			Reason:      "订阅结束收回未用额度",
+			ReferenceId: subscription.TradeNo,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	subscription.Status = status
+	subscription.GrantedQuota = 0
+	return subscription.save(tx)
+}
+
+// refreshSubscriptionUserCache updates the cached quota and group of a user changed by a subscription
+func refreshSubscriptionUserCache(userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := CacheUpdateUserQuota(userId); err != nil {
+		common.SysError("failed to update user quota cache: " + err.Error())
+	}
+	if group, err := GetUserGroup(userId); err == nil {
+		_ = common.RedisSet(fmt.Sprintf("user_group:%d", userId), group, time.Duration(UserId2GroupCacheSeconds)*time.Second)
+	}
+}
+
+// ActivateSubscription starts a subscription whose checkout completed, its first period is granted right away.
+// A user has one running subscription at most: when another one already runs, the subscription is canceled and
+// ErrSubscriptionRunning is returned so that it can be canceled in Stripe too.
+func ActivateSubscription(tradeNo string, customerId string, stripeSubscriptionId string) error {
+	if tradeNo == "" {
+		return errors.New("未提供订阅单号")
+	}
+	var subscription *Subscription
+	var plan *Plan
+	running := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		subscription, err = findSubscription(tx, tradeNo, "")
+		if err != nil {
+			return err
+		}
+		if subscription.Status != common.SubscriptionStatusPending {
+			return errors.New("订阅状态错误")
+		}
+		plan, err = getPlanById(tx, subscription.PlanId)
+		if err != nil {
+			return errors.New("套餐不存在")
+		}
+		// the user row serializes the activations of its subscriptions
+		user := &User{}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "group").
+			Where("id = ?", subscription.UserId).First(user).Error
+		if err != nil {
+			return err
+		}
+		var others []*Subscription
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? and id <> ? and status in ?", user.Id,
+			subscription.Id, []string{common.SubscriptionStatusActive, common.SubscriptionStatusPastDue}).Find(&others).Error
+		if err != nil {
+			return err
+		}
+		subscription.StripeSubscriptionId = stripeSubscriptionId
+		if len(others) > 0 {
+			running = true
+			subscription.Status = common.SubscriptionStatusCanceled
+			return subscription.save(tx)
+		}
+		updates := map[string]interface{}{"stripe_customer": customerId}
+		// no other subscription runs, so the group of the user is not the group of a plan
+		subscription.PreviousGroup = user.Group
+		if plan.Group != "" {
+			updates["group"] = plan.Group
+		}
+		err = tx.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+		now := common.GetTimestamp()
+		if _, err = subscription.startPeriod(tx, plan, now, plan.PeriodEnd(now)); err != nil {
+			return err
+		}
+		if subscription.PaidUntil < subscription.PeriodEnd {
+			subscription.PaidUntil = subscription.PeriodEnd
+		}
+		subscription.Status = common.SubscriptionStatusActive
+		return subscription.save(tx)
+	})
+	if err != nil {
+		return errors.New("订阅失败，" + err.Error())
+	}
+	if running {
+		return ErrSubscriptionRunning
+	}
+	refreshSubscriptionUserCache(subscription.UserId)
+	RecordLog(subscription.UserId, LogTypeTopup, fmt.Sprintf("订阅套餐 %s 成功，本期额度: %v", plan.Name, common.LogQuotaF(float64(plan.Quota))))
+	return nil
+}
+
+// PaySubscription records a paid invoice of the subscription, the period it pays is started by
+// ProcessSubscriptions when the current one ends
+func PaySubscription(tradeNo string, stripeSubscriptionId string, periodEnd int64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		subscription, err := findSubscription(tx, tradeNo, stripeSubscriptionId)
+		if err != nil {
+			return err
+		}
+		switch subscription.Status {
+		case common.SubscriptionStatusPastDue:
+			subscription.Status = common.SubscriptionStatusActive
+		case common.SubscriptionStatusPending, common.SubscriptionStatusActive:
+		default:
+			return errors.New("订阅已结束")
+		}
+		if periodEnd > subscription.PaidUntil {
+			subscription.PaidUntil = periodEnd
+		}
+		return subscription.save(tx)
+	})
+}
+
+// SetSubscriptionPastDue marks a subscription whose renewal payment failed, it lapses when the grace period
+// passes without payment
+func SetSubscriptionPastDue(tradeNo string, stripeSubscriptionId string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		subscription, err := findSubscription(tx, tradeNo, stripeSubscriptionId)
+		if err != nil {
+			return err
+		}
+		if subscription.Status != common.SubscriptionStatusActive {
+			return nil
+		}
+		subscription.Status = common.SubscriptionStatusPastDue
+		return subscription.save(tx)
+	})
+}
+
+func SetSubscriptionCancelAtPeriodEnd(tradeNo string, stripeSubscriptionId string, cancel bool) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		subscription, err := findSubscription(tx, tradeNo, stripeSubscriptionId)
+		if err != nil {
+			return err
+		}
+		subscription.CancelAtPeriodEnd = cancel
+		return subscription.save(tx)
+	})
+}
+
+// CancelSubscription ends a subscription deleted in Stripe right away
+func CancelSubscription(tradeNo string, stripeSubscriptionId string) error {
+	var subscription *Subscription
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		subscription, err = findSubscription(tx, tradeNo, stripeSubscriptionId)
+		if err != nil {
+			return err
+		}
+		switch subscription.Status {
+		case common.SubscriptionStatusActive, common.SubscriptionStatusPastDue:
+		case common.SubscriptionStatusPending:
+			subscription.Status = common.SubscriptionStatusCanceled
+			return subscription.save(tx)
+		default:
+			return nil
+		}
+		plan, err := getPlanById(tx, subscription.PlanId)
+		if err != nil {
+			return errors.New("套餐不存在")
+		}
+		return subscription.lapse(tx, plan, common.SubscriptionStatusCanceled)
+	})
+	if err != nil {
+		return err
+	}
+	refreshSubscriptionUserCache(subscription.UserId)
+	RecordLog(subscription.UserId, LogTypeSystem, "订阅已取消")
+	return nil
+}
+
+// processSubscription starts the next period of a subscription whose period ended, or lets it lapse when the next
+// period was not paid within the grace period. A period counts as paid when Stripe was paid for at least half of it,
+// so that the periods computed here and by Stripe may differ slightly.
+func processSubscription(id int, now int64) error {
+	var result string
+	var userId int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		subscription := &Subscription{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(subscription).Error
+		if err != nil {
+			return err
+		}
+		userId = subscription.UserId
+		// the subscription may have been canceled or processed since it was listed
+		if (subscription.Status != common.SubscriptionStatusActive && subscription.Status != common.SubscriptionStatusPastDue) ||
+			subscription.PeriodEnd > now {
+			return nil
+		}
+		plan, err := getPlanById(tx, subscription.PlanId)
+		if err != nil {
+			return errors.New("套餐不存在")
+		}
+		length := subscription.PeriodEnd - subscription.PeriodStart
+		if subscription.PaidUntil-subscription.PeriodEnd > length/2 {
+			delta, err := subscription.startPeriod(tx, plan, subscription.PeriodEnd, subscription.PaidUntil)
+			if err != nil {
+				return err
+			}
+			result = fmt.Sprintf("套餐 %s 进入新周期，本期额度: %v，额度变化: %v", plan.Name,
+				common.LogQuotaF(float64(plan.Quota)), common.LogQuotaF(float64(delta)))
+			return subscription.save(tx)
+		}
+		grace := int64(common.SubscriptionGraceDays) * 24 * 3600
+		if !subscription.CancelAtPeriodEnd && now < subscription.PeriodEnd+grace {
+			return nil
+		}
+		result = fmt.Sprintf("套餐 %s 已到期", plan.Name)
+		return subscription.lapse(tx, plan, common.SubscriptionStatusExpired)
+	})
+	if err == nil && result != "" {
+		refreshSubscriptionUserCache(userId)
+		RecordLog(userId, LogTypeSystem, result)
+	}
+	return err
+}
+
+// ProcessSubscriptions starts the new periods of the running subscriptions and lets the unpaid ones lapse
+func ProcessSubscriptions() {
+	now := common.GetTimestamp()
+	var ids []int
+	err := DB.Model(&Subscription{}).Where("status in ? and period_end <= ?",
+		[]string{common.SubscriptionStatusActive, common.SubscriptionStatusPastDue}, now).Pluck("id", &ids).Error
+	if err != nil {
+		common.SysError("failed to get subscriptions: " + err.Error())
+		return
+	}
+	for _, id := range ids {
+		if err := processSubscription(id, now); err != nil {
+			common.SysError("failed to process subscription " + strconv.Itoa(id) + ": " + err.Error())
+		}
+	}
+}
@@ -18,6 +18,7 @@ const (
 	TaskStatusFailure               = "FAILURE"
 	TaskStatusSuccess               = "SUCCESS"
 	TaskStatusUnknown               = "UNKNOWN"
+	TaskStatusCancelling            = "CANCELLING"
 )
 
 type Task struct {
@@ -52,7 +53,9 @@ func (t *Task) GetData(v any) error {
 }
 
 type Properties struct {
-	Input string `json:"input"`
+	Input    string `json:"input"`
+	TokenId  int    `json:"token_id,omitempty"`  // 批处理任务执行时使用的令牌
+	ClientIp string `json:"client_ip,omitempty"` // 批处理任务提交时的客户端 IP
 }
 
 func (m *Properties) Scan(val interface{}) error {
@@ -181,6 +184,29 @@ func GetAllUnFinishSyncTasks(limit int) []*Task {
 	return tasks
 }
 
+func GetTasksByPlatformAndStatus(platform constant.TaskPlatform, status TaskStatus, limit int) []*Task {
+	var tasks []*Task
+	err := DB.Where("platform = ? and status = ?", platform, status).Limit(limit).Order("id").Find(&tasks).Error
+	if err != nil {
+		return nil
+	}
+	return tasks
+}
+
+// GetUserTasksByPlatform lists the tasks of a user newest first, beforeId > 0 only returns older tasks
+func GetUserTasksByPlatform(userId int, platform constant.TaskPlatform, beforeId int64, limit int) []*Task {
+	var tasks []*Task
+	query := DB.Where("user_id = ? and platform = ?", userId, platform)
+	if beforeId > 0 {
+		query = query.Where("id < ?", beforeId)
+	}
+	err := query.Order("id desc").Limit(limit).Find(&tasks).Error
+	if err != nil {
+		return nil
+	}
+	return tasks
+}
+
 func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -240,6 +266,12 @@ func (Task *Task) Update() error {
 	return err
 }
 
+// TaskUpdateIfStatus updates the task only while it still has the given status, reports whether it did
+func TaskUpdateIfStatus(id int64, status TaskStatus, params map[string]any) (bool, error) {
+	result := DB.Model(&Task{}).Where("id = ? and status = ?", id, status).Updates(params)
+	return result.RowsAffected > 0, result.Error
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
@@ -26,6 +26,10 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	FallbackDisabled   bool           `json:"fallback_disabled" gorm:"default:false"`
+	DailyQuotaLimit    int            `json:"daily_quota_limit" gorm:"default:0"` // spend windows, 0 means unlimited
+	WeeklyQuotaLimit   int            `json:"weekly_quota_limit" gorm:"default:0"`
+	MonthlyQuotaLimit  int            `json:"monthly_quota_limit" gorm:"default:0"`
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -73,6 +77,7 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	token, err = CacheGetTokenByKey(key)
 	if err == nil {
 		if token.Status == common.TokenStatusExhausted {
+			go notifyTokenExhausted(token)
 			keyPrefix := key[:3]
 			keySuffix := key[len(key)-3:]
 			return token, errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
@@ -93,6 +98,7 @@ func ValidateUserToken(key string) (token *Token, err error) {
 			return token, errors.New("该令牌已过期")
 		}
 		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+			go notifyTokenExhausted(token)
 			if !common.RedisEnabled {
 				// in this case, we can make sure the token is exhausted
 				token.Status = common.TokenStatusExhausted
@@ -110,6 +116,19 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	return nil, errors.New("无效的令牌")
 }
 
+func notifyTokenExhausted(token *Token) {
+	Notify(token.UserId, NotificationMessage{
+		Event:    NotificationEventTokenExhausted,
+		DedupKey: fmt.Sprintf("token_exhausted:%d", token.Id),
+		Title:    "令牌额度已用尽",
+		Content:  fmt.Sprintf("您的令牌「%s」（#%d）额度已用尽，使用该令牌的请求将被拒绝。", token.Name, token.Id),
+		Data: map[string]interface{}{
+			"token_id":   token.Id,
+			"token_name": token.Name,
+		},
+	})
+}
+
 func GetTokenByIds(id int, userId int) (*Token, error) {
 	if id == 0 || userId == 0 {
 		return nil, errors.New("id 或 userId 为空！")
@@ -155,7 +174,8 @@ func (token *Token) Insert() error {
 func (token *Token) Update() error {
 	var err error
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "fallback_disabled", "daily_quota_limit",
+		"weekly_quota_limit", "monthly_quota_limit").Updates(token).Error
 	return err
 }
 
@@ -170,6 +190,14 @@ func (token *Token) Delete() error {
 	return err
 }
 
+func (token *Token) GetSpendLimits() SpendLimits {
+	return SpendLimits{
+		Daily:   token.DailyQuotaLimit,
+		Weekly:  token.WeeklyQuotaLimit,
+		Monthly: token.MonthlyQuotaLimit,
+	}
+}
+
 func (token *Token) IsModelLimitsEnabled() bool {
 	return token.ModelLimitsEnabled
 }
@@ -283,16 +311,31 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) (userQuot
 			return 0, err
 		}
 	}
-	err = DecreaseUserQuota(relayInfo.UserId, quota)
+	err = DecreaseUserQuota(relayInfo.UserId, quota, QuotaChange{
+		Type:        QuotaChangePreConsume,
+		Reason:      "请求预扣费",
+		ReferenceId: relayInfo.RequestId,
+	})
+	if err == nil {
+		addSpendWindows(relayInfo, quota)
+	}
 	return userQuota - quota, err
 }
 
 func PostConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, userQuota int, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
 	if quota > 0 {
-		err = DecreaseUserQuota(relayInfo.UserId, quota)
+		err = DecreaseUserQuota(relayInfo.UserId, quota, QuotaChange{
+			Type:        QuotaChangeConsume,
+			Reason:      "请求消费",
+			ReferenceId: relayInfo.RequestId,
+		})
 	} else {
-		err = IncreaseUserQuota(relayInfo.UserId, -quota)
+		err = IncreaseUserQuota(relayInfo.UserId, -quota, QuotaChange{
+			Type:        QuotaChangeRefund,
+			Reason:      "退还预扣费",
+			ReferenceId: relayInfo.RequestId,
+		})
 	}
 	if err != nil {
 		return err
@@ -308,6 +351,8 @@ func PostConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, userQuota int, quot
 			return err
 		}
 	}
+	addSpendWindows(relayInfo, quota)
+	go notifyBalance(relayInfo.UserId, userQuota, userQuota-(quota+preConsumedQuota))
 
 	if sendEmail {
 		if (quota + preConsumedQuota) != 0 {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"one-api/common"
 )
 
@@ -64,7 +65,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(refCol+" = ?", referenceId).First(topUp).Error
 		if err != nil {
 			return errors.New("充值订单不存在")
 		}
@@ -86,6 +87,15 @@ func Recharge(referenceId string, customerId string) (err error) {
 			return err
 		}
 
+		err = recordUserQuotaChange(tx, topUp.UserId, int(quota), QuotaChange{
+			Type:        QuotaChangeTopUp,
+			Reason:      "在线充值",
+			ReferenceId: referenceId,
+		})
+		if err != nil {
+			return err
+		}
+
 		return nil
 	})
 
@@ -94,6 +104,7 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", common.LogQuotaF(quota), topUp.Amount))
+	go notifyTopUp(topUp.UserId, int(quota), "topup:"+referenceId, "在线充值")
 
 	return nil
 }
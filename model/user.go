@@ -9,36 +9,40 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // User if you add sensitive fields, don't forget to clean them in setupLogin function.
 // Otherwise, the sensitive information will be saved on local storage in plain text!
 type User struct {
-	Id               int            `json:"id"`
-	Username         string         `json:"username" gorm:"unique;index" validate:"max=12"`
-	Password         string         `json:"password" gorm:"not null;" validate:"min=8,max=20"`
-	DisplayName      string         `json:"display_name" gorm:"index" validate:"max=20"`
-	Role             int            `json:"role" gorm:"type:int;default:1"`   // admin, common
-	Status           int            `json:"status" gorm:"type:int;default:1"` // enabled, disabled
-	Email            string         `json:"email" gorm:"index" validate:"max=50"`
-	GitHubId         string         `json:"github_id" gorm:"column:github_id;index"`
-	LinuxDoId        string         `json:"linuxdo_id" gorm:"column:linuxdo_id;index"`
-	LinuxDoLevel     int            `json:"linuxdo_level" gorm:"column:linuxdo_level;type:int;default:0"`
-	WeChatId         string         `json:"wechat_id" gorm:"column:wechat_id;index"`
-	TelegramId       string         `json:"telegram_id" gorm:"column:telegram_id;index"`
-	VerificationCode string         `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
-	AccessToken      *string        `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
-	Quota            int            `json:"quota" gorm:"type:int;default:0"`
-	UsedQuota        int            `json:"used_quota" gorm:"type:int;default:0;column:used_quota"` // used quota
-	RequestCount     int            `json:"request_count" gorm:"type:int;default:0;"`               // request number
-	Group            string         `json:"group" gorm:"type:varchar(64);default:'default'"`
-	AffCode          string         `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
-	AffCount         int            `json:"aff_count" gorm:"type:int;default:0;column:aff_count"`
-	AffQuota         int            `json:"aff_quota" gorm:"type:int;default:0;column:aff_quota"`           // 邀请剩余额度
-	AffHistoryQuota  int            `json:"aff_history_quota" gorm:"type:int;default:0;column:aff_history"` // 邀请历史额度
-	InviterId        int            `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
-	StripeCustomer   string         `json:"stripe_customer" gorm:"column:stripe_customer;index"`
-	DeletedAt        gorm.DeletedAt `gorm:"index"`
+	Id                int            `json:"id"`
+	Username          string         `json:"username" gorm:"unique;index" validate:"max=12"`
+	Password          string         `json:"password" gorm:"not null;" validate:"min=8,max=20"`
+	DisplayName       string         `json:"display_name" gorm:"index" validate:"max=20"`
+	Role              int            `json:"role" gorm:"type:int;default:1"`   // admin, common
+	Status            int            `json:"status" gorm:"type:int;default:1"` // enabled, disabled
+	Email             string         `json:"email" gorm:"index" validate:"max=50"`
+	GitHubId          string         `json:"github_id" gorm:"column:github_id;index"`
+	LinuxDoId         string         `json:"linuxdo_id" gorm:"column:linuxdo_id;index"`
+	LinuxDoLevel      int            `json:"linuxdo_level" gorm:"column:linuxdo_level;type:int;default:0"`
+	WeChatId          string         `json:"wechat_id" gorm:"column:wechat_id;index"`
+	TelegramId        string         `json:"telegram_id" gorm:"column:telegram_id;index"`
+	VerificationCode  string         `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
+	AccessToken       *string        `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
+	Quota             int            `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota         int            `json:"used_quota" gorm:"type:int;default:0;column:used_quota"` // used quota
+	RequestCount      int            `json:"request_count" gorm:"type:int;default:0;"`               // request number
+	Group             string         `json:"group" gorm:"type:varchar(64);default:'default'"`
+	AffCode           string         `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
+	AffCount          int            `json:"aff_count" gorm:"type:int;default:0;column:aff_count"`
+	AffQuota          int            `json:"aff_quota" gorm:"type:int;default:0;column:aff_quota"`           // 邀请剩余额度
+	AffHistoryQuota   int            `json:"aff_history_quota" gorm:"type:int;default:0;column:aff_history"` // 邀请历史额度
+	InviterId         int            `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	StripeCustomer    string         `json:"stripe_customer" gorm:"column:stripe_customer;index"`
+	DailyQuotaLimit   int            `json:"daily_quota_limit" gorm:"type:int;default:0"` // spend windows, 0 means unlimited
+	WeeklyQuotaLimit  int            `json:"weekly_quota_limit" gorm:"type:int;default:0"`
+	MonthlyQuotaLimit int            `json:"monthly_quota_limit" gorm:"type:int;default:0"`
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
 }
 
 func (user *User) GetAccessToken() string {
@@ -178,14 +182,24 @@ func HardDeleteUserById(id int) error {
 }
 
 func inviteUser(inviterId int) (err error) {
-	user, err := GetUserById(inviterId, true)
-	if err != nil {
-		return err
-	}
-	user.AffCount++
-	user.AffQuota += common.QuotaForInviter
-	user.AffHistoryQuota += common.QuotaForInviter
-	return DB.Save(user).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// only the referral columns are moved, saving the whole user would write back a stale quota
+		result := tx.Model(&User{}).Where("id = ?", inviterId).Updates(map[string]interface{}{
+			"aff_count":   gorm.Expr("aff_count + ?", 1),
+			"aff_quota":   gorm.Expr("aff_quota + ?", common.QuotaForInviter),
+			"aff_history": gorm.Expr("aff_history + ?", common.QuotaForInviter),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recordUserAffQuotaChange(tx, inviterId, common.QuotaForInviter, QuotaChange{
+			Type:   QuotaChangeReferral,
+			Reason: "邀请用户奖励",
+		})
+	})
 }
 
 func (user *User) TransferAffQuotaToQuota(quota int) error {
@@ -202,7 +216,7 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	defer tx.Rollback() // 确保在函数退出时事务能回滚
 
 	// 加锁查询用户以确保数据一致性
-	err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, user.Id).Error
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, user.Id).Error
 	if err != nil {
 		return err
 	}
@@ -213,11 +227,20 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	}
 
 	// 更新用户额度
+	err = tx.Model(user).Updates(map[string]interface{}{
+		"aff_quota": gorm.Expr("aff_quota - ?", quota),
+		"quota":     gorm.Expr("quota + ?", quota),
+	}).Error
+	if err != nil {
+		return err
+	}
 	user.AffQuota -= quota
 	user.Quota += quota
-
-	// 保存用户状态
-	if err := tx.Save(user).Error; err != nil {
+	err = recordUserQuotaChange(tx, user.Id, quota, QuotaChange{
+		Type:   QuotaChangeAffTransfer,
+		Reason: "邀请额度划转",
+	})
+	if err != nil {
 		return err
 	}
 
@@ -236,16 +259,27 @@ func (user *User) Insert(inviterId int) error {
 	user.Quota = common.QuotaForNewUser
 	//user.SetAccessToken(common.GetUUID())
 	user.AffCode = common.GetRandomString(4)
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return recordUserQuotaChange(tx, user.Id, user.Quota, QuotaChange{
+			Type:   QuotaChangeRegister,
+			Reason: "新用户注册赠送",
+		})
+	})
+	if err != nil {
+		return err
 	}
 	if common.QuotaForNewUser > 0 {
 		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(common.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, QuotaChange{
+				Type:   QuotaChangeReferral,
+				Reason: "使用邀请码赠送",
+			})
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -267,7 +301,8 @@ func (user *User) Update(updatePassword bool) error {
 	}
 	newUser := *user
 	DB.First(&user, user.Id)
-	err = DB.Model(user).Updates(newUser).Error
+	// the quota only changes through the ledger, the one loaded with the user may be stale
+	err = DB.Model(user).Omit("quota", "aff_quota").Updates(newUser).Error
 	if err == nil {
 		if common.RedisEnabled {
 			_ = common.RedisSet(fmt.Sprintf("user_group:%d", user.Id), user.Group, time.Duration(UserId2GroupCacheSeconds)*time.Second)
@@ -277,7 +312,8 @@ func (user *User) Update(updatePassword bool) error {
 	return err
 }
 
-func (user *User) Edit(updatePassword bool) error {
+// Edit saves the changes an admin made to the user, a change of its quota is recorded as an adjustment by operatorId
+func (user *User) Edit(updatePassword bool, operatorId int) error {
 	var err error
 	if updatePassword {
 		user.Password, err = common.Password2Hash(user.Password)
@@ -287,20 +323,40 @@ func (user *User) Edit(updatePassword bool) error {
 	}
 	newUser := *user
 	updates := map[string]interface{}{
-		"username":     newUser.Username,
-		"display_name": newUser.DisplayName,
-		"group":        newUser.Group,
-		"quota":        newUser.Quota,
+		"username":            newUser.Username,
+		"display_name":        newUser.DisplayName,
+		"group":               newUser.Group,
+		"daily_quota_limit":   newUser.DailyQuotaLimit,
+		"weekly_quota_limit":  newUser.WeeklyQuotaLimit,
+		"monthly_quota_limit": newUser.MonthlyQuotaLimit,
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
 	}
-	DB.First(&user, user.Id)
-	err = DB.Model(user).Updates(updates).Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, user.Id).Error
+		if err != nil {
+			return err
+		}
+		// the quota is moved by the delta, so that requests billed meanwhile are not overwritten
+		delta := newUser.Quota - user.Quota
+		updates["quota"] = gorm.Expr("quota + ?", delta)
+		err = tx.Model(user).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+		user.Quota += delta
+		return recordUserQuotaChange(tx, user.Id, delta, QuotaChange{
+			Type:        QuotaChangeAdminAdjust,
+			Reason:      "管理员调整额度",
+			ReferenceId: fmt.Sprintf("admin:%d", operatorId),
+		})
+	})
 	if err == nil {
 		if common.RedisEnabled {
 			_ = common.RedisSet(fmt.Sprintf("user_group:%d", user.Id), user.Group, time.Duration(UserId2GroupCacheSeconds)*time.Second)
 			_ = common.RedisSet(fmt.Sprintf("user_quota:%d", user.Id), strconv.Itoa(user.Quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
+			_ = common.RedisDel(fmt.Sprintf("user_spend_limits:%d", user.Id))
 		}
 	}
 	return err
@@ -465,6 +521,23 @@ func IsLinuxDoEnabled(userId int) (bool, error) {
 	return user.LinuxDoId == "" || user.LinuxDoLevel >= common.LinuxDoMinLevel, nil
 }
 
+func (user *User) GetSpendLimits() SpendLimits {
+	return SpendLimits{
+		Daily:   user.DailyQuotaLimit,
+		Weekly:  user.WeeklyQuotaLimit,
+		Monthly: user.MonthlyQuotaLimit,
+	}
+}
+
+func GetUserSpendLimits(userId int) (SpendLimits, error) {
+	if userId == 0 {
+		return SpendLimits{}, errors.New("user id is empty")
+	}
+	var user User
+	err := DB.Where("id = ?", userId).Select("daily_quota_limit, weekly_quota_limit, monthly_quota_limit").Find(&user).Error
+	return user.GetSpendLimits(), err
+}
+
 func ValidateAccessToken(token string) (user *User) {
 	if token == "" {
 		return nil
@@ -507,36 +580,31 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
-func IncreaseUserQuota(id int, quota int) (err error) {
+func IncreaseUserQuota(id int, quota int, change QuotaChange) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
-	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
-		return nil
-	}
-	return increaseUserQuota(id, quota)
+	return addUserQuota(id, quota, change)
 }
 
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	return err
-}
-
-func DecreaseUserQuota(id int, quota int) (err error) {
+func DecreaseUserQuota(id int, quota int, change QuotaChange) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	return addUserQuota(id, -quota, change)
+}
+
+func addUserQuota(id int, delta int, change QuotaChange) error {
+	entry := newQuotaLedgerEntry(id, userQuotaAccount(id), delta, change)
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
+		addNewUserQuotaRecord(id, delta, entry)
 		return nil
 	}
-	return decreaseUserQuota(id, quota)
-}
-
-func decreaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	return err
+	var entries []*QuotaLedgerEntry
+	if entry != nil {
+		entries = append(entries, entry)
+	}
+	return updateUserQuota(id, delta, entries)
 }
 
 func GetRootUserEmail() (email string) {
@@ -21,6 +21,9 @@ const (
 var batchUpdateStores []map[int]int
 var batchUpdateLocks []sync.Mutex
 
+// the ledger entries of the batched user quota changes, written together with them
+var batchUpdateQuotaLedgerEntries = make(map[int][]*QuotaLedgerEntry)
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int))
@@ -47,18 +50,32 @@ func addNewRecord(type_ int, id int, value int) {
 	}
 }
 
+func addNewUserQuotaRecord(id int, delta int, entry *QuotaLedgerEntry) {
+	batchUpdateLocks[BatchUpdateTypeUserQuota].Lock()
+	defer batchUpdateLocks[BatchUpdateTypeUserQuota].Unlock()
+	batchUpdateStores[BatchUpdateTypeUserQuota][id] += delta
+	if entry != nil {
+		batchUpdateQuotaLedgerEntries[id] = append(batchUpdateQuotaLedgerEntries[id], entry)
+	}
+}
+
 func batchUpdate() {
 	common.SysLog("batch update started")
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
 		batchUpdateStores[i] = make(map[int]int)
+		var ledgerEntries map[int][]*QuotaLedgerEntry
+		if i == BatchUpdateTypeUserQuota {
+			ledgerEntries = batchUpdateQuotaLedgerEntries
+			batchUpdateQuotaLedgerEntries = make(map[int][]*QuotaLedgerEntry)
+		}
 		batchUpdateLocks[i].Unlock()
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
 			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
+				err := updateUserQuota(key, value, ledgerEntries[key])
 				if err != nil {
 					common.SysError("failed to batch update user quota: " + err.Error())
 				}
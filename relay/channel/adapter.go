@@ -23,6 +23,22 @@ type Adaptor interface {
 	GetChannelName() string
 }
 
+// ClaudeNativeAdaptor is implemented by adaptors whose upstream speaks the Anthropic Messages format,
+// so that /v1/messages requests can be relayed without a round trip through the OpenAI format
+type ClaudeNativeAdaptor interface {
+	ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error)
+}
+
+// GeminiNativeAdaptor is implemented by adaptors whose upstream speaks the Gemini generateContent format
+type GeminiNativeAdaptor interface {
+	ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error)
+}
+
+// ResponsesNativeAdaptor is implemented by adaptors whose upstream serves the OpenAI Responses api
+type ResponsesNativeAdaptor interface {
+	ConvertResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error)
+}
+
 type TaskAdaptor interface {
 	Init(info *relaycommon.TaskRelayInfo)
 
@@ -26,6 +26,8 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", info.BaseUrl)
 	case constant.RelayModeImagesGenerations:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", info.BaseUrl)
+	case constant.RelayModeImagesEdits:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/image2image/image-synthesis", info.BaseUrl)
 	default:
 		fullRequestURL = fmt.Sprintf("%s/compatible-mode/v1/chat/completions", info.BaseUrl)
 	}
@@ -38,6 +40,10 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *re
 	if info.IsStream {
 		req.Header.Set("X-DashScope-SSE", "enable")
 	}
+	if info.RelayMode == constant.RelayModeImagesGenerations || info.RelayMode == constant.RelayModeImagesEdits {
+		// image synthesis only runs as an async task
+		req.Header.Set("X-DashScope-Async", "enable")
+	}
 	if c.GetString("plugin") != "" {
 		req.Header.Set("X-DashScope-Plugin", c.GetString("plugin"))
 	}
@@ -50,8 +56,7 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 	}
 	switch info.RelayMode {
 	case constant.RelayModeEmbeddings:
-		baiduEmbeddingRequest := embeddingRequestOpenAI2Ali(*request)
-		return baiduEmbeddingRequest, nil
+		return embeddingRequestOpenAI2Ali(*request)
 	default:
 		aliReq := requestOpenAI2Ali(*request)
 		return aliReq, nil
@@ -59,8 +64,17 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
-	aliRequest := oaiImage2Ali(request)
-	return aliRequest, nil
+	// read by aliImageHandler to return base64 images
+	c.Set("response_format", request.ResponseFormat)
+	switch info.RelayMode {
+	case constant.RelayModeImagesEdits:
+		return oaiImageEdit2Ali(request)
+	case constant.RelayModeImagesVariations:
+		return nil, errors.New("image variations are not supported by ali")
+	default:
+		aliRequest := oaiImage2Ali(request)
+		return aliRequest, nil
+	}
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
@@ -78,10 +92,10 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
 	switch info.RelayMode {
-	case constant.RelayModeImagesGenerations:
+	case constant.RelayModeImagesGenerations, constant.RelayModeImagesEdits:
 		err, usage = aliImageHandler(c, resp, info)
 	case constant.RelayModeEmbeddings:
-		err, usage = aliEmbeddingHandler(c, resp)
+		err, usage = aliEmbeddingHandler(c, resp, info)
 	default:
 		if info.IsStream {
 			err, usage = openai.OaiStreamHandler(c, resp, info)
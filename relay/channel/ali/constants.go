@@ -2,7 +2,7 @@ package ali
 
 var ModelList = []string{
 	"qwen-turbo", "qwen-plus", "qwen-max", "qwen-max-longcontext",
-	"text-embedding-v1",
+	"text-embedding-v1", "text-embedding-v2", "text-embedding-v3",
 }
 
 var ChannelName = "ali"
@@ -30,14 +30,17 @@ type AliEmbeddingRequest struct {
 	Input struct {
 		Texts []string `json:"texts"`
 	} `json:"input"`
-	Parameters *struct {
-		TextType string `json:"text_type,omitempty"`
-	} `json:"parameters,omitempty"`
+	Parameters *AliEmbeddingParameters `json:"parameters,omitempty"`
+}
+
+type AliEmbeddingParameters struct {
+	TextType  string `json:"text_type,omitempty"`
+	Dimension int    `json:"dimension,omitempty"`
 }
 
 type AliEmbedding struct {
-	Embedding any `json:"embedding"`
-	TextIndex int `json:"text_index"`
+	Embedding []float64 `json:"embedding"`
+	TextIndex int       `json:"text_index"`
 }
 
 type AliEmbeddingResponse struct {
@@ -88,6 +91,9 @@ type AliImageRequest struct {
 	Input struct {
 		Prompt         string `json:"prompt"`
 		NegativePrompt string `json:"negative_prompt,omitempty"`
+		Function       string `json:"function,omitempty"`
+		BaseImageUrl   string `json:"base_image_url,omitempty"`
+		MaskImageUrl   string `json:"mask_image_url,omitempty"`
 	} `json:"input"`
 	Parameters struct {
 		Size  string `json:"size,omitempty"`
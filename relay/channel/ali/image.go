@@ -1,11 +1,17 @@
 package ali
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
@@ -26,8 +32,75 @@ func oaiImage2Ali(request dto.ImageRequest) *AliImageRequest {
 	return &imageRequest
 }
 
+// oaiImageEdit2Ali maps an image edit to the wanx image edit task, a mask turns it into an inpainting
+func oaiImageEdit2Ali(request dto.ImageRequest) (*AliImageRequest, error) {
+	imageRequest := oaiImage2Ali(request)
+	// the edited image keeps the size of the base image
+	imageRequest.Parameters.Size = ""
+	baseImage, err := imageFile2DataUrl(request.Image)
+	if err != nil {
+		return nil, err
+	}
+	imageRequest.Input.Function = "description_edit"
+	imageRequest.Input.BaseImageUrl = baseImage
+	if request.Mask != nil {
+		maskImage, err := mask2AliMask(request.Mask)
+		if err != nil {
+			return nil, err
+		}
+		imageRequest.Input.Function = "description_edit_with_mask"
+		imageRequest.Input.MaskImageUrl = maskImage
+	}
+	return imageRequest, nil
+}
+
+func imageFile2DataUrl(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	mimeType := header.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// mask2AliMask converts an openai mask, where transparent pixels mark the area to edit,
+// into the black and white mask of ali, where white marks the area to edit
+func mask2AliMask(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	mask, err := png.Decode(file)
+	if err != nil {
+		return "", fmt.Errorf("mask must be a png image: %w", err)
+	}
+	bounds := mask.Bounds()
+	aliMask := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, alpha := mask.At(x, y).RGBA(); alpha == 0 {
+				aliMask.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	var buffer bytes.Buffer
+	if err = png.Encode(&buffer, aliMask); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
 func updateTask(info *relaycommon.RelayInfo, taskID string, key string) (*AliResponse, error, []byte) {
-	url := fmt.Sprintf("/api/v1/tasks/%s", taskID)
+	url := fmt.Sprintf("%s/api/v1/tasks/%s", info.BaseUrl, taskID)
 
 	var aliResponse AliResponse
 
@@ -125,8 +198,8 @@ func responseAli2OpenAIImage(c *gin.Context, response *AliResponse, info *relayc
 }
 
 func aliImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
-	apiKey := c.Request.Header.Get("Authorization")
-	apiKey = strings.TrimPrefix(apiKey, "Bearer ")
+	// the task is polled with the channel key, not the key of the client
+	apiKey := info.ApiKey
 	responseFormat := c.GetString("response_format")
 
 	var aliTaskResponse AliResponse
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
+	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
 )
@@ -25,18 +26,25 @@ func requestOpenAI2Ali(request dto.GeneralOpenAIRequest) *dto.GeneralOpenAIReque
 	return &request
 }
 
-func embeddingRequestOpenAI2Ali(request dto.GeneralOpenAIRequest) *AliEmbeddingRequest {
-	return &AliEmbeddingRequest{
-		Model: "text-embedding-v1",
-		Input: struct {
-			Texts []string `json:"texts"`
-		}{
-			Texts: request.ParseInput(),
-		},
+func embeddingRequestOpenAI2Ali(request dto.GeneralOpenAIRequest) (*AliEmbeddingRequest, error) {
+	input, err := request.ParseEmbeddingInput()
+	if err != nil {
+		return nil, err
+	}
+	aliRequest := &AliEmbeddingRequest{
+		Model: common.GetStringIfEmpty(request.Model, "text-embedding-v1"),
+	}
+	aliRequest.Input.Texts = input
+	if request.Dimensions > 0 {
+		// only text-embedding-v3 accepts a dimension
+		aliRequest.Parameters = &AliEmbeddingParameters{
+			Dimension: request.Dimensions,
+		}
 	}
+	return aliRequest, nil
 }
 
-func aliEmbeddingHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+func aliEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	var aliResponse AliEmbeddingResponse
 	err := json.NewDecoder(resp.Body).Decode(&aliResponse)
 	if err != nil {
@@ -60,7 +68,7 @@ func aliEmbeddingHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorW
 		}, nil
 	}
 
-	fullTextResponse := embeddingResponseAli2OpenAI(&aliResponse)
+	fullTextResponse := embeddingResponseAli2OpenAI(c, &aliResponse, info)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
@@ -71,19 +79,26 @@ func aliEmbeddingHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorW
 	return nil, &fullTextResponse.Usage
 }
 
-func embeddingResponseAli2OpenAI(response *AliEmbeddingResponse) *dto.OpenAIEmbeddingResponse {
+func embeddingResponseAli2OpenAI(c *gin.Context, response *AliEmbeddingResponse, info *relaycommon.RelayInfo) *dto.OpenAIEmbeddingResponse {
 	openAIEmbeddingResponse := dto.OpenAIEmbeddingResponse{
 		Object: "list",
 		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(response.Output.Embeddings)),
-		Model:  "text-embedding-v1",
-		Usage:  dto.Usage{TotalTokens: response.Usage.TotalTokens},
+		Model:  info.UpstreamModelName,
+		Usage: dto.Usage{
+			PromptTokens: response.Usage.TotalTokens,
+			TotalTokens:  response.Usage.TotalTokens,
+		},
+	}
+	if openAIEmbeddingResponse.Usage.TotalTokens == 0 {
+		openAIEmbeddingResponse.Usage.PromptTokens = info.PromptTokens
+		openAIEmbeddingResponse.Usage.TotalTokens = info.PromptTokens
 	}
 
 	for _, item := range response.Output.Embeddings {
 		openAIEmbeddingResponse.Data = append(openAIEmbeddingResponse.Data, dto.OpenAIEmbeddingResponseItem{
 			Object:    `embedding`,
 			Index:     item.TextIndex,
-			Embedding: item.Embedding,
+			Embedding: service.EncodeEmbedding(c, item.Embedding),
 		})
 	}
 	return &openAIEmbeddingResponse
@@ -1,21 +1,27 @@
 package channel
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
 	"io"
 	"net/http"
+	"net/url"
 	logCommon "one-api/common"
 	"one-api/relay/common"
 	"one-api/relay/constant"
 	"one-api/service"
+	"time"
 )
 
 func SetupApiRequestHeader(info *common.RelayInfo, c *gin.Context, req *http.Request) {
 	if info.RelayMode == constant.RelayModeAudioTranscription || info.RelayMode == constant.RelayModeAudioTranslation {
 		// multipart/form-data
+	} else if info.RelayMode == constant.RelayModeRealtime {
+		// websocket handshake, there is no body
 	} else {
 		req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
 		req.Header.Set("Accept", c.Request.Header.Get("Accept"))
@@ -49,7 +55,18 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	if info.ParamOverride != "" && requestBody != nil {
+		body, err := io.ReadAll(requestBody)
+		if err != nil {
+			return nil, fmt.Errorf("read request body failed: %w", err)
+		}
+		body, err = common.ApplyParamOverride(info, body)
+		if err != nil {
+			return nil, fmt.Errorf("param override failed: %w", err)
+		}
+		requestBody = bytes.NewReader(body)
+	}
+	req, err := newRequest(c, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -76,7 +93,10 @@ func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBod
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	if info.ParamOverride != "" {
+		logCommon.LogWarn(c, "param override is not applied to multipart requests")
+	}
+	req, err := newRequest(c, fullRequestURL, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -94,6 +114,15 @@ func DoFormRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBod
 	return resp, nil
 }
 
+// newRequest builds the upstream request, an attempt of a hedged request is bound to its context so that it is
+// cancelled once another attempt is served
+func newRequest(c *gin.Context, fullRequestURL string, requestBody io.Reader) (*http.Request, error) {
+	if _, ok := c.Get("hedge"); ok {
+		return http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
+	}
+	return http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+}
+
 func doRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	resp, err := service.GetHttpClient().Do(req)
 	if err != nil {
@@ -107,6 +136,45 @@ func doRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
+// DoWssRequest opens the upstream websocket of a realtime session, the headers are prepared by the
+// adaptor exactly as for a plain http request
+func DoWssRequest(a Adaptor, c *gin.Context, info *common.RelayInfo) (*websocket.Conn, *http.Response, error) {
+	fullRequestURL, err := a.GetRequestURL(info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get request url failed: %w", err)
+	}
+	if info.ParamOverride != "" {
+		logCommon.LogWarn(c, "param override is not applied to realtime sessions")
+	}
+	req, err := http.NewRequest(http.MethodGet, fullRequestURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("new request failed: %w", err)
+	}
+	err = a.SetupRequestHeader(c, req, info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("setup request header failed: %w", err)
+	}
+	dialer := websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+	}
+	if len(info.Proxy) > 0 {
+		proxyURL, err := url.Parse(info.Proxy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse proxy url failed: %w", err)
+		}
+		dialer.Proxy = http.ProxyURL(proxyURL)
+	}
+	conn, resp, err := dialer.DialContext(c.Request.Context(), fullRequestURL, req.Header)
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			// the handshake was refused, let the caller report the upstream error
+			return nil, resp, nil
+		}
+		return nil, nil, fmt.Errorf("dial failed: %w", err)
+	}
+	return conn, resp, nil
+}
+
 func doRequestWithProxy(c *gin.Context, req *http.Request, proxy string) (*http.Response, error) {
 	client, err := service.GetProxyHttpClient(proxy)
 	if err != nil {
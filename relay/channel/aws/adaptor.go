@@ -55,6 +55,20 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 	return claudeReq, err
 }
 
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	// bedrock takes the model and the stream flag from the api call instead of the body
+	delete(request, "model")
+	delete(request, "stream")
+	request["anthropic_version"] = "bedrock-2023-05-31"
+
+	c.Set("request_model", info.UpstreamModelName)
+	c.Set("converted_request", request)
+	return request, nil
+}
+
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
 	return nil, nil
 }
@@ -64,6 +78,14 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayFormat == relaycommon.RelayFormatClaude {
+		if info.IsStream {
+			err, usage = awsClaudeNativeStreamHandler(c, info)
+		} else {
+			err, usage = awsClaudeNativeHandler(c, info)
+		}
+		return
+	}
 	if info.IsStream {
 		err, usage = awsStreamHandler(c, resp, info, a.RequestMode)
 	} else {
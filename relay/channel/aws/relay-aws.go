@@ -89,6 +89,10 @@ func awsHandler(c *gin.Context, info *relaycommon.RelayInfo, requestMode int) (*
 	if err != nil {
 		return wrapErr(errors.Wrap(err, "marshal request")), nil
 	}
+	awsReq.Body, err = relaycommon.ApplyParamOverride(info, awsReq.Body)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "param override")), nil
+	}
 
 	awsResp, err := awsCli.InvokeModel(c.Request.Context(), awsReq)
 	if err != nil {
@@ -102,11 +106,8 @@ func awsHandler(c *gin.Context, info *relaycommon.RelayInfo, requestMode int) (*
 	}
 
 	openaiResp := claude.ResponseClaude2OpenAI(requestMode, claudeResponse)
-	usage := relaymodel.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := claude.UsageClaude2OpenAI(&claudeResponse.Usage)
+	claude.SetReasoningTokens(&usage, claude.ResponseThinking(claudeResponse), info.UpstreamModelName)
 	openaiResp.Usage = usage
 
 	c.JSON(http.StatusOK, openaiResp)
@@ -146,6 +147,10 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	if err != nil {
 		return wrapErr(errors.Wrap(err, "marshal request")), nil
 	}
+	awsReq.Body, err = relaycommon.ApplyParamOverride(info, awsReq.Body)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "param override")), nil
+	}
 
 	awsResp, err := awsCli.InvokeModelWithResponseStream(c.Request.Context(), awsReq)
 	if err != nil {
@@ -156,6 +161,7 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	var usage relaymodel.Usage
+	var thinkingText strings.Builder
 	var id string
 	var model string
 	isFirst := true
@@ -180,9 +186,16 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			}
 
 			response, claudeUsage := claude.StreamResponseClaude2OpenAI(requestMode, claudeResp)
+			if claudeResp.Delta != nil {
+				thinkingText.WriteString(claudeResp.Delta.Thinking)
+			}
 			if claudeUsage != nil {
-				usage.PromptTokens += claudeUsage.InputTokens
-				usage.CompletionTokens += claudeUsage.OutputTokens
+				eventUsage := claude.UsageClaude2OpenAI(claudeUsage)
+				usage.PromptTokens += eventUsage.PromptTokens
+				usage.CompletionTokens += eventUsage.CompletionTokens
+				usage.PromptTokensDetails.CachedTokens += eventUsage.PromptTokensDetails.CachedTokens
+				usage.PromptTokensDetails.CachedCreationTokens += eventUsage.PromptTokensDetails.CachedCreationTokens
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 			}
 
 			if response == nil {
@@ -214,6 +227,7 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			return false
 		}
 	})
+	claude.SetReasoningTokens(&usage, thinkingText.String(), info.UpstreamModelName)
 	if info.ShouldIncludeUsage {
 		response := service.GenerateFinalUsageResponse(id, createdTime, info.UpstreamModelName, usage)
 		err := service.ObjectData(c, response)
@@ -230,3 +244,113 @@ func awsStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	}
 	return nil, &usage
 }
+
+func awsClaudeNativeBody(c *gin.Context, info *relaycommon.RelayInfo) ([]byte, error) {
+	request, ok := c.Get("converted_request")
+	if !ok {
+		return nil, errors.New("request not found")
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return relaycommon.ApplyParamOverride(info, body)
+}
+
+func awsClaudeNativeHandler(c *gin.Context, info *relaycommon.RelayInfo) (*relaymodel.OpenAIErrorWithStatusCode, *relaymodel.Usage) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
+	}
+
+	awsModelId, err := awsModelID(c.GetString("request_model"))
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+
+	awsReq := &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+	}
+	awsReq.Body, err = awsClaudeNativeBody(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "marshal request")), nil
+	}
+
+	awsResp, err := awsCli.InvokeModel(c.Request.Context(), awsReq)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "InvokeModel")), nil
+	}
+
+	claudeResponse := new(claude.ClaudeResponse)
+	err = json.Unmarshal(awsResp.Body, claudeResponse)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "unmarshal response")), nil
+	}
+	usage := claude.UsageClaude2OpenAI(&claudeResponse.Usage)
+	claude.SetReasoningTokens(&usage, claude.ResponseThinking(claudeResponse), info.UpstreamModelName)
+	c.Data(http.StatusOK, "application/json", awsResp.Body)
+	return nil, &usage
+}
+
+func awsClaudeNativeStreamHandler(c *gin.Context, info *relaycommon.RelayInfo) (*relaymodel.OpenAIErrorWithStatusCode, *relaymodel.Usage) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "newAwsClient")), nil
+	}
+
+	awsModelId, err := awsModelID(c.GetString("request_model"))
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "awsModelID")), nil
+	}
+
+	awsReq := &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(awsModelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+	}
+	awsReq.Body, err = awsClaudeNativeBody(c, info)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "marshal request")), nil
+	}
+
+	awsResp, err := awsCli.InvokeModelWithResponseStream(c.Request.Context(), awsReq)
+	if err != nil {
+		return wrapErr(errors.Wrap(err, "InvokeModelWithResponseStream")), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	service.SetEventStreamHeaders(c)
+	usage := &relaymodel.Usage{}
+	var thinkingText strings.Builder
+	for event := range stream.Events() {
+		switch v := event.(type) {
+		case *types.ResponseStreamMemberChunk:
+			info.SetFirstResponseTime()
+			claudeResp := new(claude.ClaudeResponse)
+			err := json.Unmarshal(v.Value.Bytes, claudeResp)
+			if err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+				continue
+			}
+			claude.ClaudeNativeStreamUsage(claudeResp, usage)
+			if claudeResp.Delta != nil {
+				thinkingText.WriteString(claudeResp.Delta.Thinking)
+			}
+			err = service.ClaudeChunkData(c, claudeResp.Type, string(v.Value.Bytes))
+			if err != nil {
+				common.LogError(c, "send_stream_response_failed: "+err.Error())
+			}
+		case *types.UnknownUnionMember:
+			common.SysError("unknown tag: " + v.Tag)
+		}
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	claude.SetReasoningTokens(usage, thinkingText.String(), info.UpstreamModelName)
+	return nil, usage
+}
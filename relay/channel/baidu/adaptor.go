@@ -42,6 +42,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	if strings.HasPrefix(info.UpstreamModelName, "tao-8k") {
 		suffix = "embeddings/"
 	}
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		suffix = "embeddings/"
+	}
 	switch info.UpstreamModelName {
 	case "ERNIE-4.0":
 		suffix += "completions_pro"
@@ -110,8 +113,7 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 	}
 	switch info.RelayMode {
 	case constant.RelayModeEmbeddings:
-		baiduEmbeddingRequest := embeddingRequestOpenAI2Baidu(*request)
-		return baiduEmbeddingRequest, nil
+		return embeddingRequestOpenAI2Baidu(*request)
 	default:
 		baiduRequest := requestOpenAI2Baidu(*request)
 		return baiduRequest, nil
@@ -132,7 +134,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 	} else {
 		switch info.RelayMode {
 		case constant.RelayModeEmbeddings:
-			err, usage = baiduEmbeddingHandler(c, resp)
+			err, usage = baiduEmbeddingHandler(c, resp, info)
 		default:
 			err, usage = baiduHandler(c, resp)
 		}
@@ -87,24 +87,32 @@ func streamResponseBaidu2OpenAI(baiduResponse *BaiduChatStreamResponse) *dto.Cha
 	return &response
 }
 
-func embeddingRequestOpenAI2Baidu(request dto.GeneralOpenAIRequest) *BaiduEmbeddingRequest {
-	return &BaiduEmbeddingRequest{
-		Input: request.ParseInput(),
+func embeddingRequestOpenAI2Baidu(request dto.GeneralOpenAIRequest) (*BaiduEmbeddingRequest, error) {
+	input, err := request.ParseEmbeddingInput()
+	if err != nil {
+		return nil, err
 	}
+	return &BaiduEmbeddingRequest{
+		Input: input,
+	}, nil
 }
 
-func embeddingResponseBaidu2OpenAI(response *BaiduEmbeddingResponse) *dto.OpenAIEmbeddingResponse {
+func embeddingResponseBaidu2OpenAI(c *gin.Context, response *BaiduEmbeddingResponse, info *relaycommon.RelayInfo) *dto.OpenAIEmbeddingResponse {
 	openAIEmbeddingResponse := dto.OpenAIEmbeddingResponse{
 		Object: "list",
 		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(response.Data)),
-		Model:  "baidu-embedding",
+		Model:  info.UpstreamModelName,
 		Usage:  response.Usage,
 	}
+	if openAIEmbeddingResponse.Usage.TotalTokens == 0 {
+		openAIEmbeddingResponse.Usage.PromptTokens = info.PromptTokens
+		openAIEmbeddingResponse.Usage.TotalTokens = info.PromptTokens
+	}
 	for _, item := range response.Data {
 		openAIEmbeddingResponse.Data = append(openAIEmbeddingResponse.Data, dto.OpenAIEmbeddingResponseItem{
 			Object:    item.Object,
 			Index:     item.Index,
-			Embedding: item.Embedding,
+			Embedding: service.EncodeEmbedding(c, item.Embedding),
 		})
 	}
 	return &openAIEmbeddingResponse
@@ -209,7 +217,7 @@ func baiduHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStat
 	return nil, &fullTextResponse.Usage
 }
 
-func baiduEmbeddingHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+func baiduEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	var baiduResponse BaiduEmbeddingResponse
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -234,7 +242,7 @@ func baiduEmbeddingHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErro
 			StatusCode: resp.StatusCode,
 		}, nil
 	}
-	fullTextResponse := embeddingResponseBaidu2OpenAI(&baiduResponse)
+	fullTextResponse := embeddingResponseBaidu2OpenAI(c, &baiduResponse, info)
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
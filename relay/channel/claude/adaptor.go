@@ -32,7 +32,7 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
-	if strings.HasPrefix(info.UpstreamModelName, "claude-3") {
+	if info.RelayFormat == relaycommon.RelayFormatClaude || strings.HasPrefix(info.UpstreamModelName, "claude-3") {
 		a.RequestMode = RequestModeMessage
 	} else {
 		a.RequestMode = RequestModeCompletion
@@ -76,6 +76,14 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 	}
 }
 
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	request["model"] = info.UpstreamModelName
+	return request, nil
+}
+
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
 	return nil, nil
 }
@@ -85,6 +93,14 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayFormat == relaycommon.RelayFormatClaude {
+		if info.IsStream {
+			err, usage = ClaudeNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = ClaudeNativeHandler(c, resp, info)
+		}
+		return
+	}
 	if info.IsStream {
 		err, usage = ClaudeStreamHandler(c, resp, info, a.RequestMode)
 	} else {
@@ -1,6 +1,9 @@
 package claude
 
-import "one-api/dto"
+import (
+	"encoding/json"
+	"one-api/dto"
+)
 
 type ClaudeMetadata struct {
 	UserId string `json:"user_id"`
@@ -20,14 +23,16 @@ type ClaudeMediaMessage struct {
 	Id        string `json:"id,omitempty"`
 	Name      string `json:"name,omitempty"`
 	Input     any    `json:"input,omitempty"`
-	Content   string `json:"content,omitempty"`
+	Content   any    `json:"content,omitempty"`
 	ToolUseId string `json:"tool_use_id,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
 }
 
 type ClaudeMessageSource struct {
 	Type      string `json:"type"`
-	MediaType string `json:"media_type"`
-	Data      string `json:"data"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
 }
 
 type ClaudeMessage struct {
@@ -35,6 +40,25 @@ type ClaudeMessage struct {
 	Content any    `json:"content"`
 }
 
+// IsStringContent reports whether the message content is a plain string rather than a list of blocks
+func (m ClaudeMessage) IsStringContent() bool {
+	_, ok := m.Content.(string)
+	return ok
+}
+
+func (m ClaudeMessage) ParseContent() ([]ClaudeMediaMessage, error) {
+	if s, ok := m.Content.(string); ok {
+		return []ClaudeMediaMessage{{Type: "text", Text: s}}, nil
+	}
+	var contents []ClaudeMediaMessage
+	contentBytes, err := json.Marshal(m.Content)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contentBytes, &contents)
+	return contents, err
+}
+
 type Tool struct {
 	Name            string                 `json:"name"`
 	Description     any                    `json:"description,omitempty"`
@@ -54,7 +78,7 @@ type InputSchema struct {
 type ClaudeRequest struct {
 	Model             string          `json:"model"`
 	Prompt            string          `json:"prompt,omitempty"`
-	System            string          `json:"system,omitempty"`
+	System            any             `json:"system,omitempty"`
 	Messages          []ClaudeMessage `json:"messages,omitempty"`
 	MaxTokens         uint            `json:"max_tokens,omitempty"`
 	MaxTokensToSample uint            `json:"max_tokens_to_sample,omitempty"`
@@ -62,11 +86,11 @@ type ClaudeRequest struct {
 	Temperature       float64         `json:"temperature,omitempty"`
 	TopP              float64         `json:"top_p,omitempty"`
 	TopK              int             `json:"top_k,omitempty"`
-	//ClaudeMetadata    `json:"metadata,omitempty"`
-	Stream     bool          `json:"stream,omitempty"`
-	Tools      []Tool        `json:"tools,omitempty"`
-	ToolChoice any           `json:"tool_choice,omitempty"`
-	Thinking   *dto.Thinking `json:"thinking,omitempty"`
+	Metadata          *ClaudeMetadata `json:"metadata,omitempty"`
+	Stream            bool            `json:"stream,omitempty"`
+	Tools             []Tool          `json:"tools,omitempty"`
+	ToolChoice        any             `json:"tool_choice,omitempty"`
+	Thinking          *dto.Thinking   `json:"thinking,omitempty"`
 }
 
 type ClaudeError struct {
@@ -89,7 +113,44 @@ type ClaudeResponse struct {
 	Message      *ClaudeResponse      `json:"message"` // stream only: message_start
 }
 
+// ParseSystem flattens the system prompt, which may be a string or a list of text blocks
+func (r *ClaudeRequest) ParseSystem() string {
+	if s, ok := r.System.(string); ok {
+		return s
+	}
+	systemBytes, err := json.Marshal(r.System)
+	if err != nil {
+		return ""
+	}
+	var blocks []ClaudeMediaMessage
+	if err = json.Unmarshal(systemBytes, &blocks); err != nil {
+		return ""
+	}
+	var system string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			system += block.Text
+		}
+	}
+	return system
+}
+
 type ClaudeUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+	OutputTokens             int `json:"output_tokens"`
+}
+
+// ClaudeNativeResponse is the Anthropic Messages response returned to /v1/messages clients
+// when the upstream speaks the OpenAI format
+type ClaudeNativeResponse struct {
+	Id           string               `json:"id"`
+	Type         string               `json:"type"`
+	Role         string               `json:"role"`
+	Model        string               `json:"model"`
+	Content      []ClaudeMediaMessage `json:"content"`
+	StopReason   string               `json:"stop_reason"`
+	StopSequence *string              `json:"stop_sequence"`
+	Usage        ClaudeUsage          `json:"usage"`
 }
@@ -314,6 +314,49 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 	return &claudeRequest, nil
 }
 
+// UsageClaude2OpenAI converts Anthropic usage, whose input_tokens exclude the tokens read from
+// or written to the prompt cache, to a usage whose prompt tokens cover the whole prompt
+func UsageClaude2OpenAI(claudeUsage *ClaudeUsage) dto.Usage {
+	usage := dto.Usage{
+		PromptTokens:     claudeUsage.InputTokens + claudeUsage.CacheReadInputTokens + claudeUsage.CacheCreationInputTokens,
+		CompletionTokens: claudeUsage.OutputTokens,
+	}
+	usage.PromptTokensDetails.CachedTokens = claudeUsage.CacheReadInputTokens
+	usage.PromptTokensDetails.CachedCreationTokens = claudeUsage.CacheCreationInputTokens
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// usageOpenAI2Claude is the reverse of UsageClaude2OpenAI
+func usageOpenAI2Claude(usage *dto.Usage) ClaudeUsage {
+	return ClaudeUsage{
+		InputTokens:              usage.PromptTokens - usage.PromptTokensDetails.CachedTokens - usage.PromptTokensDetails.CachedCreationTokens,
+		CacheCreationInputTokens: usage.PromptTokensDetails.CachedCreationTokens,
+		CacheReadInputTokens:     usage.PromptTokensDetails.CachedTokens,
+		OutputTokens:             usage.CompletionTokens,
+	}
+}
+
+// SetReasoningTokens estimates the thinking part of the output tokens, Anthropic only reports the total
+func SetReasoningTokens(usage *dto.Usage, thinking string, model string) {
+	if thinking == "" {
+		return
+	}
+	reasoningTokens, _ := service.CountTokenText(thinking, model)
+	usage.CompletionTokensDetails.ReasoningTokens = min(reasoningTokens, usage.CompletionTokens)
+}
+
+// ResponseThinking joins the thinking blocks of a non-stream response
+func ResponseThinking(claudeResponse *ClaudeResponse) string {
+	var thinking strings.Builder
+	for _, message := range claudeResponse.Content {
+		if message.Type == "thinking" {
+			thinking.WriteString(message.Thinking)
+		}
+	}
+	return thinking.String()
+}
+
 func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *ClaudeResponse) (*dto.ChatCompletionsStreamResponse, *ClaudeUsage) {
 	var response dto.ChatCompletionsStreamResponse
 	var claudeUsage *ClaudeUsage
@@ -464,6 +507,7 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 	var usage *dto.Usage
 	usage = &dto.Usage{}
 	responseText := ""
+	thinkingText := ""
 	createdTime := common.GetTimestamp()
 	scanner := bufio.NewScanner(resp.Body)
 	scanner.Split(bufio.ScanLines)
@@ -496,12 +540,13 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 				// message_start, 获取usage
 				responseId = claudeResponse.Message.Id
 				info.UpstreamModelName = claudeResponse.Message.Model
-				usage.PromptTokens = claudeUsage.InputTokens
+				*usage = UsageClaude2OpenAI(claudeUsage)
 			} else if claudeResponse.Type == "content_block_delta" {
 				responseText += claudeResponse.Delta.Text
+				thinkingText += claudeResponse.Delta.Thinking
 			} else if claudeResponse.Type == "message_delta" {
 				usage.CompletionTokens = claudeUsage.OutputTokens
-				usage.TotalTokens = claudeUsage.InputTokens + claudeUsage.OutputTokens
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 			} else if claudeResponse.Type == "content_block_start" {
 
 			} else {
@@ -528,6 +573,7 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 		if usage.CompletionTokens == 0 {
 			usage, _ = service.ResponseText2Usage(responseText, info.UpstreamModelName, usage.PromptTokens)
 		}
+		SetReasoningTokens(usage, thinkingText, info.UpstreamModelName)
 	}
 	if info.ShouldIncludeUsage {
 		response := service.GenerateFinalUsageResponse(responseId, createdTime, info.UpstreamModelName, *usage)
@@ -577,9 +623,8 @@ func ClaudeHandler(c *gin.Context, resp *http.Response, requestMode int, info *r
 		usage.CompletionTokens = completionTokens
 		usage.TotalTokens = info.PromptTokens + completionTokens
 	} else {
-		usage.PromptTokens = claudeResponse.Usage.InputTokens
-		usage.CompletionTokens = claudeResponse.Usage.OutputTokens
-		usage.TotalTokens = claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens
+		usage = UsageClaude2OpenAI(&claudeResponse.Usage)
+		SetReasoningTokens(&usage, ResponseThinking(&claudeResponse), info.UpstreamModelName)
 	}
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
@@ -591,3 +636,509 @@ func ClaudeHandler(c *gin.Context, resp *http.Response, requestMode int, info *r
 	_, err = c.Writer.Write(jsonResponse)
 	return nil, &usage
 }
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "stop":
+		return "end_turn"
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+// RequestClaude2OpenAI converts an inbound Anthropic Messages request so it can be served by
+// channels which only speak the OpenAI chat completions format
+func RequestClaude2OpenAI(claudeRequest ClaudeRequest) (*dto.GeneralOpenAIRequest, error) {
+	openAIRequest := dto.GeneralOpenAIRequest{
+		Model:       claudeRequest.Model,
+		MaxTokens:   claudeRequest.MaxTokens,
+		Temperature: claudeRequest.Temperature,
+		TopP:        claudeRequest.TopP,
+		TopK:        claudeRequest.TopK,
+		Stream:      claudeRequest.Stream,
+	}
+	if len(claudeRequest.StopSequences) > 0 {
+		openAIRequest.Stop = claudeRequest.StopSequences
+	}
+	if claudeRequest.Metadata != nil {
+		openAIRequest.User = claudeRequest.Metadata.UserId
+	}
+
+	for _, tool := range claudeRequest.Tools {
+		// server tools (web search, computer use, ...) have no openai equivalent
+		if tool.InputSchema == nil {
+			continue
+		}
+		description, _ := tool.Description.(string)
+		openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCall{
+			Type: "function",
+			Function: dto.FunctionCall{
+				Name:        tool.Name,
+				Description: description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if toolChoice, ok := claudeRequest.ToolChoice.(map[string]any); ok {
+		switch toolChoice["type"] {
+		case "auto":
+			openAIRequest.ToolChoice = "auto"
+		case "any":
+			openAIRequest.ToolChoice = "required"
+		case "none":
+			openAIRequest.ToolChoice = "none"
+		case "tool":
+			openAIRequest.ToolChoice = map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": toolChoice["name"],
+				},
+			}
+		}
+	}
+
+	messages := make([]dto.Message, 0, len(claudeRequest.Messages)+1)
+	if system := claudeRequest.ParseSystem(); system != "" {
+		systemMessage := dto.Message{Role: "system"}
+		systemMessage.SetStringContent(system)
+		messages = append(messages, systemMessage)
+	}
+	for _, claudeMessage := range claudeRequest.Messages {
+		if claudeMessage.IsStringContent() {
+			message := dto.Message{Role: claudeMessage.Role}
+			message.SetStringContent(claudeMessage.Content.(string))
+			messages = append(messages, message)
+			continue
+		}
+		contents, err := claudeMessage.ParseContent()
+		if err != nil {
+			return nil, fmt.Errorf("invalid message content: %w", err)
+		}
+		mediaContents := make([]map[string]any, 0, len(contents))
+		toolCalls := make([]dto.ToolCall, 0)
+		for _, content := range contents {
+			switch content.Type {
+			case "text":
+				mediaContents = append(mediaContents, map[string]any{
+					"type": dto.ContentTypeText,
+					"text": content.Text,
+				})
+			case "image":
+				if content.Source == nil {
+					continue
+				}
+				url := content.Source.Url
+				if content.Source.Type == "base64" {
+					url = fmt.Sprintf("data:%s;base64,%s", content.Source.MediaType, content.Source.Data)
+				}
+				mediaContents = append(mediaContents, map[string]any{
+					"type": dto.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": url,
+					},
+				})
+			case "tool_use":
+				args, _ := json.Marshal(content.Input)
+				toolCalls = append(toolCalls, dto.ToolCall{
+					ID:   content.Id,
+					Type: "function",
+					Function: dto.FunctionCall{
+						Name:      content.Name,
+						Arguments: string(args),
+					},
+				})
+			case "tool_result":
+				// openai expects tool results as separate messages right after the assistant tool calls
+				toolMessage := dto.Message{
+					Role:       "tool",
+					ToolCallId: content.ToolUseId,
+				}
+				toolMessage.SetStringContent(claudeToolResultText(content.Content))
+				messages = append(messages, toolMessage)
+			}
+		}
+		if len(mediaContents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := dto.Message{Role: claudeMessage.Role}
+		if len(mediaContents) == 1 && mediaContents[0]["type"] == dto.ContentTypeText {
+			message.SetStringContent(mediaContents[0]["text"].(string))
+		} else if len(mediaContents) > 0 {
+			message.Content, _ = json.Marshal(mediaContents)
+		}
+		if len(toolCalls) > 0 {
+			message.ToolCalls = toolCalls
+		}
+		messages = append(messages, message)
+	}
+	openAIRequest.Messages = messages
+	return &openAIRequest, nil
+}
+
+// claudeToolResultText flattens tool_result content, which may be a string or a list of blocks
+func claudeToolResultText(content any) string {
+	if s, ok := content.(string); ok {
+		return s
+	}
+	contentBytes, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	var blocks []ClaudeMediaMessage
+	if err = json.Unmarshal(contentBytes, &blocks); err != nil {
+		return string(contentBytes)
+	}
+	var text string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			text += block.Text
+		}
+	}
+	return text
+}
+
+func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse) *ClaudeNativeResponse {
+	claudeResponse := ClaudeNativeResponse{
+		Id:         fmt.Sprintf("msg_%s", common.GetUUID()),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      openAIResponse.Model,
+		Content:    make([]ClaudeMediaMessage, 0),
+		Usage:      usageOpenAI2Claude(&openAIResponse.Usage),
+		StopReason: "end_turn",
+	}
+	if len(openAIResponse.Choices) == 0 {
+		return &claudeResponse
+	}
+	choice := openAIResponse.Choices[0]
+	if choice.Message.ReasoningContent != nil && *choice.Message.ReasoningContent != "" {
+		claudeResponse.Content = append(claudeResponse.Content, ClaudeMediaMessage{
+			Type:     "thinking",
+			Thinking: *choice.Message.ReasoningContent,
+		})
+	}
+	if text := choice.Message.StringContent(); text != "" && text != "null" {
+		claudeResponse.Content = append(claudeResponse.Content, ClaudeMediaMessage{
+			Type: "text",
+			Text: text,
+		})
+	}
+	if choice.Message.ToolCalls != nil {
+		var toolCalls []dto.ToolCall
+		toolCallsBytes, _ := json.Marshal(choice.Message.ToolCalls)
+		if err := json.Unmarshal(toolCallsBytes, &toolCalls); err == nil {
+			for _, toolCall := range toolCalls {
+				input := make(map[string]any)
+				_ = json.Unmarshal([]byte(toolCall.Function.Arguments), &input)
+				claudeResponse.Content = append(claudeResponse.Content, ClaudeMediaMessage{
+					Type:  "tool_use",
+					Id:    toolCall.ID,
+					Name:  toolCall.Function.Name,
+					Input: input,
+				})
+			}
+		}
+	}
+	claudeResponse.StopReason = stopReasonOpenAI2Claude(choice.FinishReason)
+	return &claudeResponse
+}
+
+// ClaudeStreamEvent is a single Anthropic Messages stream event, Data is marshalled as the event payload
+type ClaudeStreamEvent struct {
+	Type string
+	Data map[string]any
+}
+
+// OpenAI2ClaudeStreamState translates OpenAI chat completion chunks into Anthropic Messages
+// stream events, keeping track of which content block is currently open
+type OpenAI2ClaudeStreamState struct {
+	Id           string
+	Model        string
+	PromptTokens int
+
+	started     bool
+	blockIndex  int
+	blockType   string
+	toolBlocks  map[int]int
+	stopReason  string
+	usage       ClaudeUsage
+	hasUsage    bool
+	contentText strings.Builder
+}
+
+func NewOpenAI2ClaudeStreamState(model string, promptTokens int) *OpenAI2ClaudeStreamState {
+	return &OpenAI2ClaudeStreamState{
+		Id:           fmt.Sprintf("msg_%s", common.GetUUID()),
+		Model:        model,
+		PromptTokens: promptTokens,
+		blockIndex:   -1,
+		toolBlocks:   make(map[int]int),
+	}
+}
+
+func (s *OpenAI2ClaudeStreamState) start() []ClaudeStreamEvent {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	return []ClaudeStreamEvent{{
+		Type: "message_start",
+		Data: map[string]any{
+			"type": "message_start",
+			"message": map[string]any{
+				"id":            s.Id,
+				"type":          "message",
+				"role":          "assistant",
+				"model":         s.Model,
+				"content":       []any{},
+				"stop_reason":   nil,
+				"stop_sequence": nil,
+				"usage": map[string]any{
+					"input_tokens":  s.PromptTokens,
+					"output_tokens": 0,
+				},
+			},
+		},
+	}}
+}
+
+func (s *OpenAI2ClaudeStreamState) stopBlock() []ClaudeStreamEvent {
+	if s.blockType == "" {
+		return nil
+	}
+	s.blockType = ""
+	return []ClaudeStreamEvent{{
+		Type: "content_block_stop",
+		Data: map[string]any{
+			"type":  "content_block_stop",
+			"index": s.blockIndex,
+		},
+	}}
+}
+
+func (s *OpenAI2ClaudeStreamState) startBlock(contentBlock map[string]any) []ClaudeStreamEvent {
+	events := s.stopBlock()
+	s.blockIndex++
+	s.blockType = contentBlock["type"].(string)
+	return append(events, ClaudeStreamEvent{
+		Type: "content_block_start",
+		Data: map[string]any{
+			"type":          "content_block_start",
+			"index":         s.blockIndex,
+			"content_block": contentBlock,
+		},
+	})
+}
+
+func (s *OpenAI2ClaudeStreamState) delta(delta map[string]any) ClaudeStreamEvent {
+	return ClaudeStreamEvent{
+		Type: "content_block_delta",
+		Data: map[string]any{
+			"type":  "content_block_delta",
+			"index": s.blockIndex,
+			"delta": delta,
+		},
+	}
+}
+
+// Convert translates one OpenAI chunk into zero or more Anthropic stream events
+func (s *OpenAI2ClaudeStreamState) Convert(chunk *dto.ChatCompletionsStreamResponse) []ClaudeStreamEvent {
+	if chunk.Model != "" && !s.started {
+		s.Model = chunk.Model
+	}
+	events := s.start()
+	if chunk.Usage != nil && (chunk.Usage.PromptTokens != 0 || chunk.Usage.CompletionTokens != 0) {
+		s.usage = usageOpenAI2Claude(chunk.Usage)
+		s.hasUsage = true
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Delta.ReasoningContent != nil && *choice.Delta.ReasoningContent != "" {
+			if s.blockType != "thinking" {
+				events = append(events, s.startBlock(map[string]any{"type": "thinking", "thinking": ""})...)
+			}
+			s.contentText.WriteString(*choice.Delta.ReasoningContent)
+			events = append(events, s.delta(map[string]any{"type": "thinking_delta", "thinking": *choice.Delta.ReasoningContent}))
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			if s.blockType != "text" {
+				events = append(events, s.startBlock(map[string]any{"type": "text", "text": ""})...)
+			}
+			s.contentText.WriteString(text)
+			events = append(events, s.delta(map[string]any{"type": "text_delta", "text": text}))
+		}
+		for i, toolCall := range choice.Delta.ToolCalls {
+			toolIndex := i
+			if toolCall.Index != nil {
+				toolIndex = *toolCall.Index
+			}
+			if _, ok := s.toolBlocks[toolIndex]; !ok {
+				events = append(events, s.startBlock(map[string]any{
+					"type":  "tool_use",
+					"id":    toolCall.ID,
+					"name":  toolCall.Function.Name,
+					"input": map[string]any{},
+				})...)
+				s.toolBlocks[toolIndex] = s.blockIndex
+			}
+			if toolCall.Function.Arguments != "" {
+				s.contentText.WriteString(toolCall.Function.Arguments)
+				events = append(events, s.delta(map[string]any{"type": "input_json_delta", "partial_json": toolCall.Function.Arguments}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+	return events
+}
+
+// Finish closes the open content block and emits the final message_delta and message_stop events
+func (s *OpenAI2ClaudeStreamState) Finish(usage *dto.Usage) []ClaudeStreamEvent {
+	events := s.start()
+	events = append(events, s.stopBlock()...)
+	if !s.hasUsage && usage != nil {
+		s.usage = usageOpenAI2Claude(usage)
+	}
+	if s.stopReason == "" {
+		s.stopReason = "end_turn"
+	}
+	events = append(events, ClaudeStreamEvent{
+		Type: "message_delta",
+		Data: map[string]any{
+			"type": "message_delta",
+			"delta": map[string]any{
+				"stop_reason":   s.stopReason,
+				"stop_sequence": nil,
+			},
+			"usage": s.usage,
+		},
+	}, ClaudeStreamEvent{
+		Type: "message_stop",
+		Data: map[string]any{
+			"type": "message_stop",
+		},
+	})
+	return events
+}
+
+// ResponseText returns all text emitted so far, used to estimate usage when the upstream reports none
+func (s *OpenAI2ClaudeStreamState) ResponseText() string {
+	return s.contentText.String()
+}
+
+// ClaudeNativeStreamUsage updates usage from a native Anthropic stream event
+func ClaudeNativeStreamUsage(claudeResponse *ClaudeResponse, usage *dto.Usage) {
+	switch claudeResponse.Type {
+	case "message_start":
+		if claudeResponse.Message != nil {
+			*usage = UsageClaude2OpenAI(&claudeResponse.Message.Usage)
+		}
+	case "message_delta":
+		// newer deltas repeat the cumulative input usage, older ones only carry output_tokens
+		if claudeResponse.Usage.InputTokens > 0 || claudeResponse.Usage.CacheReadInputTokens > 0 || claudeResponse.Usage.CacheCreationInputTokens > 0 {
+			deltaUsage := UsageClaude2OpenAI(&claudeResponse.Usage)
+			usage.PromptTokens = deltaUsage.PromptTokens
+			usage.PromptTokensDetails = deltaUsage.PromptTokensDetails
+		}
+		if claudeResponse.Usage.OutputTokens > 0 {
+			usage.CompletionTokens = claudeResponse.Usage.OutputTokens
+		}
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+}
+
+// ClaudeNativeStreamHandler forwards an Anthropic Messages stream to the client unchanged
+func ClaudeNativeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	usage := &dto.Usage{}
+	var responseText strings.Builder
+	var thinkingText strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+	service.SetEventStreamHeaders(c)
+
+	for scanner.Scan() {
+		info.SetFirstResponseTime()
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			_, err := c.Writer.WriteString(line + "\n")
+			if err != nil {
+				common.LogError(c, "send_stream_response_failed: "+err.Error())
+			}
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		var claudeResponse ClaudeResponse
+		err := json.Unmarshal([]byte(data), &claudeResponse)
+		if err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+		} else {
+			ClaudeNativeStreamUsage(&claudeResponse, usage)
+			if claudeResponse.Type == "message_start" && claudeResponse.Message != nil {
+				info.UpstreamModelName = claudeResponse.Message.Model
+			}
+			if claudeResponse.Delta != nil {
+				responseText.WriteString(claudeResponse.Delta.Text)
+				responseText.WriteString(claudeResponse.Delta.PartialJson)
+				responseText.WriteString(claudeResponse.Delta.Thinking)
+				thinkingText.WriteString(claudeResponse.Delta.Thinking)
+			}
+		}
+		_, err = c.Writer.WriteString(line + "\n")
+		if err != nil {
+			common.LogError(c, "send_stream_response_failed: "+err.Error())
+		}
+		c.Writer.Flush()
+	}
+	resp.Body.Close()
+
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	if usage.CompletionTokens == 0 {
+		usage, _ = service.ResponseText2Usage(responseText.String(), info.UpstreamModelName, usage.PromptTokens)
+	}
+	SetReasoningTokens(usage, thinkingText.String(), info.UpstreamModelName)
+	return nil, usage
+}
+
+// ClaudeNativeHandler forwards a non-stream Anthropic Messages response to the client unchanged
+func ClaudeNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var claudeResponse ClaudeResponse
+	err = json.Unmarshal(responseBody, &claudeResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if claudeResponse.Error.Type != "" {
+		return &dto.OpenAIErrorWithStatusCode{
+			Error: dto.OpenAIError{
+				Message: claudeResponse.Error.Message,
+				Type:    claudeResponse.Error.Type,
+				Param:   "",
+				Code:    claudeResponse.Error.Type,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	usage := UsageClaude2OpenAI(&claudeResponse.Usage)
+	SetReasoningTokens(&usage, ResponseThinking(&claudeResponse), info.UpstreamModelName)
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, &usage
+}
@@ -31,6 +31,8 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	if info.RelayMode == constant.RelayModeRerank {
 		return fmt.Sprintf("%s/v1/rerank", info.BaseUrl), nil
+	} else if info.RelayMode == constant.RelayModeEmbeddings {
+		return fmt.Sprintf("%s/v2/embed", info.BaseUrl), nil
 	} else {
 		return fmt.Sprintf("%s/v1/chat", info.BaseUrl), nil
 	}
@@ -43,6 +45,9 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *re
 }
 
 func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (any, error) {
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		return embeddingRequestOpenAI2Cohere(*request)
+	}
 	return requestOpenAI2Cohere(*request), nil
 }
 
@@ -57,6 +62,8 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
 	if info.RelayMode == constant.RelayModeRerank {
 		err, usage = cohereRerankHandler(c, resp, info)
+	} else if info.RelayMode == constant.RelayModeEmbeddings {
+		err, usage = cohereEmbeddingHandler(c, resp, info)
 	} else {
 		if info.IsStream {
 			err, usage = cohereStreamHandler(c, resp, info)
@@ -44,6 +44,22 @@ type CohereRerankResponseResult struct {
 	Meta    CohereMeta                   `json:"meta"`
 }
 
+type CohereEmbeddingRequest struct {
+	Model           string   `json:"model"`
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	EmbeddingTypes  []string `json:"embedding_types"`
+	OutputDimension int      `json:"output_dimension,omitempty"`
+}
+
+type CohereEmbeddingResponse struct {
+	Id         string `json:"id"`
+	Embeddings struct {
+		Float [][]float64 `json:"float"`
+	} `json:"embeddings"`
+	Meta CohereMeta `json:"meta"`
+}
+
 type CohereMeta struct {
 	//Tokens CohereTokens `json:"tokens"`
 	BilledUnits CohereBilledUnits `json:"billed_units"`
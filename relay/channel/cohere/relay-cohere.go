@@ -65,6 +65,21 @@ func requestConvertRerank2Cohere(rerankRequest dto.RerankRequest) *CohereRerankR
 	return &cohereReq
 }
 
+func embeddingRequestOpenAI2Cohere(request dto.GeneralOpenAIRequest) (*CohereEmbeddingRequest, error) {
+	input, err := request.ParseEmbeddingInput()
+	if err != nil {
+		return nil, err
+	}
+	return &CohereEmbeddingRequest{
+		Model: request.Model,
+		Texts: input,
+		// openai has no notion of input types, embeddings are most often stored for retrieval
+		InputType:       "search_document",
+		EmbeddingTypes:  []string{"float"},
+		OutputDimension: request.Dimensions,
+	}, nil
+}
+
 func stopReasonCohere2OpenAI(reason string) string {
 	switch reason {
 	case "COMPLETE":
@@ -251,3 +266,50 @@ func cohereRerankHandler(c *gin.Context, resp *http.Response, info *relaycommon.
 	_, err = c.Writer.Write(jsonResponse)
 	return nil, &usage
 }
+
+func cohereEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var cohereResp CohereEmbeddingResponse
+	err = json.Unmarshal(responseBody, &cohereResp)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := dto.Usage{}
+	if cohereResp.Meta.BilledUnits.InputTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+		usage.TotalTokens = info.PromptTokens
+	} else {
+		usage.PromptTokens = cohereResp.Meta.BilledUnits.InputTokens
+		usage.TotalTokens = cohereResp.Meta.BilledUnits.InputTokens
+	}
+
+	embeddingResp := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(cohereResp.Embeddings.Float)),
+		Model:  info.UpstreamModelName,
+		Usage:  usage,
+	}
+	for i, embedding := range cohereResp.Embeddings.Float {
+		embeddingResp.Data = append(embeddingResp.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: service.EncodeEmbedding(c, embedding),
+		})
+	}
+
+	jsonResponse, err := json.Marshal(embeddingResp)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &usage
+}
@@ -10,6 +10,7 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
 )
 
 type Adaptor struct {
@@ -41,7 +42,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	}
 
 	action := "generateContent"
-	if info.IsStream {
+	if info.RelayMode == relayconstant.RelayModeEmbeddings {
+		action = "batchEmbedContents"
+	} else if info.IsStream {
 		action = "streamGenerateContent?alt=sse"
 	}
 	return fmt.Sprintf("%s/%s/models/%s:%s", info.BaseUrl, version, info.UpstreamModelName, action), nil
@@ -57,9 +60,19 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if info.RelayMode == relayconstant.RelayModeEmbeddings {
+		return embeddingRequestOpenAI2Gemini(*request, info)
+	}
 	return CovertGemini2OpenAI(*request), nil
 }
 
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return request, nil
+}
+
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
 	return nil, nil
 }
@@ -69,6 +82,18 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayFormat == relaycommon.RelayFormatGemini {
+		if info.IsStream {
+			err, usage = GeminiNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = GeminiNativeHandler(c, resp, info)
+		}
+		return
+	}
+	if info.RelayMode == relayconstant.RelayModeEmbeddings {
+		err, usage = geminiEmbeddingHandler(c, resp, info)
+		return
+	}
 	if info.IsStream {
 		err, usage = GeminiChatStreamHandler(c, resp, info)
 	} else {
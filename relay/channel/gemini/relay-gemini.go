@@ -3,6 +3,7 @@ package gemini
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
@@ -253,8 +254,7 @@ func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycom
 		response.Created = createAt
 		responseText += response.Choices[0].Delta.GetContentString()
 		if geminiResponse.UsageMetadata.TotalTokenCount != 0 {
-			usage.PromptTokens = geminiResponse.UsageMetadata.PromptTokenCount
-			usage.CompletionTokens = geminiResponse.UsageMetadata.CandidatesTokenCount
+			geminiUsage(geminiResponse.UsageMetadata, usage)
 		}
 		err = service.ObjectData(c, response)
 		if err != nil {
@@ -305,12 +305,543 @@ func GeminiChatHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWit
 		}, nil
 	}
 	fullTextResponse := responseGeminiChat2OpenAI(&geminiResponse)
+	usage := dto.Usage{}
+	geminiUsage(geminiResponse.UsageMetadata, &usage)
+	fullTextResponse.Usage = usage
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &usage
+}
+
+var geminiFinishReasonMap = map[string]string{
+	"stop":           "STOP",
+	"length":         "MAX_TOKENS",
+	"content_filter": "SAFETY",
+	"tool_calls":     "STOP",
+	"function_call":  "STOP",
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	if geminiReason, ok := geminiFinishReasonMap[reason]; ok {
+		return geminiReason
+	}
+	return "STOP"
+}
+
+// RequestGemini2OpenAI converts a native generateContent request into the openai chat format,
+// it is the reverse of CovertGemini2OpenAI and is used when the channel does not speak gemini
+func RequestGemini2OpenAI(geminiRequest GeminiChatRequest, model string, stream bool) (*dto.GeneralOpenAIRequest, error) {
+	config := geminiRequest.GenerationConfig
+	openAIRequest := dto.GeneralOpenAIRequest{
+		Model:       model,
+		Stream:      stream,
+		MaxTokens:   config.MaxOutputTokens,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        int(config.TopK),
+		N:           config.CandidateCount,
+		Seed:        config.Seed,
+	}
+	if len(config.StopSequences) > 0 {
+		openAIRequest.Stop = config.StopSequences
+	}
+	if config.ResponseMimeType == "application/json" {
+		openAIRequest.ResponseFormat = map[string]string{"type": "json_object"}
+	}
+
+	for _, tool := range geminiRequest.Tools {
+		if tool.FunctionDeclarations == nil {
+			continue
+		}
+		declarationsBytes, err := json.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function declarations: %w", err)
+		}
+		var declarations []GeminiFunctionDeclaration
+		if err = json.Unmarshal(declarationsBytes, &declarations); err != nil {
+			return nil, fmt.Errorf("invalid function declarations: %w", err)
+		}
+		for _, declaration := range declarations {
+			openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCall{
+				Type: "function",
+				Function: dto.FunctionCall{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  declaration.Parameters,
+				},
+			})
+		}
+	}
+	if geminiRequest.ToolConfig != nil && geminiRequest.ToolConfig.FunctionCallingConfig != nil {
+		callingConfig := geminiRequest.ToolConfig.FunctionCallingConfig
+		switch callingConfig.Mode {
+		case "AUTO":
+			openAIRequest.ToolChoice = "auto"
+		case "NONE":
+			openAIRequest.ToolChoice = "none"
+		case "ANY":
+			openAIRequest.ToolChoice = "required"
+			if len(callingConfig.AllowedFunctionNames) == 1 {
+				openAIRequest.ToolChoice = map[string]any{
+					"type": "function",
+					"function": map[string]any{
+						"name": callingConfig.AllowedFunctionNames[0],
+					},
+				}
+			}
+		}
+	}
+
+	messages := make([]dto.Message, 0, len(geminiRequest.Contents)+1)
+	if geminiRequest.SystemInstructions != nil {
+		var system string
+		for _, part := range geminiRequest.SystemInstructions.Parts {
+			system += part.Text
+		}
+		if system != "" {
+			systemMessage := dto.Message{Role: "system"}
+			systemMessage.SetStringContent(system)
+			messages = append(messages, systemMessage)
+		}
+	}
+	// gemini pairs function responses with calls by name, openai by id
+	pendingCallIds := make(map[string][]string)
+	for _, content := range geminiRequest.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		mediaContents := make([]map[string]any, 0, len(content.Parts))
+		toolCalls := make([]dto.ToolCall, 0)
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				args, _ := json.Marshal(part.FunctionCall.Arguments)
+				callId := fmt.Sprintf("call_%s", common.GetUUID())
+				pendingCallIds[part.FunctionCall.FunctionName] = append(pendingCallIds[part.FunctionCall.FunctionName], callId)
+				toolCalls = append(toolCalls, dto.ToolCall{
+					ID:   callId,
+					Type: "function",
+					Function: dto.FunctionCall{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: string(args),
+					},
+				})
+			case part.FunctionResponse != nil:
+				callId := fmt.Sprintf("call_%s", common.GetUUID())
+				if ids := pendingCallIds[part.FunctionResponse.Name]; len(ids) > 0 {
+					callId = ids[0]
+					pendingCallIds[part.FunctionResponse.Name] = ids[1:]
+				}
+				result, _ := json.Marshal(part.FunctionResponse.Response)
+				toolMessage := dto.Message{
+					Role:       "tool",
+					ToolCallId: callId,
+				}
+				toolMessage.SetStringContent(string(result))
+				messages = append(messages, toolMessage)
+			case part.InlineData != nil:
+				mediaContents = append(mediaContents, map[string]any{
+					"type": dto.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+					},
+				})
+			case part.FileData != nil:
+				mediaContents = append(mediaContents, map[string]any{
+					"type": dto.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": part.FileData.FileUri,
+					},
+				})
+			case part.Text != "":
+				mediaContents = append(mediaContents, map[string]any{
+					"type": dto.ContentTypeText,
+					"text": part.Text,
+				})
+			}
+		}
+		if len(mediaContents) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		message := dto.Message{Role: role}
+		if len(mediaContents) == 1 && mediaContents[0]["type"] == dto.ContentTypeText {
+			message.SetStringContent(mediaContents[0]["text"].(string))
+		} else if len(mediaContents) > 0 {
+			message.Content, _ = json.Marshal(mediaContents)
+		}
+		if len(toolCalls) > 0 {
+			message.ToolCalls = toolCalls
+		}
+		messages = append(messages, message)
+	}
+	if len(messages) == 0 {
+		return nil, errors.New("contents is empty")
+	}
+	openAIRequest.Messages = messages
+	return &openAIRequest, nil
+}
+
+func toolCalls2GeminiParts(toolCalls []dto.ToolCall) []GeminiPart {
+	parts := make([]GeminiPart, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		var args any
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+			args = map[string]any{}
+		}
+		parts = append(parts, GeminiPart{
+			FunctionCall: &FunctionCall{
+				FunctionName: toolCall.Function.Name,
+				Arguments:    args,
+			},
+		})
+	}
+	return parts
+}
+
+func usage2GeminiUsageMetadata(usage dto.Usage) GeminiUsageMetadata {
+	return GeminiUsageMetadata{
+		PromptTokenCount:        usage.PromptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens - usage.CompletionTokensDetails.ReasoningTokens,
+		TotalTokenCount:         usage.PromptTokens + usage.CompletionTokens,
+		CachedContentTokenCount: usage.PromptTokensDetails.CachedTokens,
+		ThoughtsTokenCount:      usage.CompletionTokensDetails.ReasoningTokens,
+	}
+}
+
+func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse) *GeminiChatResponse {
+	geminiResponse := GeminiChatResponse{
+		Candidates:    make([]GeminiChatCandidate, 0, len(openAIResponse.Choices)),
+		UsageMetadata: usage2GeminiUsageMetadata(openAIResponse.Usage),
+		ModelVersion:  openAIResponse.Model,
+	}
+	for _, choice := range openAIResponse.Choices {
+		candidate := GeminiChatCandidate{
+			Index:        int64(choice.Index),
+			FinishReason: finishReasonOpenAI2Gemini(choice.FinishReason),
+			Content: GeminiChatContent{
+				Role:  "model",
+				Parts: make([]GeminiPart, 0),
+			},
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			candidate.Content.Parts = append(candidate.Content.Parts, GeminiPart{Text: text})
+		}
+		if choice.Message.ToolCalls != nil {
+			toolCallsBytes, _ := json.Marshal(choice.Message.ToolCalls)
+			var toolCalls []dto.ToolCall
+			if err := json.Unmarshal(toolCallsBytes, &toolCalls); err == nil {
+				candidate.Content.Parts = append(candidate.Content.Parts, toolCalls2GeminiParts(toolCalls)...)
+			}
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, candidate)
+	}
+	return &geminiResponse
+}
+
+// OpenAI2GeminiStreamState turns openai chat completion chunks into streamGenerateContent chunks.
+// openai streams tool call arguments in fragments while gemini sends each call whole, so calls are
+// collected and sent with the last chunk, which also carries the finish reason and usage metadata.
+type OpenAI2GeminiStreamState struct {
+	model        string
+	finishReason string
+	toolCalls    []dto.ToolCall
+	toolIndexes  map[int]int
+	pending      *GeminiChatResponse
+	responseText strings.Builder
+}
+
+func NewOpenAI2GeminiStreamState(model string) *OpenAI2GeminiStreamState {
+	return &OpenAI2GeminiStreamState{
+		model:       model,
+		toolIndexes: make(map[int]int),
+	}
+}
+
+func (s *OpenAI2GeminiStreamState) newChunk(parts []GeminiPart) *GeminiChatResponse {
+	return &GeminiChatResponse{
+		Candidates: []GeminiChatCandidate{
+			{
+				Content: GeminiChatContent{
+					Role:  "model",
+					Parts: parts,
+				},
+			},
+		},
+		ModelVersion: s.model,
+	}
+}
+
+// Convert returns the chunks that are ready to be sent, the latest text chunk is held back
+// so that Finish can attach the finish reason to it
+func (s *OpenAI2GeminiStreamState) Convert(chunk *dto.ChatCompletionsStreamResponse) []*GeminiChatResponse {
+	var chunks []*GeminiChatResponse
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			toolIndex := 0
+			if toolCall.Index != nil {
+				toolIndex = *toolCall.Index
+			}
+			i, ok := s.toolIndexes[toolIndex]
+			if !ok {
+				s.toolIndexes[toolIndex] = len(s.toolCalls)
+				s.toolCalls = append(s.toolCalls, toolCall)
+				continue
+			}
+			if toolCall.Function.Name != "" {
+				s.toolCalls[i].Function.Name = toolCall.Function.Name
+			}
+			s.toolCalls[i].Function.Arguments += toolCall.Function.Arguments
+		}
+		text := choice.Delta.GetContentString()
+		if text == "" {
+			continue
+		}
+		s.responseText.WriteString(text)
+		if s.pending != nil {
+			chunks = append(chunks, s.pending)
+		}
+		s.pending = s.newChunk([]GeminiPart{{Text: text}})
+	}
+	return chunks
+}
+
+func (s *OpenAI2GeminiStreamState) Finish(usage *dto.Usage) []*GeminiChatResponse {
+	var chunks []*GeminiChatResponse
+	last := s.pending
+	if last == nil || len(s.toolCalls) > 0 {
+		if last != nil {
+			chunks = append(chunks, last)
+		}
+		last = s.newChunk(toolCalls2GeminiParts(s.toolCalls))
+	}
+	last.Candidates[0].FinishReason = finishReasonOpenAI2Gemini(s.finishReason)
+	if usage != nil {
+		last.UsageMetadata = usage2GeminiUsageMetadata(*usage)
+	}
+	s.pending = nil
+	return append(chunks, last)
+}
+
+func (s *OpenAI2GeminiStreamState) ResponseText() string {
+	return s.responseText.String()
+}
+
+// GeminiStreamSSE reports whether the client asked streamGenerateContent for server-sent events (alt=sse),
+// the gemini api answers with a chunked json array otherwise
+func GeminiStreamSSE(c *gin.Context) bool {
+	return c.Query("alt") == "sse"
+}
+
+func SetGeminiStreamHeaders(c *gin.Context) {
+	service.SetEventStreamHeaders(c)
+	if !GeminiStreamSSE(c) {
+		c.Writer.Header().Set("Content-Type", "application/json")
+	}
+}
+
+// GeminiStreamFrame frames the index-th chunk of a streamGenerateContent response
+func GeminiStreamFrame(sse bool, data string, index int) string {
+	if sse {
+		return fmt.Sprintf("data: %s\n\n", data)
+	}
+	if index == 0 {
+		return "[" + data
+	}
+	return ",\r\n" + data
+}
+
+// GeminiStreamEnd closes a streamGenerateContent response after count chunks were framed
+func GeminiStreamEnd(sse bool, count int) string {
+	if sse {
+		return ""
+	}
+	if count == 0 {
+		return "[]"
+	}
+	return "]"
+}
+
+// geminiUsage updates usage from usageMetadata, thoughts are not part of candidatesTokenCount
+// but are billed as completion tokens like OpenAI reasoning tokens
+func geminiUsage(usageMetadata GeminiUsageMetadata, usage *dto.Usage) {
+	if usageMetadata.PromptTokenCount != 0 {
+		// promptTokenCount already includes the cached content
+		usage.PromptTokens = usageMetadata.PromptTokenCount
+		usage.PromptTokensDetails.CachedTokens = usageMetadata.CachedContentTokenCount
+		for _, detail := range usageMetadata.PromptTokensDetails {
+			switch detail.Modality {
+			case "TEXT":
+				usage.PromptTokensDetails.TextTokens = detail.TokenCount
+			case "AUDIO":
+				usage.PromptTokensDetails.AudioTokens = detail.TokenCount
+			case "IMAGE":
+				usage.PromptTokensDetails.ImageTokens = detail.TokenCount
+			}
+		}
+	}
+	if usageMetadata.CandidatesTokenCount+usageMetadata.ThoughtsTokenCount != 0 {
+		usage.CompletionTokens = usageMetadata.CandidatesTokenCount + usageMetadata.ThoughtsTokenCount
+		usage.CompletionTokensDetails.ReasoningTokens = usageMetadata.ThoughtsTokenCount
+		for _, detail := range usageMetadata.CandidatesTokensDetails {
+			switch detail.Modality {
+			case "TEXT":
+				usage.CompletionTokensDetails.TextTokens = detail.TokenCount
+			case "AUDIO":
+				usage.CompletionTokensDetails.AudioTokens = detail.TokenCount
+			case "IMAGE":
+				usage.CompletionTokensDetails.ImageTokens = detail.TokenCount
+			}
+		}
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+}
+
+// GeminiNativeStreamHandler forwards a streamGenerateContent response to the client unchanged,
+// usage is taken from the usageMetadata of the chunks
+func GeminiNativeStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	usage := &dto.Usage{}
+	var responseText strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+	SetGeminiStreamHeaders(c)
+
+	sse := GeminiStreamSSE(c)
+	count := 0
+	for scanner.Scan() {
+		info.SetFirstResponseTime()
+		data := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(data, "data:") {
+			continue
+		}
+		data = strings.TrimSpace(strings.TrimPrefix(data, "data:"))
+		var geminiResponse GeminiChatResponse
+		err := json.Unmarshal([]byte(data), &geminiResponse)
+		if err != nil {
+			common.LogError(c, "error unmarshalling stream response: "+err.Error())
+			continue
+		}
+		geminiUsage(geminiResponse.UsageMetadata, usage)
+		for _, candidate := range geminiResponse.Candidates {
+			for _, part := range candidate.Content.Parts {
+				responseText.WriteString(part.Text)
+			}
+		}
+		_, err = c.Writer.WriteString(GeminiStreamFrame(sse, data, count))
+		if err != nil {
+			common.LogError(c, "send_stream_response_failed: "+err.Error())
+		}
+		c.Writer.Flush()
+		count++
+	}
+	_, _ = c.Writer.WriteString(GeminiStreamEnd(sse, count))
+	c.Writer.Flush()
+	resp.Body.Close()
+
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	if usage.CompletionTokens == 0 {
+		usage, _ = service.ResponseText2Usage(responseText.String(), info.UpstreamModelName, usage.PromptTokens)
+	}
+	return nil, usage
+}
+
+// GeminiNativeHandler forwards a generateContent response to the client unchanged
+func GeminiNativeHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var geminiResponse GeminiChatResponse
+	err = json.Unmarshal(responseBody, &geminiResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := &dto.Usage{}
+	geminiUsage(geminiResponse.UsageMetadata, usage)
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		common.LogError(c, "write_response_body_failed: "+err.Error())
+	}
+	return nil, usage
+}
+
+func embeddingRequestOpenAI2Gemini(request dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) (*GeminiBatchEmbeddingRequest, error) {
+	input, err := request.ParseEmbeddingInput()
+	if err != nil {
+		return nil, err
+	}
+	geminiRequest := &GeminiBatchEmbeddingRequest{
+		Requests: make([]GeminiEmbeddingRequest, 0, len(input)),
+	}
+	for _, text := range input {
+		geminiRequest.Requests = append(geminiRequest.Requests, GeminiEmbeddingRequest{
+			Model: "models/" + info.UpstreamModelName,
+			Content: GeminiChatContent{
+				Parts: []GeminiPart{
+					{
+						Text: text,
+					},
+				},
+			},
+			OutputDimensionality: request.Dimensions,
+		})
+	}
+	return geminiRequest, nil
+}
+
+func geminiEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var geminiResponse GeminiBatchEmbeddingResponse
+	err = json.Unmarshal(responseBody, &geminiResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	// gemini does not report the token count of embeddings
 	usage := dto.Usage{
-		PromptTokens:     geminiResponse.UsageMetadata.PromptTokenCount,
-		CompletionTokens: geminiResponse.UsageMetadata.CandidatesTokenCount,
-		TotalTokens:      geminiResponse.UsageMetadata.TotalTokenCount,
+		PromptTokens: info.PromptTokens,
+		TotalTokens:  info.PromptTokens,
+	}
+	fullTextResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(geminiResponse.Embeddings)),
+		Model:  info.UpstreamModelName,
+		Usage:  usage,
+	}
+	for i, embedding := range geminiResponse.Embeddings {
+		fullTextResponse.Data = append(fullTextResponse.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: service.EncodeEmbedding(c, embedding.Values),
+		})
 	}
-	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
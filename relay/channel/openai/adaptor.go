@@ -9,6 +9,7 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"one-api/common"
 	"one-api/dto"
 	"one-api/relay/channel"
@@ -18,6 +19,7 @@ import (
 	"one-api/relay/channel/moonshot"
 	relaycommon "one-api/relay/common"
 	"one-api/relay/constant"
+	"strconv"
 	"strings"
 )
 
@@ -31,11 +33,18 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.RelayMode == constant.RelayModeRealtime {
+		return getRealtimeURL(info), nil
+	}
 	switch info.ChannelType {
 	case common.ChannelTypeAzure:
 		// https://learn.microsoft.com/en-us/azure/cognitive-services/openai/chatgpt-quickstart?pivots=rest-api&tabs=command-line#rest-api
 		requestURL := strings.Split(info.RequestURLPath, "?")[0]
 		requestURL = fmt.Sprintf("%s?api-version=%s", requestURL, info.ApiVersion)
+		if info.RelayMode == constant.RelayModeResponses {
+			// the responses api is not scoped to a deployment
+			return relaycommon.GetFullRequestURL(info.BaseUrl, "/openai/responses?api-version="+info.ApiVersion, info.ChannelType), nil
+		}
 		task := strings.TrimPrefix(requestURL, "/v1/")
 		model_ := info.UpstreamModelName
 		model_ = strings.Replace(model_, ".", "", -1)
@@ -56,6 +65,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
 	channel.SetupApiRequestHeader(info, c, req)
+	if info.RelayMode == constant.RelayModeRealtime && info.ChannelType != common.ChannelTypeAzure {
+		req.Header.Set("OpenAI-Beta", "realtime=v1")
+	}
 	if info.ChannelType == common.ChannelTypeAzure {
 		req.Header.Set("api-key", info.ApiKey)
 		return nil
@@ -87,6 +99,14 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 	return request, nil
 }
 
+func (a *Adaptor) ConvertResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	request["model"] = info.UpstreamModelName
+	return request, nil
+}
+
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
 	return nil, errors.New("not implemented")
 }
@@ -128,13 +148,86 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
-	return request, nil
+	switch info.RelayMode {
+	case constant.RelayModeImagesEdits, constant.RelayModeImagesVariations:
+		return imageRequest2Form(c, request)
+	default:
+		return request, nil
+	}
+}
+
+// imageRequest2Form rebuilds the multipart body of an image edit or variation, the uploads are
+// read again for every attempt so that retries send the complete files
+func imageRequest2Form(c *gin.Context, request dto.ImageRequest) (io.Reader, error) {
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	fields := map[string]string{
+		"model":           request.Model,
+		"prompt":          request.Prompt,
+		"size":            request.Size,
+		"quality":         request.Quality,
+		"response_format": request.ResponseFormat,
+		"user":            request.User,
+	}
+	if request.N != 0 {
+		fields["n"] = strconv.Itoa(request.N)
+	}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	files := map[string]*multipart.FileHeader{
+		"image": request.Image,
+		"mask":  request.Mask,
+	}
+	for key, header := range files {
+		if header == nil {
+			continue
+		}
+		if err := copyFormFile(writer, key, header); err != nil {
+			return nil, err
+		}
+	}
+	// 关闭 multipart 编写器以设置分界线
+	writer.Close()
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return &requestBody, nil
+}
+
+func copyFormFile(writer *multipart.Writer, key string, header *multipart.FileHeader) error {
+	file, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("open %s failed: %w", key, err)
+	}
+	defer file.Close()
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// keep the content type of the upload, the image type is checked upstream
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="%s"; filename="%s"`, key, strings.ReplaceAll(header.Filename, `"`, "'"))},
+		"Content-Type":        {contentType},
+	})
+	if err != nil {
+		return errors.New("create form file failed")
+	}
+	if _, err = io.Copy(part, file); err != nil {
+		return errors.New("copy file failed")
+	}
+	return nil
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
-	if info.RelayMode == constant.RelayModeAudioTranscription || info.RelayMode == constant.RelayModeAudioTranslation {
+	switch info.RelayMode {
+	case constant.RelayModeAudioTranscription, constant.RelayModeAudioTranslation,
+		constant.RelayModeImagesEdits, constant.RelayModeImagesVariations:
 		return channel.DoFormRequest(a, c, info, requestBody)
-	} else {
+	default:
 		return channel.DoApiRequest(a, c, info, requestBody)
 	}
 }
@@ -147,8 +240,14 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		fallthrough
 	case constant.RelayModeAudioTranscription:
 		err, usage = OpenaiSTTHandler(c, resp, info, a.ResponseFormat)
-	case constant.RelayModeImagesGenerations:
+	case constant.RelayModeImagesGenerations, constant.RelayModeImagesEdits, constant.RelayModeImagesVariations:
 		err, usage = OpenaiTTSHandler(c, resp, info)
+	case constant.RelayModeResponses:
+		if info.IsStream {
+			err, usage = OpenaiResponsesStreamHandler(c, resp, info)
+		} else {
+			err, usage = OpenaiResponsesHandler(c, resp, info)
+		}
 	default:
 		if info.IsStream {
 			err, usage = OaiStreamHandler(c, resp, info)
@@ -28,6 +28,7 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 	model := info.UpstreamModelName
 
 	var responseTextBuilder strings.Builder
+	var reasoningTextBuilder strings.Builder
 	var usage = &dto.Usage{}
 	var streamItems []string // store stream items
 
@@ -115,11 +116,15 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 				var streamResponse dto.ChatCompletionsStreamResponse
 				err := json.Unmarshal(common.StringToByteSlice(item), &streamResponse)
 				if err == nil {
-					//if service.ValidUsage(streamResponse.Usage) {
-					//	usage = streamResponse.Usage
-					//}
+					if !containStreamUsage && service.ValidUsage(streamResponse.Usage) {
+						// some upstreams send the usage before the last chunk
+						usage = streamResponse.Usage
+					}
 					for _, choice := range streamResponse.Choices {
 						responseTextBuilder.WriteString(choice.Delta.GetContentString())
+						if choice.Delta.ReasoningContent != nil {
+							reasoningTextBuilder.WriteString(*choice.Delta.ReasoningContent)
+						}
 						if choice.Delta.ToolCalls != nil {
 							if len(choice.Delta.ToolCalls) > toolCount {
 								toolCount = len(choice.Delta.ToolCalls)
@@ -134,12 +139,15 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 			}
 		} else {
 			for _, streamResponse := range streamResponses {
-				//if service.ValidUsage(streamResponse.Usage) {
-				//	usage = streamResponse.Usage
-				//	containStreamUsage = true
-				//}
+				if !containStreamUsage && service.ValidUsage(streamResponse.Usage) {
+					// some upstreams send the usage before the last chunk
+					usage = streamResponse.Usage
+				}
 				for _, choice := range streamResponse.Choices {
 					responseTextBuilder.WriteString(choice.Delta.GetContentString())
+					if choice.Delta.ReasoningContent != nil {
+						reasoningTextBuilder.WriteString(*choice.Delta.ReasoningContent)
+					}
 					if choice.Delta.ToolCalls != nil {
 						if len(choice.Delta.ToolCalls) > toolCount {
 							toolCount = len(choice.Delta.ToolCalls)
@@ -176,9 +184,18 @@ func OaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.Rel
 		}
 	}
 
+	if !containStreamUsage && service.ValidUsage(usage) {
+		// the usage chunk was already forwarded, it must not be repeated below
+		containStreamUsage = true
+	}
 	if !containStreamUsage {
 		usage, _ = service.ResponseText2Usage(responseTextBuilder.String(), info.UpstreamModelName, info.PromptTokens)
 		usage.CompletionTokens += toolCount * 7
+		if reasoningTextBuilder.Len() > 0 {
+			usage.CompletionTokensDetails.ReasoningTokens, _ = service.CountTokenText(reasoningTextBuilder.String(), info.UpstreamModelName)
+			usage.CompletionTokens += usage.CompletionTokensDetails.ReasoningTokens
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
 	}
 
 	if info.ShouldIncludeUsage && !containStreamUsage {
@@ -230,15 +247,22 @@ func OpenaiHandler(c *gin.Context, resp *http.Response, promptTokens int, model
 	resp.Body.Close()
 	if simpleResponse.Usage.TotalTokens == 0 || (simpleResponse.Usage.PromptTokens == 0 && simpleResponse.Usage.CompletionTokens == 0) {
 		completionTokens := 0
+		reasoningTokens := 0
 		for _, choice := range simpleResponse.Choices {
 			ctkm, _ := service.CountTokenText(string(choice.Message.Content), model)
 			completionTokens += ctkm
+			if choice.Message.ReasoningContent != nil {
+				rtkm, _ := service.CountTokenText(*choice.Message.ReasoningContent, model)
+				reasoningTokens += rtkm
+			}
 		}
+		completionTokens += reasoningTokens
 		simpleResponse.Usage = dto.Usage{
 			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
 			TotalTokens:      promptTokens + completionTokens,
 		}
+		simpleResponse.Usage.CompletionTokensDetails.ReasoningTokens = reasoningTokens
 	}
 	return nil, &simpleResponse.Usage
 }
@@ -0,0 +1,26 @@
+package openai
+
+import (
+	"fmt"
+	"net/url"
+	"one-api/common"
+	relaycommon "one-api/relay/common"
+	"strings"
+)
+
+// getRealtimeURL builds the upstream websocket url of a realtime session
+func getRealtimeURL(info *relaycommon.RelayInfo) string {
+	requestURL := "/v1/realtime?model=" + url.QueryEscape(info.UpstreamModelName)
+	if info.ChannelType == common.ChannelTypeAzure {
+		// azure addresses the deployment with a query parameter instead of a path segment
+		deployment := strings.Replace(info.UpstreamModelName, ".", "", -1)
+		requestURL = fmt.Sprintf("/openai/realtime?api-version=%s&deployment=%s", info.ApiVersion, url.QueryEscape(deployment))
+	}
+	fullRequestURL := relaycommon.GetFullRequestURL(info.BaseUrl, requestURL, info.ChannelType)
+	if strings.HasPrefix(fullRequestURL, "https://") {
+		fullRequestURL = "wss://" + strings.TrimPrefix(fullRequestURL, "https://")
+	} else if strings.HasPrefix(fullRequestURL, "http://") {
+		fullRequestURL = "ws://" + strings.TrimPrefix(fullRequestURL, "http://")
+	}
+	return fullRequestURL
+}
@@ -0,0 +1,647 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponsesOutputKey is the context key the responses handlers leave the final response object under,
+// the relay helper picks it up to store the response locally
+const ResponsesOutputKey = "responses_output"
+
+func intPointer(i int) *int {
+	return &i
+}
+
+func responsesItemText(content any) string {
+	if text, ok := content.(string); ok {
+		return text
+	}
+	parts, _ := content.([]any)
+	var text string
+	for _, part := range parts {
+		partMap, _ := part.(map[string]any)
+		if partText, ok := partMap["text"].(string); ok {
+			text += partText
+		}
+	}
+	return text
+}
+
+func responsesItemContent(content any) json.RawMessage {
+	if text, ok := content.(string); ok {
+		jsonContent, _ := json.Marshal(text)
+		return jsonContent
+	}
+	parts, _ := content.([]any)
+	mediaContents := make([]map[string]any, 0, len(parts))
+	for _, part := range parts {
+		partMap, _ := part.(map[string]any)
+		switch partMap["type"] {
+		case "input_text", "output_text":
+			mediaContents = append(mediaContents, map[string]any{
+				"type": dto.ContentTypeText,
+				"text": partMap["text"],
+			})
+		case "input_image":
+			url, _ := partMap["image_url"].(string)
+			if url == "" {
+				// file_id references an openai hosted file, which other channels cannot read
+				continue
+			}
+			imageUrl := map[string]any{
+				"url": url,
+			}
+			if detail, ok := partMap["detail"].(string); ok {
+				imageUrl["detail"] = detail
+			}
+			mediaContents = append(mediaContents, map[string]any{
+				"type":      dto.ContentTypeImageURL,
+				"image_url": imageUrl,
+			})
+		}
+	}
+	if len(mediaContents) == 1 && mediaContents[0]["type"] == dto.ContentTypeText {
+		jsonContent, _ := json.Marshal(mediaContents[0]["text"])
+		return jsonContent
+	}
+	jsonContent, _ := json.Marshal(mediaContents)
+	return jsonContent
+}
+
+// RequestResponses2OpenAI converts a responses request, whose conversation has already been
+// resolved into items, into a chat completions request
+func RequestResponses2OpenAI(request *dto.OpenAIResponsesRequest, items []map[string]any) (*dto.GeneralOpenAIRequest, error) {
+	openAIRequest := dto.GeneralOpenAIRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxOutputTokens,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		Stream:      request.Stream,
+		User:        request.User,
+	}
+	if request.ParallelToolCalls != nil {
+		openAIRequest.ParallelToolCalls = *request.ParallelToolCalls
+	}
+	if request.Reasoning != nil {
+		openAIRequest.ReasoningEffort = request.Reasoning.Effort
+	}
+	if request.Text != nil && request.Text.Format != nil {
+		switch request.Text.Format.Type {
+		case "json_object":
+			openAIRequest.ResponseFormat = map[string]any{"type": "json_object"}
+		case "json_schema":
+			jsonSchema := map[string]any{
+				"name":   request.Text.Format.Name,
+				"schema": request.Text.Format.Schema,
+			}
+			if request.Text.Format.Strict != nil {
+				jsonSchema["strict"] = *request.Text.Format.Strict
+			}
+			openAIRequest.ResponseFormat = map[string]any{
+				"type":        "json_schema",
+				"json_schema": jsonSchema,
+			}
+		}
+	}
+
+	for _, tool := range request.Tools {
+		// built-in tools (web search, file search, ...) only exist on openai
+		if tool.Type != "function" {
+			continue
+		}
+		openAIRequest.Tools = append(openAIRequest.Tools, dto.ToolCall{
+			Type: "function",
+			Function: dto.FunctionCall{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	switch toolChoice := request.ToolChoice.(type) {
+	case string:
+		openAIRequest.ToolChoice = toolChoice
+	case map[string]any:
+		if toolChoice["type"] == "function" {
+			openAIRequest.ToolChoice = map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": toolChoice["name"],
+				},
+			}
+		}
+	}
+
+	messages := make([]dto.Message, 0, len(items)+1)
+	if request.Instructions != "" {
+		systemMessage := dto.Message{Role: "system"}
+		systemMessage.SetStringContent(request.Instructions)
+		messages = append(messages, systemMessage)
+	}
+	// consecutive function calls belong to a single assistant message
+	var toolCalls []dto.ToolCall
+	flushToolCalls := func() {
+		if len(toolCalls) == 0 {
+			return
+		}
+		messages = append(messages, dto.Message{
+			Role:      "assistant",
+			Content:   json.RawMessage("null"),
+			ToolCalls: toolCalls,
+		})
+		toolCalls = nil
+	}
+	for _, item := range items {
+		itemType, _ := item["type"].(string)
+		if itemType == "" {
+			itemType = "message"
+		}
+		switch itemType {
+		case "message":
+			flushToolCalls()
+			role, _ := item["role"].(string)
+			if role == "developer" {
+				role = "system"
+			}
+			messages = append(messages, dto.Message{
+				Role:    role,
+				Content: responsesItemContent(item["content"]),
+			})
+		case "function_call":
+			name, _ := item["name"].(string)
+			callId, _ := item["call_id"].(string)
+			arguments, _ := item["arguments"].(string)
+			toolCalls = append(toolCalls, dto.ToolCall{
+				ID:   callId,
+				Type: "function",
+				Function: dto.FunctionCall{
+					Name:      name,
+					Arguments: arguments,
+				},
+			})
+		case "function_call_output":
+			flushToolCalls()
+			callId, _ := item["call_id"].(string)
+			toolMessage := dto.Message{
+				Role:       "tool",
+				ToolCallId: callId,
+			}
+			toolMessage.SetStringContent(responsesItemText(item["output"]))
+			messages = append(messages, toolMessage)
+		}
+	}
+	flushToolCalls()
+	if len(messages) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	openAIRequest.Messages = messages
+	return &openAIRequest, nil
+}
+
+func usage2ResponsesUsage(usage dto.Usage) *dto.ResponsesUsage {
+	responsesUsage := &dto.ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+	}
+	if usage.PromptTokensDetails.CachedTokens != 0 {
+		details := usage.PromptTokensDetails
+		responsesUsage.InputTokensDetails = &details
+	}
+	if usage.CompletionTokensDetails.ReasoningTokens != 0 {
+		details := usage.CompletionTokensDetails
+		responsesUsage.OutputTokensDetails = &details
+	}
+	return responsesUsage
+}
+
+func NewResponsesResponse(model string) *dto.OpenAIResponsesResponse {
+	return &dto.OpenAIResponsesResponse{
+		Id:        fmt.Sprintf("resp_%s", common.GetUUID()),
+		Object:    "response",
+		CreatedAt: common.GetTimestamp(),
+		Status:    "in_progress",
+		Model:     model,
+		Output:    make([]dto.ResponsesOutput, 0),
+	}
+}
+
+func setResponsesStatus(response *dto.OpenAIResponsesResponse, finishReason string) {
+	response.Status = "completed"
+	if finishReason == "length" {
+		response.Status = "incomplete"
+		response.IncompleteDetails = &struct {
+			Reason string `json:"reason"`
+		}{Reason: "max_output_tokens"}
+	}
+}
+
+func ResponseOpenAI2Responses(openAIResponse *dto.OpenAITextResponse) *dto.OpenAIResponsesResponse {
+	response := NewResponsesResponse(openAIResponse.Model)
+	response.Usage = usage2ResponsesUsage(openAIResponse.Usage)
+	finishReason := ""
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
+		finishReason = choice.FinishReason
+		if choice.Message.ReasoningContent != nil && *choice.Message.ReasoningContent != "" {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type: "reasoning",
+				Id:   fmt.Sprintf("rs_%s", common.GetUUID()),
+				Summary: []dto.ResponsesOutputContent{
+					{Type: "summary_text", Text: *choice.Message.ReasoningContent},
+				},
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" && text != "null" {
+			response.Output = append(response.Output, dto.ResponsesOutput{
+				Type:   "message",
+				Id:     fmt.Sprintf("msg_%s", common.GetUUID()),
+				Status: "completed",
+				Role:   "assistant",
+				Content: []dto.ResponsesOutputContent{
+					{Type: "output_text", Text: text, Annotations: []any{}},
+				},
+			})
+		}
+		if choice.Message.ToolCalls != nil {
+			toolCallsBytes, _ := json.Marshal(choice.Message.ToolCalls)
+			var toolCalls []dto.ToolCall
+			_ = json.Unmarshal(toolCallsBytes, &toolCalls)
+			for _, toolCall := range toolCalls {
+				response.Output = append(response.Output, dto.ResponsesOutput{
+					Type:      "function_call",
+					Id:        fmt.Sprintf("fc_%s", common.GetUUID()),
+					Status:    "completed",
+					CallId:    toolCall.ID,
+					Name:      toolCall.Function.Name,
+					Arguments: toolCall.Function.Arguments,
+				})
+			}
+		}
+	}
+	setResponsesStatus(response, finishReason)
+	return response
+}
+
+// OpenAI2ResponsesStreamState turns chat completion chunks into typed responses stream events.
+// Every output item (reasoning, message, function call) is opened when its first delta arrives
+// and closed when a different kind of output starts or the stream ends.
+type OpenAI2ResponsesStreamState struct {
+	response       *dto.OpenAIResponsesResponse
+	sequenceNumber int
+	started        bool
+	current        int // index of the open reasoning or message item, -1 if none
+	toolItems      map[int]int
+	finishReason   string
+}
+
+func NewOpenAI2ResponsesStreamState(response *dto.OpenAIResponsesResponse) *OpenAI2ResponsesStreamState {
+	return &OpenAI2ResponsesStreamState{
+		response:  response,
+		current:   -1,
+		toolItems: make(map[int]int),
+	}
+}
+
+func (s *OpenAI2ResponsesStreamState) Response() *dto.OpenAIResponsesResponse {
+	return s.response
+}
+
+func (s *OpenAI2ResponsesStreamState) event(eventType string) *dto.ResponsesStreamResponse {
+	event := &dto.ResponsesStreamResponse{
+		Type:           eventType,
+		SequenceNumber: s.sequenceNumber,
+	}
+	s.sequenceNumber++
+	return event
+}
+
+func (s *OpenAI2ResponsesStreamState) snapshot() *dto.OpenAIResponsesResponse {
+	response := *s.response
+	response.Output = append(make([]dto.ResponsesOutput, 0, len(s.response.Output)), s.response.Output...)
+	return &response
+}
+
+func (s *OpenAI2ResponsesStreamState) itemEvent(eventType string, index int) *dto.ResponsesStreamResponse {
+	event := s.event(eventType)
+	item := s.response.Output[index]
+	// the item keeps changing after the event is built, copy its parts
+	item.Content = append([]dto.ResponsesOutputContent(nil), item.Content...)
+	item.Summary = append([]dto.ResponsesOutputContent(nil), item.Summary...)
+	event.OutputIndex = intPointer(index)
+	event.Item = &item
+	return event
+}
+
+func (s *OpenAI2ResponsesStreamState) openItem(item dto.ResponsesOutput) []*dto.ResponsesStreamResponse {
+	s.response.Output = append(s.response.Output, item)
+	index := len(s.response.Output) - 1
+	events := []*dto.ResponsesStreamResponse{s.itemEvent("response.output_item.added", index)}
+	switch item.Type {
+	case "message":
+		event := s.event("response.content_part.added")
+		event.ItemId = item.Id
+		event.OutputIndex = intPointer(index)
+		event.ContentIndex = intPointer(0)
+		event.Part = &dto.ResponsesOutputContent{Type: "output_text", Annotations: []any{}}
+		events = append(events, event)
+	case "reasoning":
+		event := s.event("response.reasoning_summary_part.added")
+		event.ItemId = item.Id
+		event.OutputIndex = intPointer(index)
+		event.SummaryIndex = intPointer(0)
+		event.Part = &dto.ResponsesOutputContent{Type: "summary_text"}
+		events = append(events, event)
+	}
+	return events
+}
+
+func (s *OpenAI2ResponsesStreamState) closeItem(index int) []*dto.ResponsesStreamResponse {
+	item := &s.response.Output[index]
+	item.Status = "completed"
+	var events []*dto.ResponsesStreamResponse
+	switch item.Type {
+	case "message":
+		part := item.Content[0]
+		event := s.event("response.output_text.done")
+		event.ItemId = item.Id
+		event.OutputIndex = intPointer(index)
+		event.ContentIndex = intPointer(0)
+		event.Text = part.Text
+		events = append(events, event)
+		event = s.event("response.content_part.done")
+		event.ItemId = item.Id
+		event.OutputIndex = intPointer(index)
+		event.ContentIndex = intPointer(0)
+		event.Part = &part
+		events = append(events, event)
+	case "reasoning":
+		item.Status = ""
+		part := item.Summary[0]
+		event := s.event("response.reasoning_summary_text.done")
+		event.ItemId = item.Id
+		event.OutputIndex = intPointer(index)
+		event.SummaryIndex = intPointer(0)
+		event.Text = part.Text
+		events = append(events, event)
+		event = s.event("response.reasoning_summary_part.done")
+		event.ItemId = item.Id
+		event.OutputIndex = intPointer(index)
+		event.SummaryIndex = intPointer(0)
+		event.Part = &part
+		events = append(events, event)
+	case "function_call":
+		event := s.event("response.function_call_arguments.done")
+		event.ItemId = item.Id
+		event.OutputIndex = intPointer(index)
+		event.Arguments = item.Arguments
+		events = append(events, event)
+	}
+	return append(events, s.itemEvent("response.output_item.done", index))
+}
+
+func (s *OpenAI2ResponsesStreamState) closeCurrent() []*dto.ResponsesStreamResponse {
+	if s.current < 0 {
+		return nil
+	}
+	events := s.closeItem(s.current)
+	s.current = -1
+	return events
+}
+
+// textDelta appends to the open item of the given type, opening a new one if needed
+func (s *OpenAI2ResponsesStreamState) textDelta(itemType string, delta string) []*dto.ResponsesStreamResponse {
+	var events []*dto.ResponsesStreamResponse
+	if s.current < 0 || s.response.Output[s.current].Type != itemType {
+		events = append(events, s.closeCurrent()...)
+		if itemType == "message" {
+			events = append(events, s.openItem(dto.ResponsesOutput{
+				Type:    "message",
+				Id:      fmt.Sprintf("msg_%s", common.GetUUID()),
+				Status:  "in_progress",
+				Role:    "assistant",
+				Content: []dto.ResponsesOutputContent{{Type: "output_text", Annotations: []any{}}},
+			})...)
+		} else {
+			events = append(events, s.openItem(dto.ResponsesOutput{
+				Type:    "reasoning",
+				Id:      fmt.Sprintf("rs_%s", common.GetUUID()),
+				Summary: []dto.ResponsesOutputContent{{Type: "summary_text"}},
+			})...)
+		}
+		s.current = len(s.response.Output) - 1
+	}
+	item := &s.response.Output[s.current]
+	var event *dto.ResponsesStreamResponse
+	if itemType == "message" {
+		item.Content[0].Text += delta
+		event = s.event("response.output_text.delta")
+		event.ContentIndex = intPointer(0)
+	} else {
+		item.Summary[0].Text += delta
+		event = s.event("response.reasoning_summary_text.delta")
+		event.SummaryIndex = intPointer(0)
+	}
+	event.ItemId = item.Id
+	event.OutputIndex = intPointer(s.current)
+	event.Delta = delta
+	return append(events, event)
+}
+
+func (s *OpenAI2ResponsesStreamState) start() []*dto.ResponsesStreamResponse {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	created := s.event("response.created")
+	created.Response = s.snapshot()
+	inProgress := s.event("response.in_progress")
+	inProgress.Response = s.snapshot()
+	return []*dto.ResponsesStreamResponse{created, inProgress}
+}
+
+func (s *OpenAI2ResponsesStreamState) Convert(chunk *dto.ChatCompletionsStreamResponse) []*dto.ResponsesStreamResponse {
+	events := s.start()
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+		if choice.Delta.ReasoningContent != nil && *choice.Delta.ReasoningContent != "" {
+			events = append(events, s.textDelta("reasoning", *choice.Delta.ReasoningContent)...)
+		}
+		if text := choice.Delta.GetContentString(); text != "" {
+			events = append(events, s.textDelta("message", text)...)
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			toolIndex := 0
+			if toolCall.Index != nil {
+				toolIndex = *toolCall.Index
+			}
+			index, ok := s.toolItems[toolIndex]
+			if !ok {
+				events = append(events, s.closeCurrent()...)
+				events = append(events, s.openItem(dto.ResponsesOutput{
+					Type:   "function_call",
+					Id:     fmt.Sprintf("fc_%s", common.GetUUID()),
+					Status: "in_progress",
+					CallId: toolCall.ID,
+					Name:   toolCall.Function.Name,
+				})...)
+				index = len(s.response.Output) - 1
+				s.toolItems[toolIndex] = index
+			}
+			if toolCall.Function.Arguments == "" {
+				continue
+			}
+			item := &s.response.Output[index]
+			item.Arguments += toolCall.Function.Arguments
+			event := s.event("response.function_call_arguments.delta")
+			event.ItemId = item.Id
+			event.OutputIndex = intPointer(index)
+			event.Delta = toolCall.Function.Arguments
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (s *OpenAI2ResponsesStreamState) Finish(usage *dto.Usage) []*dto.ResponsesStreamResponse {
+	events := s.start()
+	events = append(events, s.closeCurrent()...)
+	for index := range s.response.Output {
+		if s.response.Output[index].Type == "function_call" {
+			events = append(events, s.closeItem(index)...)
+		}
+	}
+	if usage != nil {
+		s.response.Usage = usage2ResponsesUsage(*usage)
+	}
+	setResponsesStatus(s.response, s.finishReason)
+	eventType := "response.completed"
+	if s.response.Status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	event := s.event(eventType)
+	event.Response = s.snapshot()
+	return append(events, event)
+}
+
+func responsesUsage(response *dto.OpenAIResponsesResponse, info *relaycommon.RelayInfo, responseText string) *dto.Usage {
+	usage := &dto.Usage{}
+	if response != nil && response.Usage != nil {
+		usage.PromptTokens = response.Usage.InputTokens
+		usage.CompletionTokens = response.Usage.OutputTokens
+		if response.Usage.InputTokensDetails != nil {
+			usage.PromptTokensDetails = *response.Usage.InputTokensDetails
+		}
+		if response.Usage.OutputTokensDetails != nil {
+			usage.CompletionTokensDetails = *response.Usage.OutputTokensDetails
+		}
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	if usage.CompletionTokens == 0 {
+		usage.CompletionTokens, _ = service.CountTokenText(responseText, info.UpstreamModelName)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+func responsesOutputText(response *dto.OpenAIResponsesResponse) string {
+	var text strings.Builder
+	for _, item := range response.Output {
+		for _, content := range item.Content {
+			text.WriteString(content.Text)
+		}
+		text.WriteString(item.Arguments)
+	}
+	return text.String()
+}
+
+// OpenaiResponsesHandler forwards a non-stream /v1/responses answer unchanged
+func OpenaiResponsesHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var response dto.OpenAIResponsesResponse
+	err = json.Unmarshal(responseBody, &response)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if response.Error != nil && response.Error.Message != "" {
+		return &dto.OpenAIErrorWithStatusCode{
+			Error:      *response.Error,
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	c.Set(ResponsesOutputKey, responseBody)
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(responseBody)
+	if err != nil {
+		common.LogError(c, "write_response_body_failed: "+err.Error())
+	}
+	return nil, responsesUsage(&response, info, responsesOutputText(&response))
+}
+
+// OpenaiResponsesStreamHandler forwards a /v1/responses event stream unchanged, the final
+// response object is taken from the response.completed (or incomplete / failed) event
+func OpenaiResponsesStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var responseText strings.Builder
+	var finalResponse *dto.OpenAIResponsesResponse
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	scanner.Split(bufio.ScanLines)
+	service.SetEventStreamHeaders(c)
+
+	for scanner.Scan() {
+		info.SetFirstResponseTime()
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			var event dto.ResponsesStreamResponse
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				common.SysError("error unmarshalling stream response: " + err.Error())
+			} else {
+				switch event.Type {
+				case "response.output_text.delta", "response.function_call_arguments.delta":
+					responseText.WriteString(event.Delta)
+				case "response.completed", "response.incomplete", "response.failed":
+					finalResponse = event.Response
+					// keep the raw object, it may carry output items this relay does not model
+					var rawEvent struct {
+						Response json.RawMessage `json:"response"`
+					}
+					if err := json.Unmarshal([]byte(data), &rawEvent); err == nil {
+						c.Set(ResponsesOutputKey, []byte(rawEvent.Response))
+					}
+				}
+			}
+		}
+		_, err := c.Writer.WriteString(line + "\n")
+		if err != nil {
+			common.LogError(c, "send_stream_response_failed: "+err.Error())
+		}
+		c.Writer.Flush()
+	}
+	resp.Body.Close()
+	return nil, responsesUsage(finalResponse, info, responseText.String())
+}
@@ -14,6 +14,7 @@ import (
 	"one-api/relay/channel/gemini"
 	"one-api/relay/channel/openai"
 	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
 	"strings"
 )
 
@@ -21,6 +22,8 @@ const (
 	RequestModeClaude = 1
 	RequestModeGemini = 2
 	RequestModeLlama  = 3
+	// RequestModeEmbedding serves /v1/embeddings with the text embedding models
+	RequestModeEmbedding = 4
 )
 
 var claudeModelMap = map[string]string{
@@ -48,7 +51,9 @@ func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
-	if strings.HasPrefix(info.UpstreamModelName, "claude") {
+	if info.RelayMode == relayconstant.RelayModeEmbeddings {
+		a.RequestMode = RequestModeEmbedding
+	} else if strings.HasPrefix(info.UpstreamModelName, "claude") {
 		a.RequestMode = RequestModeClaude
 	} else if strings.HasPrefix(info.UpstreamModelName, "gemini") {
 		a.RequestMode = RequestModeGemini
@@ -103,6 +108,14 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 			adc.ProjectID,
 			region,
 		), nil
+	} else if a.RequestMode == RequestModeEmbedding {
+		return fmt.Sprintf(
+			"https://%s-aiplatform.googleapis.com/v1/projects/%s/locations/%s/publishers/google/models/%s:predict",
+			region,
+			adc.ProjectID,
+			region,
+			info.UpstreamModelName,
+		), nil
 	}
 	return "", errors.New("unsupported request mode")
 }
@@ -140,10 +153,37 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 		return geminiRequest, nil
 	} else if a.RequestMode == RequestModeLlama {
 		return request, nil
+	} else if a.RequestMode == RequestModeEmbedding {
+		return embeddingRequestOpenAI2Vertex(*request)
 	}
 	return nil, errors.New("unsupported request mode")
 }
 
+func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if a.RequestMode != RequestModeClaude {
+		return nil, errors.New("unsupported request mode")
+	}
+	// vertex takes the model from the url and the version from the body
+	delete(request, "model")
+	request["anthropic_version"] = anthropicVersion
+	c.Set("request_model", info.UpstreamModelName)
+	return request, nil
+}
+
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request map[string]any) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if a.RequestMode != RequestModeGemini {
+		return nil, errors.New("unsupported request mode")
+	}
+	c.Set("request_model", info.UpstreamModelName)
+	return request, nil
+}
+
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
 	return nil, nil
 }
@@ -153,6 +193,26 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayFormat == relaycommon.RelayFormatClaude && a.RequestMode == RequestModeClaude {
+		if info.IsStream {
+			err, usage = claude.ClaudeNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = claude.ClaudeNativeHandler(c, resp, info)
+		}
+		return
+	}
+	if info.RelayFormat == relaycommon.RelayFormatGemini && a.RequestMode == RequestModeGemini {
+		if info.IsStream {
+			err, usage = gemini.GeminiNativeStreamHandler(c, resp, info)
+		} else {
+			err, usage = gemini.GeminiNativeHandler(c, resp, info)
+		}
+		return
+	}
+	if a.RequestMode == RequestModeEmbedding {
+		err, usage = vertexEmbeddingHandler(c, resp, info)
+		return
+	}
 	if info.IsStream {
 		switch a.RequestMode {
 		case RequestModeClaude:
@@ -10,6 +10,8 @@ var ModelList = []string{
 	"gemini-1.5-pro-001", "gemini-1.5-flash-001", "gemini-pro", "gemini-pro-vision",
 
 	"meta/llama3-405b-instruct-maas",
+
+	"text-embedding-004", "text-embedding-005", "text-multilingual-embedding-002",
 }
 
 var ChannelName = "vertex-ai"
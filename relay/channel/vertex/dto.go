@@ -5,7 +5,7 @@ import "one-api/relay/channel/claude"
 type VertexAIClaudeRequest struct {
 	AnthropicVersion string                 `json:"anthropic_version"`
 	Messages         []claude.ClaudeMessage `json:"messages"`
-	System           string                 `json:"system,omitempty"`
+	System           any                    `json:"system,omitempty"`
 	MaxTokens        int                    `json:"max_tokens,omitempty"`
 	StopSequences    []string               `json:"stop_sequences,omitempty"`
 	Stream           bool                   `json:"stream,omitempty"`
@@ -15,3 +15,29 @@ type VertexAIClaudeRequest struct {
 	Tools            []claude.Tool          `json:"tools,omitempty"`
 	ToolChoice       any                    `json:"tool_choice,omitempty"`
 }
+
+type VertexEmbeddingRequest struct {
+	Instances  []VertexEmbeddingInstance  `json:"instances"`
+	Parameters *VertexEmbeddingParameters `json:"parameters,omitempty"`
+}
+
+type VertexEmbeddingInstance struct {
+	Content string `json:"content"`
+}
+
+type VertexEmbeddingParameters struct {
+	OutputDimensionality int `json:"outputDimensionality,omitempty"`
+}
+
+type VertexEmbeddingResponse struct {
+	Predictions []VertexEmbeddingPrediction `json:"predictions"`
+}
+
+type VertexEmbeddingPrediction struct {
+	Embeddings struct {
+		Values     []float64 `json:"values"`
+		Statistics struct {
+			TokenCount int `json:"token_count"`
+		} `json:"statistics"`
+	} `json:"embeddings"`
+}
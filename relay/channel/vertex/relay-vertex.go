@@ -1,6 +1,15 @@
 package vertex
 
-import "one-api/common"
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+)
 
 func GetModelRegion(other string, localModelName string) string {
 	// if other is json string
@@ -14,3 +23,69 @@ func GetModelRegion(other string, localModelName string) string {
 	}
 	return other
 }
+
+func embeddingRequestOpenAI2Vertex(request dto.GeneralOpenAIRequest) (*VertexEmbeddingRequest, error) {
+	input, err := request.ParseEmbeddingInput()
+	if err != nil {
+		return nil, err
+	}
+	vertexRequest := &VertexEmbeddingRequest{
+		Instances: make([]VertexEmbeddingInstance, 0, len(input)),
+	}
+	for _, text := range input {
+		vertexRequest.Instances = append(vertexRequest.Instances, VertexEmbeddingInstance{
+			Content: text,
+		})
+	}
+	if request.Dimensions > 0 {
+		vertexRequest.Parameters = &VertexEmbeddingParameters{
+			OutputDimensionality: request.Dimensions,
+		}
+	}
+	return vertexRequest, nil
+}
+
+func vertexEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var vertexResponse VertexEmbeddingResponse
+	err = json.Unmarshal(responseBody, &vertexResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	fullTextResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(vertexResponse.Predictions)),
+		Model:  info.UpstreamModelName,
+	}
+	promptTokens := 0
+	for i, prediction := range vertexResponse.Predictions {
+		promptTokens += prediction.Embeddings.Statistics.TokenCount
+		fullTextResponse.Data = append(fullTextResponse.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: service.EncodeEmbedding(c, prediction.Embeddings.Values),
+		})
+	}
+	if promptTokens == 0 {
+		promptTokens = info.PromptTokens
+	}
+	fullTextResponse.Usage = dto.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &fullTextResponse.Usage
+}
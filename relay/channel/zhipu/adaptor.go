@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"one-api/dto"
 	"one-api/relay/channel"
+	"one-api/relay/channel/zhipu_4v"
 	relaycommon "one-api/relay/common"
+	"one-api/relay/constant"
 )
 
 type Adaptor struct {
@@ -28,6 +30,10 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		// v3 has no batch embeddings, the v4 api accepts the same key
+		return fmt.Sprintf("%s/api/paas/v4/embeddings", info.BaseUrl), nil
+	}
 	method := "invoke"
 	if info.IsStream {
 		method = "sse-invoke"
@@ -46,6 +52,9 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, info *relaycommon.RelayInfo, re
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		return zhipu_4v.RequestOpenAI2ZhipuEmbedding(*request)
+	}
 	if request.TopP >= 1 {
 		request.TopP = 0.99
 	}
@@ -61,6 +70,10 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode) {
+	if info.RelayMode == constant.RelayModeEmbeddings {
+		err, usage = zhipu_4v.ZhipuEmbeddingHandler(c, resp, info)
+		return
+	}
 	if info.IsStream {
 		err, usage = zhipuStreamHandler(c, resp)
 	} else {
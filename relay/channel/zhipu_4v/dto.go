@@ -53,6 +53,21 @@ type ZhipuV4StreamResponse struct {
 	Usage   dto.Usage                                 `json:"usage"`
 }
 
+type ZhipuV4EmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type ZhipuV4EmbeddingResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Usage dto.Usage `json:"usage"`
+}
+
 type tokenData struct {
 	Token      string
 	ExpiryTime time.Time
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
+	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
 	"sync"
@@ -279,3 +280,59 @@ func zhipuHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStat
 
 	return nil, &textResponse.Usage
 }
+
+// RequestOpenAI2ZhipuEmbedding is shared with the v3 channel, the embeddings api only exists in v4
+func RequestOpenAI2ZhipuEmbedding(request dto.GeneralOpenAIRequest) (*ZhipuV4EmbeddingRequest, error) {
+	input, err := request.ParseEmbeddingInput()
+	if err != nil {
+		return nil, err
+	}
+	return &ZhipuV4EmbeddingRequest{
+		Model:      request.Model,
+		Input:      input,
+		Dimensions: request.Dimensions,
+	}, nil
+}
+
+func ZhipuEmbeddingHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var zhipuResponse ZhipuV4EmbeddingResponse
+	err = json.Unmarshal(responseBody, &zhipuResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := zhipuResponse.Usage
+	if usage.TotalTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+		usage.TotalTokens = info.PromptTokens
+	}
+	fullTextResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(zhipuResponse.Data)),
+		Model:  common.GetStringIfEmpty(zhipuResponse.Model, info.UpstreamModelName),
+		Usage:  usage,
+	}
+	for _, item := range zhipuResponse.Data {
+		// zhipu only returns floats, base64 is encoded here
+		fullTextResponse.Data = append(fullTextResponse.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     item.Index,
+			Embedding: service.EncodeEmbedding(c, item.Embedding),
+		})
+	}
+	jsonResponse, err := json.Marshal(fullTextResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	return nil, &usage
+}
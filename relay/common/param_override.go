@@ -0,0 +1,173 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strconv"
+	"strings"
+)
+
+const (
+	ParamOverrideSet    = "set"
+	ParamOverrideDelete = "delete"
+	ParamOverrideClamp  = "clamp"
+)
+
+// ParamOverrideRule changes the request body a channel sends upstream, after it was converted for the channel
+type ParamOverrideRule struct {
+	// Model restricts the rule to a model name or pattern, matched against the requested and the upstream model
+	Model string `json:"model,omitempty"`
+	Op    string `json:"op"`
+	// Path is dot separated, array elements are addressed by index, e.g. "messages.0.content"
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"` // for set
+	Min   *float64    `json:"min,omitempty"`   // for clamp
+	Max   *float64    `json:"max,omitempty"`   // for clamp
+}
+
+func ParseParamOverride(jsonStr string) ([]ParamOverrideRule, error) {
+	var rules []ParamOverrideRule
+	if strings.TrimSpace(jsonStr) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		if rule.Path == "" {
+			return nil, errors.New(fmt.Sprintf("param override rule %d has no path", i+1))
+		}
+		switch rule.Op {
+		case ParamOverrideSet, ParamOverrideDelete:
+		case ParamOverrideClamp:
+			if rule.Min == nil && rule.Max == nil {
+				return nil, errors.New(fmt.Sprintf("param override rule %d clamps without min or max", i+1))
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("param override rule %d has invalid op %s", i+1, rule.Op))
+		}
+	}
+	return rules, nil
+}
+
+// ApplyParamOverride applies the rules of the channel to a JSON request body, bodies that are not JSON objects
+// are returned unchanged
+func ApplyParamOverride(info *RelayInfo, body []byte) ([]byte, error) {
+	rules, err := ParseParamOverride(info.ParamOverride)
+	if err != nil || len(rules) == 0 {
+		return body, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var request map[string]interface{}
+	if err = decoder.Decode(&request); err != nil {
+		return body, nil
+	}
+	for _, rule := range rules {
+		if rule.Model != "" && !common.MatchModelPattern(rule.Model, info.OriginModelName) &&
+			!common.MatchModelPattern(rule.Model, info.UpstreamModelName) {
+			continue
+		}
+		keys := strings.Split(rule.Path, ".")
+		switch rule.Op {
+		case ParamOverrideSet:
+			setJSONPath(request, keys, rule.Value)
+		case ParamOverrideDelete:
+			deleteJSONPath(request, keys)
+		case ParamOverrideClamp:
+			clampJSONPath(request, keys, rule.Min, rule.Max)
+		}
+	}
+	return json.Marshal(request)
+}
+
+// getJSONPath returns the value at the path, objects are created on the way when create is set
+func getJSONPath(node interface{}, keys []string, create bool) (interface{}, bool) {
+	for _, key := range keys {
+		switch value := node.(type) {
+		case map[string]interface{}:
+			child, ok := value[key]
+			if !ok {
+				if !create {
+					return nil, false
+				}
+				child = make(map[string]interface{})
+				value[key] = child
+			}
+			node = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			node = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func setJSONPath(root map[string]interface{}, keys []string, value interface{}) {
+	parent, ok := getJSONPath(root, keys[:len(keys)-1], true)
+	if !ok {
+		return
+	}
+	last := keys[len(keys)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		if index, err := strconv.Atoi(last); err == nil && index >= 0 && index < len(node) {
+			node[index] = value
+		}
+	}
+}
+
+func deleteJSONPath(root map[string]interface{}, keys []string) {
+	parentKeys := keys[:len(keys)-1]
+	parent, ok := getJSONPath(root, parentKeys, false)
+	if !ok {
+		return
+	}
+	last := keys[len(keys)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		delete(node, last)
+	case []interface{}:
+		index, err := strconv.Atoi(last)
+		if err != nil || index < 0 || index >= len(node) {
+			return
+		}
+		// an array element is removed by replacing the array in its parent
+		setJSONPath(root, keys[:len(keys)-1], append(node[:index:index], node[index+1:]...))
+	}
+}
+
+func clampJSONPath(root map[string]interface{}, keys []string, min *float64, max *float64) {
+	value, ok := getJSONPath(root, keys, false)
+	if !ok {
+		return
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return
+	}
+	current, err := number.Float64()
+	if err != nil {
+		return
+	}
+	clamped := current
+	if min != nil && clamped < *min {
+		clamped = *min
+	}
+	if max != nil && clamped > *max {
+		clamped = *max
+	}
+	if clamped != current {
+		setJSONPath(root, keys, clamped)
+	}
+}
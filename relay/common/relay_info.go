@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"one-api/common"
 	"one-api/relay/constant"
@@ -8,6 +9,24 @@ import (
 	"time"
 )
 
+const (
+	RelayFormatOpenAI = "openai"
+	RelayFormatClaude = "claude"
+	RelayFormatGemini = "gemini"
+)
+
+type batchIdContextKey struct{}
+
+// WithBatchId marks the requests made with ctx as lines of a batch job, clients cannot set this themselves
+func WithBatchId(ctx context.Context, batchId string) context.Context {
+	return context.WithValue(ctx, batchIdContextKey{}, batchId)
+}
+
+func BatchIdFromContext(ctx context.Context) string {
+	batchId, _ := ctx.Value(batchIdContextKey{}).(string)
+	return batchId
+}
+
 type RelayInfo struct {
 	ChannelType          int
 	ChannelId            int
@@ -22,6 +41,7 @@ type RelayInfo struct {
 	IsStream             bool
 	IsPlayground         bool
 	RelayMode            int
+	RelayFormat          string // the api format spoken by the downstream client
 	UpstreamModelName    string
 	OriginModelName      string
 	RequestURLPath       string
@@ -32,8 +52,11 @@ type RelayInfo struct {
 	BaseUrl              string
 	SupportStreamOptions bool
 	ShouldIncludeUsage   bool
-	Headers           string
-	Proxy             string
+	BatchId              string // set when the request is run by a /v1/batches job
+	RequestId            string
+	Headers              string
+	Proxy                string
+	ParamOverride        string
 }
 
 func GenRelayInfo(c *gin.Context) *RelayInfo {
@@ -50,16 +73,17 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 	apiType, _ := constant.ChannelType2APIType(channelType)
 
 	info := &RelayInfo{
-		RelayMode:      constant.Path2RelayMode(c.Request.URL.Path),
-		BaseUrl:        c.GetString("base_url"),
-		RequestURLPath: c.Request.URL.String(),
-		ChannelType:    channelType,
-		ChannelId:      channelId,
-		TokenId:        tokenId,
-		UserId:         userId,
-		Group:          group,
-		TokenUnlimited: tokenUnlimited,
-		StartTime:      startTime,
+		RelayMode:         constant.Path2RelayMode(c.Request.URL.Path),
+		RelayFormat:       RelayFormatOpenAI,
+		BaseUrl:           c.GetString("base_url"),
+		RequestURLPath:    c.Request.URL.String(),
+		ChannelType:       channelType,
+		ChannelId:         channelId,
+		TokenId:           tokenId,
+		UserId:            userId,
+		Group:             group,
+		TokenUnlimited:    tokenUnlimited,
+		StartTime:         startTime,
 		FirstResponseTime: startTime.Add(-time.Second),
 		OriginModelName:   c.GetString("original_model"),
 		UpstreamModelName: c.GetString("original_model"),
@@ -67,8 +91,11 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		ApiVersion:        c.GetString("api_version"),
 		ApiKey:            strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
 		Organization:      c.GetString("channel_organization"),
-		Headers:        c.GetString("headers"),
-		Proxy:          c.GetString("proxy"),
+		Headers:           c.GetString("headers"),
+		Proxy:             c.GetString("proxy"),
+		ParamOverride:     c.GetString("param_override"),
+		BatchId:           BatchIdFromContext(c.Request.Context()),
+		RequestId:         c.GetString(common.RequestIdKey),
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/pg") {
 		info.IsPlayground = true
@@ -120,6 +147,7 @@ type TaskRelayInfo struct {
 	RequestURLPath    string
 	ApiKey            string
 	BaseUrl           string
+	RequestId         string
 
 	Action       string
 	OriginTaskID string
@@ -150,6 +178,7 @@ func GenTaskRelayInfo(c *gin.Context) *TaskRelayInfo {
 		StartTime:      startTime,
 		ApiType:        apiType,
 		ApiKey:         strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
+		RequestId:      c.GetString(common.RequestIdKey),
 	}
 	if info.BaseUrl == "" {
 		info.BaseUrl = common.ChannelBaseURLs[channelType]
@@ -171,5 +200,6 @@ func (info *TaskRelayInfo) ToRelayInfo() *RelayInfo {
 		RequestURLPath:    info.RequestURLPath,
 		ApiKey:            info.ApiKey,
 		BaseUrl:           info.BaseUrl,
+		RequestId:         info.RequestId,
 	}
 }
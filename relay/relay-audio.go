@@ -77,6 +77,9 @@ func AudioHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	if userQuota-preConsumedQuota < 0 {
 		return service.OpenAIErrorWrapperLocal(errors.New(fmt.Sprintf("audio pre-consumed quota failed, user quota: %d, need quota: %d", userQuota, preConsumedQuota)), "insufficient_user_quota", http.StatusBadRequest)
 	}
+	if openaiErr := service.CheckSpendWindows(c, preConsumedQuota); openaiErr != nil {
+		return openaiErr
+	}
 	err = model.CacheDecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
 	if err != nil {
 		return service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
@@ -101,8 +104,8 @@ func AudioHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		if err != nil {
 			return service.OpenAIErrorWrapper(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
 		}
-		if modelMap[audioRequest.Model] != "" {
-			audioRequest.Model = modelMap[audioRequest.Model]
+		if mappedModel, ok := common.MapModelName(modelMap, audioRequest.Model); ok {
+			audioRequest.Model = mappedModel
 		}
 	}
 	relayInfo.UpstreamModelName = audioRequest.Model
@@ -0,0 +1,263 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"one-api/relay/channel/claude"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getAndValidateClaudeRequest(c *gin.Context) (*claude.ClaudeRequest, map[string]any, error) {
+	claudeRequest := &claude.ClaudeRequest{}
+	err := common.UnmarshalBodyReusable(c, claudeRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claudeRequest.Model == "" {
+		return nil, nil, errors.New("model is required")
+	}
+	if len(claudeRequest.Messages) == 0 {
+		return nil, nil, errors.New("field messages is required")
+	}
+	// keep the original body so that native channels receive every field verbatim
+	rawRequest := make(map[string]any)
+	err = common.UnmarshalBodyReusable(c, &rawRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claudeRequest, rawRequest, nil
+}
+
+// isClaudeNativeChannel reports whether the selected channel speaks the Anthropic Messages format
+func isClaudeNativeChannel(info *relaycommon.RelayInfo) bool {
+	switch info.ChannelType {
+	case common.ChannelTypeAnthropic, common.ChannelTypeAws:
+		return true
+	case common.ChannelTypeVertexAi:
+		return strings.HasPrefix(info.UpstreamModelName, "claude")
+	}
+	return false
+}
+
+// ClaudeHelper serves the Anthropic Messages api (/v1/messages). Claude channels get the request
+// verbatim, every other channel is reached through the OpenAI chat completions format.
+func ClaudeHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	relayInfo.RelayFormat = relaycommon.RelayFormatClaude
+
+	claudeRequest, rawRequest, err := getAndValidateClaudeRequest(c)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateClaudeRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_claude_request", http.StatusBadRequest)
+	}
+	relayInfo.IsStream = claudeRequest.Stream
+
+	// map model name
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if mappedModel, ok := common.MapModelName(modelMap, claudeRequest.Model); ok {
+			claudeRequest.Model = mappedModel
+		}
+	}
+	relayInfo.UpstreamModelName = claudeRequest.Model
+
+	openAIRequest, err := claude.RequestClaude2OpenAI(*claudeRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "convert_claude_request_failed", http.StatusBadRequest)
+	}
+
+	if constant.ShouldCheckPromptSensitive() {
+		err = service.CheckSensitiveMessages(openAIRequest.Messages)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	promptTokens, err := service.CountTokenChatRequest(*openAIRequest, openAIRequest.Model)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	relayInfo.PromptTokens = promptTokens
+
+	// pre-consume quota 预消耗配额
+	quota, openaiErr := preConsumeRelayQuota(c, relayInfo, claudeRequest.Model, promptTokens, int(claudeRequest.MaxTokens))
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+
+	var requestBody io.Reader
+	nativeAdaptor, isNativeAdaptor := adaptor.(channel.ClaudeNativeAdaptor)
+	if isClaudeNativeChannel(relayInfo) && isNativeAdaptor {
+		adaptor.Init(relayInfo)
+		convertedRequest, err := nativeAdaptor.ConvertClaudeRequest(c, relayInfo, rawRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	} else {
+		// the adaptor only knows the openai format, relay as a chat completion
+		relayInfo.RelayFormat = relaycommon.RelayFormatOpenAI
+		relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+		relayInfo.RequestURLPath = "/v1/chat/completions"
+		relayInfo.ShouldIncludeUsage = true
+		if openAIRequest.Stream && relayInfo.SupportStreamOptions {
+			openAIRequest.StreamOptions = &dto.StreamOptions{
+				IncludeUsage: true,
+			}
+		}
+		adaptor.Init(relayInfo)
+		convertedRequest, err := adaptor.ConvertRequest(c, relayInfo, openAIRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	}
+
+	resp, openaiErr := doRelayRequest(c, adaptor, relayInfo, requestBody, quota)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	var usage *dto.Usage
+	if relayInfo.RelayFormat == relaycommon.RelayFormatClaude {
+		usage, openaiErr = adaptor.DoResponse(c, resp, relayInfo)
+	} else {
+		writer := newClaudeResponseWriter(c, relayInfo)
+		c.Writer = writer
+		usage, openaiErr = adaptor.DoResponse(c, resp, relayInfo)
+		c.Writer = writer.ResponseWriter
+		if openaiErr == nil {
+			writer.finish(usage)
+		}
+	}
+	if openaiErr != nil {
+		return quota.fail(c, relayInfo, openaiErr)
+	}
+	quota.settle(c, relayInfo, usage)
+	return nil
+}
+
+// claudeResponseWriter captures what an openai format handler writes and turns it into
+// Anthropic Messages output, stream chunks are translated as soon as a full line arrives
+type claudeResponseWriter struct {
+	gin.ResponseWriter
+	info   *relaycommon.RelayInfo
+	state  *claude.OpenAI2ClaudeStreamState
+	buffer bytes.Buffer
+}
+
+func newClaudeResponseWriter(c *gin.Context, info *relaycommon.RelayInfo) *claudeResponseWriter {
+	return &claudeResponseWriter{
+		ResponseWriter: c.Writer,
+		info:           info,
+		state:          claude.NewOpenAI2ClaudeStreamState(info.UpstreamModelName, info.PromptTokens),
+	}
+}
+
+func (w *claudeResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.info.IsStream {
+		w.translateStream()
+	}
+	return len(data), nil
+}
+
+func (w *claudeResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *claudeResponseWriter) translateStream() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// incomplete line, wait for the rest of it
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		w.writeEvents(w.state.Convert(&chunk))
+	}
+}
+
+func (w *claudeResponseWriter) writeEvents(events []claude.ClaudeStreamEvent) {
+	for _, event := range events {
+		jsonData, err := json.Marshal(event.Data)
+		if err != nil {
+			common.SysError("error marshalling stream event: " + err.Error())
+			continue
+		}
+		_, _ = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, jsonData))
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *claudeResponseWriter) finish(usage *dto.Usage) {
+	if w.info.IsStream {
+		w.buffer.WriteString("\n")
+		w.translateStream()
+		w.writeEvents(w.state.Finish(usage))
+		return
+	}
+	var openAIResponse dto.OpenAITextResponse
+	if err := json.Unmarshal(w.buffer.Bytes(), &openAIResponse); err != nil {
+		common.SysError("error unmarshalling response: " + err.Error())
+	}
+	if usage != nil {
+		openAIResponse.Usage = *usage
+	}
+	if openAIResponse.Model == "" {
+		openAIResponse.Model = w.info.UpstreamModelName
+	}
+	jsonData, err := json.Marshal(claude.ResponseOpenAI2Claude(&openAIResponse))
+	if err != nil {
+		common.SysError("error marshalling response: " + err.Error())
+		return
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	_, _ = w.ResponseWriter.Write(jsonData)
+}
@@ -0,0 +1,277 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"one-api/relay/channel/gemini"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getAndValidateGeminiRequest(c *gin.Context) (*gemini.GeminiChatRequest, map[string]any, error) {
+	geminiRequest := &gemini.GeminiChatRequest{}
+	err := common.UnmarshalBodyReusable(c, geminiRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(geminiRequest.Contents) == 0 {
+		return nil, nil, errors.New("field contents is required")
+	}
+	// keep the original body so that native channels receive every field verbatim
+	rawRequest := make(map[string]any)
+	err = common.UnmarshalBodyReusable(c, &rawRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return geminiRequest, rawRequest, nil
+}
+
+// isGeminiNativeChannel reports whether the selected channel speaks the Gemini generateContent format
+func isGeminiNativeChannel(info *relaycommon.RelayInfo) bool {
+	switch info.ChannelType {
+	case common.ChannelTypeGemini:
+		return true
+	case common.ChannelTypeVertexAi:
+		return strings.HasPrefix(info.UpstreamModelName, "gemini")
+	}
+	return false
+}
+
+// GeminiHelper serves the Gemini generateContent and streamGenerateContent apis (/v1beta/models/{model}:action).
+// Gemini channels get the request verbatim, every other channel is reached through the OpenAI chat completions format.
+func GeminiHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	relayInfo.RelayFormat = relaycommon.RelayFormatGemini
+	relayInfo.IsStream = strings.HasSuffix(c.Request.URL.Path, ":streamGenerateContent")
+
+	geminiRequest, rawRequest, err := getAndValidateGeminiRequest(c)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateGeminiRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	modelName := relayInfo.OriginModelName
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if mappedModel, ok := common.MapModelName(modelMap, modelName); ok {
+			modelName = mappedModel
+		}
+	}
+	relayInfo.UpstreamModelName = modelName
+
+	openAIRequest, err := gemini.RequestGemini2OpenAI(*geminiRequest, modelName, relayInfo.IsStream)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "convert_gemini_request_failed", http.StatusBadRequest)
+	}
+
+	if constant.ShouldCheckPromptSensitive() {
+		err = service.CheckSensitiveMessages(openAIRequest.Messages)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	promptTokens, err := service.CountTokenChatRequest(*openAIRequest, modelName)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	relayInfo.PromptTokens = promptTokens
+
+	// pre-consume quota 预消耗配额
+	quota, openaiErr := preConsumeRelayQuota(c, relayInfo, modelName, promptTokens, int(openAIRequest.MaxTokens))
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+
+	var requestBody io.Reader
+	nativeAdaptor, isNativeAdaptor := adaptor.(channel.GeminiNativeAdaptor)
+	if isGeminiNativeChannel(relayInfo) && isNativeAdaptor {
+		adaptor.Init(relayInfo)
+		convertedRequest, err := nativeAdaptor.ConvertGeminiRequest(c, relayInfo, rawRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	} else {
+		// the adaptor only knows the openai format, relay as a chat completion
+		relayInfo.RelayFormat = relaycommon.RelayFormatOpenAI
+		relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+		relayInfo.RequestURLPath = "/v1/chat/completions"
+		relayInfo.ShouldIncludeUsage = true
+		if openAIRequest.Stream && relayInfo.SupportStreamOptions {
+			openAIRequest.StreamOptions = &dto.StreamOptions{
+				IncludeUsage: true,
+			}
+		}
+		adaptor.Init(relayInfo)
+		convertedRequest, err := adaptor.ConvertRequest(c, relayInfo, openAIRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	}
+
+	resp, openaiErr := doRelayRequest(c, adaptor, relayInfo, requestBody, quota)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	var usage *dto.Usage
+	if relayInfo.RelayFormat == relaycommon.RelayFormatGemini {
+		usage, openaiErr = adaptor.DoResponse(c, resp, relayInfo)
+	} else {
+		writer := newGeminiResponseWriter(c, relayInfo)
+		c.Writer = writer
+		usage, openaiErr = adaptor.DoResponse(c, resp, relayInfo)
+		c.Writer = writer.ResponseWriter
+		if openaiErr == nil {
+			writer.finish(usage)
+		}
+	}
+	if openaiErr != nil {
+		return quota.fail(c, relayInfo, openaiErr)
+	}
+	quota.settle(c, relayInfo, usage)
+	return nil
+}
+
+// geminiResponseWriter captures what an openai format handler writes and turns it into
+// generateContent output, stream chunks are translated as soon as a full line arrives
+type geminiResponseWriter struct {
+	gin.ResponseWriter
+	sse    bool
+	info   *relaycommon.RelayInfo
+	state  *gemini.OpenAI2GeminiStreamState
+	buffer bytes.Buffer
+	count  int
+}
+
+func newGeminiResponseWriter(c *gin.Context, info *relaycommon.RelayInfo) *geminiResponseWriter {
+	return &geminiResponseWriter{
+		ResponseWriter: c.Writer,
+		sse:            gemini.GeminiStreamSSE(c),
+		info:           info,
+		state:          gemini.NewOpenAI2GeminiStreamState(info.UpstreamModelName),
+	}
+}
+
+func (w *geminiResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.info.IsStream {
+		w.translateStream()
+	}
+	return len(data), nil
+}
+
+func (w *geminiResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush is deferred to writeChunks, the headers may only be sent once the content type is settled
+func (w *geminiResponseWriter) Flush() {
+}
+
+func (w *geminiResponseWriter) translateStream() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// incomplete line, wait for the rest of it
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		w.writeChunks(w.state.Convert(&chunk))
+	}
+}
+
+func (w *geminiResponseWriter) writeChunks(chunks []*gemini.GeminiChatResponse) {
+	if w.count == 0 && !w.sse {
+		w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	}
+	for _, chunk := range chunks {
+		jsonData, err := json.Marshal(chunk)
+		if err != nil {
+			common.SysError("error marshalling stream chunk: " + err.Error())
+			continue
+		}
+		_, err = w.ResponseWriter.WriteString(gemini.GeminiStreamFrame(w.sse, string(jsonData), w.count))
+		if err != nil {
+			common.SysError("error writing stream chunk: " + err.Error())
+		}
+		w.count++
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *geminiResponseWriter) finish(usage *dto.Usage) {
+	if w.info.IsStream {
+		w.buffer.WriteString("\n")
+		w.translateStream()
+		w.writeChunks(w.state.Finish(usage))
+		_, _ = w.ResponseWriter.WriteString(gemini.GeminiStreamEnd(w.sse, w.count))
+		w.ResponseWriter.Flush()
+		return
+	}
+	var openAIResponse dto.OpenAITextResponse
+	if err := json.Unmarshal(w.buffer.Bytes(), &openAIResponse); err != nil {
+		common.SysError("error unmarshalling response: " + err.Error())
+	}
+	if usage != nil {
+		openAIResponse.Usage = *usage
+	}
+	if openAIResponse.Model == "" {
+		openAIResponse.Model = w.info.UpstreamModelName
+	}
+	jsonData, err := json.Marshal(gemini.ResponseOpenAI2Gemini(&openAIResponse))
+	if err != nil {
+		common.SysError("error marshalling response: " + err.Error())
+		return
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	_, _ = w.ResponseWriter.Write(jsonData)
+}
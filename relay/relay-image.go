@@ -13,17 +13,57 @@ import (
 	"one-api/dto"
 	"one-api/model"
 	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
 	"one-api/service"
+	"strconv"
 	"strings"
 )
 
+// getImageFormRequest reads the multipart body of /v1/images/edits and /v1/images/variations
+func getImageFormRequest(c *gin.Context, info *relaycommon.RelayInfo, imageRequest *dto.ImageRequest) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return err
+	}
+	imageRequest.Model = c.PostForm("model")
+	imageRequest.Prompt = c.PostForm("prompt")
+	imageRequest.Size = c.PostForm("size")
+	imageRequest.Quality = c.PostForm("quality")
+	imageRequest.ResponseFormat = c.PostForm("response_format")
+	imageRequest.User = c.PostForm("user")
+	if n := c.PostForm("n"); n != "" {
+		imageRequest.N, err = strconv.Atoi(n)
+		if err != nil {
+			return errors.New("n must be an integer")
+		}
+	}
+	images := form.File["image"]
+	if len(images) == 0 {
+		images = form.File["image[]"]
+	}
+	if len(images) == 0 {
+		return errors.New("image is required")
+	}
+	imageRequest.Image = images[0]
+	if masks := form.File["mask"]; len(masks) > 0 && info.RelayMode == relayconstant.RelayModeImagesEdits {
+		imageRequest.Mask = masks[0]
+	}
+	return nil
+}
+
 func getAndValidImageRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.ImageRequest, error) {
 	imageRequest := &dto.ImageRequest{}
-	err := common.UnmarshalBodyReusable(c, imageRequest)
+	var err error
+	if info.RelayMode == relayconstant.RelayModeImagesEdits || info.RelayMode == relayconstant.RelayModeImagesVariations {
+		err = getImageFormRequest(c, info, imageRequest)
+	} else {
+		err = common.UnmarshalBodyReusable(c, imageRequest)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if imageRequest.Prompt == "" {
+	// a variation is made from the image alone
+	if imageRequest.Prompt == "" && info.RelayMode != relayconstant.RelayModeImagesVariations {
 		return nil, errors.New("prompt is required")
 	}
 	if strings.Contains(imageRequest.Size, "×") {
@@ -59,7 +99,7 @@ func getAndValidImageRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.
 	//if imageRequest.N != 0 && (imageRequest.N < 1 || imageRequest.N > 10) {
 	//	return service.OpenAIErrorWrapper(errors.New("n must be between 1 and 10"), "invalid_field_value", http.StatusBadRequest)
 	//}
-	if constant.ShouldCheckPromptSensitive() {
+	if constant.ShouldCheckPromptSensitive() && imageRequest.Prompt != "" {
 		err := service.CheckSensitiveInput(imageRequest.Prompt)
 		if err != nil {
 			return nil, err
@@ -85,8 +125,8 @@ func ImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 		if err != nil {
 			return service.OpenAIErrorWrapper(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
 		}
-		if modelMap[imageRequest.Model] != "" {
-			imageRequest.Model = modelMap[imageRequest.Model]
+		if mappedModel, ok := common.MapModelName(modelMap, imageRequest.Model); ok {
+			imageRequest.Model = mappedModel
 		}
 	}
 	relayInfo.UpstreamModelName = imageRequest.Model
@@ -128,6 +168,9 @@ func ImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	if userQuota-quota < 0 {
 		return service.OpenAIErrorWrapperLocal(errors.New(fmt.Sprintf("image pre-consumed quota failed, user quota: %d, need quota: %d", userQuota, quota)), "insufficient_user_quota", http.StatusBadRequest)
 	}
+	if openaiErr := service.CheckSpendWindows(c, quota); openaiErr != nil {
+		return openaiErr
+	}
 
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
@@ -142,11 +185,16 @@ func ImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
-	jsonData, err := json.Marshal(convertedRequest)
-	if err != nil {
-		return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+	if reader, ok := convertedRequest.(io.Reader); ok {
+		// multipart uploads are sent as they were built by the adaptor
+		requestBody = reader
+	} else {
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
 	}
-	requestBody = bytes.NewBuffer(jsonData)
 
 	statusCodeMappingStr := c.GetString("status_code_mapping")
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
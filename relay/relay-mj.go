@@ -184,6 +184,12 @@ func RelaySwapFace(c *gin.Context) *dto.MidjourneyResponse {
 			Description: "quota_not_enough",
 		}
 	}
+	if openaiErr := service.CheckSpendWindows(c, quota); openaiErr != nil {
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: openaiErr.Error.Message,
+		}
+	}
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	baseURL := c.GetString("base_url")
 	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
@@ -489,6 +495,14 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *dto.MidjourneyRespons
 			Description: "quota_not_enough",
 		}
 	}
+	if consumeQuota {
+		if openaiErr := service.CheckSpendWindows(c, quota); openaiErr != nil {
+			return &dto.MidjourneyResponse{
+				Code:        4,
+				Description: openaiErr.Error.Message,
+			}
+		}
+	}
 
 	midjResponseWithStatus, responseBody, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
 	if err != nil {
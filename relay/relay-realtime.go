@@ -0,0 +1,315 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// realtimeUpgrader accepts sessions from any origin, browser clients authenticate with the
+// openai-insecure-api-key subprotocol instead of cookies
+var realtimeUpgrader = websocket.Upgrader{
+	Subprotocols: []string{"realtime"},
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// isRealtimeChannel reports whether the selected channel serves the realtime websocket api
+func isRealtimeChannel(info *relaycommon.RelayInfo) bool {
+	return info.ChannelType == common.ChannelTypeOpenAI || info.ChannelType == common.ChannelTypeAzure
+}
+
+// RealtimeHelper relays an OpenAI realtime websocket session (/v1/realtime). The upstream socket is opened
+// before the client handshake is answered, so a refused channel can still be retried. Usage is read from
+// every response.done event and billed right away, the session is closed once the quota runs out.
+func RealtimeHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	relayInfo.IsStream = true
+
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return service.OpenAIErrorWrapperLocal(errors.New("the realtime api requires a websocket connection"), "websocket_upgrade_required", http.StatusBadRequest)
+	}
+	if !isRealtimeChannel(relayInfo) {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("channel type %d does not support the realtime api", relayInfo.ChannelType), "realtime_not_supported", http.StatusBadRequest)
+	}
+	modelName := c.Query("model")
+	if modelName == "" {
+		return service.OpenAIErrorWrapperLocal(errors.New("model is required"), "invalid_realtime_request", http.StatusBadRequest)
+	}
+
+	// map model name
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if mappedModel, ok := common.MapModelName(modelMap, modelName); ok {
+			modelName = mappedModel
+		}
+	}
+	relayInfo.UpstreamModelName = modelName
+
+	// nothing is pre-consumed, a session has no upper bound. it must just not start without quota
+	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	if !relayInfo.TokenUnlimited && c.GetInt("token_quota") <= 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("token quota is not enough"), "insufficient_token_quota", http.StatusForbidden)
+	}
+	if openaiErr := service.CheckSpendWindows(c, 0); openaiErr != nil {
+		return openaiErr
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo)
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	upstreamConn, resp, err := channel.DoWssRequest(adaptor, c, relayInfo)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if upstreamConn == nil {
+		openaiErr := service.RelayErrorHandler(resp)
+		// reset status code 重置状态码
+		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
+		return openaiErr
+	}
+
+	clientConn, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already answered the client
+		_ = upstreamConn.Close()
+		common.LogError(c, "upgrade realtime connection failed: "+err.Error())
+		return nil
+	}
+
+	session := &realtimeSession{
+		c:            c,
+		info:         relayInfo,
+		modelName:    modelName,
+		clientConn:   clientConn,
+		upstreamConn: upstreamConn,
+		userQuota:    userQuota,
+		lastConsume:  relayInfo.StartTime,
+	}
+	session.modelPrice, session.usePrice = common.GetModelPrice(modelName, false)
+	session.modelRatio = common.GetModelRatio(modelName)
+	session.groupRatio = common.GetGroupRatio(relayInfo.Group)
+	session.run()
+	return nil
+}
+
+type realtimeSession struct {
+	c            *gin.Context
+	info         *relaycommon.RelayInfo
+	modelName    string
+	clientConn   *websocket.Conn
+	upstreamConn *websocket.Conn
+	closeOnce    sync.Once
+
+	modelRatio float64
+	groupRatio float64
+	modelPrice float64
+	usePrice   bool
+
+	userQuota   int
+	lastConsume time.Time
+	responses   int
+	totalQuota  int
+}
+
+func (s *realtimeSession) run() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.forwardClient()
+	}()
+	s.forwardUpstream()
+	wg.Wait()
+	common.LogInfo(s.c, fmt.Sprintf("realtime session closed after %d responses, total quota %d", s.responses, s.totalQuota))
+}
+
+// forwardClient copies client events to the upstream
+func (s *realtimeSession) forwardClient() {
+	defer s.close(websocket.CloseNormalClosure, "")
+	for {
+		messageType, data, err := s.clientConn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err = s.upstreamConn.WriteMessage(messageType, data); err != nil {
+			return
+		}
+	}
+}
+
+// forwardUpstream copies upstream events to the client and bills every finished response
+func (s *realtimeSession) forwardUpstream() {
+	defer s.close(websocket.CloseNormalClosure, "")
+	for {
+		messageType, data, err := s.upstreamConn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if s.responses == 0 {
+			s.info.SetFirstResponseTime()
+		}
+		if err = s.clientConn.WriteMessage(messageType, data); err != nil {
+			return
+		}
+		// audio deltas are large, only decode the events that can carry usage
+		if !bytes.Contains(data, []byte(dto.RealtimeEventTypeResponseDone)) {
+			continue
+		}
+		var event dto.RealtimeEvent
+		if err = json.Unmarshal(data, &event); err != nil {
+			continue
+		}
+		if event.Type != dto.RealtimeEventTypeResponseDone || event.Response == nil || event.Response.Usage == nil {
+			continue
+		}
+		if openaiErr := s.consume(event.Response.Usage); openaiErr != nil {
+			s.sendError(openaiErr)
+			s.close(websocket.ClosePolicyViolation, openaiErr.Error.Message)
+			return
+		}
+	}
+}
+
+// consume bills one response and reports an error once the user or token quota or a spend window is used up
+func (s *realtimeSession) consume(usage *dto.RealtimeUsage) *dto.OpenAIErrorWithStatusCode {
+	s.responses++
+	textInputTokens := usage.InputTokenDetails.TextTokens
+	audioInputTokens := usage.InputTokenDetails.AudioTokens
+	textOutputTokens := usage.OutputTokenDetails.TextTokens
+	audioOutputTokens := usage.OutputTokenDetails.AudioTokens
+	if textInputTokens+audioInputTokens == 0 {
+		textInputTokens = usage.InputTokens
+	}
+	if textOutputTokens+audioOutputTokens == 0 {
+		textOutputTokens = usage.OutputTokens
+	}
+
+	completionRatio := common.GetCompletionRatio(s.modelName)
+	audioRatio := common.GetAudioRatio(s.modelName)
+	audioCompletionRatio := common.GetAudioCompletionRatio(s.modelName)
+	ratio := s.modelRatio * s.groupRatio
+
+	quota := 0
+	var logContent string
+	if !s.usePrice {
+		tokens := float64(textInputTokens) + float64(audioInputTokens)*audioRatio +
+			float64(textOutputTokens)*completionRatio + float64(audioOutputTokens)*audioRatio*audioCompletionRatio
+		quota = int(math.Round(tokens * ratio))
+		if ratio != 0 && quota <= 0 {
+			quota = 1
+		}
+		logContent = fmt.Sprintf("模型倍率 %.2f，补全倍率 %.2f，音频倍率 %.2f，音频补全倍率 %.2f，分组倍率 %.2f",
+			s.modelRatio, completionRatio, audioRatio, audioCompletionRatio, s.groupRatio)
+	} else {
+		quota = int(s.modelPrice * common.QuotaPerUnit * s.groupRatio)
+		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", s.modelPrice, s.groupRatio)
+	}
+	if usage.TotalTokens == 0 {
+		quota = 0
+	}
+
+	if quota != 0 {
+		err := model.PostConsumeTokenQuota(s.info, s.userQuota, quota, 0, true)
+		if err != nil {
+			common.LogError(s.c, "error consuming token remain quota: "+err.Error())
+		}
+		err = model.CacheUpdateUserQuota(s.info.UserId)
+		if err != nil {
+			common.LogError(s.c, "error update user quota cache: "+err.Error())
+		}
+		model.UpdateUserUsedQuotaAndRequestCount(s.info.UserId, quota)
+		model.UpdateChannelUsedQuota(s.info.ChannelId, quota)
+	}
+	s.totalQuota += quota
+	s.c.Set("channel_usage_tokens", s.c.GetInt("channel_usage_tokens")+usage.TotalTokens)
+
+	now := time.Now()
+	useTimeSeconds := int(now.Unix() - s.lastConsume.Unix())
+	s.lastConsume = now
+	other := service.GenerateTextOtherInfo(s.c, s.info, s.modelRatio, s.groupRatio, completionRatio, s.modelPrice)
+	other["realtime"] = true
+	other["audio_ratio"] = audioRatio
+	other["audio_completion_ratio"] = audioCompletionRatio
+	other["input_audio_tokens"] = audioInputTokens
+	other["output_audio_tokens"] = audioOutputTokens
+	model.RecordConsumeLog(s.c, s.info.UserId, s.info.ChannelId, usage.InputTokens, usage.OutputTokens, s.modelName,
+		s.c.GetString("token_name"), quota, logContent, s.info.TokenId, s.userQuota, useTimeSeconds, true, other)
+
+	userQuota, err := model.GetUserQuota(s.info.UserId)
+	if err != nil {
+		common.LogError(s.c, "error get user quota: "+err.Error())
+		return nil
+	}
+	s.userQuota = userQuota
+	if s.userQuota <= 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+	if !s.info.TokenUnlimited {
+		token, err := model.GetTokenById(s.info.TokenId)
+		if err != nil {
+			common.LogError(s.c, "error get token: "+err.Error())
+			return nil
+		}
+		if token.RemainQuota <= 0 {
+			return service.OpenAIErrorWrapperLocal(errors.New("token quota is not enough"), "insufficient_token_quota", http.StatusForbidden)
+		}
+	}
+	// the windows are only checked when the session starts, a long session must not run past them
+	return service.CheckSpendWindows(s.c, 0)
+}
+
+// sendError tells the client why the session ends, in the realtime error event format
+func (s *realtimeSession) sendError(openaiErr *dto.OpenAIErrorWithStatusCode) {
+	event := dto.RealtimeEvent{
+		EventId: "event_" + common.GetUUID(),
+		Type:    dto.RealtimeEventTypeError,
+		Error:   &openaiErr.Error,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_ = s.clientConn.WriteMessage(websocket.TextMessage, data)
+}
+
+// close ends both sides of the session, whichever side stops first
+func (s *realtimeSession) close(code int, text string) {
+	s.closeOnce.Do(func() {
+		deadline := time.Now().Add(time.Second)
+		_ = s.clientConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline)
+		_ = s.upstreamConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+		_ = s.clientConn.Close()
+		_ = s.upstreamConn.Close()
+	})
+}
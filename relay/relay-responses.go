@@ -0,0 +1,327 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel"
+	"one-api/relay/channel/openai"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getAndValidateResponsesRequest(c *gin.Context) (*dto.OpenAIResponsesRequest, map[string]any, error) {
+	responsesRequest := &dto.OpenAIResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, responsesRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if responsesRequest.Model == "" {
+		return nil, nil, fmt.Errorf("model is required")
+	}
+	if len(responsesRequest.Input) == 0 {
+		return nil, nil, fmt.Errorf("field input is required")
+	}
+	// keep the original body so that native channels receive every field verbatim
+	rawRequest := make(map[string]any)
+	err = common.UnmarshalBodyReusable(c, &rawRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return responsesRequest, rawRequest, nil
+}
+
+// isResponsesNativeChannel reports whether the selected channel serves the Responses api itself
+func isResponsesNativeChannel(info *relaycommon.RelayInfo) bool {
+	return info.ChannelType == common.ChannelTypeOpenAI || info.ChannelType == common.ChannelTypeAzure
+}
+
+// ResponsesHelper serves the OpenAI Responses api (/v1/responses). OpenAI and Azure channels get the
+// request verbatim, every other channel is reached through the chat completions format. Conversations
+// are resolved locally, so previous_response_id works regardless of which channel answered before.
+func ResponsesHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+
+	responsesRequest, rawRequest, err := getAndValidateResponsesRequest(c)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateResponsesRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_responses_request", http.StatusBadRequest)
+	}
+	relayInfo.IsStream = responsesRequest.Stream
+
+	// map model name
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping != "" && modelMapping != "{}" {
+		modelMap := make(map[string]string)
+		err := json.Unmarshal([]byte(modelMapping), &modelMap)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+		}
+		if mappedModel, ok := common.MapModelName(modelMap, responsesRequest.Model); ok {
+			responsesRequest.Model = mappedModel
+		}
+	}
+	relayInfo.UpstreamModelName = responsesRequest.Model
+
+	items, err := responsesRequest.ParseInput()
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "invalid_input", http.StatusBadRequest)
+	}
+	isNative := isResponsesNativeChannel(relayInfo)
+	if responsesRequest.PreviousResponseId != "" {
+		previous, err := model.GetStoredResponse(relayInfo.UserId, responsesRequest.PreviousResponseId)
+		if err == nil {
+			history, err := previous.ConversationItems()
+			if err != nil {
+				return service.OpenAIErrorWrapperLocal(err, "read_previous_response_failed", http.StatusInternalServerError)
+			}
+			items = append(history, items...)
+			// the upstream gets the whole conversation, it may never have seen the previous response
+			delete(rawRequest, "previous_response_id")
+			rawRequest["input"] = items
+		} else if !isNative {
+			return service.OpenAIErrorWrapperLocal(fmt.Errorf("previous response with id '%s' not found", responsesRequest.PreviousResponseId), "previous_response_not_found", http.StatusNotFound)
+		}
+	}
+
+	openAIRequest, err := openai.RequestResponses2OpenAI(responsesRequest, items)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "convert_responses_request_failed", http.StatusBadRequest)
+	}
+
+	if constant.ShouldCheckPromptSensitive() {
+		err = service.CheckSensitiveMessages(openAIRequest.Messages)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+	}
+
+	promptTokens, err := service.CountTokenChatRequest(*openAIRequest, openAIRequest.Model)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	relayInfo.PromptTokens = promptTokens
+
+	// pre-consume quota 预消耗配额
+	quota, openaiErr := preConsumeRelayQuota(c, relayInfo, responsesRequest.Model, promptTokens, int(responsesRequest.MaxOutputTokens))
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+
+	var requestBody io.Reader
+	nativeAdaptor, isNativeAdaptor := adaptor.(channel.ResponsesNativeAdaptor)
+	isNative = isNative && isNativeAdaptor
+	if isNative {
+		adaptor.Init(relayInfo)
+		convertedRequest, err := nativeAdaptor.ConvertResponsesRequest(c, relayInfo, rawRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	} else {
+		// the adaptor only knows the chat format, relay as a chat completion
+		relayInfo.RelayMode = relayconstant.RelayModeChatCompletions
+		relayInfo.RequestURLPath = "/v1/chat/completions"
+		relayInfo.ShouldIncludeUsage = true
+		if openAIRequest.Stream && relayInfo.SupportStreamOptions {
+			openAIRequest.StreamOptions = &dto.StreamOptions{
+				IncludeUsage: true,
+			}
+		}
+		adaptor.Init(relayInfo)
+		convertedRequest, err := adaptor.ConvertRequest(c, relayInfo, openAIRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewBuffer(jsonData)
+	}
+
+	resp, openaiErr := doRelayRequest(c, adaptor, relayInfo, requestBody, quota)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	var usage *dto.Usage
+	var responseData []byte
+	if isNative {
+		usage, openaiErr = adaptor.DoResponse(c, resp, relayInfo)
+		if data, ok := c.Get(openai.ResponsesOutputKey); ok {
+			responseData, _ = data.([]byte)
+		}
+	} else {
+		writer := newResponsesResponseWriter(c, relayInfo, responsesRequest)
+		c.Writer = writer
+		usage, openaiErr = adaptor.DoResponse(c, resp, relayInfo)
+		c.Writer = writer.ResponseWriter
+		if openaiErr == nil {
+			responseData = writer.finish(usage)
+		}
+	}
+	if openaiErr != nil {
+		return quota.fail(c, relayInfo, openaiErr)
+	}
+	if responsesRequest.ShouldStore() && len(responseData) > 0 {
+		storeResponse(c, relayInfo, responsesRequest, items, responseData)
+	}
+	quota.settle(c, relayInfo, usage)
+	return nil
+}
+
+func storeResponse(c *gin.Context, relayInfo *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, items []map[string]any, responseData []byte) {
+	var response struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(responseData, &response); err != nil || response.Id == "" {
+		common.LogError(c, "response id not found, response not stored")
+		return
+	}
+	input, err := json.Marshal(items)
+	if err != nil {
+		common.LogError(c, "marshal response input failed: "+err.Error())
+		return
+	}
+	storedResponse := &model.StoredResponse{
+		ResponseId:         response.Id,
+		UserId:             relayInfo.UserId,
+		ChannelId:          relayInfo.ChannelId,
+		Model:              request.Model,
+		PreviousResponseId: request.PreviousResponseId,
+		Input:              input,
+		Data:               responseData,
+		CreatedAt:          common.GetTimestamp(),
+	}
+	if err = storedResponse.Insert(); err != nil {
+		common.LogError(c, "store response failed: "+err.Error())
+	}
+}
+
+// responsesResponseWriter captures what a chat completions handler writes and turns it into
+// Responses api output, stream chunks are translated as soon as a full line arrives
+type responsesResponseWriter struct {
+	gin.ResponseWriter
+	info    *relaycommon.RelayInfo
+	request *dto.OpenAIResponsesRequest
+	state   *openai.OpenAI2ResponsesStreamState
+	buffer  bytes.Buffer
+}
+
+func newResponsesResponseWriter(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) *responsesResponseWriter {
+	response := openai.NewResponsesResponse(info.UpstreamModelName)
+	response.Instructions = request.Instructions
+	response.PreviousResponseId = request.PreviousResponseId
+	return &responsesResponseWriter{
+		ResponseWriter: c.Writer,
+		info:           info,
+		request:        request,
+		state:          openai.NewOpenAI2ResponsesStreamState(response),
+	}
+}
+
+func (w *responsesResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if w.info.IsStream {
+		w.translateStream()
+	}
+	return len(data), nil
+}
+
+func (w *responsesResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responsesResponseWriter) translateStream() {
+	for {
+		line, err := w.buffer.ReadString('\n')
+		if err != nil {
+			// incomplete line, wait for the rest of it
+			w.buffer.Reset()
+			w.buffer.WriteString(line)
+			return
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			common.SysError("error unmarshalling stream response: " + err.Error())
+			continue
+		}
+		w.writeEvents(w.state.Convert(&chunk))
+	}
+}
+
+func (w *responsesResponseWriter) writeEvents(events []*dto.ResponsesStreamResponse) {
+	for _, event := range events {
+		jsonData, err := json.Marshal(event)
+		if err != nil {
+			common.SysError("error marshalling stream event: " + err.Error())
+			continue
+		}
+		_, _ = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, jsonData))
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish writes the remaining output and returns the final response object for storage
+func (w *responsesResponseWriter) finish(usage *dto.Usage) []byte {
+	var response *dto.OpenAIResponsesResponse
+	if w.info.IsStream {
+		w.buffer.WriteString("\n")
+		w.translateStream()
+		w.writeEvents(w.state.Finish(usage))
+		response = w.state.Response()
+	} else {
+		var openAIResponse dto.OpenAITextResponse
+		if err := json.Unmarshal(w.buffer.Bytes(), &openAIResponse); err != nil {
+			common.SysError("error unmarshalling response: " + err.Error())
+		}
+		if usage != nil {
+			openAIResponse.Usage = *usage
+		}
+		if openAIResponse.Model == "" {
+			openAIResponse.Model = w.info.UpstreamModelName
+		}
+		response = openai.ResponseOpenAI2Responses(&openAIResponse)
+		response.Instructions = w.request.Instructions
+		response.PreviousResponseId = w.request.PreviousResponseId
+	}
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling response: " + err.Error())
+		return nil
+	}
+	if !w.info.IsStream {
+		w.ResponseWriter.Header().Del("Content-Length")
+		w.ResponseWriter.Header().Set("Content-Type", "application/json")
+		_, _ = w.ResponseWriter.Write(jsonData)
+	}
+	return jsonData
+}
@@ -13,6 +13,7 @@ import (
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/model"
+	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
@@ -51,6 +52,13 @@ func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo)
 			return nil, errors.New("field messages is required")
 		}
 	case relayconstant.RelayModeEmbeddings:
+		if textRequest.Input == "" || textRequest.Input == nil {
+			return nil, errors.New("field input is required")
+		}
+		// read by the adaptors whose upstream only returns float vectors
+		if encodingFormat, ok := textRequest.EncodingFormat.(string); ok {
+			c.Set("encoding_format", encodingFormat)
+		}
 	case relayconstant.RelayModeModerations:
 		if textRequest.Input == "" || textRequest.Input == nil {
 			return nil, errors.New("field input is required")
@@ -85,20 +93,15 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
 		}
-		if modelMap[textRequest.Model] != "" {
+		if mappedModel, ok := common.MapModelName(modelMap, textRequest.Model); ok {
 			isModelMapped = true
-			textRequest.Model = modelMap[textRequest.Model]
+			textRequest.Model = mappedModel
 			// set upstream model name
 			//isModelMapped = true
 		}
 	}
 	relayInfo.UpstreamModelName = textRequest.Model
-	modelPrice, getModelPriceSuccess := common.GetModelPrice(textRequest.Model, false)
-	groupRatio := common.GetGroupRatio(relayInfo.Group)
 
-	var preConsumedQuota int
-	var ratio float64
-	var modelRatio float64
 	//err := service.SensitiveWordsCheck(textRequest)
 
 	if constant.ShouldCheckPromptSensitive() {
@@ -114,20 +117,8 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
 	}
 
-	if !getModelPriceSuccess {
-		preConsumedTokens := common.PreConsumedQuota
-		if textRequest.MaxTokens != 0 {
-			preConsumedTokens = promptTokens + int(textRequest.MaxTokens)
-		}
-		modelRatio = common.GetModelRatio(textRequest.Model)
-		ratio = modelRatio * groupRatio
-		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
-	} else {
-		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
-	}
-
 	// pre-consume quota 预消耗配额
-	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, preConsumedQuota, relayInfo)
+	quota, openaiErr := preConsumeRelayQuota(c, relayInfo, textRequest.Model, promptTokens, int(textRequest.MaxTokens))
 	if openaiErr != nil {
 		return openaiErr
 	}
@@ -179,32 +170,93 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
-	statusCodeMappingStr := c.GetString("status_code_mapping")
+	resp, openaiErr := doRelayRequest(c, adaptor, relayInfo, requestBody, quota)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	usage, openaiErr := adaptor.DoResponse(c, resp, relayInfo)
+	if openaiErr != nil {
+		return quota.fail(c, relayInfo, openaiErr)
+	}
+	quota.settle(c, relayInfo, usage)
+	return nil
+}
+
+// relayQuota is the price of a request and the quota pre-consumed for it. The helpers of the chat formats share
+// it with TextHelper, so that they price, pre-consume and refund alike.
+type relayQuota struct {
+	modelName        string
+	modelPrice       float64
+	usePrice         bool
+	modelRatio       float64
+	groupRatio       float64
+	ratio            float64
+	preConsumedQuota int
+	userQuota        int
+}
+
+// preConsumeRelayQuota prices the request for the upstream model and pre-consumes its quota, maxTokens is the
+// completion limit of the request, 0 when it has none
+func preConsumeRelayQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string, promptTokens int, maxTokens int) (*relayQuota, *dto.OpenAIErrorWithStatusCode) {
+	quota := &relayQuota{
+		modelName:  modelName,
+		groupRatio: common.GetGroupRatio(relayInfo.Group),
+	}
+	quota.modelPrice, quota.usePrice = common.GetModelPrice(modelName, false)
+	var preConsumedQuota int
+	if !quota.usePrice {
+		preConsumedTokens := common.PreConsumedQuota
+		if maxTokens != 0 {
+			preConsumedTokens = promptTokens + maxTokens
+		}
+		quota.modelRatio = common.GetModelRatioByPromptTokens(modelName, promptTokens)
+		quota.ratio = quota.modelRatio * quota.groupRatio
+		preConsumedQuota = int(float64(preConsumedTokens) * quota.ratio)
+	} else {
+		preConsumedQuota = int(quota.modelPrice * common.QuotaPerUnit * quota.groupRatio)
+	}
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	quota.preConsumedQuota, quota.userQuota, openaiErr = preConsumeQuota(c, preConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return nil, openaiErr
+	}
+	return quota, nil
+}
+
+// doRelayRequest sends the request upstream, the pre-consumed quota is given back when it fails
+func doRelayRequest(c *gin.Context, adaptor channel.Adaptor, relayInfo *relaycommon.RelayInfo, requestBody io.Reader, quota *relayQuota) (*http.Response, *dto.OpenAIErrorWithStatusCode) {
 	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
 	if err != nil {
-		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+		// also the way a cancelled hedge attempt ends, it must not keep what it pre-consumed
+		quota.refund(c, relayInfo)
+		return nil, service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
-
 	if resp != nil {
 		relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
 		if resp.StatusCode != http.StatusOK {
-			returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
-			openaiErr := service.RelayErrorHandler(resp)
-			// reset status code 重置状态码
-			service.ResetStatusCode(openaiErr, statusCodeMappingStr)
-			return openaiErr
+			return nil, quota.fail(c, relayInfo, service.RelayErrorHandler(resp))
 		}
 	}
+	return resp, nil
+}
 
-	usage, openaiErr := adaptor.DoResponse(c, resp, relayInfo)
-	if openaiErr != nil {
-		returnPreConsumedQuota(c, relayInfo, userQuota, preConsumedQuota)
-		// reset status code 重置状态码
-		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
-		return openaiErr
-	}
-	postConsumeQuota(c, relayInfo, textRequest.Model, usage, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice, getModelPriceSuccess, "")
-	return nil
+func (quota *relayQuota) refund(c *gin.Context, relayInfo *relaycommon.RelayInfo) {
+	returnPreConsumedQuota(c, relayInfo, quota.userQuota, quota.preConsumedQuota)
+}
+
+// fail gives the pre-consumed quota back for a failed request and maps the status code of the error
+func (quota *relayQuota) fail(c *gin.Context, relayInfo *relaycommon.RelayInfo, openaiErr *dto.OpenAIErrorWithStatusCode) *dto.OpenAIErrorWithStatusCode {
+	quota.refund(c, relayInfo)
+	// reset status code 重置状态码
+	service.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+	return openaiErr
+}
+
+// settle bills the usage of a served request
+func (quota *relayQuota) settle(c *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) {
+	postConsumeQuota(c, relayInfo, quota.modelName, usage, quota.ratio, quota.preConsumedQuota, quota.userQuota,
+		quota.modelRatio, quota.groupRatio, quota.modelPrice, quota.usePrice, "")
 }
 
 func getPromptTokens(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.RelayInfo) (int, error) {
@@ -263,6 +315,9 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 	if userQuota-preConsumedQuota < 0 {
 		return 0, 0, service.OpenAIErrorWrapperLocal(errors.New(fmt.Sprintf("chat pre-consumed quota failed, user quota: %d, need quota: %d", userQuota, preConsumedQuota)), "insufficient_user_quota", http.StatusBadRequest)
 	}
+	if openaiErr := service.CheckSpendWindows(c, preConsumedQuota); openaiErr != nil {
+		return 0, 0, openaiErr
+	}
 	err = model.CacheDecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
 	if err != nil {
 		return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
@@ -308,6 +363,11 @@ func returnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, us
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string,
 	usage *dto.Usage, ratio float64, preConsumedQuota int, userQuota int, modelRatio float64, groupRatio float64,
 	modelPrice float64, usePrice bool, extraContent string) {
+	if !service.ClaimHedge(ctx) {
+		// another attempt of the hedged request was served, only that one is billed
+		returnPreConsumedQuota(ctx, relayInfo, userQuota, preConsumedQuota)
+		return
+	}
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -316,16 +376,44 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelN
 		}
 		extraContent += "  ，（可能是请求出错）"
 	}
+	// the actual usage replaces the estimate counted against the TPM limit of the channel
+	ctx.Set("channel_usage_tokens", usage.TotalTokens)
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
 
+	cacheTokens := usage.PromptTokensDetails.CachedTokens
+	cacheCreationTokens := usage.PromptTokensDetails.CachedCreationTokens
+	audioInputTokens := usage.PromptTokensDetails.AudioTokens
+	audioOutputTokens := usage.CompletionTokensDetails.AudioTokens
+
 	tokenName := ctx.GetString("token_name")
 	completionRatio := common.GetCompletionRatio(modelName)
+	cacheRatio := common.GetCacheRatio(modelName)
+	cacheCreationRatio := common.GetCreateCacheRatio(modelName)
+	audioRatio := common.GetAudioRatio(modelName)
+	audioCompletionRatio := common.GetAudioCompletionRatio(modelName)
+
+	// the tier is picked by the actual prompt length, the estimate may have picked another one
+	ratioTier, tiered := common.GetModelRatioTier(modelName, promptTokens)
+	if tiered && !usePrice {
+		modelRatio = ratioTier.ModelRatio
+		ratio = modelRatio * groupRatio
+		if ratioTier.CompletionRatio > 0 {
+			completionRatio = ratioTier.CompletionRatio
+		}
+	}
 
 	quota := 0
 	if !usePrice {
-		quota = promptTokens + int(math.Round(float64(completionTokens)*completionRatio))
+		// cached, cache-write and audio tokens are part of the prompt tokens but priced by their own ratios,
+		// reasoning tokens are ordinary completion tokens
+		promptQuota := float64(promptTokens-cacheTokens-cacheCreationTokens-audioInputTokens) +
+			float64(cacheTokens)*cacheRatio + float64(cacheCreationTokens)*cacheCreationRatio +
+			float64(audioInputTokens)*audioRatio
+		completionQuota := float64(completionTokens-audioOutputTokens)*completionRatio +
+			float64(audioOutputTokens)*audioRatio*audioCompletionRatio
+		quota = int(math.Round(promptQuota)) + int(math.Round(completionQuota))
 		quota = int(math.Round(float64(quota) * ratio))
 		if ratio != 0 && quota <= 0 {
 			quota = 1
@@ -337,9 +425,25 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelN
 	var logContent string
 	if !usePrice {
 		logContent = fmt.Sprintf("模型倍率 %.2f，补全倍率 %.2f，分组倍率 %.2f", modelRatio, completionRatio, groupRatio)
+		if tiered {
+			logContent += fmt.Sprintf("，提示超过 %d tokens 的分级价格", ratioTier.Threshold)
+		}
+		if cacheTokens != 0 {
+			logContent += fmt.Sprintf("，缓存读取倍率 %.2f", cacheRatio)
+		}
+		if cacheCreationTokens != 0 {
+			logContent += fmt.Sprintf("，缓存写入倍率 %.2f", cacheCreationRatio)
+		}
+		if audioInputTokens != 0 || audioOutputTokens != 0 {
+			logContent += fmt.Sprintf("，音频倍率 %.2f，音频补全倍率 %.2f", audioRatio, audioCompletionRatio)
+		}
 	} else {
 		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", modelPrice, groupRatio)
 	}
+	if relayInfo.BatchId != "" {
+		quota = int(math.Round(float64(quota) * common.BatchDiscountRatio))
+		logContent += fmt.Sprintf("，批处理折扣 %.2f", common.BatchDiscountRatio)
+	}
 
 	// record all the consume log even if quota is 0
 	if totalTokens == 0 {
@@ -380,6 +484,24 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelN
 		logContent += ", " + extraContent
 	}
 	other := service.GenerateTextOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio, modelPrice)
+	if cacheTokens != 0 || cacheCreationTokens != 0 {
+		other["cache_tokens"] = cacheTokens
+		other["cache_ratio"] = cacheRatio
+		other["cache_creation_tokens"] = cacheCreationTokens
+		other["cache_creation_ratio"] = cacheCreationRatio
+	}
+	if audioInputTokens != 0 || audioOutputTokens != 0 {
+		other["audio_ratio"] = audioRatio
+		other["audio_completion_ratio"] = audioCompletionRatio
+		other["input_audio_tokens"] = audioInputTokens
+		other["output_audio_tokens"] = audioOutputTokens
+	}
+	if tiered && !usePrice {
+		other["ratio_tier"] = ratioTier.Threshold
+	}
+	if usage.CompletionTokensDetails.ReasoningTokens != 0 {
+		other["reasoning_tokens"] = usage.CompletionTokensDetails.ReasoningTokens
+	}
 	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, logModel,
 		tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, other)
 
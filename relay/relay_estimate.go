@@ -0,0 +1,72 @@
+package relay
+
+import (
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel/claude"
+	"one-api/relay/channel/gemini"
+	"one-api/relay/channel/openai"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EstimatePromptTokens counts the prompt tokens of the request the way its helper will, before a channel is
+// chosen, so that the TPM limits of the channels can reserve them. It is 0 when the prompt cannot be counted.
+func EstimatePromptTokens(c *gin.Context, relayMode int) int {
+	var promptTokens int
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions,
+		relayconstant.RelayModeEmbeddings, relayconstant.RelayModeModerations:
+		textRequest := &dto.GeneralOpenAIRequest{}
+		if err := common.UnmarshalBodyReusable(c, textRequest); err != nil {
+			return 0
+		}
+		promptTokens, _ = getPromptTokens(textRequest, &relaycommon.RelayInfo{RelayMode: relayMode})
+	case relayconstant.RelayModeClaudeMessages:
+		claudeRequest, _, err := getAndValidateClaudeRequest(c)
+		if err != nil {
+			return 0
+		}
+		openAIRequest, err := claude.RequestClaude2OpenAI(*claudeRequest)
+		if err != nil {
+			return 0
+		}
+		promptTokens, _ = service.CountTokenChatRequest(*openAIRequest, openAIRequest.Model)
+	case relayconstant.RelayModeGemini:
+		geminiRequest, _, err := getAndValidateGeminiRequest(c)
+		if err != nil {
+			return 0
+		}
+		modelName := c.GetString("original_model")
+		openAIRequest, err := gemini.RequestGemini2OpenAI(*geminiRequest, modelName, false)
+		if err != nil {
+			return 0
+		}
+		promptTokens, _ = service.CountTokenChatRequest(*openAIRequest, modelName)
+	case relayconstant.RelayModeResponses:
+		// the history of previous_response_id is not counted, it is only loaded by the helper
+		responsesRequest, _, err := getAndValidateResponsesRequest(c)
+		if err != nil {
+			return 0
+		}
+		items, err := responsesRequest.ParseInput()
+		if err != nil {
+			return 0
+		}
+		openAIRequest, err := openai.RequestResponses2OpenAI(responsesRequest, items)
+		if err != nil {
+			return 0
+		}
+		promptTokens, _ = service.CountTokenChatRequest(*openAIRequest, openAIRequest.Model)
+	case relayconstant.RelayModeRerank:
+		rerankRequest := dto.RerankRequest{}
+		if err := common.UnmarshalBodyReusable(c, &rerankRequest); err != nil {
+			return 0
+		}
+		promptTokens = getRerankPromptToken(rerankRequest)
+	}
+	return promptTokens
+}
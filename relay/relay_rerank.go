@@ -48,8 +48,8 @@ func RerankHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 		if err != nil {
 			return service.OpenAIErrorWrapperLocal(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
 		}
-		if modelMap[rerankRequest.Model] != "" {
-			rerankRequest.Model = modelMap[rerankRequest.Model]
+		if mappedModel, ok := common.MapModelName(modelMap, rerankRequest.Model); ok {
+			rerankRequest.Model = mappedModel
 			// set upstream model name
 			//isModelMapped = true
 		}
@@ -66,7 +66,7 @@ func RerankHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode
 	promptToken := getRerankPromptToken(*rerankRequest)
 	if !success {
 		preConsumedTokens := promptToken
-		modelRatio = common.GetModelRatio(rerankRequest.Model)
+		modelRatio = common.GetModelRatioByPromptTokens(rerankRequest.Model, promptToken)
 		ratio = modelRatio * groupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
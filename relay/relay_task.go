@@ -60,6 +60,10 @@ func RelayTaskSubmit(c *gin.Context, relayMode int) (taskErr *dto.TaskError) {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
+	if openaiErr := service.CheckSpendWindows(c, quota); openaiErr != nil {
+		taskErr = service.TaskErrorWrapperLocal(errors.New(openaiErr.Error.Message), openaiErr.Error.Code.(string), openaiErr.StatusCode)
+		return
+	}
 
 	if relayInfo.OriginTaskID != "" {
 		originTask, exist, err := model.GetByTaskId(relayInfo.UserId, relayInfo.OriginTaskID)
@@ -48,6 +48,7 @@ func SetApiRouter(router *gin.Engine) {
 			{
 				selfRoute.GET("/self/groups", controller.GetUserGroups)
 				selfRoute.GET("/self", controller.GetSelf)
+				selfRoute.GET("/self/statement", controller.GetSelfStatement)
 				selfRoute.GET("/models", controller.GetUserModels)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
@@ -56,6 +57,10 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/topup", middleware.CriticalRateLimit(), controller.TopUp)
 				selfRoute.POST("/pay", middleware.CriticalRateLimit(), controller.RequestPayLink)
 				selfRoute.POST("/amount", controller.RequestAmount)
+				selfRoute.GET("/plans", controller.GetPlans)
+				selfRoute.GET("/subscription", controller.GetSelfSubscription)
+				selfRoute.POST("/subscribe", middleware.CriticalRateLimit(), controller.Subscribe)
+				selfRoute.POST("/subscription/cancel", controller.CancelSelfSubscription)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 			}
 
@@ -65,6 +70,10 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
+				adminRoute.GET("/:id/ledger", controller.GetUserQuotaLedger)
+				adminRoute.GET("/:id/ledger/check", controller.CheckUserQuotaLedger)
+				adminRoute.GET("/:id/statement", controller.GetUserStatement)
+				adminRoute.GET("/ledger/check", controller.CheckAllQuotaLedgers)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
@@ -84,6 +93,12 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
+			channelRoute.GET("/breaker", controller.GetChannelBreakers)
+			channelRoute.DELETE("/breaker/:id", controller.ResetChannelBreaker)
+			channelRoute.GET("/stats", controller.GetChannelsStats)
+			channelRoute.GET("/:id/health", controller.GetChannelHealth)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.PUT("/:id/keys", controller.UpdateChannelKeyStatus)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
@@ -108,6 +123,15 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
+		planRoute := apiRouter.Group("/plan")
+		planRoute.Use(middleware.AdminAuth())
+		{
+			planRoute.GET("/", controller.GetAllPlans)
+			planRoute.POST("/", controller.AddPlan)
+			planRoute.PUT("/", controller.UpdatePlan)
+			planRoute.DELETE("/:id", controller.DeletePlan)
+			planRoute.GET("/subscriptions", controller.GetAllSubscriptions)
+		}
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
 		{
@@ -127,6 +151,15 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
+		notificationRoute := apiRouter.Group("/notification")
+		notificationRoute.GET("/", middleware.AdminAuth(), controller.GetAllNotifications)
+		notificationRoute.GET("/self", middleware.UserAuth(), controller.GetSelfNotifications)
+		notificationRoute.GET("/subscription", middleware.UserAuth(), controller.GetNotificationSubscriptions)
+		notificationRoute.POST("/subscription", middleware.UserAuth(), controller.AddNotificationSubscription)
+		notificationRoute.PUT("/subscription", middleware.UserAuth(), controller.UpdateNotificationSubscription)
+		notificationRoute.DELETE("/subscription/:id", middleware.UserAuth(), controller.DeleteNotificationSubscription)
+		notificationRoute.POST("/subscription/:id/test", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.TestNotificationSubscription)
+
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
@@ -15,10 +15,40 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelName, channelId)
 	content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelName, channelId, reason)
 	notifyRootUser(subject, content)
+	go model.NotifyAdmins(model.NotificationMessage{
+		Event:    model.NotificationEventChannelDisabled,
+		DedupKey: fmt.Sprintf("channel_disabled:%d", channelId),
+		Title:    subject,
+		Content:  content,
+		Data: map[string]interface{}{
+			"channel_id":   channelId,
+			"channel_name": channelName,
+			"reason":       reason,
+		},
+	})
+}
+
+// DisableChannelKey disables one key of a multi-key channel, the channel itself is disabled with its last key
+func DisableChannelKey(channelId int, channelName string, fingerprint string, reason string) {
+	enabled, err := model.UpdateChannelKeyStatus(channelId, fingerprint, common.ChannelStatusAutoDisabled, reason)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to disable key %s of channel #%d: %s", fingerprint, channelId, err.Error()))
+		return
+	}
+	common.SysLog(fmt.Sprintf("key %s of channel #%d disabled, %d keys left: %s", fingerprint, channelId, enabled, reason))
+	if enabled == 0 {
+		DisableChannel(channelId, channelName, "所有密钥均已被禁用，最后一个原因："+reason)
+	}
 }
 
 func EnableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, common.ChannelStatusEnabled, "")
+	// keys disabled together with the channel come back with it
+	if channel, err := model.GetChannelById(channelId, true); err == nil && channel.IsMultiKey() {
+		if err = model.EnableAutoDisabledChannelKeys(channelId); err != nil {
+			common.SysError(fmt.Sprintf("failed to enable keys of channel #%d: %s", channelId, err.Error()))
+		}
+	}
 	subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 	content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 	notifyRootUser(subject, content)
@@ -85,6 +115,19 @@ func ShouldDisableChannel(channelType int, err *relaymodel.OpenAIErrorWithStatus
 	return false
 }
 
+// IsChannelFailure reports whether an error counts against the channel in its circuit breaker,
+// errors caused by the request itself do not
+func IsChannelFailure(err *relaymodel.OpenAIErrorWithStatusCode) bool {
+	if err == nil || err.LocalError {
+		return false
+	}
+	switch err.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return err.StatusCode >= http.StatusInternalServerError
+}
+
 func ShouldEnableChannel(err error, openaiWithStatusErr *relaymodel.OpenAIErrorWithStatusCode, status int) bool {
 	if !common.AutomaticEnableChannelEnabled {
 		return false
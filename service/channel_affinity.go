@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// affinityPromptMessages is how many leading messages identify a conversation together with its system prompt
+const affinityPromptMessages = 2
+
+type affinityRequest struct {
+	User         string            `json:"user"`
+	System       json.RawMessage   `json:"system"`
+	Instructions json.RawMessage   `json:"instructions"`
+	Messages     []json.RawMessage `json:"messages"`
+}
+
+// GetChannelAffinityKey identifies the conversation of a request for sticky routing, empty when affinity is
+// disabled for the group and model or the request carries nothing to identify it
+func GetChannelAffinityKey(c *gin.Context, group string, modelName string) string {
+	affinity := common.GetChannelAffinity(group, modelName)
+	var value string
+	switch affinity {
+	case common.ChannelAffinityToken:
+		if tokenId := c.GetInt("token_id"); tokenId != 0 {
+			value = fmt.Sprintf("%d", tokenId)
+		}
+	case common.ChannelAffinityHeader:
+		value = c.Request.Header.Get(common.ChannelAffinityHeaderName)
+	case common.ChannelAffinityUser, common.ChannelAffinityPrompt:
+		if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+			return ""
+		}
+		var request affinityRequest
+		if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+			return ""
+		}
+		if affinity == common.ChannelAffinityUser {
+			value = request.User
+			break
+		}
+		// the system prompt and the first messages stay the same for the whole conversation
+		leading := request.Messages
+		if len(leading) > affinityPromptMessages {
+			leading = leading[:affinityPromptMessages]
+		}
+		if len(leading) == 0 && len(request.System) == 0 && len(request.Instructions) == 0 {
+			return ""
+		}
+		data, err := json.Marshal([]interface{}{request.System, request.Instructions, leading})
+		if err != nil {
+			return ""
+		}
+		value = string(data)
+	}
+	if value == "" {
+		return ""
+	}
+	hash := common.Sha256Raw(fmt.Sprintf("%d:%s", c.GetInt("id"), value))
+	return fmt.Sprintf("%s:%s:%s:%s", group, modelName, affinity, hex.EncodeToString(hash[:16]))
+}
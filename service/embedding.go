@@ -0,0 +1,22 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EncodeEmbedding returns an embedding in the encoding_format asked by the client. Providers that only
+// return float vectors are base64 encoded here, as little endian float32 like openai does.
+func EncodeEmbedding(c *gin.Context, embedding []float64) any {
+	if c.GetString("encoding_format") != "base64" {
+		return embedding
+	}
+	buf := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
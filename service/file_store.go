@@ -0,0 +1,69 @@
+package service
+
+import (
+	"io"
+	"one-api/constant"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps the content of uploaded files and batch results, addressed by file id
+type FileStore interface {
+	Save(name string, reader io.Reader) (int64, error)
+	Open(name string) (io.ReadCloser, error)
+	Delete(name string) error
+}
+
+var fileStore FileStore = &LocalFileStore{Dir: constant.FileStorePath}
+
+// SetFileStore replaces the default local disk store
+func SetFileStore(store FileStore) {
+	fileStore = store
+}
+
+func GetFileStore() FileStore {
+	return fileStore
+}
+
+type LocalFileStore struct {
+	Dir string
+}
+
+func (s *LocalFileStore) Save(name string, reader io.Reader) (int64, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return 0, err
+	}
+	// write to a temporary file first so that a failed upload never leaves a partial file behind
+	tmp, err := os.CreateTemp(s.Dir, name+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(name))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+func (s *LocalFileStore) Open(name string) (io.ReadCloser, error) {
+	return os.Open(s.path(name))
+}
+
+func (s *LocalFileStore) Delete(name string) error {
+	err := os.Remove(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalFileStore) path(name string) string {
+	return filepath.Join(s.Dir, filepath.Base(name))
+}
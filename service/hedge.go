@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"one-api/common"
+	"one-api/model"
+	relayconstant "one-api/relay/constant"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HedgeRace is shared by the attempts of a hedged request. Each attempt runs on its own copy of the context, the
+// first one to finish claims the race and is the only one billed and answered to the client.
+type HedgeRace struct {
+	Delay time.Duration
+
+	lock     sync.Mutex
+	channels []int
+	winner   int32
+}
+
+func (race *HedgeRace) AddChannel(channelId int) {
+	race.lock.Lock()
+	defer race.lock.Unlock()
+	race.channels = append(race.channels, channelId)
+}
+
+func (race *HedgeRace) Channels() []int {
+	race.lock.Lock()
+	defer race.lock.Unlock()
+	return append([]int(nil), race.channels...)
+}
+
+// Hedged reports whether a second attempt was sent
+func (race *HedgeRace) Hedged() bool {
+	return len(race.Channels()) > 1
+}
+
+// Winner returns the attempt that claimed the race, 0 while none did
+func (race *HedgeRace) Winner() int {
+	return int(atomic.LoadInt32(&race.winner))
+}
+
+// Claim makes the attempt the winner unless another attempt already is
+func (race *HedgeRace) Claim(attempt int) bool {
+	return atomic.CompareAndSwapInt32(&race.winner, 0, int32(attempt)) || race.Winner() == attempt
+}
+
+func getHedgeRace(c *gin.Context) *HedgeRace {
+	race, ok := c.Get("hedge")
+	if !ok {
+		return nil
+	}
+	return race.(*HedgeRace)
+}
+
+// ClaimHedge is called by an attempt before it is billed, it is false when another attempt was already served
+func ClaimHedge(c *gin.Context) bool {
+	race := getHedgeRace(c)
+	if race == nil {
+		return true
+	}
+	return race.Claim(c.GetInt("hedge_attempt"))
+}
+
+// LostHedge reports whether another attempt of the hedged request was served
+func LostHedge(c *gin.Context) bool {
+	race := getHedgeRace(c)
+	if race == nil {
+		return false
+	}
+	winner := race.Winner()
+	return winner != 0 && winner != c.GetInt("hedge_attempt")
+}
+
+type hedgeRequest struct {
+	Stream              bool `json:"stream"`
+	MaxTokens           int  `json:"max_tokens"`
+	MaxCompletionTokens int  `json:"max_completion_tokens"`
+}
+
+// GetHedgeDelay returns how long to wait for the channel before hedging the request, false when the request
+// is not hedged: hedging must be enabled for the group and only non-stream completions and embeddings are hedged
+func GetHedgeDelay(c *gin.Context, relayMode int, group string, channelId int) (time.Duration, bool) {
+	hedge, ok := common.GetChannelHedge(group)
+	if !ok {
+		return 0, false
+	}
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeEmbeddings:
+	default:
+		return 0, false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return 0, false
+	}
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return 0, false
+	}
+	var request hedgeRequest
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil || request.Stream {
+		return 0, false
+	}
+	if hedge.MaxTokens > 0 && relayMode != relayconstant.RelayModeEmbeddings {
+		maxTokens := request.MaxTokens
+		if request.MaxCompletionTokens > maxTokens {
+			maxTokens = request.MaxCompletionTokens
+		}
+		if maxTokens == 0 || maxTokens > hedge.MaxTokens {
+			return 0, false
+		}
+	}
+	delay := time.Duration(hedge.Delay) * time.Millisecond
+	if hedge.Percentile > 0 {
+		if percentile := model.ChannelLatencyPercentile(channelId, hedge.Percentile); percentile > 0 {
+			delay = percentile
+		}
+	}
+	return delay, delay > 0
+}
+
+var (
+	hedgeBudgets     = make(map[string]int)
+	hedgeBudgetsLock sync.Mutex
+	hedgeBudgetsAt   int64
+)
+
+// AcquireHedgeBudget counts a hedge against the per minute cap of the group, false when the cap is reached
+func AcquireHedgeBudget(group string) bool {
+	hedge, _ := common.GetChannelHedge(group)
+	if hedge.MaxPerMinute <= 0 {
+		return true
+	}
+	minute := time.Now().Unix() / 60
+	if common.RedisEnabled {
+		key := fmt.Sprintf("hedge_budget:%s:%d", group, minute)
+		count, err := common.RDB.Incr(context.Background(), key).Result()
+		if err != nil {
+			common.SysError("failed to count hedge budget: " + err.Error())
+			return false
+		}
+		if count == 1 {
+			common.RDB.Expire(context.Background(), key, 2*time.Minute)
+		}
+		return count <= int64(hedge.MaxPerMinute)
+	}
+	hedgeBudgetsLock.Lock()
+	defer hedgeBudgetsLock.Unlock()
+	if hedgeBudgetsAt != minute {
+		hedgeBudgetsAt = minute
+		hedgeBudgets = make(map[string]int)
+	}
+	if hedgeBudgets[group] >= hedge.MaxPerMinute {
+		return false
+	}
+	hedgeBudgets[group]++
+	return true
+}
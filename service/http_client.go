@@ -9,11 +9,13 @@ import (
 	"net/url"
 	"one-api/common"
 	"strings"
+	"syscall"
 	"time"
 )
 
 var httpClient *http.Client
 var impatientHTTPClient *http.Client
+var webhookHTTPClient *http.Client
 
 func init() {
 	if common.RelayTimeout == 0 {
@@ -27,6 +29,29 @@ func init() {
 	impatientHTTPClient = &http.Client{
 		Timeout: 5 * time.Second,
 	}
+
+	// webhooks are given by users, the addresses are checked once resolved and redirects are not followed,
+	// so that they cannot reach the network around the server
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !common.IsPublicIP(ip) {
+				return fmt.Errorf("the address %s is not public", host)
+			}
+			return nil
+		},
+	}
+	webhookHTTPClient = &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
 }
 
 func GetHttpClient() *http.Client {
@@ -37,6 +62,10 @@ func GetImpatientHttpClient() *http.Client {
 	return impatientHTTPClient
 }
 
+func GetWebhookHttpClient() *http.Client {
+	return webhookHTTPClient
+}
+
 func GetProxyHttpClient(proxyURLStr string) (*http.Client, error) {
 	// 解析代理URL
 	proxyURL, err := url.Parse(proxyURLStr)
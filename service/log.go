@@ -2,6 +2,7 @@ package service
 
 import (
 	"github.com/gin-gonic/gin"
+	"one-api/common"
 	relaycommon "one-api/relay/common"
 )
 
@@ -12,6 +13,19 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	other["completion_ratio"] = completionRatio
 	other["model_price"] = modelPrice
 	other["frt"] = float64(relayInfo.FirstResponseTime.UnixMilli() - relayInfo.StartTime.UnixMilli())
+	if relayInfo.BatchId != "" {
+		other["batch_id"] = relayInfo.BatchId
+		other["batch_discount_ratio"] = common.BatchDiscountRatio
+	}
+	if fallbackFrom := ctx.GetString("fallback_from"); fallbackFrom != "" {
+		other["fallback_from"] = fallbackFrom
+	}
+	if race := getHedgeRace(ctx); race != nil && race.Hedged() {
+		other["hedge"] = map[string]interface{}{
+			"delay":    race.Delay.Milliseconds(),
+			"channels": race.Channels(),
+		}
+	}
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	other["admin_info"] = adminInfo
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/json"
+	"one-api/common"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelFallbacks returns the models to try, in order, once the channels of modelName are exhausted. Only json
+// requests naming the model in the body can move to another model, and tokens can opt out of fallbacks.
+func GetModelFallbacks(c *gin.Context, group string, modelName string) []string {
+	if c.GetBool("token_fallback_disabled") {
+		return nil
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return nil
+	}
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") ||
+		strings.HasPrefix(c.Request.URL.Path, "/v1beta/") {
+		return nil
+	}
+	rootModel := c.GetString("fallback_from")
+	if rootModel == "" {
+		rootModel = modelName
+	}
+	chain := common.GetModelFallbacks(group, rootModel)
+	// continue after the model served right now
+	for i, fallback := range chain {
+		if fallback == modelName {
+			chain = chain[i+1:]
+			break
+		}
+	}
+	var tokenModelLimit map[string]bool
+	if c.GetBool("token_model_limit_enabled") {
+		limit, _ := c.Get("token_model_limit")
+		tokenModelLimit, _ = limit.(map[string]bool)
+		if tokenModelLimit == nil {
+			return nil
+		}
+	}
+	fallbacks := make([]string, 0, len(chain))
+	for _, fallback := range chain {
+		if fallback == rootModel || fallback == modelName {
+			continue
+		}
+		if tokenModelLimit != nil && !tokenModelLimit[fallback] {
+			continue
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	return fallbacks
+}
+
+// UseFallbackModel rewrites the model of the request body, the relay then serves and bills the fallback model
+func UseFallbackModel(c *gin.Context, fromModel string, toModel string) error {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	request := make(map[string]json.RawMessage)
+	err = json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return err
+	}
+	request["model"], err = json.Marshal(toModel)
+	if err != nil {
+		return err
+	}
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	c.Set(common.KeyRequestBody, requestBody)
+	if c.GetString("fallback_from") == "" {
+		c.Set("fallback_from", fromModel)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"time"
+)
+
+// DeliverNotifications delivers the notifications created by this instance, the master node also retries the
+// failed ones and the ones left behind by other instances
+func DeliverNotifications() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case notification := <-model.NotificationQueue():
+			notification.Delivered(DeliverNotification(notification))
+		case <-ticker.C:
+			if !common.IsMasterNode {
+				continue
+			}
+			for _, notification := range model.ClaimDueNotifications(100) {
+				notification.Delivered(DeliverNotification(notification))
+			}
+		}
+	}
+}
+
+// DeliverNotification sends the notification through its channel
+func DeliverNotification(notification *model.Notification) error {
+	switch notification.Channel {
+	case model.NotificationChannelEmail:
+		return common.SendEmail(notification.Title, notification.Target, notification.Content)
+	case model.NotificationChannelWebhook:
+		return deliverWebhook(notification)
+	case model.NotificationChannelTelegram:
+		return deliverTelegram(notification)
+	}
+	return fmt.Errorf("unknown notification channel: %s", notification.Channel)
+}
+
+type notificationWebhookPayload struct {
+	Id        int             `json:"id"`
+	Event     string          `json:"event"`
+	Title     string          `json:"title"`
+	Content   string          `json:"content"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+// SignNotificationWebhook returns the signature of a webhook body, the receiver recomputes it with the secret of the
+// subscription to check that the payload is genuine
+func SignNotificationWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliverWebhook(notification *model.Notification) error {
+	subscription, err := model.GetNotificationSubscriptionById(notification.SubscriptionId, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get subscription: %w", err)
+	}
+	data := json.RawMessage(notification.Data)
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	timestamp := time.Now().Unix()
+	body, err := json.Marshal(notificationWebhookPayload{
+		Id:        notification.Id,
+		Event:     notification.Event,
+		Title:     notification.Title,
+		Content:   notification.Content,
+		Data:      data,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, notification.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Notification-Event", notification.Event)
+	req.Header.Set("X-Notification-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Notification-Signature", SignNotificationWebhook(subscription.Secret, timestamp, body))
+	resp, err := GetWebhookHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func deliverTelegram(notification *model.Notification) error {
+	if common.TelegramBotToken == "" {
+		return errors.New("未配置 Telegram 机器人")
+	}
+	body, _ := json.Marshal(map[string]string{
+		"chat_id": notification.Target,
+		"text":    notification.Title + "\n\n" + notification.Content,
+	})
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", common.TelegramBotToken)
+	resp, err := GetImpatientHttpClient().Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the error contains the url, hence the token
+		return errors.New("failed to reach telegram")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("telegram responded with status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
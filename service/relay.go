@@ -73,3 +73,25 @@ func GenerateFinalUsageResponse(id string, createAt int64, model string, usage d
 		Usage:             &usage,
 	}
 }
+
+// ClaudeChunkData writes a raw Anthropic Messages stream event
+func ClaudeChunkData(c *gin.Context, eventType string, data string) error {
+	_, err := c.Writer.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data))
+	if err != nil {
+		return err
+	}
+	if flusher, ok := c.Writer.(http.Flusher); ok {
+		flusher.Flush()
+	} else {
+		return errors.New("streaming error: flusher not found")
+	}
+	return nil
+}
+
+func ClaudeData(c *gin.Context, eventType string, object interface{}) error {
+	jsonData, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("error marshalling object: %w", err)
+	}
+	return ClaudeChunkData(c, eventType, string(jsonData))
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"one-api/dto"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SpendWindowExhaustedCode is the error code of the requests refused by a daily, weekly or monthly spend limit
+const SpendWindowExhaustedCode = "spend_window_exhausted"
+
+// CheckSpendWindows fails the request when spending quota would exceed a spend window of its token or user. quota
+// is the price of the request when it is known upfront, else the quota it pre-consumes.
+func CheckSpendWindows(c *gin.Context, quota int) *dto.OpenAIErrorWithStatusCode {
+	// the playground has no token, only the limits of the user apply
+	value, _ := c.Get("token_spend_limits")
+	tokenLimits, _ := value.(model.SpendLimits)
+	err := model.CheckSpendWindows(c.GetInt("token_id"), tokenLimits, c.GetInt("id"), quota)
+	if err == nil {
+		return nil
+	}
+	var windowErr *model.SpendWindowError
+	if errors.As(err, &windowErr) {
+		return OpenAIErrorWrapperLocal(err, SpendWindowExhaustedCode, http.StatusForbidden)
+	}
+	return OpenAIErrorWrapperLocal(err, "check_spend_window_failed", http.StatusInternalServerError)
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var quotaChangeNames = map[string]string{
+	model.QuotaChangeOpening:      "期初余额",
+	model.QuotaChangeRegister:     "注册赠送",
+	model.QuotaChangeTopUp:        "在线充值",
+	model.QuotaChangeRedemption:   "兑换码充值",
+	model.QuotaChangeSubscription: "订阅套餐",
+	model.QuotaChangeReferral:     "邀请奖励",
+	model.QuotaChangeAffTransfer:  "邀请额度划转",
+	model.QuotaChangeAdminAdjust:  "管理员调整",
+	model.QuotaChangePreConsume:   "预扣费",
+	model.QuotaChangeConsume:      "消费",
+	model.QuotaChangeRefund:       "退还",
+}
+
+func quotaChangeName(changeType string) string {
+	if name, ok := quotaChangeNames[changeType]; ok {
+		return name
+	}
+	return changeType
+}
+
+// statementAmount converts quota to the currency it is sold in
+func statementAmount(quota int) string {
+	return strconv.FormatFloat(float64(quota)/common.QuotaPerUnit, 'f', 6, 64)
+}
+
+func statementTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+// ledgerEntryAmount returns the change the entry made to the balance of the user
+func ledgerEntryAmount(statement *model.Statement, entry *model.QuotaLedgerEntry) int {
+	if entry.CreditAccount == fmt.Sprintf("user:%d", statement.UserId) {
+		return entry.Amount
+	}
+	return -entry.Amount
+}
+
+// StatementFileName is the name the exports of the statement are downloaded as
+func StatementFileName(statement *model.Statement, ext string) string {
+	name := fmt.Sprintf("statement-%d-%s", statement.UserId, statement.Period)
+	if statement.TokenId != 0 {
+		name = fmt.Sprintf("statement-%d-token-%d-%s", statement.UserId, statement.TokenId, statement.Period)
+	}
+	return name + "." + ext
+}
+
+// WriteStatementCSV writes the statement as one table, the first column tells the section of each row
+func WriteStatementCSV(w io.Writer, statement *model.Statement) error {
+	// a byte order mark, so that spreadsheet applications read the file as UTF-8
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"分类", "项目", "请求数", "提示 Tokens", "补全 Tokens", "额度", "金额"})
+	line := func(section string, l model.StatementLine) {
+		_ = writer.Write([]string{section, l.Name, strconv.Itoa(l.Requests), strconv.Itoa(l.PromptTokens),
+			strconv.Itoa(l.CompletionTokens), strconv.Itoa(l.Quota), statementAmount(l.Quota)})
+	}
+	total := statement.Consumption
+	total.Name = statement.Period
+	line("消费合计", total)
+	for _, l := range statement.ByModel {
+		line("按模型", l)
+	}
+	for _, l := range statement.ByToken {
+		line("按令牌", l)
+	}
+	for _, l := range statement.ByDay {
+		line("按日", l)
+	}
+	if statement.TokenId == 0 {
+		balance := func(section string, quota int) {
+			_ = writer.Write([]string{section, statement.Period, "", "", "", strconv.Itoa(quota), statementAmount(quota)})
+		}
+		balance("期初余额", statement.OpeningBalance)
+		for _, change := range statement.Changes {
+			_ = writer.Write([]string{"额度变动", quotaChangeName(change.Type), strconv.Itoa(change.Count), "", "",
+				strconv.Itoa(change.Amount), statementAmount(change.Amount)})
+		}
+		balance("期末余额", statement.ClosingBalance)
+		entry := func(section string, entry *model.QuotaLedgerEntry) {
+			amount := ledgerEntryAmount(statement, entry)
+			_ = writer.Write([]string{section, strings.TrimSpace(statementTime(entry.CreatedAt) + " " + entry.Reason + " " + entry.ReferenceId),
+				"", "", "", strconv.Itoa(amount), statementAmount(amount)})
+		}
+		for _, e := range statement.TopUps {
+			entry("充值", e)
+		}
+		for _, e := range statement.Adjustments {
+			entry("调整", e)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+var statementTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"amount": statementAmount,
+	"time":   statementTime,
+	"change": quotaChangeName,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.SystemName}} 账单 {{.Statement.Period}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; color: #222; margin: 32px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 16px; margin-top: 28px; border-bottom: 1px solid #ccc; padding-bottom: 4px; }
+table { width: 100%; border-collapse: collapse; font-size: 13px; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eee; }
+td.num, th.num { text-align: right; }
+.meta { color: #666; font-size: 13px; }
+@media print { body { margin: 0; } h2 { page-break-after: avoid; } tr { page-break-inside: avoid; } }
+</style>
+</head>
+<body>
+{{$s := .Statement}}
+<h1>{{.SystemName}} 账单</h1>
+<div class="meta">
+用户：{{$s.Username}}（#{{$s.UserId}}）{{if $s.TokenId}}　令牌：{{$s.TokenName}}（#{{$s.TokenId}}）{{end}}<br>
+账单周期：{{time $s.Start}} 至 {{time $s.End}}<br>
+生成时间：{{time $s.GeneratedAt}}
+</div>
+{{define "lines"}}
+<table>
+<tr><th>{{.Title}}</th><th class="num">请求数</th><th class="num">提示 Tokens</th><th class="num">补全 Tokens</th><th class="num">额度</th><th class="num">金额</th></tr>
+{{range .Lines}}<tr><td>{{.Name}}</td><td class="num">{{.Requests}}</td><td class="num">{{.PromptTokens}}</td><td class="num">{{.CompletionTokens}}</td><td class="num">{{.Quota}}</td><td class="num">{{amount .Quota}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>消费合计</h2>
+<table>
+<tr><th class="num">请求数</th><th class="num">提示 Tokens</th><th class="num">补全 Tokens</th><th class="num">额度</th><th class="num">金额</th></tr>
+<tr><td class="num">{{$s.Consumption.Requests}}</td><td class="num">{{$s.Consumption.PromptTokens}}</td><td class="num">{{$s.Consumption.CompletionTokens}}</td><td class="num">{{$s.Consumption.Quota}}</td><td class="num">{{amount $s.Consumption.Quota}}</td></tr>
+</table>
+<h2>按模型</h2>
+{{template "lines" (index .Sections 0)}}
+<h2>按令牌</h2>
+{{template "lines" (index .Sections 1)}}
+<h2>按日</h2>
+{{template "lines" (index .Sections 2)}}
+{{if not $s.TokenId}}
+<h2>额度变动</h2>
+<table>
+<tr><th>项目</th><th class="num">笔数</th><th class="num">额度</th><th class="num">金额</th></tr>
+<tr><td>期初余额</td><td></td><td class="num">{{$s.OpeningBalance}}</td><td class="num">{{amount $s.OpeningBalance}}</td></tr>
+{{range $s.Changes}}<tr><td>{{change .Type}}</td><td class="num">{{.Count}}</td><td class="num">{{.Amount}}</td><td class="num">{{amount .Amount}}</td></tr>
+{{end}}<tr><td>期末余额</td><td></td><td class="num">{{$s.ClosingBalance}}</td><td class="num">{{amount $s.ClosingBalance}}</td></tr>
+</table>
+{{if $s.TopUps}}
+<h2>充值记录</h2>
+<table>
+<tr><th>时间</th><th>类型</th><th>说明</th><th>单号</th><th class="num">额度</th></tr>
+{{range .TopUps}}<tr><td>{{time .Entry.CreatedAt}}</td><td>{{change .Entry.Type}}</td><td>{{.Entry.Reason}}</td><td>{{.Entry.ReferenceId}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if $s.Adjustments}}
+<h2>调整记录</h2>
+<table>
+<tr><th>时间</th><th>类型</th><th>说明</th><th>单号</th><th class="num">额度</th></tr>
+{{range .Adjustments}}<tr><td>{{time .Entry.CreatedAt}}</td><td>{{change .Entry.Type}}</td><td>{{.Entry.Reason}}</td><td>{{.Entry.ReferenceId}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type statementSection struct {
+	Title string
+	Lines []model.StatementLine
+}
+
+type statementEntry struct {
+	Entry  *model.QuotaLedgerEntry
+	Amount int // signed, e.g. the end of a subscription takes quota back
+}
+
+func statementEntries(statement *model.Statement, entries []*model.QuotaLedgerEntry) []statementEntry {
+	result := make([]statementEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, statementEntry{Entry: entry, Amount: ledgerEntryAmount(statement, entry)})
+	}
+	return result
+}
+
+// WriteStatementHTML writes the statement as a printable page, browsers save it as a PDF document
+func WriteStatementHTML(w io.Writer, statement *model.Statement) error {
+	return statementTemplate.Execute(w, map[string]interface{}{
+		"SystemName": common.SystemName,
+		"Statement":  statement,
+		"Sections": []statementSection{
+			{Title: "模型", Lines: statement.ByModel},
+			{Title: "令牌", Lines: statement.ByToken},
+			{Title: "日期", Lines: statement.ByDay},
+		},
+		"TopUps":      statementEntries(statement, statement.TopUps),
+		"Adjustments": statementEntries(statement, statement.Adjustments),
+	})
+}
+
+// EmailMonthlyStatements emails the users with an email address their statement of the previous month
+func EmailMonthlyStatements() {
+	if !common.StatementEmailEnabled {
+		return
+	}
+	_, start, end, err := model.StatementPeriod("")
+	if err != nil {
+		common.SysError("failed to get the statement period: " + err.Error())
+		return
+	}
+	userIds, err := model.GetStatementUserIds(start, end)
+	if err != nil {
+		common.SysError("failed to get the users to send statements to: " + err.Error())
+		return
+	}
+	common.SysLog(fmt.Sprintf("sending the monthly statements to %d users", len(userIds)))
+	for _, userId := range userIds {
+		if err = emailStatement(userId); err != nil {
+			common.SysError(fmt.Sprintf("failed to send the statement of user #%d: %s", userId, err.Error()))
+		}
+	}
+}
+
+func emailStatement(userId int) error {
+	statement, err := model.GenerateStatement(userId, 0, "")
+	if err != nil {
+		return err
+	}
+	email, err := model.GetUserEmail(userId)
+	if err != nil {
+		return err
+	}
+	var content bytes.Buffer
+	if err = WriteStatementHTML(&content, statement); err != nil {
+		return err
+	}
+	return common.SendEmail(fmt.Sprintf("%s %s 账单", common.SystemName, statement.Period), email, content.String())
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/robfig/cron/v3"
 	"one-api/common"
+	"one-api/model"
+	"one-api/service"
 )
 
 func InitCron() {
@@ -16,6 +18,22 @@ func InitCron() {
 	if err != nil {
 		common.SysError("定时任务初始化失败")
 	}
+	// 订阅周期
+	if common.IsMasterNode {
+		_, err = c.AddFunc("0 */5 * * * *", func() {
+			model.ProcessSubscriptions()
+		})
+		if err != nil {
+			common.SysError("订阅定时任务初始化失败")
+		}
+		// 月度账单，每月 1 日发送上月账单
+		_, err = c.AddFunc("0 30 0 1 * *", func() {
+			service.EmailMonthlyStatements()
+		})
+		if err != nil {
+			common.SysError("月度账单定时任务初始化失败")
+		}
+	}
 	c.Start()
 	common.SysLog(fmt.Sprintf("定时任务初始化完成"))
 }
@@ -18,6 +18,7 @@ import Channel from './pages/Channel';
 import Token from './pages/Token';
 import EditChannel from './pages/Channel/EditChannel';
 import Redemption from './pages/Redemption';
+import Plan from './pages/Plan';
 import TopUp from './pages/TopUp';
 import Log from './pages/Log';
 import Chat from './pages/Chat';
@@ -118,6 +119,14 @@ function App() {
             </PrivateRoute>
           }
         />
+        <Route
+          path='/plan'
+          element={
+            <PrivateRoute>
+              <Plan />
+            </PrivateRoute>
+          }
+        />
         <Route
           path='/user'
           element={
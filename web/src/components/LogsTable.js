@@ -257,6 +257,7 @@ const LogsTable = () => {
       title: '模型',
       dataIndex: 'model_name',
       render: (text, record, index) => {
+        let other = getLogOther(record.other);
         return record.type === 0 || record.type === 2 ? (
           <>
             <Tag
@@ -269,6 +270,27 @@ const LogsTable = () => {
               {' '}
               {text}{' '}
             </Tag>
+            {other?.fallback_from && (
+              <Tooltip content={'回退自 ' + other.fallback_from}>
+                <Tag color='orange' size='large'>
+                  回退
+                </Tag>
+              </Tooltip>
+            )}
+            {other?.hedge && (
+              <Tooltip
+                content={
+                  '首个渠道 ' +
+                  other.hedge.delay +
+                  'ms 内未响应，对冲到渠道 ' +
+                  other.hedge.channels.join(', ')
+                }
+              >
+                <Tag color='cyan' size='large'>
+                  对冲
+                </Tag>
+              </Tooltip>
+            )}
           </>
         ) : (
           <></>
@@ -391,6 +413,10 @@ const LogsTable = () => {
           other.model_price,
           other.completion_ratio,
           other.group_ratio,
+          other.cache_tokens,
+          other.cache_ratio,
+          other.cache_creation_tokens,
+          other.cache_creation_ratio,
         );
         return (
           <Tooltip content={content}>
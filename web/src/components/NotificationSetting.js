@@ -0,0 +1,415 @@
+import React, { useEffect, useState } from 'react';
+import {
+  API,
+  isAdmin,
+  showError,
+  showSuccess,
+  timestamp2string,
+} from '../helpers';
+
+import { ITEMS_PER_PAGE } from '../constants';
+import { renderQuota } from '../helpers/render';
+import {
+  Button,
+  Divider,
+  Input,
+  Modal,
+  Popconfirm,
+  Select,
+  Switch,
+  Table,
+  Tag,
+  Typography,
+} from '@douyinfe/semi-ui';
+
+const eventNames = {
+  balance_low: '余额低于阈值',
+  token_exhausted: '令牌额度用尽',
+  channel_disabled: '渠道被自动禁用',
+  topup_success: '充值成功',
+  task_failed: '任务执行失败',
+};
+
+const channelNames = {
+  email: '邮件',
+  webhook: 'Webhook',
+  telegram: 'Telegram',
+};
+
+const targetPlaceholders = {
+  email: '留空则发送到账户绑定的邮箱',
+  webhook: '接收通知的 URL，例如 https://example.com/hook',
+  telegram: '留空则发送给账户绑定的 Telegram 用户，也可填写群组 Chat ID',
+};
+
+function renderTimestamp(timestamp) {
+  return <>{timestamp ? timestamp2string(timestamp) : '-'}</>;
+}
+
+function renderNotificationStatus(status) {
+  switch (status) {
+    case 'pending':
+      return (
+        <Tag color='orange' size='large'>
+          等待重试
+        </Tag>
+      );
+    case 'sent':
+      return (
+        <Tag color='green' size='large'>
+          已发送
+        </Tag>
+      );
+    case 'failed':
+      return (
+        <Tag color='red' size='large'>
+          发送失败
+        </Tag>
+      );
+    default:
+      return (
+        <Tag color='black' size='large'>
+          未知状态
+        </Tag>
+      );
+  }
+}
+
+const emptySubscription = {
+  id: undefined,
+  event: 'balance_low',
+  channel: 'email',
+  target: '',
+  secret: '',
+  threshold: 0,
+  enabled: true,
+};
+
+const NotificationSetting = () => {
+  const [subscriptions, setSubscriptions] = useState([]);
+  const [loading, setLoading] = useState(true);
+  const [showEdit, setShowEdit] = useState(false);
+  const [inputs, setInputs] = useState(emptySubscription);
+  const [notifications, setNotifications] = useState([]);
+  const [notificationsLoading, setNotificationsLoading] = useState(true);
+  const [activePage, setActivePage] = useState(1);
+
+  const eventOptions = Object.keys(eventNames)
+    .filter((event) => event !== 'channel_disabled' || isAdmin())
+    .map((event) => ({ label: eventNames[event], value: event }));
+  const channelOptions = Object.keys(channelNames).map((channel) => ({
+    label: channelNames[channel],
+    value: channel,
+  }));
+
+  const columns = [
+    {
+      title: '事件',
+      dataIndex: 'event',
+      render: (text, record, index) => {
+        return (
+          <div>
+            {eventNames[text] || text}
+            {text === 'balance_low' &&
+              `（${renderQuota(parseInt(record.threshold))}）`}
+          </div>
+        );
+      },
+    },
+    {
+      title: '渠道',
+      dataIndex: 'channel',
+      render: (text, record, index) => {
+        return <div>{channelNames[text] || text}</div>;
+      },
+    },
+    {
+      title: '接收地址',
+      dataIndex: 'target',
+      render: (text, record, index) => {
+        return <div>{text === '' ? '账户绑定' : text}</div>;
+      },
+    },
+    {
+      title: '状态',
+      dataIndex: 'enabled',
+      render: (text, record, index) => {
+        return (
+          <Switch
+            checked={text}
+            onChange={(checked) => {
+              saveSubscription({ ...record, enabled: checked }).then();
+            }}
+          />
+        );
+      },
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (text, record, index) => (
+        <div>
+          <Popconfirm
+            title='确定是否要删除此通知？'
+            okType={'danger'}
+            position={'left'}
+            onConfirm={() => {
+              deleteSubscription(record.id);
+            }}
+          >
+            <Button theme='light' type='danger' style={{ marginRight: 1 }}>
+              删除
+            </Button>
+          </Popconfirm>
+          <Button
+            theme='light'
+            type='secondary'
+            style={{ marginRight: 1 }}
+            onClick={() => {
+              testSubscription(record.id);
+            }}
+          >
+            测试
+          </Button>
+          <Button
+            theme='light'
+            type='tertiary'
+            style={{ marginRight: 1 }}
+            onClick={() => {
+              setInputs(record);
+              setShowEdit(true);
+            }}
+          >
+            编辑
+          </Button>
+        </div>
+      ),
+    },
+  ];
+
+  const notificationColumns = [
+    {
+      title: '时间',
+      dataIndex: 'created_at',
+      render: (text, record, index) => {
+        return <div>{renderTimestamp(text)}</div>;
+      },
+    },
+    {
+      title: '事件',
+      dataIndex: 'event',
+      render: (text, record, index) => {
+        return <div>{eventNames[text] || text}</div>;
+      },
+    },
+    {
+      title: '渠道',
+      dataIndex: 'channel',
+      render: (text, record, index) => {
+        return <div>{channelNames[text] || text}</div>;
+      },
+    },
+    {
+      title: '标题',
+      dataIndex: 'title',
+    },
+    {
+      title: '状态',
+      dataIndex: 'status',
+      render: (text, record, index) => {
+        return <div>{renderNotificationStatus(text)}</div>;
+      },
+    },
+    {
+      title: '尝试次数',
+      dataIndex: 'attempts',
+    },
+    {
+      title: '错误信息',
+      dataIndex: 'last_error',
+    },
+  ];
+
+  const loadSubscriptions = async () => {
+    setLoading(true);
+    const res = await API.get(`/api/notification/subscription`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setSubscriptions(data || []);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const loadNotifications = async (page) => {
+    setNotificationsLoading(true);
+    const res = await API.get(`/api/notification/self?p=${page - 1}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setNotifications(data || []);
+      setActivePage(page);
+    } else {
+      showError(message);
+    }
+    setNotificationsLoading(false);
+  };
+
+  useEffect(() => {
+    loadSubscriptions().then();
+    loadNotifications(1).then();
+  }, []);
+
+  const saveSubscription = async (subscription) => {
+    const payload = {
+      ...subscription,
+      threshold: parseInt(subscription.threshold) || 0,
+    };
+    let res;
+    if (payload.id) {
+      res = await API.put(`/api/notification/subscription`, payload);
+    } else {
+      res = await API.post(`/api/notification/subscription`, payload);
+    }
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('保存成功！');
+      await loadSubscriptions();
+    } else {
+      showError(message);
+    }
+    return success;
+  };
+
+  const deleteSubscription = async (id) => {
+    const res = await API.delete(`/api/notification/subscription/${id}`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('操作成功完成！');
+      await loadSubscriptions();
+    } else {
+      showError(message);
+    }
+  };
+
+  const testSubscription = async (id) => {
+    const res = await API.post(`/api/notification/subscription/${id}/test`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('测试通知已发送');
+    } else {
+      showError(message);
+    }
+    await loadNotifications(1);
+  };
+
+  const handleInputChange = (name, value) => {
+    setInputs((inputs) => ({ ...inputs, [name]: value }));
+  };
+
+  return (
+    <>
+      <Modal
+        title={inputs.id ? '编辑通知' : '添加通知'}
+        visible={showEdit}
+        onCancel={() => setShowEdit(false)}
+        onOk={async () => {
+          if (await saveSubscription(inputs)) {
+            setShowEdit(false);
+          }
+        }}
+      >
+        <Typography.Text>事件</Typography.Text>
+        <Select
+          style={{ width: '100%', marginTop: 8, marginBottom: 16 }}
+          optionList={eventOptions}
+          value={inputs.event}
+          onChange={(value) => handleInputChange('event', value)}
+        />
+        {inputs.event === 'balance_low' && (
+          <>
+            <Typography.Text>
+              {`余额阈值${renderQuota(parseInt(inputs.threshold) || 0)}`}
+            </Typography.Text>
+            <Input
+              style={{ marginTop: 8, marginBottom: 16 }}
+              placeholder='余额低于此额度时通知'
+              type='number'
+              value={inputs.threshold}
+              onChange={(value) => handleInputChange('threshold', value)}
+            />
+          </>
+        )}
+        <Typography.Text>渠道</Typography.Text>
+        <Select
+          style={{ width: '100%', marginTop: 8, marginBottom: 16 }}
+          optionList={channelOptions}
+          value={inputs.channel}
+          onChange={(value) => handleInputChange('channel', value)}
+        />
+        <Typography.Text>接收地址</Typography.Text>
+        <Input
+          style={{ marginTop: 8, marginBottom: 16 }}
+          placeholder={targetPlaceholders[inputs.channel]}
+          value={inputs.target}
+          onChange={(value) => handleInputChange('target', value)}
+        />
+        {inputs.channel === 'webhook' && (
+          <>
+            <Typography.Text>签名密钥</Typography.Text>
+            <Input
+              style={{ marginTop: 8, marginBottom: 8 }}
+              placeholder='留空自动生成'
+              value={inputs.secret}
+              onChange={(value) => handleInputChange('secret', value)}
+            />
+            <Typography.Text type='tertiary'>
+              请求头 X-Notification-Signature 为 sha256=HMAC-SHA256(密钥,
+              时间戳 + "." + 请求体)，时间戳见 X-Notification-Timestamp
+            </Typography.Text>
+          </>
+        )}
+      </Modal>
+      <Table
+        style={{ marginTop: 20 }}
+        columns={columns}
+        dataSource={subscriptions}
+        pagination={false}
+        loading={loading}
+      ></Table>
+      <Button
+        theme='light'
+        type='primary'
+        style={{ marginTop: 10 }}
+        onClick={() => {
+          setInputs(emptySubscription);
+          setShowEdit(true);
+        }}
+      >
+        添加通知
+      </Button>
+      <Divider margin='24px' align='left'>
+        通知记录
+      </Divider>
+      <Table
+        style={{ marginTop: 20 }}
+        columns={notificationColumns}
+        dataSource={notifications}
+        pagination={{
+          currentPage: activePage,
+          pageSize: ITEMS_PER_PAGE,
+          total:
+            (activePage - 1) * ITEMS_PER_PAGE +
+            notifications.length +
+            (notifications.length === ITEMS_PER_PAGE ? 1 : 0),
+          onPageChange: (page) => {
+            loadNotifications(page).then();
+          },
+        }}
+        loading={notificationsLoading}
+      ></Table>
+    </>
+  );
+};
+
+export default NotificationSetting;
@@ -18,10 +18,16 @@ const OperationSetting = () => {
     QuotaForInviter: 0,
     QuotaForInvitee: 0,
     QuotaRemindThreshold: 0,
+    NotificationDedupMinutes: 0,
     PreConsumedQuota: 0,
     StreamCacheQueueLength: 0,
     ModelRatio: '',
     CompletionRatio: '',
+    CacheRatio: '',
+    CreateCacheRatio: '',
+    AudioRatio: '',
+    AudioCompletionRatio: '',
+    ModelRatioTiers: '',
     ModelPrice: '',
     GroupRatio: '',
     UserUsableGroups: '',
@@ -32,6 +38,23 @@ const OperationSetting = () => {
     AutomaticDisableChannelEnabled: false,
     AutomaticEnableChannelEnabled: false,
     ChannelDisableThreshold: 0,
+    CircuitBreakerEnabled: false,
+    CircuitBreakerFailureThreshold: 0,
+    CircuitBreakerErrorRate: 0,
+    CircuitBreakerMinRequests: 0,
+    CircuitBreakerWindow: 0,
+    CircuitBreakerCooldown: 0,
+    CircuitBreakerHalfOpenRequests: 0,
+    ChannelQueueSize: 0,
+    ChannelQueueTimeout: 0,
+    ChannelHealthRetentionDays: 0,
+    ChannelSelectStrategy: '',
+    ChannelSelectStrategies: '',
+    ModelFallbacks: '',
+    ChannelAffinities: '',
+    ChannelAffinityTTL: 0,
+    ChannelAffinityHeaderName: '',
+    ChannelHedges: '',
     LogConsumeEnabled: false,
     DisplayInCurrencyEnabled: false,
     DisplayTokenStatEnabled: false,
@@ -67,6 +90,15 @@ const OperationSetting = () => {
           item.key === 'GroupRatio' ||
           item.key === 'UserUsableGroups' ||
           item.key === 'CompletionRatio' ||
+          item.key === 'CacheRatio' ||
+          item.key === 'CreateCacheRatio' ||
+          item.key === 'AudioRatio' ||
+          item.key === 'AudioCompletionRatio' ||
+          item.key === 'ModelRatioTiers' ||
+          item.key === 'ChannelSelectStrategies' ||
+          item.key === 'ModelFallbacks' ||
+          item.key === 'ChannelAffinities' ||
+          item.key === 'ChannelHedges' ||
           item.key === 'ModelPrice'
         ) {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
@@ -62,6 +62,7 @@ const PersonalSetting = () => {
   const [models, setModels] = useState([]);
   const [openTransfer, setOpenTransfer] = useState(false);
   const [transferAmount, setTransferAmount] = useState(0);
+  const [statementMonth, setStatementMonth] = useState('');
 
   useEffect(() => {
     // let user = localStorage.getItem('user');
@@ -154,6 +155,28 @@ const PersonalSetting = () => {
     showSuccess(`邀请链接已复制到剪切板`);
   };
 
+  const downloadStatement = async (format) => {
+    const res = await API.get('/api/user/self/statement', {
+      params: { month: statementMonth, format },
+      responseType: 'blob',
+    });
+    if (res.data.type.startsWith('application/json')) {
+      const { message } = JSON.parse(await res.data.text());
+      showError(message);
+      return;
+    }
+    const url = URL.createObjectURL(res.data);
+    if (format === 'html') {
+      window.open(url, '_blank');
+    } else {
+      const link = document.createElement('a');
+      link.href = url;
+      link.download = `statement-${statementMonth || 'last-month'}.csv`;
+      link.click();
+    }
+    setTimeout(() => URL.revokeObjectURL(url), 60000);
+  };
+
   const handleSystemTokenClick = async (e) => {
     e.target.select();
     await copy(e.target.value);
@@ -432,6 +455,25 @@ const PersonalSetting = () => {
                 </Descriptions>
               </div>
             </Card>
+            <Card>
+              <Typography.Title heading={6}>月度账单</Typography.Title>
+              <div style={{ marginTop: 10 }}>
+                <Space>
+                  <Input
+                    value={statementMonth}
+                    onChange={(value) => setStatementMonth(value)}
+                    placeholder='账单月份，如 2024-01，留空为上月'
+                    style={{ width: 280 }}
+                  />
+                  <Button onClick={() => downloadStatement('csv')}>
+                    导出 CSV
+                  </Button>
+                  <Button onClick={() => downloadStatement('html')}>
+                    打印账单
+                  </Button>
+                </Space>
+              </div>
+            </Card>
             <Card>
               <Typography.Title heading={6}>个人信息</Typography.Title>
               <div style={{ marginTop: 20 }}>
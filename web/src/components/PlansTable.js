@@ -0,0 +1,395 @@
+import React, { useEffect, useState } from 'react';
+import { API, showError, showSuccess, timestamp2string } from '../helpers';
+
+import { ITEMS_PER_PAGE } from '../constants';
+import { renderQuota } from '../helpers/render';
+import {
+  Button,
+  Divider,
+  Form,
+  Popconfirm,
+  Table,
+  Tag,
+} from '@douyinfe/semi-ui';
+import EditPlan from '../pages/Plan/EditPlan';
+
+const periodNames = {
+  day: '天',
+  week: '周',
+  month: '月',
+  year: '年',
+};
+
+function renderTimestamp(timestamp) {
+  return <>{timestamp ? timestamp2string(timestamp) : '-'}</>;
+}
+
+function renderPlanStatus(status) {
+  switch (status) {
+    case 1:
+      return (
+        <Tag color='green' size='large'>
+          已启用
+        </Tag>
+      );
+    case 2:
+      return (
+        <Tag color='red' size='large'>
+          已停售
+        </Tag>
+      );
+    default:
+      return (
+        <Tag color='black' size='large'>
+          未知状态
+        </Tag>
+      );
+  }
+}
+
+export function renderSubscriptionStatus(status) {
+  switch (status) {
+    case 'pending':
+      return (
+        <Tag color='grey' size='large'>
+          待支付
+        </Tag>
+      );
+    case 'active':
+      return (
+        <Tag color='green' size='large'>
+          生效中
+        </Tag>
+      );
+    case 'past_due':
+      return (
+        <Tag color='orange' size='large'>
+          续费失败
+        </Tag>
+      );
+    case 'canceled':
+      return (
+        <Tag color='red' size='large'>
+          已取消
+        </Tag>
+      );
+    case 'expired':
+      return (
+        <Tag color='grey' size='large'>
+          已过期
+        </Tag>
+      );
+    default:
+      return (
+        <Tag color='black' size='large'>
+          未知状态
+        </Tag>
+      );
+  }
+}
+
+const PlansTable = () => {
+  const [plans, setPlans] = useState([]);
+  const [loading, setLoading] = useState(true);
+  const [showEdit, setShowEdit] = useState(false);
+  const [editingPlan, setEditingPlan] = useState({
+    id: undefined,
+  });
+  const [subscriptions, setSubscriptions] = useState([]);
+  const [subscriptionsLoading, setSubscriptionsLoading] = useState(true);
+  const [activePage, setActivePage] = useState(1);
+  const [searchUserId, setSearchUserId] = useState('');
+
+  const planName = (id) => {
+    const plan = plans.find((plan) => plan.id === id);
+    return plan ? plan.name : id;
+  };
+
+  const columns = [
+    {
+      title: 'ID',
+      dataIndex: 'id',
+    },
+    {
+      title: '名称',
+      dataIndex: 'name',
+    },
+    {
+      title: '状态',
+      dataIndex: 'status',
+      render: (text, record, index) => {
+        return <div>{renderPlanStatus(text)}</div>;
+      },
+    },
+    {
+      title: '价格',
+      dataIndex: 'price',
+      render: (text, record, index) => {
+        if (record.stripe_price_id !== '') {
+          return <div>{record.stripe_price_id}</div>;
+        }
+        return (
+          <div>
+            {text} {record.currency.toUpperCase()} /{' '}
+            {periodNames[record.period] || record.period}
+          </div>
+        );
+      },
+    },
+    {
+      title: '每周期额度',
+      dataIndex: 'quota',
+      render: (text, record, index) => {
+        return <div>{renderQuota(parseInt(text))}</div>;
+      },
+    },
+    {
+      title: '分组',
+      dataIndex: 'group',
+      render: (text, record, index) => {
+        return <div>{text === '' ? '不修改' : text}</div>;
+      },
+    },
+    {
+      title: '额度结转',
+      dataIndex: 'roll_over',
+      render: (text, record, index) => {
+        return <div>{text ? '是' : '否'}</div>;
+      },
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (text, record, index) => (
+        <div>
+          <Popconfirm
+            title='确定是否要删除此套餐？'
+            content='已有的订阅将持续到其失效为止'
+            okType={'danger'}
+            position={'left'}
+            onConfirm={() => {
+              deletePlan(record.id);
+            }}
+          >
+            <Button theme='light' type='danger' style={{ marginRight: 1 }}>
+              删除
+            </Button>
+          </Popconfirm>
+          <Button
+            theme='light'
+            type={record.status === 1 ? 'warning' : 'secondary'}
+            style={{ marginRight: 1 }}
+            onClick={async () => {
+              setPlanStatus(record, record.status === 1 ? 2 : 1);
+            }}
+          >
+            {record.status === 1 ? '停售' : '启用'}
+          </Button>
+          <Button
+            theme='light'
+            type='tertiary'
+            style={{ marginRight: 1 }}
+            onClick={() => {
+              setEditingPlan(record);
+              setShowEdit(true);
+            }}
+          >
+            编辑
+          </Button>
+        </div>
+      ),
+    },
+  ];
+
+  const subscriptionColumns = [
+    {
+      title: 'ID',
+      dataIndex: 'id',
+    },
+    {
+      title: '用户ID',
+      dataIndex: 'user_id',
+    },
+    {
+      title: '套餐',
+      dataIndex: 'plan_id',
+      render: (text, record, index) => {
+        return <div>{planName(text)}</div>;
+      },
+    },
+    {
+      title: '状态',
+      dataIndex: 'status',
+      render: (text, record, index) => {
+        return (
+          <div>
+            {renderSubscriptionStatus(text)}
+            {record.cancel_at_period_end && (
+              <Tag color='orange' size='large'>
+                到期取消
+              </Tag>
+            )}
+          </div>
+        );
+      },
+    },
+    {
+      title: '当前周期',
+      dataIndex: 'period_start',
+      render: (text, record, index) => {
+        return (
+          <div>
+            {renderTimestamp(text)} ~ {renderTimestamp(record.period_end)}
+          </div>
+        );
+      },
+    },
+    {
+      title: '本周期发放额度',
+      dataIndex: 'granted_quota',
+      render: (text, record, index) => {
+        return <div>{renderQuota(parseInt(text))}</div>;
+      },
+    },
+    {
+      title: '创建时间',
+      dataIndex: 'created_time',
+      render: (text, record, index) => {
+        return <div>{renderTimestamp(text)}</div>;
+      },
+    },
+  ];
+
+  const loadPlans = async () => {
+    setLoading(true);
+    const res = await API.get(`/api/plan/`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setPlans(data || []);
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  const loadSubscriptions = async (page) => {
+    setSubscriptionsLoading(true);
+    const res = await API.get(
+      `/api/plan/subscriptions?p=${page - 1}&user_id=${searchUserId}`,
+    );
+    const { success, message, data } = res.data;
+    if (success) {
+      setSubscriptions(data || []);
+      setActivePage(page);
+    } else {
+      showError(message);
+    }
+    setSubscriptionsLoading(false);
+  };
+
+  const refresh = async () => {
+    await loadPlans();
+  };
+
+  useEffect(() => {
+    loadPlans().then();
+    loadSubscriptions(1).then();
+  }, []);
+
+  const deletePlan = async (id) => {
+    const res = await API.delete(`/api/plan/${id}`);
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('操作成功完成！');
+      await loadPlans();
+    } else {
+      showError(message);
+    }
+  };
+
+  const setPlanStatus = async (plan, status) => {
+    const res = await API.put(`/api/plan/`, { ...plan, status });
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('操作成功完成！');
+      await loadPlans();
+    } else {
+      showError(message);
+    }
+  };
+
+  const closeEdit = () => {
+    setShowEdit(false);
+    setTimeout(() => {
+      setEditingPlan({
+        id: undefined,
+      });
+    }, 500);
+  };
+
+  return (
+    <>
+      <EditPlan
+        refresh={refresh}
+        editingPlan={editingPlan}
+        visiable={showEdit}
+        handleClose={closeEdit}
+      ></EditPlan>
+      <Table
+        style={{ marginTop: 20 }}
+        columns={columns}
+        dataSource={plans}
+        pagination={false}
+        loading={loading}
+      ></Table>
+      <Button
+        theme='light'
+        type='primary'
+        style={{ marginTop: 10 }}
+        onClick={() => {
+          setEditingPlan({
+            id: undefined,
+          });
+          setShowEdit(true);
+        }}
+      >
+        添加套餐
+      </Button>
+      <Divider margin='24px' align='left'>
+        订阅记录
+      </Divider>
+      <Form
+        onSubmit={() => {
+          loadSubscriptions(1).then();
+        }}
+      >
+        <Form.Input
+          label='用户ID'
+          field='user_id'
+          placeholder='留空查看全部用户'
+          value={searchUserId}
+          onChange={(value) => setSearchUserId(value)}
+        />
+      </Form>
+      <Table
+        style={{ marginTop: 20 }}
+        columns={subscriptionColumns}
+        dataSource={subscriptions}
+        pagination={{
+          currentPage: activePage,
+          pageSize: ITEMS_PER_PAGE,
+          total:
+            (activePage - 1) * ITEMS_PER_PAGE +
+            subscriptions.length +
+            (subscriptions.length === ITEMS_PER_PAGE ? 1 : 0),
+          onPageChange: (page) => {
+            loadSubscriptions(page).then();
+          },
+        }}
+        loading={subscriptionsLoading}
+      ></Table>
+    </>
+  );
+};
+
+export default PlansTable;
@@ -54,6 +54,7 @@ const SiderBar = () => {
     channel: '/channel',
     token: '/token',
     redemption: '/redemption',
+    plan: '/plan',
     topup: '/topup',
     user: '/user',
     log: '/log',
@@ -111,6 +112,13 @@ const SiderBar = () => {
         icon: <IconGift />,
         className: isAdmin() ? 'semi-navigation-item-normal' : 'tableHiddle',
       },
+      {
+        text: '订阅套餐',
+        itemKey: 'plan',
+        to: '/plan',
+        icon: <IconCalendarClock />,
+        className: isAdmin() ? 'semi-navigation-item-normal' : 'tableHiddle',
+      },
       {
         text: '钱包',
         itemKey: 'topup',
@@ -38,6 +38,7 @@ const SystemSetting = () => {
     PaymentEnabled: false,
     StripeUnitPrice: 8.0,
     MinTopUp: 5,
+    SubscriptionGraceDays: 3,
     TopupGroupRatio: '',
     Footer: '',
     WeChatAuthEnabled: '',
@@ -52,6 +53,7 @@ const SystemSetting = () => {
     EmailDomainRestrictionEnabled: '',
     EmailAliasRestrictionEnabled: '',
     SMTPSSLEnabled: '',
+    StatementEmailEnabled: '',
     EmailDomainWhitelist: [],
     // telegram login
     TelegramOAuthEnabled: '',
@@ -114,6 +116,7 @@ const SystemSetting = () => {
       case 'EmailDomainRestrictionEnabled':
       case 'EmailAliasRestrictionEnabled':
       case 'SMTPSSLEnabled':
+      case 'StatementEmailEnabled':
       case 'RegisterEnabled':
       case 'UserSelfDeletionEnabled':
       case 'PaymentEnabled':
@@ -157,6 +160,7 @@ const SystemSetting = () => {
       name === 'StripePriceId' ||
       name === 'StripeUnitPrice' ||
       name === 'MinTopUp' ||
+      name === 'SubscriptionGraceDays' ||
       name === 'GitHubClientId' ||
       name === 'GitHubClientSecret' ||
       name === 'LinuxDoClientId' ||
@@ -225,6 +229,7 @@ const SystemSetting = () => {
     await updateOption('PaymentEnable', inputs.PaymentEnabled);
     await updateOption('StripeUnitPrice', inputs.StripeUnitPrice);
     await updateOption('MinTopUp', inputs.MinTopUp);
+    await updateOption('SubscriptionGraceDays', inputs.SubscriptionGraceDays);
   };
 
   const submitSMTP = async () => {
@@ -459,6 +464,15 @@ const SystemSetting = () => {
               min={1}
               onChange={handleInputChange}
             />
+            <Form.Input
+              label='订阅续费宽限天数'
+              placeholder='续费失败后套餐继续保留的天数'
+              value={inputs.SubscriptionGraceDays}
+              name='SubscriptionGraceDays'
+              type={'number'}
+              min={0}
+              onChange={handleInputChange}
+            />
           </Form.Group>
           <Form.Group widths='equal'>
             <Form.TextArea
@@ -701,6 +715,12 @@ const SystemSetting = () => {
               onChange={handleInputChange}
               checked={inputs.SMTPSSLEnabled === 'true'}
             />
+            <Form.Checkbox
+              label='每月 1 日向用户发送上月账单邮件'
+              name='StatementEmailEnabled'
+              onChange={handleInputChange}
+              checked={inputs.StatementEmailEnabled === 'true'}
+            />
           </Form.Group>
           <Form.Button onClick={submitSMTP}>保存 SMTP 设置</Form.Button>
           <Divider />
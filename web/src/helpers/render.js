@@ -141,6 +141,10 @@ export function renderModelPrice(
   modelPrice = -1,
   completionRatio,
   groupRatio,
+  cacheTokens = 0,
+  cacheRatio = 1,
+  cacheCreationTokens = 0,
+  cacheCreationRatio = 1,
 ) {
   // 1 ratio = $0.002 / 1K tokens
   if (modelPrice !== -1) {
@@ -159,8 +163,13 @@ export function renderModelPrice(
     // 这里的 *2 是因为 1倍率=0.002刀，请勿删除
     let inputRatioPrice = modelRatio * 2.0;
     let completionRatioPrice = modelRatio * 2.0 * completionRatio;
+    let cacheRatioPrice = modelRatio * 2.0 * cacheRatio;
+    let cacheCreationRatioPrice = modelRatio * 2.0 * cacheCreationRatio;
+    let uncachedTokens = inputTokens - cacheTokens - cacheCreationTokens;
     let price =
-      (inputTokens / 1000000) * inputRatioPrice * groupRatio +
+      (uncachedTokens / 1000000) * inputRatioPrice * groupRatio +
+      (cacheTokens / 1000000) * cacheRatioPrice * groupRatio +
+      (cacheCreationTokens / 1000000) * cacheCreationRatioPrice * groupRatio +
       (completionTokens / 1000000) * completionRatioPrice * groupRatio;
     return (
       <>
@@ -169,14 +178,30 @@ export function renderModelPrice(
             提示：${inputRatioPrice} * {groupRatio} = $
             {inputRatioPrice * groupRatio} / 1M tokens
           </p>
+          {cacheTokens > 0 && (
+            <p>
+              缓存读取：${cacheRatioPrice} * {groupRatio} = $
+              {cacheRatioPrice * groupRatio} / 1M tokens
+            </p>
+          )}
+          {cacheCreationTokens > 0 && (
+            <p>
+              缓存写入：${cacheCreationRatioPrice} * {groupRatio} = $
+              {cacheCreationRatioPrice * groupRatio} / 1M tokens
+            </p>
+          )}
           <p>
             补全：${completionRatioPrice} * {groupRatio} = $
             {completionRatioPrice * groupRatio} / 1M tokens
           </p>
           <p></p>
           <p>
-            提示 {inputTokens} tokens / 1M tokens * ${inputRatioPrice} + 补全{' '}
-            {completionTokens} tokens / 1M tokens * ${completionRatioPrice} *
+            提示 {uncachedTokens} tokens / 1M tokens * ${inputRatioPrice} +{' '}
+            {cacheTokens > 0 &&
+              `缓存读取 ${cacheTokens} tokens / 1M tokens * $${cacheRatioPrice} + `}
+            {cacheCreationTokens > 0 &&
+              `缓存写入 ${cacheCreationTokens} tokens / 1M tokens * $${cacheCreationRatioPrice} + `}
+            补全 {completionTokens} tokens / 1M tokens * ${completionRatioPrice} *
             分组 {groupRatio} = ${price.toFixed(6)}
           </p>
           <p>仅供参考，以实际扣费为准</p>
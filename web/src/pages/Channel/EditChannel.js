@@ -22,6 +22,7 @@ import {
   TextArea,
   Checkbox,
   Banner,
+  InputNumber,
 } from '@douyinfe/semi-ui';
 import { Divider } from 'semantic-ui-react';
 import { getChannelModels, loadChannelModels } from '../../components/utils.js';
@@ -31,12 +32,20 @@ const MODEL_MAPPING_EXAMPLE = {
   'gpt-3.5-turbo-0301': 'gpt-3.5-turbo',
   'gpt-4-0314': 'gpt-4',
   'gpt-4-32k-0314': 'gpt-4-32k',
+  '^gpt-4o-(.*)$': 'azure-gpt4o-$1',
 };
 
 const HEADERS_EXAMPLE = {
   'headerName': 'headerValue',
 }
 
+const PARAM_OVERRIDE_EXAMPLE = [
+  { op: 'delete', path: 'stream_options' },
+  { model: 'o1*', op: 'delete', path: 'temperature' },
+  { op: 'set', path: 'parallel_tool_calls', value: false },
+  { op: 'clamp', path: 'max_tokens', max: 4096 },
+];
+
 const STATUS_CODE_MAPPING_EXAMPLE = {
   400: '500',
 };
@@ -90,7 +99,12 @@ const EditChannel = (props) => {
     test_model: '',
     groups: ['default'],
     headers: '',
+    param_override: '',
     proxy: '',
+    key_mode: '',
+    max_concurrency: 0,
+    rpm_limit: 0,
+    tpm_limit: 0,
   };
   const [batch, setBatch] = useState(false);
   const [autoBan, setAutoBan] = useState(true);
@@ -185,6 +199,13 @@ const EditChannel = (props) => {
             2,
         );
       }
+      if (data.param_override) {
+        data.param_override = JSON.stringify(
+            JSON.parse(data.param_override),
+            null,
+            2,
+        );
+      }
       setInputs(data);
       if (data.auto_ban === 0) {
         setAutoBan(false);
@@ -329,6 +350,10 @@ const EditChannel = (props) => {
       showInfo('自定义请求头必须是合法的 JSON 格式！');
       return;
     }
+    if (inputs.param_override && !verifyJSON(inputs.param_override)) {
+      showInfo('参数覆盖必须是合法的 JSON 格式！');
+      return;
+    }
     let localInputs = { ...inputs };
     if (localInputs.base_url && localInputs.base_url.endsWith('/')) {
       localInputs.base_url = localInputs.base_url.slice(
@@ -738,7 +763,7 @@ const EditChannel = (props) => {
                     填入
                   </Button>
                 }
-                placeholder='输入自定义模型名称'
+                placeholder='输入自定义模型名称，支持通配符（如 claude-3-5-*）和以 ^ 开头的正则表达式'
                 value={customModel}
                 onChange={(value) => {
                   setCustomModel(value.trim());
@@ -749,7 +774,7 @@ const EditChannel = (props) => {
             <Typography.Text strong>模型重定向：</Typography.Text>
           </div>
           <TextArea
-              placeholder={`此项可选，用于修改请求体中的模型名称，为一个 JSON 字符串，键为请求中模型名称，值为要替换的模型名称，例如：\n${JSON.stringify(MODEL_MAPPING_EXAMPLE, null, 2)}`}
+              placeholder={`此项可选，用于修改请求体中的模型名称，为一个 JSON 字符串，键为请求中模型名称（支持通配符和以 ^ 开头的正则表达式），值为要替换的模型名称（正则表达式可用 $1 引用分组），例如：\n${JSON.stringify(MODEL_MAPPING_EXAMPLE, null, 2)}`}
               name='model_mapping'
               onChange={(value) => {
                 handleInputChange('model_mapping', value);
@@ -801,15 +826,65 @@ const EditChannel = (props) => {
           >
             填入模板
           </Typography.Text>
+          <div style={{marginTop: 10}}>
+            <Typography.Text strong>参数覆盖：</Typography.Text>
+          </div>
+          <TextArea
+              placeholder={`此项可选，用于修改发往上游的请求体，为一个 JSON 数组，按顺序应用。op 为 set（设置）、delete（删除）或 clamp（限制数值范围），path 为以点分隔的字段路径（数组元素用下标），model 可选，为规则生效的模型名称或通配符，例如：\n${JSON.stringify(PARAM_OVERRIDE_EXAMPLE, null, 2)}`}
+              name='param_override'
+              onChange={(value) => {
+                handleInputChange('param_override', value);
+              }}
+              autosize
+              value={inputs.param_override}
+              autoComplete='new-password'
+          />
+          <Typography.Text
+              style={{
+                color: 'rgba(var(--semi-blue-5), 1)',
+                userSelect: 'none',
+                cursor: 'pointer',
+              }}
+              onClick={() => {
+                handleInputChange(
+                    'param_override',
+                    JSON.stringify(PARAM_OVERRIDE_EXAMPLE, null, 2),
+                );
+              }}
+          >
+            填入模板
+          </Typography.Text>
+          {inputs.type !== 2 && inputs.type !== 5 && inputs.type !== 36 && (
+              <>
+                <div style={{marginTop: 10}}>
+                  <Typography.Text strong>密钥模式：</Typography.Text>
+                </div>
+                <Select
+                    name='key_mode'
+                    optionList={[
+                      { label: '单密钥', value: '' },
+                      { label: '多密钥轮询', value: 'round_robin' },
+                      { label: '多密钥随机', value: 'random' },
+                    ]}
+                    value={inputs.key_mode}
+                    onChange={(value) => handleInputChange('key_mode', value)}
+                    style={{width: '50%'}}
+                />
+              </>
+          )}
           <div style={{marginTop: 10}}>
             <Typography.Text strong>密钥：</Typography.Text>
           </div>
-          {batch ? (
+          {batch || inputs.key_mode ? (
               <TextArea
                   label='密钥'
                   name='key'
                   required
-                  placeholder={'请输入密钥，一行一个'}
+                  placeholder={
+                    inputs.key_mode
+                      ? '请输入密钥，一行一个，每个密钥单独启用和禁用' + (isEdit ? '，留空则不修改' : '')
+                      : '请输入密钥，一行一个'
+                  }
                   onChange={(value) => {
                     handleInputChange('key', value);
                   }}
@@ -888,6 +963,35 @@ const EditChannel = (props) => {
               }}
               value={inputs.test_model}
           />
+          <div style={{marginTop: 10}}>
+            <Typography.Text strong>上游限制：</Typography.Text>
+          </div>
+          <Space>
+            <InputNumber
+                name='max_concurrency'
+                prefix='并发'
+                min={0}
+                onChange={(value) => handleInputChange('max_concurrency', value || 0)}
+                value={inputs.max_concurrency}
+            />
+            <InputNumber
+                name='rpm_limit'
+                prefix='RPM'
+                min={0}
+                onChange={(value) => handleInputChange('rpm_limit', value || 0)}
+                value={inputs.rpm_limit}
+            />
+            <InputNumber
+                name='tpm_limit'
+                prefix='TPM'
+                min={0}
+                onChange={(value) => handleInputChange('tpm_limit', value || 0)}
+                value={inputs.tpm_limit}
+            />
+          </Space>
+          <Typography.Text type='tertiary'>
+            0 表示不限制，达到限制的渠道不会被选中，所有渠道都达到限制时请求将排队等待
+          </Typography.Text>
           <div style={{marginTop: 10, display: 'flex'}}>
             <Space>
               <Checkbox
@@ -0,0 +1,220 @@
+import React, { useEffect, useState } from 'react';
+import { API, isMobile, showError, showSuccess } from '../../helpers';
+import { renderQuotaWithPrompt } from '../../helpers/render';
+import {
+  Button,
+  Input,
+  Select,
+  SideSheet,
+  Space,
+  Spin,
+  Switch,
+  Typography,
+} from '@douyinfe/semi-ui';
+import Title from '@douyinfe/semi-ui/lib/es/typography/title';
+
+const periodOptions = [
+  { value: 'day', label: '天' },
+  { value: 'week', label: '周' },
+  { value: 'month', label: '月' },
+  { value: 'year', label: '年' },
+];
+
+const EditPlan = (props) => {
+  const isEdit = props.editingPlan.id !== undefined;
+  const [loading, setLoading] = useState(false);
+  const originInputs = {
+    name: '',
+    description: '',
+    price: 10,
+    currency: 'usd',
+    stripe_price_id: '',
+    period: 'month',
+    quota: 5000000,
+    group: '',
+    roll_over: false,
+    status: 1,
+  };
+  const [inputs, setInputs] = useState(originInputs);
+  const {
+    name,
+    description,
+    price,
+    currency,
+    stripe_price_id,
+    period,
+    quota,
+    group,
+    roll_over,
+  } = inputs;
+
+  const handleCancel = () => {
+    props.handleClose();
+  };
+
+  const handleInputChange = (name, value) => {
+    setInputs((inputs) => ({ ...inputs, [name]: value }));
+  };
+
+  useEffect(() => {
+    if (isEdit) {
+      setInputs({ ...originInputs, ...props.editingPlan });
+    } else {
+      setInputs(originInputs);
+    }
+  }, [props.editingPlan.id]);
+
+  const submit = async () => {
+    if (inputs.name === '') {
+      showError('套餐名称不能为空');
+      return;
+    }
+    setLoading(true);
+    let localInputs = {
+      ...inputs,
+      price: parseFloat(inputs.price),
+      quota: parseInt(inputs.quota),
+    };
+    let res;
+    if (isEdit) {
+      res = await API.put(`/api/plan/`, {
+        ...localInputs,
+        id: parseInt(props.editingPlan.id),
+      });
+    } else {
+      res = await API.post(`/api/plan/`, localInputs);
+    }
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess(isEdit ? '套餐更新成功！' : '套餐创建成功！');
+      setInputs(originInputs);
+      props.refresh();
+      props.handleClose();
+    } else {
+      showError(message);
+    }
+    setLoading(false);
+  };
+
+  return (
+    <>
+      <SideSheet
+        placement={isEdit ? 'right' : 'left'}
+        title={<Title level={3}>{isEdit ? '更新套餐信息' : '创建新的套餐'}</Title>}
+        headerStyle={{ borderBottom: '1px solid var(--semi-color-border)' }}
+        bodyStyle={{ borderBottom: '1px solid var(--semi-color-border)' }}
+        visible={props.visiable}
+        footer={
+          <div style={{ display: 'flex', justifyContent: 'flex-end' }}>
+            <Space>
+              <Button theme='solid' size={'large'} onClick={submit}>
+                提交
+              </Button>
+              <Button
+                theme='solid'
+                size={'large'}
+                type={'tertiary'}
+                onClick={handleCancel}
+              >
+                取消
+              </Button>
+            </Space>
+          </div>
+        }
+        closeIcon={null}
+        onCancel={() => handleCancel()}
+        width={isMobile() ? '100%' : 600}
+      >
+        <Spin spinning={loading}>
+          <Input
+            style={{ marginTop: 20 }}
+            label='名称'
+            name='name'
+            placeholder={'请输入名称'}
+            onChange={(value) => handleInputChange('name', value)}
+            value={name}
+            autoComplete='new-password'
+            required
+          />
+          <Input
+            style={{ marginTop: 10 }}
+            label='描述'
+            name='description'
+            placeholder={'展示给用户的套餐说明'}
+            onChange={(value) => handleInputChange('description', value)}
+            value={description}
+            autoComplete='new-password'
+          />
+          <div style={{ marginTop: 20 }}>
+            <Typography.Text>计费周期</Typography.Text>
+          </div>
+          <Select
+            style={{ marginTop: 8, width: '100%' }}
+            optionList={periodOptions}
+            onChange={(value) => handleInputChange('period', value)}
+            value={period}
+          />
+          <Input
+            style={{ marginTop: 10 }}
+            label='每周期价格'
+            name='price'
+            type='number'
+            onChange={(value) => handleInputChange('price', value)}
+            value={price}
+            autoComplete='new-password'
+          />
+          <Input
+            style={{ marginTop: 10 }}
+            label='货币'
+            name='currency'
+            placeholder={'例如 usd'}
+            onChange={(value) => handleInputChange('currency', value)}
+            value={currency}
+            autoComplete='new-password'
+          />
+          <Input
+            style={{ marginTop: 10 }}
+            label='Stripe 价格 ID'
+            name='stripe_price_id'
+            placeholder={'可选，填写后按 Stripe 中的周期价格收费'}
+            onChange={(value) => handleInputChange('stripe_price_id', value)}
+            value={stripe_price_id}
+            autoComplete='new-password'
+          />
+          <div style={{ marginTop: 20 }}>
+            <Typography.Text>{`每周期额度${renderQuotaWithPrompt(quota)}`}</Typography.Text>
+          </div>
+          <Input
+            style={{ marginTop: 8 }}
+            name='quota'
+            placeholder={'请输入额度'}
+            onChange={(value) => handleInputChange('quota', value)}
+            value={quota}
+            autoComplete='new-password'
+            type='number'
+          />
+          <Input
+            style={{ marginTop: 10 }}
+            label='分组'
+            name='group'
+            placeholder={'订阅期间用户所在分组，留空不修改'}
+            onChange={(value) => handleInputChange('group', value)}
+            value={group}
+            autoComplete='new-password'
+          />
+          <div style={{ marginTop: 20 }}>
+            <Space>
+              <Switch
+                checked={roll_over}
+                onChange={(value) => handleInputChange('roll_over', value)}
+              />
+              <Typography.Text>周期结束时保留未用完的额度</Typography.Text>
+            </Space>
+          </div>
+        </Spin>
+      </SideSheet>
+    </>
+  );
+};
+
+export default EditPlan;
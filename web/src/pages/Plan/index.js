@@ -0,0 +1,18 @@
+import React from 'react';
+import PlansTable from '../../components/PlansTable';
+import { Layout } from '@douyinfe/semi-ui';
+
+const Plan = () => (
+  <>
+    <Layout>
+      <Layout.Header>
+        <h3>管理订阅套餐</h3>
+      </Layout.Header>
+      <Layout.Content>
+        <PlansTable />
+      </Layout.Content>
+    </Layout>
+  </>
+);
+
+export default Plan;
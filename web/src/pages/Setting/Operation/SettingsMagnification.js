@@ -24,6 +24,11 @@ export default function SettingsMagnification(props) {
     ModelPrice: '',
     ModelRatio: '',
     CompletionRatio: '',
+    CacheRatio: '',
+    CreateCacheRatio: '',
+    AudioRatio: '',
+    AudioCompletionRatio: '',
+    ModelRatioTiers: '',
     GroupRatio: '',
     UserUsableGroups: '',
   });
@@ -198,6 +203,143 @@ export default function SettingsMagnification(props) {
               />
             </Col>
           </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'缓存读取倍率'}
+                extraText={'命中提示词缓存的输入 token 相对普通输入 token 的倍率，未设置的模型按供应商默认折扣计算'}
+                placeholder={'为一个 JSON 文本，键为模型名称，值为倍率'}
+                field={'CacheRatio'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串',
+                  },
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    CacheRatio: value,
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'缓存写入倍率'}
+                extraText={'写入提示词缓存的输入 token 相对普通输入 token 的倍率'}
+                placeholder={'为一个 JSON 文本，键为模型名称，值为倍率'}
+                field={'CreateCacheRatio'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串',
+                  },
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    CreateCacheRatio: value,
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'音频倍率'}
+                extraText={'音频输入 token 相对文本输入 token 的倍率'}
+                placeholder={'为一个 JSON 文本，键为模型名称，值为倍率'}
+                field={'AudioRatio'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串',
+                  },
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    AudioRatio: value,
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'音频补全倍率'}
+                extraText={'音频输出 token 相对音频输入 token 的倍率'}
+                placeholder={'为一个 JSON 文本，键为模型名称，值为倍率'}
+                field={'AudioCompletionRatio'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串',
+                  },
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    AudioCompletionRatio: value,
+                  })
+                }
+              />
+            </Col>
+          </Row>
+          <Row gutter={16}>
+            <Col span={16}>
+              <Form.TextArea
+                label={'上下文分级倍率'}
+                extraText={
+                  '提示 token 数超过 threshold 的请求按该级的模型倍率和补全倍率计费，completion_ratio 不填则使用模型的补全倍率，例如 {"gemini-1.5-pro*": [{"threshold": 128000, "model_ratio": 2.5, "completion_ratio": 4}]}'
+                }
+                placeholder={'为一个 JSON 文本，键为模型名称，值为分级列表'}
+                field={'ModelRatioTiers'}
+                autosize={{ minRows: 6, maxRows: 12 }}
+                trigger='blur'
+                stopValidateWithError
+                rules={[
+                  {
+                    validator: (rule, value) => {
+                      return verifyJSON(value);
+                    },
+                    message: '不是合法的 JSON 字符串',
+                  },
+                ]}
+                onChange={(value) =>
+                  setInputs({
+                    ...inputs,
+                    ModelRatioTiers: value,
+                  })
+                }
+              />
+            </Col>
+          </Row>
           <Row gutter={16}>
             <Col span={16}>
               <Form.TextArea
@@ -6,15 +6,41 @@ import {
   showError,
   showSuccess,
   showWarning,
+  verifyJSON,
 } from '../../../helpers';
 
+const optionsChannelSelectStrategy = [
+  { label: '加权随机', value: 'weighted_random' },
+  { label: '最少并发', value: 'least_in_flight' },
+  { label: '最低延迟 (EWMA)', value: 'ewma_latency' },
+  { label: '二选一负载均衡', value: 'power_of_two' },
+];
+
 export default function SettingsMonitoring(props) {
   const [loading, setLoading] = useState(false);
   const [inputs, setInputs] = useState({
     ChannelDisableThreshold: '',
     QuotaRemindThreshold: '',
+    NotificationDedupMinutes: '',
     AutomaticDisableChannelEnabled: false,
     AutomaticEnableChannelEnabled: false,
+    CircuitBreakerEnabled: false,
+    CircuitBreakerFailureThreshold: '',
+    CircuitBreakerErrorRate: '',
+    CircuitBreakerMinRequests: '',
+    CircuitBreakerWindow: '',
+    CircuitBreakerCooldown: '',
+    CircuitBreakerHalfOpenRequests: '',
+    ChannelQueueSize: '',
+    ChannelQueueTimeout: '',
+    ChannelHealthRetentionDays: '',
+    ChannelSelectStrategy: '',
+    ChannelSelectStrategies: '',
+    ModelFallbacks: '',
+    ChannelAffinities: '',
+    ChannelAffinityTTL: '',
+    ChannelAffinityHeaderName: '',
+    ChannelHedges: '',
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -108,6 +134,23 @@ export default function SettingsMonitoring(props) {
                   }
                 />
               </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'通知去重时间'}
+                  step={1}
+                  min={0}
+                  suffix={'分钟'}
+                  extraText={'同一事件在此时间内只通知一次'}
+                  placeholder={''}
+                  field={'NotificationDedupMinutes'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      NotificationDedupMinutes: String(value),
+                    })
+                  }
+                />
+              </Col>
             </Row>
             <Row gutter={16}>
               <Col span={8}>
@@ -141,6 +184,347 @@ export default function SettingsMonitoring(props) {
                 />
               </Col>
             </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.Switch
+                  field={'CircuitBreakerEnabled'}
+                  label={'启用渠道熔断'}
+                  size='large'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CircuitBreakerEnabled: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'连续失败次数'}
+                  step={1}
+                  min={0}
+                  suffix={'次'}
+                  extraText={'连续失败达到此次数时熔断渠道，0 表示不检查'}
+                  placeholder={''}
+                  field={'CircuitBreakerFailureThreshold'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CircuitBreakerFailureThreshold: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'错误率阈值'}
+                  step={0.05}
+                  min={0}
+                  suffix={''}
+                  extraText={'统计窗口内错误率达到此值时熔断渠道，0 表示不检查'}
+                  placeholder={''}
+                  field={'CircuitBreakerErrorRate'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CircuitBreakerErrorRate: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'最少请求数'}
+                  step={1}
+                  min={0}
+                  suffix={'次'}
+                  extraText={'统计窗口内请求数达到此值后才检查错误率'}
+                  placeholder={''}
+                  field={'CircuitBreakerMinRequests'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CircuitBreakerMinRequests: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'统计窗口'}
+                  step={1}
+                  min={0}
+                  suffix={'秒'}
+                  extraText={''}
+                  placeholder={''}
+                  field={'CircuitBreakerWindow'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CircuitBreakerWindow: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'熔断时长'}
+                  step={1}
+                  min={0}
+                  suffix={'秒'}
+                  extraText={'熔断后经过此时长进入半开状态'}
+                  placeholder={''}
+                  field={'CircuitBreakerCooldown'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CircuitBreakerCooldown: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'半开探测请求数'}
+                  step={1}
+                  min={0}
+                  suffix={'次'}
+                  extraText={'半开状态放行的请求数，全部成功后恢复渠道'}
+                  placeholder={''}
+                  field={'CircuitBreakerHalfOpenRequests'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CircuitBreakerHalfOpenRequests: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'渠道排队长度'}
+                  step={1}
+                  min={0}
+                  extraText={'每个渠道达到并发、RPM 或 TPM 限制时最多排队等待的请求数'}
+                  placeholder={''}
+                  field={'ChannelQueueSize'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelQueueSize: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'渠道排队超时'}
+                  step={1}
+                  min={0}
+                  suffix={'秒'}
+                  extraText={''}
+                  placeholder={''}
+                  field={'ChannelQueueTimeout'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelQueueTimeout: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'渠道健康记录保留时间'}
+                  step={1}
+                  min={0}
+                  suffix={'天'}
+                  extraText={'渠道测试和请求结果采样的保留天数，0 为永久保留'}
+                  placeholder={''}
+                  field={'ChannelHealthRetentionDays'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelHealthRetentionDays: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.Select
+                  label={'渠道选择策略'}
+                  optionList={optionsChannelSelectStrategy}
+                  field={'ChannelSelectStrategy'}
+                  extraText={'在同一优先级的渠道中选择渠道的方式'}
+                  style={{ width: 180 }}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelSelectStrategy: String(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'分组/模型渠道选择策略'}
+                  extraText={
+                    '为一个 JSON 文本，键为 分组:模型、模型名称或分组名称，值为策略，例如 {"vip": "least_in_flight", "gpt-4o": "ewma_latency"}'
+                  }
+                  placeholder={'为一个 JSON 文本'}
+                  field={'ChannelSelectStrategies'}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => {
+                        return verifyJSON(value);
+                      },
+                      message: '不是合法的 JSON 字符串',
+                    },
+                  ]}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelSelectStrategies: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'模型回退链'}
+                  extraText={
+                    '为一个 JSON 文本，按分组配置模型渠道用尽后依次尝试的模型，例如 {"default": {"claude-3-5-sonnet-20241022": ["gpt-4o", "deepseek-chat"]}}'
+                  }
+                  placeholder={'为一个 JSON 文本'}
+                  field={'ModelFallbacks'}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => {
+                        return verifyJSON(value);
+                      },
+                      message: '不是合法的 JSON 字符串',
+                    },
+                  ]}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ModelFallbacks: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'会话粘性路由'}
+                  extraText={
+                    '为一个 JSON 文本，键为 分组:模型、模型名称或分组名称，值为会话标识来源：token（令牌）、user（请求中的 user 字段）、header（请求头）、prompt（系统提示词与开头消息），例如 {"claude-3-5-sonnet-20241022": "prompt"}'
+                  }
+                  placeholder={'为一个 JSON 文本'}
+                  field={'ChannelAffinities'}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => {
+                        return verifyJSON(value);
+                      },
+                      message: '不是合法的 JSON 字符串',
+                    },
+                  ]}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelAffinities: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={8}>
+                <Form.InputNumber
+                  label={'会话粘性时长'}
+                  step={1}
+                  min={1}
+                  suffix={'秒'}
+                  extraText={'会话最后一次请求后保持使用同一渠道的时间'}
+                  placeholder={''}
+                  field={'ChannelAffinityTTL'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelAffinityTTL: String(value),
+                    })
+                  }
+                />
+              </Col>
+              <Col span={8}>
+                <Form.Input
+                  label={'会话标识请求头'}
+                  extraText={'会话标识来源为 header 时读取的请求头'}
+                  placeholder={'X-Session-Id'}
+                  field={'ChannelAffinityHeaderName'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelAffinityHeaderName: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
+            <Row gutter={16}>
+              <Col span={16}>
+                <Form.TextArea
+                  label={'对冲请求'}
+                  extraText={
+                    '为一个 JSON 文本，键为分组名称。非流式的对话补全和嵌入请求在首个渠道 delay 毫秒内未响应时同时发往另一个渠道，先返回的结果生效，只计费生效的结果；percentile 为按渠道近期延迟分位数决定等待时间（如 0.95），max_tokens 为仅对冲最大 token 数不超过该值的请求，max_per_minute 为每分钟最多对冲的请求数，例如 {"vip": {"delay": 2000, "percentile": 0.95, "max_tokens": 1024, "max_per_minute": 60}}'
+                  }
+                  placeholder={'为一个 JSON 文本'}
+                  field={'ChannelHedges'}
+                  autosize={{ minRows: 4, maxRows: 12 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => {
+                        return verifyJSON(value);
+                      },
+                      message: '不是合法的 JSON 字符串',
+                    },
+                  ]}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      ChannelHedges: value,
+                    })
+                  }
+                />
+              </Col>
+            </Row>
             <Row>
               <Button size='large' onClick={onSubmit}>
                 保存监控设置
@@ -7,6 +7,7 @@ import { isRoot } from '../../helpers';
 import OtherSetting from '../../components/OtherSetting';
 import PersonalSetting from '../../components/PersonalSetting';
 import OperationSetting from '../../components/OperationSetting';
+import NotificationSetting from '../../components/NotificationSetting';
 const Setting = () => {
   const navigate = useNavigate();
   const location = useLocation();
@@ -17,6 +18,11 @@ const Setting = () => {
       content: <PersonalSetting />,
       itemKey: 'personal',
     },
+    {
+      tab: '通知设置',
+      content: <NotificationSetting />,
+      itemKey: 'notification',
+    },
   ];
 
   if (isRoot()) {
@@ -7,7 +7,7 @@ import {
   showSuccess,
   timestamp2string,
 } from '../../helpers';
-import { renderQuotaWithPrompt } from '../../helpers/render';
+import { renderQuota, renderQuotaWithPrompt } from '../../helpers/render';
 import {
   AutoComplete,
   Banner,
@@ -37,6 +37,10 @@ const EditToken = (props) => {
     model_limits: [],
     allow_ips: '',
     group: '',
+    fallback_disabled: false,
+    daily_quota_limit: 0,
+    weekly_quota_limit: 0,
+    monthly_quota_limit: 0,
   };
   const [inputs, setInputs] = useState(originInputs);
   const {
@@ -48,6 +52,7 @@ const EditToken = (props) => {
     model_limits,
     allow_ips,
     group,
+    fallback_disabled,
   } = inputs;
   // const [visible, setVisible] = useState(false);
   const [models, setModels] = useState([]);
@@ -168,12 +173,35 @@ const EditToken = (props) => {
     return result;
   };
 
+  const spendWindowLimits = [
+    { field: 'daily_quota_limit', window: 'day', label: '每日' },
+    { field: 'weekly_quota_limit', window: 'week', label: '每周' },
+    { field: 'monthly_quota_limit', window: 'month', label: '每月' },
+  ];
+
+  const parseSpendLimits = (localInputs) => {
+    spendWindowLimits.forEach(({ field }) => {
+      localInputs[field] = parseInt(localInputs[field]) || 0;
+    });
+  };
+
+  const renderSpendWindowUsage = (window) => {
+    const usage = (inputs.spend_windows || []).find(
+      (usage) => usage.window === window,
+    );
+    if (!usage) {
+      return '';
+    }
+    return `（本期已用 ${renderQuota(usage.used)}，${timestamp2string(usage.reset_at)} 重置）`;
+  };
+
   const submit = async () => {
     setLoading(true);
     if (isEdit) {
       // 编辑令牌的逻辑保持不变
       let localInputs = { ...inputs };
       localInputs.remain_quota = parseInt(localInputs.remain_quota);
+      parseSpendLimits(localInputs);
       if (localInputs.expired_time !== -1) {
         let time = Date.parse(localInputs.expired_time);
         if (isNaN(time)) {
@@ -206,6 +234,7 @@ const EditToken = (props) => {
           localInputs.name = `${inputs.name}-${generateRandomSuffix()}`;
         }
         localInputs.remain_quota = parseInt(localInputs.remain_quota);
+        parseSpendLimits(localInputs);
 
         if (localInputs.expired_time !== -1) {
           let time = Date.parse(localInputs.expired_time);
@@ -397,6 +426,28 @@ const EditToken = (props) => {
             </Button>
           </div>
           <Divider />
+          <div style={{ marginTop: 10 }}>
+            <Typography.Text>
+              消费限额（按自然日、周、月自动重置，0 表示不限制）
+            </Typography.Text>
+          </div>
+          {spendWindowLimits.map(({ field, window, label }) => (
+            <div key={field} style={{ marginTop: 8 }}>
+              <Typography.Text>
+                {`${label}限额${renderQuotaWithPrompt(inputs[field] || 0)}${renderSpendWindowUsage(window)}`}
+              </Typography.Text>
+              <Input
+                style={{ marginTop: 4 }}
+                name={field}
+                placeholder={`${label}最多消费的额度`}
+                onChange={(value) => handleInputChange(field, value)}
+                value={inputs[field]}
+                autoComplete='new-password'
+                type='number'
+              />
+            </div>
+          ))}
+          <Divider />
           <div style={{ marginTop: 10 }}>
             <Typography.Text>IP白名单（请勿过度信任此功能）</Typography.Text>
           </div>
@@ -410,6 +461,20 @@ const EditToken = (props) => {
             value={inputs.allow_ips}
             style={{ fontFamily: 'JetBrains Mono, Consolas' }}
           />
+          <div style={{ marginTop: 10, display: 'flex' }}>
+            <Space>
+              <Checkbox
+                name='fallback_disabled'
+                checked={fallback_disabled}
+                onChange={(e) =>
+                  handleInputChange('fallback_disabled', e.target.checked)
+                }
+              ></Checkbox>
+              <Typography.Text>
+                禁用模型回退（模型渠道用尽时不改用其他模型）
+              </Typography.Text>
+            </Space>
+          </div>
           <div style={{ marginTop: 10, display: 'flex' }}>
             <Space>
               <Checkbox
@@ -1,5 +1,12 @@
 import React, { useEffect, useState } from 'react';
-import { API, isMobile, showError, showInfo, showSuccess } from '../../helpers';
+import {
+  API,
+  isMobile,
+  showError,
+  showInfo,
+  showSuccess,
+  timestamp2string,
+} from '../../helpers';
 import { renderNumber, renderQuota } from '../../helpers/render';
 import {
   Col,
@@ -16,6 +23,14 @@ import {
 import Title from '@douyinfe/semi-ui/lib/es/typography/title';
 import Text from '@douyinfe/semi-ui/lib/es/typography/text';
 import { Link } from 'react-router-dom';
+import { renderSubscriptionStatus } from '../../components/PlansTable';
+
+const periodNames = {
+  day: '天',
+  week: '周',
+  month: '月',
+  year: '年',
+};
 
 const TopUp = () => {
   const [redemptionCode, setRedemptionCode] = useState('');
@@ -32,6 +47,9 @@ const TopUp = () => {
   const [isPaying, setIsPaying] = useState(false);
   const [open, setOpen] = useState(false);
   const [payWay, setPayWay] = useState('');
+  const [plans, setPlans] = useState([]);
+  const [subscription, setSubscription] = useState(null);
+  const [isSubscribing, setIsSubscribing] = useState(false);
 
   const topUp = async () => {
     if (redemptionCode === '') {
@@ -138,6 +156,55 @@ const TopUp = () => {
     }
   };
 
+  const getSubscription = async () => {
+    let res = await API.get(`/api/user/subscription`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setSubscription(data);
+    } else {
+      showError(message);
+    }
+    res = await API.get(`/api/user/plans`);
+    if (res.data.success) {
+      setPlans(res.data.data || []);
+    }
+  };
+
+  const subscribe = async (plan) => {
+    setIsSubscribing(true);
+    try {
+      const res = await API.post('/api/user/subscribe', {
+        plan_id: plan.id,
+      });
+      const { message, data } = res.data;
+      if (message === 'success') {
+        location.href = data.payLink;
+      } else {
+        setIsSubscribing(false);
+        showError(data);
+      }
+    } catch (err) {
+      setIsSubscribing(false);
+      console.log(err);
+    }
+  };
+
+  const cancelSubscription = async () => {
+    const res = await API.post('/api/user/subscription/cancel');
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('订阅将在当前周期结束后取消');
+      await getSubscription();
+    } else {
+      showError(message);
+    }
+  };
+
+  const planName = (id) => {
+    const plan = plans.find((plan) => plan.id === id);
+    return plan ? plan.name : '';
+  };
+
   useEffect(() => {
     let status = localStorage.getItem('status');
     if (status) {
@@ -150,6 +217,7 @@ const TopUp = () => {
       }
       if (status.payment_enabled) {
         setPaymentEnabled(status.payment_enabled);
+        getSubscription().then();
       }
     }
     getUserQuota().then();
@@ -301,6 +369,80 @@ const TopUp = () => {
               ) : (
                 <></>
               )}
+              {paymentEnabled && (subscription || plans.length > 0) ? (
+                <div style={{ marginTop: 20 }}>
+                  <Divider>订阅套餐</Divider>
+                  {subscription ? (
+                    <Space vertical align='start'>
+                      <Space>
+                        <Text strong>{planName(subscription.plan_id)}</Text>
+                        {renderSubscriptionStatus(subscription.status)}
+                      </Space>
+                      <Text>
+                        当前周期：{timestamp2string(subscription.period_start)}{' '}
+                        ~ {timestamp2string(subscription.period_end)}
+                      </Text>
+                      <Text>
+                        本周期额度：{renderQuota(subscription.granted_quota)}
+                      </Text>
+                      {subscription.cancel_at_period_end ? (
+                        <Text type='warning'>订阅将在当前周期结束后取消</Text>
+                      ) : (
+                        <Button
+                          type={'danger'}
+                          onClick={() => {
+                            Modal.confirm({
+                              title: '确定要取消订阅吗？',
+                              content: '当前周期结束前套餐仍然有效',
+                              centered: true,
+                              onOk: cancelSubscription,
+                            });
+                          }}
+                        >
+                          取消订阅
+                        </Button>
+                      )}
+                    </Space>
+                  ) : (
+                    plans.map((plan) => (
+                      <Card
+                        key={plan.id}
+                        style={{ marginTop: 10 }}
+                        title={plan.name}
+                        headerExtraContent={
+                          <Button
+                            type={'primary'}
+                            theme={'solid'}
+                            disabled={isSubscribing}
+                            onClick={() => subscribe(plan)}
+                          >
+                            {isSubscribing ? '支付中...' : '订阅'}
+                          </Button>
+                        }
+                      >
+                        <Space vertical align='start'>
+                          {plan.description ? (
+                            <Text>{plan.description}</Text>
+                          ) : null}
+                          <Text>
+                            每{periodNames[plan.period] || plan.period}{' '}
+                            {renderQuota(plan.quota)}
+                            {plan.roll_over ? '，未用完的额度可结转' : ''}
+                          </Text>
+                          {plan.stripe_price_id === '' ? (
+                            <Text>
+                              {plan.price} {plan.currency.toUpperCase()} /{' '}
+                              {periodNames[plan.period] || plan.period}
+                            </Text>
+                          ) : null}
+                        </Space>
+                      </Card>
+                    ))
+                  )}
+                </div>
+              ) : (
+                <></>
+              )}
               {/*<div style={{ display: 'flex', justifyContent: 'right' }}>*/}
               {/*    <Text>*/}
               {/*        <Link onClick={*/}
@@ -32,6 +32,9 @@ const EditUser = (props) => {
     email: '',
     quota: 0,
     group: 'default',
+    daily_quota_limit: 0,
+    weekly_quota_limit: 0,
+    monthly_quota_limit: 0,
   });
   const [groupOptions, setGroupOptions] = useState([]);
   const {
@@ -100,6 +103,11 @@ const EditUser = (props) => {
       if (typeof data.quota === 'string') {
         data.quota = parseInt(data.quota);
       }
+      ['daily_quota_limit', 'weekly_quota_limit', 'monthly_quota_limit'].forEach(
+        (field) => {
+          data[field] = parseInt(data[field]) || 0;
+        },
+      );
       res = await API.put(`/api/user/`, data);
     } else {
       res = await API.put(`/api/user/self`, inputs);
@@ -221,6 +229,29 @@ const EditUser = (props) => {
                 />
                 <Button onClick={openAddQuotaModal}>添加额度</Button>
               </Space>
+              <div style={{ marginTop: 20 }}>
+                <Typography.Text>
+                  消费限额（所有令牌合计，按自然日、周、月自动重置，0
+                  表示不限制）
+                </Typography.Text>
+              </div>
+              {[
+                { field: 'daily_quota_limit', label: '每日' },
+                { field: 'weekly_quota_limit', label: '每周' },
+                { field: 'monthly_quota_limit', label: '每月' },
+              ].map(({ field, label }) => (
+                <Input
+                  key={field}
+                  style={{ marginTop: 8 }}
+                  name={field}
+                  prefix={label}
+                  placeholder={`${label}最多消费的额度`}
+                  onChange={(value) => handleInputChange(field, value)}
+                  value={inputs[field]}
+                  type={'number'}
+                  autoComplete='new-password'
+                />
+              ))}
             </>
           )}
           <Divider style={{ marginTop: 20 }}>以下信息不可修改</Divider>